@@ -0,0 +1,240 @@
+package authz
+
+import (
+	"errors"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"strconv"
+
+	"gorm.io/gorm"
+)
+
+// Group roles stored in models.GroupUser.Role
+const (
+	RoleMember = "member"
+	RoleAdmin  = "admin"
+	RoleOwner  = "owner" // Exactly one per group: the creator, until ownership is transferred
+)
+
+// Level - The access a route needs
+type Level int
+
+const (
+	Member Level = iota // read and add to the group
+	Admin               // destructive actions and managing members
+	Owner               // deleting the group and transferring ownership
+)
+
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrForbidden = errors.New("forbidden")
+	ErrArchived  = errors.New("archived")
+)
+
+// Scope - Who may access a resource: the members of its group, plus any
+// owners (who always have full access) and viewers (read-only access).
+// Resources in an archived group or thread are Archived, and read-only.
+type Scope struct {
+	GroupID  *uint
+	Owners   []uint
+	Viewers  []uint
+	Archived bool
+}
+
+// GroupScope - Scope of a group. Deleted groups are not found.
+func GroupScope(groupID uint) (Scope, error) {
+	var group models.Group
+	if err := database.DB.Select("id", "archived_at").First(&group, groupID).Error; err != nil {
+		return Scope{}, notFound(err)
+	}
+	return Scope{GroupID: &group.ID, Archived: group.ArchivedAt != nil}, nil
+}
+
+// ThreadScope - Scope of a thread; private threads belong to their creator.
+// Threads of a deleted group are not found either.
+func ThreadScope(threadID uint) (Scope, error) {
+	var thread models.Thread
+	if err := database.DB.First(&thread, threadID).Error; err != nil {
+		return Scope{}, notFound(err)
+	}
+
+	scope := Scope{GroupID: thread.GroupID, Owners: []uint{thread.CreatedBy}, Archived: thread.ArchivedAt != nil}
+	if thread.GroupID != nil {
+		groupScope, err := GroupScope(*thread.GroupID)
+		if err != nil {
+			return Scope{}, err
+		}
+		scope.Archived = scope.Archived || groupScope.Archived
+	}
+	return scope, nil
+}
+
+// ExpenseScope - Scope of an expense. Its payer and whoever recorded it own
+// it; personal expenses (outside any group) are also visible to their participants.
+func ExpenseScope(expenseID uint) (Scope, error) {
+	var expense models.Expense
+	if err := database.DB.First(&expense, expenseID).Error; err != nil {
+		return Scope{}, notFound(err)
+	}
+
+	scope := Scope{GroupID: expense.GroupID, Owners: []uint{expense.PaidBy}}
+	if expense.CreatedBy != 0 {
+		scope.Owners = append(scope.Owners, expense.CreatedBy)
+	}
+	if expense.ThreadID != nil {
+		threadScope, err := ThreadScope(*expense.ThreadID)
+		if err != nil {
+			return Scope{}, err
+		}
+		if scope.GroupID == nil {
+			scope.GroupID = threadScope.GroupID
+		}
+		scope.Archived = threadScope.Archived
+	}
+	if expense.GroupID != nil {
+		groupScope, err := GroupScope(*expense.GroupID)
+		if err != nil {
+			return Scope{}, err
+		}
+		scope.Archived = scope.Archived || groupScope.Archived
+	}
+	if scope.GroupID == nil {
+		database.DB.Model(&models.ExpenseParticipant{}).
+			Where("expense_id = ?", expense.ID).
+			Pluck("user_id", &scope.Viewers)
+	}
+	return scope, nil
+}
+
+// RecurringExpenseScope - Scope of a recurring expense, owned like the expenses it creates
+func RecurringExpenseScope(recurringID uint) (Scope, error) {
+	var recurring models.RecurringExpense
+	if err := database.DB.First(&recurring, recurringID).Error; err != nil {
+		return Scope{}, notFound(err)
+	}
+
+	var scope Scope
+	var err error
+	if recurring.ThreadID != nil {
+		scope, err = ThreadScope(*recurring.ThreadID)
+	} else if recurring.GroupID != nil {
+		scope, err = GroupScope(*recurring.GroupID)
+	} else {
+		return Scope{}, ErrNotFound
+	}
+	if err != nil {
+		return Scope{}, err
+	}
+	scope.Owners = []uint{recurring.PaidBy, recurring.CreatedBy}
+	return scope, nil
+}
+
+// ScopeFromVars - Resolves the scope of a route from its mux variables
+func ScopeFromVars(vars map[string]string) (Scope, error) {
+	resolvers := []struct {
+		key     string
+		resolve func(uint) (Scope, error)
+	}{
+		{"expense_id", ExpenseScope},
+		{"recurring_id", RecurringExpenseScope},
+		{"thread_id", ThreadScope},
+		{"group_id", GroupScope},
+		{"id", GroupScope}, // /groups/{id}/users
+	}
+
+	for _, res := range resolvers {
+		raw, ok := vars[res.key]
+		if !ok {
+			continue
+		}
+		id, err := strconv.ParseUint(raw, 10, 64)
+		if err != nil {
+			return Scope{}, ErrNotFound
+		}
+		return res.resolve(uint(id))
+	}
+	return Scope{}, ErrNotFound
+}
+
+// Check - Returns nil when the user has the requested access to the scope
+func Check(userID uint, scope Scope, level Level) error {
+	if scope.GroupID != nil {
+		// Former members lose access even to what they own
+		role, ok := GroupRole(*scope.GroupID, userID)
+		if !ok {
+			return ErrForbidden
+		}
+		if contains(scope.Owners, userID) {
+			return nil
+		}
+		if RoleLevel(role) < level {
+			return ErrForbidden
+		}
+		return nil
+	}
+
+	if contains(scope.Owners, userID) {
+		return nil
+	}
+	if level == Member && contains(scope.Viewers, userID) {
+		return nil
+	}
+	return ErrForbidden
+}
+
+// Writable - Returns ErrArchived when the scope is read-only
+func Writable(scope Scope) error {
+	if scope.Archived {
+		return ErrArchived
+	}
+	return nil
+}
+
+// GroupRole - Returns the user's role in a group, and whether they are a member at all
+func GroupRole(groupID, userID uint) (string, bool) {
+	var membership models.GroupUser
+	err := database.DB.
+		Where("group_id = ? AND user_id = ?", groupID, userID).
+		First(&membership).Error
+	if err != nil {
+		return "", false
+	}
+	if membership.Role == "" {
+		return RoleMember, true
+	}
+	return membership.Role, true
+}
+
+// RoleLevel - The highest access level a group role grants
+func RoleLevel(role string) Level {
+	switch role {
+	case RoleOwner:
+		return Owner
+	case RoleAdmin:
+		return Admin
+	default:
+		return Member
+	}
+}
+
+// IsGroupMember - Reports whether the user belongs to the group
+func IsGroupMember(groupID, userID uint) bool {
+	_, ok := GroupRole(groupID, userID)
+	return ok
+}
+
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func contains(ids []uint, id uint) bool {
+	for _, v := range ids {
+		if v == id {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,421 @@
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-auth-app/database"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// DefaultJWTSecret is only acceptable in dev mode
+const DefaultJWTSecret = "your_secret_key"
+
+// Mail drivers accepted in `mail.driver` / MAIL_DRIVER
+const (
+	MailDriverLog  = "log"
+	MailDriverSMTP = "smtp"
+)
+
+// Storage drivers accepted in `storage.driver` / STORAGE_DRIVER
+const (
+	StorageDriverLocal = "local"
+	StorageDriverS3    = "s3"
+)
+
+// Environments accepted in `env` / APP_ENV
+const (
+	EnvDev        = "dev"
+	EnvProduction = "production"
+)
+
+// Config holds every setting the server needs at startup.
+// Values come from defaults, then an optional JSON config file, then
+// environment variables, each overriding the previous one.
+type Config struct {
+	Env         string    `json:"env"`
+	Port        int       `json:"port"`
+	DBDriver    string    `json:"db_driver"`
+	SQLitePath  string    `json:"sqlite_path"`
+	DatabaseDSN string    `json:"database_dsn"`
+	Database    Database  `json:"database"`
+	JWTSecret   string    `json:"jwt_secret"`
+	CORSOrigins []string  `json:"cors_origins"`
+	AppURL      string    `json:"app_url"` // Frontend base URL used in email links
+	Mail        Mail      `json:"mail"`
+	RateLimit   RateLimit `json:"rate_limit"`
+	Storage     Storage   `json:"storage"`
+
+	RestoreWindowDays int `json:"restore_window_days"` // Deleted groups and threads can be restored for this long
+
+	// PGNotify shares real-time events between server instances through
+	// PostgreSQL LISTEN/NOTIFY; without it each instance only streams its own
+	PGNotify bool `json:"pg_notify"`
+
+	// WebhookAllowedNetworks - Internal networks (CIDRs or addresses) webhooks
+	// may be sent to; loopback, private and link-local addresses are refused otherwise
+	WebhookAllowedNetworks []string `json:"webhook_allowed_networks"`
+}
+
+// Database - Individual connection settings, used when no full DSN is given
+type Database struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	User     string `json:"user"`
+	Password string `json:"password"`
+	Name     string `json:"name"`
+	SSLMode  string `json:"sslmode"`
+}
+
+// Mail - Outgoing email settings. The log driver prints mails, or writes them
+// to Dir as .eml files, instead of sending them.
+type Mail struct {
+	Driver   string `json:"driver"`
+	From     string `json:"from"`
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Dir      string `json:"dir"`
+}
+
+// Storage - Where uploaded receipts are kept: files under Dir, or a bucket of
+// an S3-compatible service
+type Storage struct {
+	Driver        string `json:"driver"`
+	Dir           string `json:"dir"`
+	Endpoint      string `json:"endpoint"`
+	Region        string `json:"region"`
+	Bucket        string `json:"bucket"`
+	AccessKey     string `json:"access_key"`
+	SecretKey     string `json:"secret_key"`
+	MaxUploadSize int    `json:"max_upload_mb"` // Largest accepted upload, in megabytes
+}
+
+// RateLimit - Request limits (per minute, 0 disables the limit) and the
+// account lockout applied after repeated failed logins
+type RateLimit struct {
+	IPPerMinute   int  `json:"ip_per_minute"`   // Every request, per client IP
+	UserPerMinute int  `json:"user_per_minute"` // Authenticated requests, per user
+	AuthPerMinute int  `json:"auth_per_minute"` // Login, registration and password endpoints, per client IP
+	TrustProxy    bool `json:"trust_proxy"`     // Take the client IP from X-Forwarded-For
+	ProxyHops     int  `json:"proxy_hops"`      // Trusted proxies appending to X-Forwarded-For
+
+	LockoutThreshold   int `json:"lockout_threshold"` // Failed logins before the account is locked, 0 disables
+	LockoutBaseSeconds int `json:"lockout_base_seconds"`
+	LockoutMaxSeconds  int `json:"lockout_max_seconds"`
+}
+
+// Default returns the built-in settings. They describe a production server,
+// so the default JWT secret is refused unless APP_ENV=dev is set explicitly.
+func Default() Config {
+	return Config{
+		Env:        EnvProduction,
+		Port:       8080,
+		DBDriver:   database.DriverPostgres,
+		SQLitePath: "gatorsplit.db",
+		Database: Database{
+			Host:    "localhost",
+			Port:    5432,
+			User:    "postgres",
+			Name:    "postgres",
+			SSLMode: "disable",
+		},
+		JWTSecret:   DefaultJWTSecret,
+		CORSOrigins: []string{"http://localhost:3000"},
+		AppURL:      "http://localhost:3000",
+		Mail: Mail{
+			Driver: MailDriverLog,
+			From:   "GatorSplit <noreply@localhost>",
+			Port:   587,
+		},
+		RateLimit: RateLimit{
+			IPPerMinute:        300,
+			UserPerMinute:      120,
+			AuthPerMinute:      10,
+			ProxyHops:          1,
+			LockoutThreshold:   5,
+			LockoutBaseSeconds: 60,
+			LockoutMaxSeconds:  3600,
+		},
+		Storage: Storage{
+			Driver:        StorageDriverLocal,
+			Dir:           "uploads",
+			Region:        "us-east-1",
+			MaxUploadSize: 10,
+		},
+		RestoreWindowDays: 30,
+	}
+}
+
+// Load builds the configuration from the optional JSON file at path
+// (or $CONFIG_FILE when path is empty) and the environment, then validates it.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path == "" {
+		path = os.Getenv("CONFIG_FILE")
+	}
+	if path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return Config{}, err
+		}
+	}
+
+	if err := cfg.loadEnv(os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	if err := json.Unmarshal(data, c); err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv - Overrides settings from environment variables
+func (c *Config) loadEnv(lookup func(string) (string, bool)) error {
+	str := func(key string, dst *string) {
+		if v, ok := lookup(key); ok && v != "" {
+			*dst = v
+		}
+	}
+	num := func(key string, dst *int) error {
+		if v, ok := lookup(key); ok && v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("%s must be a number, got %q", key, v)
+			}
+			*dst = n
+		}
+		return nil
+	}
+
+	str("APP_ENV", &c.Env)
+	str("DB_DRIVER", &c.DBDriver)
+	str("SQLITE_PATH", &c.SQLitePath)
+	str("DATABASE_DSN", &c.DatabaseDSN)
+	str("DB_HOST", &c.Database.Host)
+	str("DB_USER", &c.Database.User)
+	str("DB_PASSWORD", &c.Database.Password)
+	str("DB_NAME", &c.Database.Name)
+	str("DB_SSLMODE", &c.Database.SSLMode)
+	str("JWT_SECRET", &c.JWTSecret)
+	str("APP_URL", &c.AppURL)
+	str("MAIL_DRIVER", &c.Mail.Driver)
+	str("MAIL_FROM", &c.Mail.From)
+	str("MAIL_DIR", &c.Mail.Dir)
+	str("SMTP_HOST", &c.Mail.Host)
+	str("SMTP_USERNAME", &c.Mail.Username)
+	str("SMTP_PASSWORD", &c.Mail.Password)
+	str("STORAGE_DRIVER", &c.Storage.Driver)
+	str("STORAGE_DIR", &c.Storage.Dir)
+	str("S3_ENDPOINT", &c.Storage.Endpoint)
+	str("S3_REGION", &c.Storage.Region)
+	str("S3_BUCKET", &c.Storage.Bucket)
+	str("S3_ACCESS_KEY", &c.Storage.AccessKey)
+	str("S3_SECRET_KEY", &c.Storage.SecretKey)
+
+	if err := num("PORT", &c.Port); err != nil {
+		return err
+	}
+	if err := num("DB_PORT", &c.Database.Port); err != nil {
+		return err
+	}
+	if err := num("SMTP_PORT", &c.Mail.Port); err != nil {
+		return err
+	}
+	if err := num("RESTORE_WINDOW_DAYS", &c.RestoreWindowDays); err != nil {
+		return err
+	}
+	if err := num("MAX_UPLOAD_MB", &c.Storage.MaxUploadSize); err != nil {
+		return err
+	}
+	limits := map[string]*int{
+		"RATE_LIMIT_IP_PER_MINUTE":   &c.RateLimit.IPPerMinute,
+		"RATE_LIMIT_USER_PER_MINUTE": &c.RateLimit.UserPerMinute,
+		"RATE_LIMIT_AUTH_PER_MINUTE": &c.RateLimit.AuthPerMinute,
+		"LOGIN_LOCKOUT_THRESHOLD":    &c.RateLimit.LockoutThreshold,
+		"LOGIN_LOCKOUT_BASE_SECONDS": &c.RateLimit.LockoutBaseSeconds,
+		"LOGIN_LOCKOUT_MAX_SECONDS":  &c.RateLimit.LockoutMaxSeconds,
+		"PROXY_HOPS":                 &c.RateLimit.ProxyHops,
+	}
+	for key, dst := range limits {
+		if err := num(key, dst); err != nil {
+			return err
+		}
+	}
+	if v, ok := lookup("TRUST_PROXY"); ok && v != "" {
+		trust, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("TRUST_PROXY must be true or false, got %q", v)
+		}
+		c.RateLimit.TrustProxy = trust
+	}
+
+	if v, ok := lookup("PG_NOTIFY"); ok && v != "" {
+		notify, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("PG_NOTIFY must be true or false, got %q", v)
+		}
+		c.PGNotify = notify
+	}
+
+	if v, ok := lookup("CORS_ALLOWED_ORIGINS"); ok && v != "" {
+		c.CORSOrigins = splitList(v)
+	}
+	if v, ok := lookup("WEBHOOK_ALLOWED_NETWORKS"); ok {
+		c.WebhookAllowedNetworks = splitList(v)
+	}
+	return nil
+}
+
+// Validate - Rejects settings the server cannot safely start with
+func (c Config) Validate() error {
+	if c.Env != EnvDev && c.Env != EnvProduction {
+		return fmt.Errorf("env must be %q or %q, got %q", EnvDev, EnvProduction, c.Env)
+	}
+	if c.Port < 1 || c.Port > 65535 {
+		return fmt.Errorf("port must be between 1 and 65535, got %d", c.Port)
+	}
+	if c.DBDriver != database.DriverPostgres && c.DBDriver != database.DriverSQLite {
+		return fmt.Errorf("db_driver must be %q or %q, got %q", database.DriverPostgres, database.DriverSQLite, c.DBDriver)
+	}
+	if c.DBDriver == database.DriverSQLite && c.SQLitePath == "" {
+		return errors.New("sqlite_path must not be empty when using the sqlite driver")
+	}
+	if c.JWTSecret == "" {
+		return errors.New("JWT secret must not be empty")
+	}
+	if !c.IsDev() && c.JWTSecret == DefaultJWTSecret {
+		return errors.New("JWT_SECRET must be changed from its default outside dev mode (set APP_ENV=dev for local development)")
+	}
+	if len(c.CORSOrigins) == 0 {
+		return errors.New("at least one CORS origin is required")
+	}
+	if c.AppURL == "" {
+		return errors.New("app_url must not be empty")
+	}
+	switch c.Mail.Driver {
+	case MailDriverLog:
+	case MailDriverSMTP:
+		if c.Mail.Host == "" {
+			return errors.New("SMTP_HOST is required for the smtp mail driver")
+		}
+	default:
+		return fmt.Errorf("mail driver must be %q or %q, got %q", MailDriverLog, MailDriverSMTP, c.Mail.Driver)
+	}
+	if c.Mail.From == "" {
+		return errors.New("mail from address must not be empty")
+	}
+	switch c.Storage.Driver {
+	case StorageDriverLocal:
+		if c.Storage.Dir == "" {
+			return errors.New("STORAGE_DIR is required for the local storage driver")
+		}
+	case StorageDriverS3:
+		if c.Storage.Endpoint == "" || c.Storage.Bucket == "" || c.Storage.Region == "" {
+			return errors.New("S3_ENDPOINT, S3_BUCKET and S3_REGION are required for the s3 storage driver")
+		}
+	default:
+		return fmt.Errorf("storage driver must be %q or %q, got %q", StorageDriverLocal, StorageDriverS3, c.Storage.Driver)
+	}
+	if c.Storage.MaxUploadSize < 1 {
+		return errors.New("max_upload_mb must be at least 1")
+	}
+	if c.RestoreWindowDays < 1 {
+		return errors.New("restore_window_days must be at least 1")
+	}
+	if c.PGNotify && c.DBDriver != database.DriverPostgres {
+		return errors.New("pg_notify requires the postgres database driver")
+	}
+	if _, err := c.WebhookNetworks(); err != nil {
+		return err
+	}
+	rl := c.RateLimit
+	if rl.IPPerMinute < 0 || rl.UserPerMinute < 0 || rl.AuthPerMinute < 0 || rl.LockoutThreshold < 0 {
+		return errors.New("rate limits and the lockout threshold must not be negative")
+	}
+	if rl.TrustProxy && rl.ProxyHops < 1 {
+		return errors.New("proxy_hops must be at least 1 when trust_proxy is set")
+	}
+	if rl.LockoutThreshold > 0 && (rl.LockoutBaseSeconds < 1 || rl.LockoutMaxSeconds < rl.LockoutBaseSeconds) {
+		return errors.New("lockout_base_seconds must be positive and at most lockout_max_seconds")
+	}
+	return nil
+}
+
+// IsDev reports whether the server runs in development mode
+func (c Config) IsDev() bool {
+	return c.Env == EnvDev
+}
+
+// Addr is the address the HTTP server listens on
+func (c Config) Addr() string {
+	return fmt.Sprintf(":%d", c.Port)
+}
+
+// DSN returns the connection string for the configured driver:
+// the SQLite file path, or the PostgreSQL connection string
+func (c Config) DSN() string {
+	if c.DBDriver == database.DriverSQLite {
+		return c.SQLitePath
+	}
+	if c.DatabaseDSN != "" {
+		return c.DatabaseDSN
+	}
+	db := c.Database
+	dsn := fmt.Sprintf("host=%s user=%s dbname=%s port=%d sslmode=%s TimeZone=UTC",
+		db.Host, quote(db.User), quote(db.Name), db.Port, db.SSLMode)
+	if db.Password != "" {
+		dsn += " password=" + quote(db.Password)
+	}
+	return dsn
+}
+
+// quote - Escapes a value for a key=value connection string
+func quote(v string) string {
+	v = strings.ReplaceAll(v, `\`, `\\`)
+	v = strings.ReplaceAll(v, `'`, `\'`)
+	return "'" + v + "'"
+}
+
+// WebhookNetworks - The parsed webhook_allowed_networks; a bare address
+// allows just that address
+func (c Config) WebhookNetworks() ([]netip.Prefix, error) {
+	var networks []netip.Prefix
+	for _, v := range c.WebhookAllowedNetworks {
+		network, err := netip.ParsePrefix(v)
+		if err != nil {
+			addr, addrErr := netip.ParseAddr(v)
+			if addrErr != nil {
+				return nil, fmt.Errorf("webhook_allowed_networks: %q is not a CIDR or an IP address", v)
+			}
+			network = netip.PrefixFrom(addr, addr.BitLen())
+		}
+		networks = append(networks, network.Masked())
+	}
+	return networks, nil
+}
+
+func splitList(v string) []string {
+	var items []string
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
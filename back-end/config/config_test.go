@@ -0,0 +1,147 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadEnvOverridesFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	os.WriteFile(path, []byte(`{"port": 9000, "jwt_secret": "from-file", "database": {"host": "db", "password": "filepass"}}`), 0o600)
+
+	t.Setenv("PORT", "9100")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Port != 9100 {
+		t.Errorf("Expected PORT from env to win, got %d", cfg.Port)
+	}
+	if cfg.JWTSecret != "from-file" {
+		t.Errorf("Expected jwt_secret from file, got %q", cfg.JWTSecret)
+	}
+	if len(cfg.CORSOrigins) != 2 || cfg.CORSOrigins[1] != "https://b.example.com" {
+		t.Errorf("Unexpected CORS origins: %v", cfg.CORSOrigins)
+	}
+	want := "host=db user='postgres' dbname='postgres' port=5432 sslmode=disable TimeZone=UTC password='filepass'"
+	if cfg.DSN() != want {
+		t.Errorf("Unexpected DSN:\n got %s\nwant %s", cfg.DSN(), want)
+	}
+}
+
+func TestValidateRejectsDefaultSecretInProduction(t *testing.T) {
+	cfg := Default()
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected the default JWT secret to be rejected unless dev mode is chosen")
+	}
+
+	cfg.Env = EnvDev
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Default dev config should be valid, got %v", err)
+	}
+
+	cfg.Env = EnvProduction
+
+	cfg.JWTSecret = "a-real-secret"
+	if err := cfg.Validate(); err != nil {
+		t.Errorf("Expected production config with a real secret to be valid, got %v", err)
+	}
+
+	cfg.Port = 70000
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected an out of range port to be rejected")
+	}
+
+	cfg.Port = 8080
+	cfg.RestoreWindowDays = 0
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected an empty restore window to be rejected")
+	}
+}
+
+func TestLoadDefaultsToProduction(t *testing.T) {
+	if _, err := Load(""); err == nil {
+		t.Error("Expected the default JWT secret to be rejected without APP_ENV=dev")
+	}
+
+	t.Setenv("APP_ENV", "dev")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !cfg.IsDev() {
+		t.Errorf("Expected APP_ENV=dev to select dev mode, got %q", cfg.Env)
+	}
+}
+
+func TestSQLiteDriver(t *testing.T) {
+	t.Setenv("APP_ENV", "dev")
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("SQLITE_PATH", "/var/lib/gatorsplit/data.db")
+
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.DSN() != "/var/lib/gatorsplit/data.db" {
+		t.Errorf("Expected the SQLite path as DSN, got %q", cfg.DSN())
+	}
+
+	cfg.PGNotify = true
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected LISTEN/NOTIFY to require PostgreSQL")
+	}
+	cfg.PGNotify = false
+
+	cfg.DBDriver = "mysql"
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected an unknown driver to be rejected")
+	}
+
+	cfg.DBDriver = "sqlite"
+	cfg.SQLitePath = ""
+	if err := cfg.Validate(); err == nil {
+		t.Error("Expected an empty SQLite path to be rejected")
+	}
+}
+
+func TestS3Storage(t *testing.T) {
+	t.Setenv("APP_ENV", "dev")
+	t.Setenv("STORAGE_DRIVER", "s3")
+	if _, err := Load(""); err == nil {
+		t.Error("Expected the s3 driver without an endpoint and bucket to be rejected")
+	}
+
+	t.Setenv("S3_ENDPOINT", "http://localhost:9000")
+	t.Setenv("S3_BUCKET", "receipts")
+	t.Setenv("MAX_UPLOAD_MB", "5")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Storage.Bucket != "receipts" || cfg.Storage.Region != "us-east-1" || cfg.Storage.MaxUploadSize != 5 {
+		t.Errorf("Unexpected storage settings: %+v", cfg.Storage)
+	}
+}
+
+func TestWebhookAllowedNetworks(t *testing.T) {
+	t.Setenv("APP_ENV", "dev")
+	t.Setenv("WEBHOOK_ALLOWED_NETWORKS", "10.1.0.0/16, 127.0.0.1")
+	cfg, err := Load("")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	networks, _ := cfg.WebhookNetworks()
+	if len(networks) != 2 || networks[0].String() != "10.1.0.0/16" || networks[1].String() != "127.0.0.1/32" {
+		t.Errorf("Unexpected networks: %v", networks)
+	}
+
+	t.Setenv("WEBHOOK_ALLOWED_NETWORKS", "intranet")
+	if _, err := Load(""); err == nil {
+		t.Error("Expected a network that is not a CIDR or address to be rejected")
+	}
+}
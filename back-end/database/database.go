@@ -2,8 +2,8 @@ package database
 
 import (
 	"fmt"
-	"go-auth-app/models"
 	"log"
+	"strings"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/driver/sqlite"
@@ -12,47 +12,82 @@ import (
 
 var DB *gorm.DB
 
-func ConnectDatabase() {
-	var err error
+// Supported values for the database driver setting
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// ConnectDatabase opens the database for the given driver and brings its
+// schema up to date. dsn is a PostgreSQL connection string (Data Source Name)
+// or the path of the SQLite file.
+func ConnectDatabase(driver, dsn string) {
+	db, err := Open(driver, dsn)
+	if err != nil {
+		panic(err.Error())
+	}
+	DB = db
+
+	fmt.Printf("%s database connection established.\n", driver)
+
+	// Refuses to start against a schema written by a newer release
+	if err := MigrateUp(DB); err != nil {
+		panic("Failed to migrate database: " + err.Error())
+	}
+}
 
-	// Define PostgreSQL connection string (DSN: Data Source Name)
-	dsn := "host=localhost user='postgres' password='raghu' dbname=postgres port=5432 sslmode=disable TimeZone=UTC"
+// Open connects to the database without touching its schema
+func Open(driver, dsn string) (*gorm.DB, error) {
+	dialector, err := Dialector(driver, dsn)
+	if err != nil {
+		return nil, err
+	}
 
-	// Open PostgreSQL connection
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// Unique index violations come back as gorm.ErrDuplicatedKey
+	db, err := gorm.Open(dialector, &gorm.Config{TranslateError: true})
 	if err != nil {
-		panic("Failed to connect to PostgreSQL database!")
+		return nil, fmt.Errorf("failed to connect to %s database: %w", driver, err)
 	}
 
-	fmt.Println("PostgreSQL database connection established.")
+	// SQLite only allows one writer at a time; serialise access instead of failing with "database is locked"
+	if driver == DriverSQLite {
+		sqlDB, err := db.DB()
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure SQLite connection pool: %w", err)
+		}
+		sqlDB.SetMaxOpenConns(1)
+	}
+	return db, nil
+}
 
-	// AutoMigrate will create/update tables based on the struct definition
-	DB.AutoMigrate(
-		&models.User{},
-		&models.Group{},
-		&models.GroupUser{},
-		&models.Thread{},
-		&models.Expense{},
-		&models.ExpenseParticipant{},
-	)
+// Dialector returns the GORM dialector for a driver name
+func Dialector(driver, dsn string) (gorm.Dialector, error) {
+	switch driver {
+	case DriverPostgres:
+		return postgres.Open(dsn), nil
+	case DriverSQLite:
+		// Enforce foreign keys and wait for locks rather than erroring immediately,
+		// keeping any options the path already has (e.g. file:app.db?cache=shared)
+		sep := "?"
+		if strings.Contains(dsn, "?") {
+			sep = "&"
+		}
+		return sqlite.Open(dsn + sep + "_foreign_keys=on&_busy_timeout=5000"), nil
+	}
+	return nil, fmt.Errorf("unsupported database driver %q (expected %q or %q)", driver, DriverPostgres, DriverSQLite)
 }
 
 // SetupMockDB initializes an in-memory SQLite database for testing
 func SetupMockDB() {
-	mockDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	mockDB, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{TranslateError: true})
 	if err != nil {
 		log.Fatalf("❌ Failed to initialize mock database: %v", err)
 	}
 
-	// Migrate all models
-	mockDB.AutoMigrate(
-		&models.User{},
-		&models.Group{},
-		&models.GroupUser{},
-		&models.Thread{},
-		&models.Expense{},
-		&models.ExpenseParticipant{},
-	)
+	// Build the schema the same way production does
+	if err := MigrateUp(mockDB); err != nil {
+		log.Fatalf("❌ Failed to migrate mock database: %v", err)
+	}
 
 	// 🔹 Override the global `database.DB` instance
 	DB = mockDB
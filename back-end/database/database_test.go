@@ -0,0 +1,44 @@
+package database_test
+
+import (
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"path/filepath"
+	"testing"
+)
+
+func TestConnectDatabaseSQLiteFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "gatorsplit.db")
+	database.ConnectDatabase(database.DriverSQLite, path)
+
+	user := models.User{Username: "alice", Email: "alice@example.com", Password: "secret"}
+	if err := database.DB.Create(&user).Error; err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	// Reconnecting must keep the data and not fail on the existing schema
+	database.ConnectDatabase(database.DriverSQLite, path)
+	var count int64
+	database.DB.Model(&models.User{}).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected the user to persist in the SQLite file, got %d users", count)
+	}
+}
+
+func TestDialectorRejectsUnknownDriver(t *testing.T) {
+	if _, err := database.Dialector("mysql", ""); err == nil {
+		t.Error("Expected an unknown driver to be rejected")
+	}
+}
+
+func TestSQLitePathWithOptions(t *testing.T) {
+	db, err := database.Open(database.DriverSQLite, "file:"+filepath.Join(t.TempDir(), "gatorsplit.db")+"?cache=shared")
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	var foreignKeys int
+	db.Raw("PRAGMA foreign_keys").Scan(&foreignKeys)
+	if foreignKeys != 1 {
+		t.Error("Expected foreign keys to be enforced when the path has its own options")
+	}
+}
@@ -0,0 +1,183 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Migration - One numbered, reversible schema change
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+	Down    func(tx *gorm.DB) error
+}
+
+// schemaMigration - Row of the schema_migrations table, one per applied migration
+type schemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false"`
+	Name      string    `gorm:"not null"`
+	AppliedAt time.Time `gorm:"not null"`
+}
+
+func (schemaMigration) TableName() string { return "schema_migrations" }
+
+// MigrationStatus - Whether a known migration has been applied
+type MigrationStatus struct {
+	Version   int
+	Name      string
+	AppliedAt *time.Time // nil while pending
+}
+
+// ErrSchemaTooNew is returned when the database was migrated by a newer binary
+var ErrSchemaTooNew = errors.New("database schema is newer than this binary")
+
+// migrationLockID - Arbitrary key for the PostgreSQL advisory lock that keeps
+// several instances booting at once from applying the same migration twice
+const migrationLockID = 7201553
+
+// LatestVersion is the schema version this binary expects
+func LatestVersion() int {
+	return migrations[len(migrations)-1].Version
+}
+
+// SchemaVersion returns the highest applied migration, or 0 for an empty database
+func SchemaVersion(db *gorm.DB) (int, error) {
+	if err := db.AutoMigrate(&schemaMigration{}); err != nil {
+		return 0, err
+	}
+	var version int
+	err := db.Model(&schemaMigration{}).Select("COALESCE(MAX(version), 0)").Scan(&version).Error
+	return version, err
+}
+
+// CheckSchemaVersion refuses to run against a schema migrated by a newer binary,
+// whose tables this binary might silently misuse
+func CheckSchemaVersion(db *gorm.DB) error {
+	version, err := SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	if version > LatestVersion() {
+		return fmt.Errorf("%w: database is at version %d, this binary supports up to %d", ErrSchemaTooNew, version, LatestVersion())
+	}
+	return nil
+}
+
+// MigrateUp applies every pending migration in order, each in its own transaction
+func MigrateUp(db *gorm.DB) error {
+	if err := CheckSchemaVersion(db); err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := lockMigrations(tx); err != nil {
+				return err
+			}
+			// Another instance may have applied it while we waited for the lock
+			var applied int64
+			if err := tx.Model(&schemaMigration{}).Where("version = ?", m.Version).Count(&applied).Error; err != nil {
+				return err
+			}
+			if applied > 0 {
+				return nil
+			}
+
+			fmt.Printf("⬆️ Applying migration %d_%s\n", m.Version, m.Name)
+			if err := m.Up(tx); err != nil {
+				return err
+			}
+			return tx.Create(&schemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now()}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// MigrateDown rolls back the most recent applied migrations, newest first
+func MigrateDown(db *gorm.DB, steps int) error {
+	if err := CheckSchemaVersion(db); err != nil {
+		return err
+	}
+
+	for i := 0; i < steps; i++ {
+		version, err := SchemaVersion(db)
+		if err != nil {
+			return err
+		}
+		if version == 0 {
+			return nil // Nothing left to roll back
+		}
+
+		m, ok := findMigration(version)
+		if !ok {
+			return fmt.Errorf("no migration with version %d", version)
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := lockMigrations(tx); err != nil {
+				return err
+			}
+			fmt.Printf("⬇️ Reverting migration %d_%s\n", m.Version, m.Name)
+			if err := m.Down(tx); err != nil {
+				return err
+			}
+			return tx.Where("version = ?", m.Version).Delete(&schemaMigration{}).Error
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d_%s: %w", m.Version, m.Name, err)
+		}
+	}
+	return nil
+}
+
+// Status lists every known migration and when it was applied
+func Status(db *gorm.DB) ([]MigrationStatus, error) {
+	if _, err := SchemaVersion(db); err != nil {
+		return nil, err
+	}
+
+	var applied []schemaMigration
+	if err := db.Find(&applied).Error; err != nil {
+		return nil, err
+	}
+	appliedAt := map[int]time.Time{}
+	for _, a := range applied {
+		appliedAt[a.Version] = a.AppliedAt
+	}
+
+	statuses := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status := MigrationStatus{Version: m.Version, Name: m.Name}
+		if at, ok := appliedAt[m.Version]; ok {
+			status.AppliedAt = &at
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+func findMigration(version int) (Migration, bool) {
+	for _, m := range migrations {
+		if m.Version == version {
+			return m, true
+		}
+	}
+	return Migration{}, false
+}
+
+// lockMigrations - Serialises migrations across instances sharing a PostgreSQL
+// database; the lock is released when the transaction ends. SQLite already
+// allows a single writer only.
+func lockMigrations(tx *gorm.DB) error {
+	if tx.Dialector.Name() != DriverPostgres {
+		return nil
+	}
+	return tx.Exec("SELECT pg_advisory_xact_lock(?)", migrationLockID).Error
+}
@@ -0,0 +1,168 @@
+package database_test
+
+import (
+	"errors"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"path/filepath"
+	"testing"
+
+	"gorm.io/gorm"
+)
+
+func openTestDB(t *testing.T) *gorm.DB {
+	db, err := database.Open(database.DriverSQLite, filepath.Join(t.TempDir(), "migrate.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	return db
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	db := openTestDB(t)
+
+	if err := database.MigrateUp(db); err != nil {
+		t.Fatalf("MigrateUp failed: %v", err)
+	}
+	version, _ := database.SchemaVersion(db)
+	if version != database.LatestVersion() {
+		t.Errorf("Expected version %d after up, got %d", database.LatestVersion(), version)
+	}
+
+	// Running it again must be a no-op
+	if err := database.MigrateUp(db); err != nil {
+		t.Fatalf("Second MigrateUp failed: %v", err)
+	}
+
+	if err := database.MigrateDown(db, database.LatestVersion()); err != nil {
+		t.Fatalf("MigrateDown failed: %v", err)
+	}
+	if db.Migrator().HasTable(&models.Expense{}) {
+		t.Error("Expected rolling back every migration to drop the expenses table")
+	}
+
+	statuses, err := database.Status(db)
+	if err != nil {
+		t.Fatalf("Status failed: %v", err)
+	}
+	for _, s := range statuses {
+		if s.AppliedAt != nil {
+			t.Errorf("Expected migration %d to be pending, applied at %v", s.Version, s.AppliedAt)
+		}
+	}
+}
+
+func TestMigrateRefusesNewerSchema(t *testing.T) {
+	db := openTestDB(t)
+	if err := database.MigrateUp(db); err != nil {
+		t.Fatalf("MigrateUp failed: %v", err)
+	}
+
+	// Pretend a newer release migrated this database
+	if err := db.Exec("INSERT INTO schema_migrations (version, name, applied_at) VALUES (?, 'from_the_future', CURRENT_TIMESTAMP)",
+		database.LatestVersion()+1).Error; err != nil {
+		t.Fatalf("Failed to insert migration row: %v", err)
+	}
+
+	if err := database.MigrateUp(db); !errors.Is(err, database.ErrSchemaTooNew) {
+		t.Errorf("Expected ErrSchemaTooNew, got %v", err)
+	}
+}
+
+func TestExpenseParticipantsCascade(t *testing.T) {
+	db := openTestDB(t)
+	if err := database.MigrateUp(db); err != nil {
+		t.Fatalf("MigrateUp failed: %v", err)
+	}
+
+	user := models.User{Username: "alice", Email: "alice@example.com", Password: "secret"}
+	db.Create(&user)
+	expense := models.Expense{Title: "Lunch", Amount: models.NewMoney(10), PaidBy: user.ID}
+	db.Create(&expense)
+
+	if err := db.Create(&models.ExpenseParticipant{ExpenseID: expense.ID + 100, UserID: user.ID}).Error; err == nil {
+		t.Error("Expected a participant of a missing expense to be rejected")
+	}
+	if err := db.Create(&models.ExpenseParticipant{ExpenseID: expense.ID, UserID: user.ID, AmountOwed: models.NewMoney(10)}).Error; err != nil {
+		t.Fatalf("Failed to create participant: %v", err)
+	}
+
+	db.Exec("DELETE FROM expenses WHERE id = ?", expense.ID)
+	var count int64
+	db.Model(&models.ExpenseParticipant{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected participants to be deleted with their expense, %d left", count)
+	}
+}
+
+func TestBackfillGroupAdmins(t *testing.T) {
+	db := openTestDB(t)
+	if err := database.MigrateUp(db); err != nil {
+		t.Fatalf("MigrateUp failed: %v", err)
+	}
+
+	// A group from before roles with three members, and one that has an admin
+	for _, userID := range []uint{8, 4, 6} {
+		db.Create(&models.GroupUser{GroupID: 1, UserID: userID, Role: "member"})
+	}
+	db.Create(&models.GroupUser{GroupID: 2, UserID: 3, Role: "member"})
+	db.Create(&models.GroupUser{GroupID: 2, UserID: 5, Role: "admin"})
+
+	if err := database.BackfillGroupAdmins(db); err != nil {
+		t.Fatalf("BackfillGroupAdmins failed: %v", err)
+	}
+
+	var admins []models.GroupUser
+	db.Where("role = ?", "admin").Order("group_id").Find(&admins)
+	if len(admins) != 2 || admins[0].UserID != 4 || admins[1].UserID != 5 {
+		t.Errorf("Expected user 4 to administer group 1 and user 5 group 2, got %+v", admins)
+	}
+}
+
+func TestBackfillGroupOwners(t *testing.T) {
+	db := openTestDB(t)
+	if err := database.MigrateUp(db); err != nil {
+		t.Fatalf("MigrateUp failed: %v", err)
+	}
+
+	// Groups from before ownership: one with two admins, one that already has an owner
+	db.Create(&models.GroupUser{GroupID: 1, UserID: 7, Role: "admin"})
+	db.Create(&models.GroupUser{GroupID: 1, UserID: 3, Role: "admin"})
+	db.Create(&models.GroupUser{GroupID: 2, UserID: 3, Role: "admin"})
+	db.Create(&models.GroupUser{GroupID: 2, UserID: 5, Role: "owner"})
+
+	if err := database.BackfillGroupOwners(db); err != nil {
+		t.Fatalf("BackfillGroupOwners failed: %v", err)
+	}
+
+	var owners []models.GroupUser
+	db.Where("role = ?", "owner").Order("group_id").Find(&owners)
+	if len(owners) != 2 || owners[0].UserID != 3 || owners[1].UserID != 5 {
+		t.Errorf("Expected user 3 to own group 1 and user 5 group 2, got %+v", owners)
+	}
+}
+
+func TestBackfillExpenseGroups(t *testing.T) {
+	db := openTestDB(t)
+	if err := database.MigrateUp(db); err != nil {
+		t.Fatalf("MigrateUp failed: %v", err)
+	}
+
+	group := models.Group{Name: "Trip"}
+	db.Create(&group)
+	thread := models.Thread{Name: "Hotels", GroupID: &group.ID}
+	db.Create(&thread)
+	inThread := models.Expense{Title: "Hotel", Amount: models.NewMoney(90), PaidBy: 1, ThreadID: &thread.ID}
+	personal := models.Expense{Title: "Coffee", Amount: models.NewMoney(3), PaidBy: 1}
+	db.Create(&inThread)
+	db.Create(&personal)
+
+	if err := database.BackfillExpenseGroups(db); err != nil {
+		t.Fatalf("BackfillExpenseGroups failed: %v", err)
+	}
+	db.First(&inThread, inThread.ID)
+	db.First(&personal, personal.ID)
+	if inThread.GroupID == nil || *inThread.GroupID != group.ID || personal.GroupID != nil {
+		t.Errorf("Expected only the thread's expense to get the group, got %v and %v", inThread.GroupID, personal.GroupID)
+	}
+}
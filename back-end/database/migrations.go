@@ -0,0 +1,678 @@
+package database
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// migrations - Every schema change, in order. Never edit or renumber a
+// migration once it has shipped; add a new one instead.
+//
+// Migrations never use the live models: each one works on frozen copies of
+// the tables or columns it changes, as they were when it shipped, so fresh
+// and upgraded databases have the same schema at every version.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: func(tx *gorm.DB) error {
+			// Databases created before versioned migrations stored amounts as floats
+			if err := ConvertMoneyColumns(tx); err != nil {
+				return err
+			}
+			return tx.AutoMigrate(initialModels...)
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(initialModels...)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "backfill_group_admins",
+		Up:      BackfillGroupAdmins,
+		Down:    func(tx *gorm.DB) error { return nil }, // Promotions cannot be told apart from real admins
+	},
+	{
+		Version: 3,
+		Name:    "expense_participants_expense_fk",
+		Up: func(tx *gorm.DB) error {
+			if tx.Migrator().HasConstraint(&expenseParticipantsFK{}, "Participants") {
+				return nil
+			}
+			// Participants of hard-deleted expenses would violate the new key
+			if err := tx.Exec("DELETE FROM expense_participants WHERE expense_id NOT IN (SELECT id FROM expenses)").Error; err != nil {
+				return err
+			}
+			if err := tx.Migrator().CreateConstraint(&expenseParticipantsFK{}, "Participants"); err != nil {
+				return err
+			}
+			// SQLite adds constraints by rebuilding the table, which drops its indexes
+			return tx.AutoMigrate(&initialExpenseParticipant{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropConstraint(&expenseParticipantsFK{}, "Participants"); err != nil {
+				return err
+			}
+			return tx.AutoMigrate(&initialExpenseParticipant{})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "refresh_and_revoked_tokens",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v4RefreshToken{}, &v4RevokedToken{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v4RefreshToken{}, &v4RevokedToken{})
+		},
+	},
+	{
+		Version: 5,
+		Name:    "email_verification_and_user_tokens",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v5User{}, "EmailVerifiedAt"); err != nil {
+				return err
+			}
+			return tx.AutoMigrate(&v5UserToken{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&v5UserToken{}); err != nil {
+				return err
+			}
+			return dropColumns(tx, &v5User{}, "EmailVerifiedAt")
+		},
+	},
+	{
+		Version: 6,
+		Name:    "totp_two_factor",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v6User{}, "TOTPSecret", "TOTPEnabledAt", "TOTPLastStep"); err != nil {
+				return err
+			}
+			return tx.AutoMigrate(&v6RecoveryCode{})
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropTable(&v6RecoveryCode{}); err != nil {
+				return err
+			}
+			return dropColumns(tx, &v6User{}, "TOTPSecret", "TOTPEnabledAt", "TOTPLastStep")
+		},
+	},
+	{
+		Version: 7,
+		Name:    "login_lockout",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &v7User{}, "FailedLogins", "LockedUntil")
+		},
+		Down: func(tx *gorm.DB) error {
+			return dropColumns(tx, &v7User{}, "FailedLogins", "LockedUntil")
+		},
+	},
+	{
+		Version: 8,
+		Name:    "group_invitations",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v8GroupInvitation{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v8GroupInvitation{})
+		},
+	},
+	{
+		Version: 9,
+		Name:    "group_owners",
+		Up:      BackfillGroupOwners,
+		Down: func(tx *gorm.DB) error {
+			return tx.Exec("UPDATE group_users SET role = 'admin' WHERE role = 'owner'").Error
+		},
+	},
+	{
+		Version: 10,
+		Name:    "archived_groups_and_threads",
+		Up: func(tx *gorm.DB) error {
+			if err := addColumns(tx, &v10Group{}, "ArchivedAt"); err != nil {
+				return err
+			}
+			return addColumns(tx, &v10Thread{}, "ArchivedAt")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := dropColumns(tx, &v10Group{}, "ArchivedAt"); err != nil {
+				return err
+			}
+			return dropColumns(tx, &v10Thread{}, "ArchivedAt")
+		},
+	},
+	{
+		Version: 11,
+		Name:    "recurring_expenses",
+		Up: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&v11RecurringExpense{}); err != nil {
+				return err
+			}
+			if err := addColumns(tx, &v11Expense{}, "RecurringExpenseID", "OccurrenceAt"); err != nil {
+				return err
+			}
+			if tx.Migrator().HasIndex(&v11Expense{}, "idx_expense_occurrence") {
+				return nil
+			}
+			return tx.Migrator().CreateIndex(&v11Expense{}, "idx_expense_occurrence")
+		},
+		Down: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropIndex(&v11Expense{}, "idx_expense_occurrence"); err != nil {
+				return err
+			}
+			if err := dropColumns(tx, &v11Expense{}, "RecurringExpenseID", "OccurrenceAt"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable(&v11RecurringExpense{})
+		},
+	},
+	{
+		Version: 12,
+		Name:    "attachments",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v12Attachment{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v12Attachment{})
+		},
+	},
+	{
+		Version: 13,
+		Name:    "expense_comments_and_notifications",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v13ExpenseComment{}, &v13Notification{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v13Notification{}, &v13ExpenseComment{})
+		},
+	},
+	{
+		Version: 14,
+		Name:    "activities",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v14Activity{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v14Activity{})
+		},
+	},
+	{
+		Version: 15,
+		Name:    "webhooks",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&v15Webhook{}, &v15WebhookDelivery{})
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&v15WebhookDelivery{}, &v15Webhook{})
+		},
+	},
+	{
+		Version: 16,
+		Name:    "backfill_expense_groups",
+		Up:      BackfillExpenseGroups,
+		Down:    func(tx *gorm.DB) error { return nil }, // The group is correct either way
+	},
+	{
+		Version: 17,
+		Name:    "drop_webhook_response_bodies",
+		Up: func(tx *gorm.DB) error {
+			// Receivers' answers are no longer kept
+			if !tx.Migrator().HasColumn(&v15WebhookDelivery{}, "ResponseBody") {
+				return nil
+			}
+			return dropColumns(tx, &v15WebhookDelivery{}, "ResponseBody")
+		},
+		Down: func(tx *gorm.DB) error {
+			return addColumns(tx, &v15WebhookDelivery{}, "ResponseBody")
+		},
+	},
+	{
+		Version: 18,
+		Name:    "unique_exchange_rates",
+		Up: func(tx *gorm.DB) error {
+			// Re-imported rates were stored again; the latest import wins
+			err := tx.Exec(`
+				DELETE FROM exchange_rates WHERE id NOT IN (
+					SELECT MAX(id) FROM exchange_rates GROUP BY from_currency, to_currency, effective_date
+				)
+			`).Error
+			if err != nil || tx.Migrator().HasIndex(&v18ExchangeRate{}, "idx_exchange_rate_date") {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&v18ExchangeRate{}, "idx_exchange_rate_date")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropIndex(&v18ExchangeRate{}, "idx_exchange_rate_date")
+		},
+	},
+	{
+		Version: 19,
+		Name:    "unique_expense_revisions",
+		Up: func(tx *gorm.DB) error {
+			// Concurrent edits may have recorded the same revision twice; number them in order
+			err := tx.Exec(`
+				UPDATE expense_revisions SET revision = (
+					SELECT COUNT(*) FROM expense_revisions r
+					WHERE r.expense_id = expense_revisions.expense_id AND r.id <= expense_revisions.id
+				)
+			`).Error
+			if err != nil || tx.Migrator().HasIndex(&v19ExpenseRevision{}, "idx_expense_revision") {
+				return err
+			}
+			return tx.Migrator().CreateIndex(&v19ExpenseRevision{}, "idx_expense_revision")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropIndex(&v19ExpenseRevision{}, "idx_expense_revision")
+		},
+	},
+	{
+		Version: 20,
+		Name:    "unique_group_members",
+		Up: func(tx *gorm.DB) error {
+			if err := MergeDuplicateGroupMembers(tx); err != nil {
+				return err
+			}
+			if tx.Migrator().HasIndex(&v20GroupUser{}, "idx_group_member") {
+				return nil
+			}
+			return tx.Migrator().CreateIndex(&v20GroupUser{}, "idx_group_member")
+		},
+		Down: func(tx *gorm.DB) error {
+			return tx.Migrator().DropIndex(&v20GroupUser{}, "idx_group_member")
+		},
+	},
+}
+
+// initialModels - Tables that existed when versioned migrations were introduced
+var initialModels = []interface{}{
+	&initialUser{},
+	&initialGroup{},
+	&initialGroupUser{},
+	&initialThread{},
+	&initialExpense{},
+	&initialExpenseParticipant{},
+	&initialExchangeRate{},
+	&initialExpenseRevision{},
+}
+
+// The models as migration 1 created them. Never change these; columns added
+// since then belong to the migration that added them.
+type (
+	initialUser struct {
+		gorm.Model
+		Username string `gorm:"unique;not null"`
+		Email    string `gorm:"unique;not null"`
+		Password string `gorm:"not null"`
+		IsAdmin  bool   `gorm:"not null;default:false"`
+	}
+	initialGroup struct {
+		gorm.Model
+		Name         string `gorm:"unique;not null"`
+		BaseCurrency string `gorm:"type:varchar(3);not null;default:'USD'"`
+	}
+	initialGroupUser struct {
+		GroupID uint   `gorm:"not null;index"`
+		UserID  uint   `gorm:"not null;index"`
+		Role    string `gorm:"type:varchar(10);default:'member'"`
+	}
+	initialThread struct {
+		gorm.Model
+		Name      string `gorm:"not null"`
+		GroupID   *uint  `gorm:"index"`
+		CreatedBy uint   `gorm:"not null"`
+	}
+	initialExpense struct {
+		gorm.Model
+		Title     string `gorm:"not null"`
+		Amount    int64  `gorm:"not null"`
+		Currency  string `gorm:"type:varchar(3);not null;default:'USD'"`
+		PaidBy    uint   `gorm:"not null"`
+		CreatedBy uint   `gorm:"index"`
+		GroupID   *uint  `gorm:"index"`
+		ThreadID  *uint  `gorm:"index"`
+	}
+	initialExpenseParticipant struct {
+		ExpenseID  uint  `gorm:"not null;index"`
+		UserID     uint  `gorm:"not null;index"`
+		AmountOwed int64 `gorm:"not null"`
+	}
+	initialExchangeRate struct {
+		gorm.Model
+		FromCurrency  string    `gorm:"type:varchar(3);not null;index:idx_exchange_rate_pair"`
+		ToCurrency    string    `gorm:"type:varchar(3);not null;index:idx_exchange_rate_pair"`
+		Rate          float64   `gorm:"not null"`
+		EffectiveDate time.Time `gorm:"not null;index"`
+	}
+	initialExpenseRevision struct {
+		gorm.Model
+		ExpenseID     uint `gorm:"not null;index"`
+		Revision      int  `gorm:"not null"`
+		ChangedBy     uint `gorm:"not null"`
+		ChangedFields string
+		Before        string `gorm:"column:before_state;type:text"`
+		After         string `gorm:"column:after_state;type:text"`
+	}
+)
+
+func (initialUser) TableName() string               { return "users" }
+func (initialGroup) TableName() string              { return "groups" }
+func (initialGroupUser) TableName() string          { return "group_users" }
+func (initialThread) TableName() string             { return "threads" }
+func (initialExpense) TableName() string            { return "expenses" }
+func (initialExpenseParticipant) TableName() string { return "expense_participants" }
+func (initialExchangeRate) TableName() string       { return "exchange_rates" }
+func (initialExpenseRevision) TableName() string    { return "expense_revisions" }
+
+// The tables and columns added by later migrations, as each one created
+// them. Structs of a column migration only hold the columns it adds.
+type (
+	v4RefreshToken struct {
+		gorm.Model
+		UserID     uint      `gorm:"not null;index"`
+		TokenHash  string    `gorm:"type:varchar(64);uniqueIndex;not null"`
+		FamilyID   string    `gorm:"type:varchar(32);index;not null"`
+		ExpiresAt  time.Time `gorm:"not null"`
+		RevokedAt  *time.Time
+		ReplacedBy *uint
+	}
+	v4RevokedToken struct {
+		JTI       string    `gorm:"primaryKey;type:varchar(32)"`
+		ExpiresAt time.Time `gorm:"not null;index"`
+	}
+
+	v5User struct {
+		EmailVerifiedAt *time.Time
+	}
+	v5UserToken struct {
+		gorm.Model
+		UserID    uint      `gorm:"not null;index"`
+		Purpose   string    `gorm:"type:varchar(20);not null"`
+		TokenHash string    `gorm:"type:varchar(64);uniqueIndex;not null"`
+		ExpiresAt time.Time `gorm:"not null"`
+		UsedAt    *time.Time
+	}
+
+	v6User struct {
+		TOTPSecret    string     `gorm:"column:totp_secret"`
+		TOTPEnabledAt *time.Time `gorm:"column:totp_enabled_at"`
+		TOTPLastStep  int64      `gorm:"column:totp_last_step;not null;default:0"`
+	}
+	v6RecoveryCode struct {
+		gorm.Model
+		UserID   uint   `gorm:"not null;index"`
+		CodeHash string `gorm:"type:varchar(64);not null"`
+		UsedAt   *time.Time
+	}
+
+	v7User struct {
+		FailedLogins int `gorm:"not null;default:0"`
+		LockedUntil  *time.Time
+	}
+
+	v8GroupInvitation struct {
+		gorm.Model
+		GroupID     uint      `gorm:"not null;index"`
+		InvitedBy   uint      `gorm:"not null"`
+		Email       *string   `gorm:"index"`
+		TokenHash   string    `gorm:"type:varchar(64);uniqueIndex;not null"`
+		Status      string    `gorm:"type:varchar(10);not null;default:'pending'"`
+		ExpiresAt   time.Time `gorm:"not null"`
+		MaxUses     int       `gorm:"not null;default:0"`
+		Uses        int       `gorm:"not null;default:0"`
+		AcceptedBy  *uint
+		RespondedAt *time.Time
+	}
+
+	v10Group struct {
+		ArchivedAt *time.Time
+	}
+	v10Thread struct {
+		ArchivedAt *time.Time
+	}
+
+	v11RecurringExpense struct {
+		gorm.Model
+		Title     string    `gorm:"not null"`
+		Amount    int64     `gorm:"not null"`
+		Currency  string    `gorm:"type:varchar(3);not null;default:'USD'"`
+		PaidBy    uint      `gorm:"not null"`
+		CreatedBy uint      `gorm:"not null"`
+		GroupID   *uint     `gorm:"index"`
+		ThreadID  *uint     `gorm:"index"`
+		SplitType string    `gorm:"type:varchar(10);not null"`
+		Split     string    `gorm:"type:text;not null"`
+		Rule      string    `gorm:"not null"`
+		StartsAt  time.Time `gorm:"not null"`
+		EndsAt    *time.Time
+		NextRunAt *time.Time `gorm:"index"`
+		LastRunAt *time.Time
+		Runs      int `gorm:"not null;default:0"`
+		PausedAt  *time.Time
+	}
+	v11Expense struct {
+		RecurringExpenseID *uint      `gorm:"uniqueIndex:idx_expense_occurrence"`
+		OccurrenceAt       *time.Time `gorm:"uniqueIndex:idx_expense_occurrence"`
+	}
+
+	v12Attachment struct {
+		gorm.Model
+		ExpenseID    uint   `gorm:"not null;index"`
+		UploadedBy   uint   `gorm:"not null"`
+		FileName     string `gorm:"not null"`
+		ContentType  string `gorm:"not null"`
+		Size         int64  `gorm:"not null"`
+		SHA256       string `gorm:"column:sha256;size:64;not null;index"`
+		HasThumbnail bool   `gorm:"not null;default:false"`
+	}
+
+	v13ExpenseComment struct {
+		gorm.Model
+		ExpenseID uint   `gorm:"not null;index"`
+		AuthorID  uint   `gorm:"not null"`
+		Body      string `gorm:"type:text;not null"`
+		EditedAt  *time.Time
+	}
+	v13Notification struct {
+		gorm.Model
+		UserID    uint   `gorm:"not null;index"`
+		ActorID   uint   `gorm:"not null"`
+		Type      string `gorm:"not null"`
+		GroupID   *uint
+		ExpenseID *uint
+		CommentID *uint
+		Message   string `gorm:"not null"`
+		ReadAt    *time.Time
+	}
+
+	v14Activity struct {
+		ID         uint `gorm:"primaryKey"`
+		CreatedAt  time.Time
+		GroupID    uint   `gorm:"not null;index"`
+		ActorID    *uint  `gorm:"index"`
+		Action     string `gorm:"not null;index"`
+		TargetType string `gorm:"not null"`
+		TargetID   uint   `gorm:"not null"`
+		Before     string `gorm:"column:before_state;type:text"`
+		After      string `gorm:"column:after_state;type:text"`
+	}
+
+	v15Webhook struct {
+		gorm.Model
+		GroupID   uint   `gorm:"not null;index"`
+		CreatedBy uint   `gorm:"not null"`
+		URL       string `gorm:"not null"`
+		Secret    string `gorm:"not null"`
+		Events    string `gorm:"type:text"`
+		Active    bool   `gorm:"not null"`
+	}
+	v15WebhookDelivery struct {
+		ID            uint `gorm:"primaryKey"`
+		CreatedAt     time.Time
+		WebhookID     uint `gorm:"not null;index"`
+		EventID       uint
+		EventType     string     `gorm:"not null"`
+		Payload       string     `gorm:"type:text;not null"`
+		Status        string     `gorm:"not null;index"`
+		Attempts      int        `gorm:"not null;default:0"`
+		NextAttemptAt *time.Time `gorm:"index"`
+		LastAttemptAt *time.Time
+		ResponseCode  int
+		ResponseBody  string `gorm:"type:text"`
+		Error         string `gorm:"type:text"`
+		DeliveredAt   *time.Time
+	}
+
+	v18ExchangeRate struct {
+		FromCurrency  string    `gorm:"uniqueIndex:idx_exchange_rate_date"`
+		ToCurrency    string    `gorm:"uniqueIndex:idx_exchange_rate_date"`
+		EffectiveDate time.Time `gorm:"uniqueIndex:idx_exchange_rate_date"`
+	}
+
+	v19ExpenseRevision struct {
+		ExpenseID uint `gorm:"uniqueIndex:idx_expense_revision"`
+		Revision  int  `gorm:"uniqueIndex:idx_expense_revision"`
+	}
+
+	v20GroupUser struct {
+		GroupID uint `gorm:"uniqueIndex:idx_group_member"`
+		UserID  uint `gorm:"uniqueIndex:idx_group_member"`
+	}
+)
+
+func (v4RefreshToken) TableName() string      { return "refresh_tokens" }
+func (v4RevokedToken) TableName() string      { return "revoked_tokens" }
+func (v5User) TableName() string              { return "users" }
+func (v5UserToken) TableName() string         { return "user_tokens" }
+func (v6User) TableName() string              { return "users" }
+func (v6RecoveryCode) TableName() string      { return "recovery_codes" }
+func (v7User) TableName() string              { return "users" }
+func (v8GroupInvitation) TableName() string   { return "group_invitations" }
+func (v10Group) TableName() string            { return "groups" }
+func (v10Thread) TableName() string           { return "threads" }
+func (v11RecurringExpense) TableName() string { return "recurring_expenses" }
+func (v11Expense) TableName() string          { return "expenses" }
+func (v12Attachment) TableName() string       { return "attachments" }
+func (v13ExpenseComment) TableName() string   { return "expense_comments" }
+func (v13Notification) TableName() string     { return "notifications" }
+func (v14Activity) TableName() string         { return "activities" }
+func (v15Webhook) TableName() string          { return "webhooks" }
+func (v15WebhookDelivery) TableName() string  { return "webhook_deliveries" }
+func (v18ExchangeRate) TableName() string     { return "exchange_rates" }
+func (v19ExpenseRevision) TableName() string  { return "expense_revisions" }
+func (v20GroupUser) TableName() string        { return "group_users" }
+
+// addColumns - Adds the named fields of a frozen model, skipping columns the
+// table already has
+func addColumns(tx *gorm.DB, model interface{}, fields ...string) error {
+	for _, field := range fields {
+		if tx.Migrator().HasColumn(model, field) {
+			continue
+		}
+		if err := tx.Migrator().AddColumn(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// dropColumns - Drops the named fields of a frozen model. SQLite drops a
+// column by rebuilding the table, so the table's indexes are created again.
+func dropColumns(tx *gorm.DB, model interface{}, fields ...string) error {
+	var indexes []string
+	if tx.Dialector.Name() == DriverSQLite {
+		stmt := &gorm.Statement{DB: tx}
+		if err := stmt.Parse(model); err != nil {
+			return err
+		}
+		err := tx.Raw("SELECT sql FROM sqlite_master WHERE type = 'index' AND tbl_name = ? AND sql IS NOT NULL", stmt.Schema.Table).Scan(&indexes).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, field := range fields {
+		if err := tx.Migrator().DropColumn(model, field); err != nil {
+			return err
+		}
+	}
+	for _, index := range indexes {
+		if err := tx.Exec(index).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// expenseParticipantsFK - Declares the expense_participants -> expenses
+// foreign key for the migrator without adding the association to models.Expense
+type expenseParticipantsFK struct {
+	ID           uint
+	Participants []initialExpenseParticipant `gorm:"foreignKey:ExpenseID;constraint:OnDelete:CASCADE"`
+}
+
+func (expenseParticipantsFK) TableName() string { return "expenses" }
+
+// BackfillGroupAdmins promotes one member of any group that has no admin.
+// Groups created before roles were enforced never had one and would otherwise
+// be impossible to manage. Their creator is not recorded, so the member with
+// the lowest user ID is picked; everyone else stays a member.
+func BackfillGroupAdmins(db *gorm.DB) error {
+	return db.Exec(`
+		UPDATE group_users SET role = 'admin'
+		WHERE group_id NOT IN (SELECT group_id FROM group_users WHERE role IN ('admin', 'owner'))
+		AND user_id = (SELECT MIN(m.user_id) FROM group_users m WHERE m.group_id = group_users.group_id)
+	`).Error
+}
+
+// BackfillGroupOwners makes one admin the owner of every group without one.
+// Groups predate ownership, so the admin with the lowest user ID is picked.
+func BackfillGroupOwners(db *gorm.DB) error {
+	return db.Exec(`
+		UPDATE group_users SET role = 'owner'
+		WHERE role = 'admin'
+		AND group_id NOT IN (SELECT group_id FROM group_users WHERE role = 'owner')
+		AND user_id = (SELECT MIN(a.user_id) FROM group_users a WHERE a.group_id = group_users.group_id AND a.role = 'admin')
+	`).Error
+}
+
+// BackfillExpenseGroups sets the group of expenses that were created with
+// only a thread, so every group expense can be found by its group_id
+func BackfillExpenseGroups(db *gorm.DB) error {
+	return db.Exec(`
+		UPDATE expenses SET group_id = (SELECT t.group_id FROM threads t WHERE t.id = expenses.thread_id)
+		WHERE group_id IS NULL AND thread_id IS NOT NULL
+	`).Error
+}
+
+// MergeDuplicateGroupMembers keeps one membership row per user and group.
+// Concurrent invitation accepts could add a user twice; the row with the
+// highest role is kept.
+func MergeDuplicateGroupMembers(db *gorm.DB) error {
+	var duplicates []struct {
+		GroupID uint
+		UserID  uint
+	}
+	if err := db.Raw("SELECT group_id, user_id FROM group_users GROUP BY group_id, user_id HAVING COUNT(*) > 1").Scan(&duplicates).Error; err != nil {
+		return err
+	}
+
+	for _, d := range duplicates {
+		var role string
+		err := db.Raw(`
+			SELECT role FROM group_users WHERE group_id = ? AND user_id = ?
+			ORDER BY CASE role WHEN 'owner' THEN 0 WHEN 'admin' THEN 1 ELSE 2 END LIMIT 1
+		`, d.GroupID, d.UserID).Scan(&role).Error
+		if err != nil {
+			return err
+		}
+		if err := db.Exec("DELETE FROM group_users WHERE group_id = ? AND user_id = ?", d.GroupID, d.UserID).Error; err != nil {
+			return err
+		}
+		if err := db.Exec("INSERT INTO group_users (group_id, user_id, role) VALUES (?, ?, ?)", d.GroupID, d.UserID, role).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,264 @@
+package database
+
+import (
+	"go-auth-app/models"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func openMigrationsDB(t *testing.T) *gorm.DB {
+	db, err := Open(DriverSQLite, filepath.Join(t.TempDir(), "migrations.db"))
+	if err != nil {
+		t.Fatalf("Failed to open database: %v", err)
+	}
+	return db
+}
+
+func TestInitialSchemaIsFrozen(t *testing.T) {
+	db := openMigrationsDB(t)
+	if err := migrations[0].Up(db); err != nil {
+		t.Fatalf("Initial migration failed: %v", err)
+	}
+
+	// Columns added to the models later come from their own migrations only
+	for model, column := range map[interface{}]string{
+		&models.User{}:    "email_verified_at",
+		&models.Group{}:   "archived_at",
+		&models.Expense{}: "recurring_expense_id",
+	} {
+		if db.Migrator().HasColumn(model, column) {
+			t.Errorf("Expected the initial schema not to have %T.%s", model, column)
+		}
+	}
+	if !db.Migrator().HasColumn(&models.Expense{}, "created_by") {
+		t.Error("Expected the initial schema to have expenses.created_by")
+	}
+}
+
+func TestMigrationsOnlyAddTheirOwnColumns(t *testing.T) {
+	db := openMigrationsDB(t)
+
+	// Columns each migration adds, missing before it runs and present after
+	added := map[int][]struct {
+		model  interface{}
+		column string
+	}{
+		5:  {{&models.User{}, "email_verified_at"}},
+		6:  {{&models.User{}, "totp_secret"}, {&models.User{}, "totp_last_step"}},
+		7:  {{&models.User{}, "failed_logins"}, {&models.User{}, "locked_until"}},
+		10: {{&models.Group{}, "archived_at"}, {&models.Thread{}, "archived_at"}},
+		11: {{&models.Expense{}, "recurring_expense_id"}, {&models.Expense{}, "occurrence_at"}},
+	}
+	for _, m := range migrations {
+		for _, c := range added[m.Version] {
+			if db.Migrator().HasColumn(c.model, c.column) {
+				t.Errorf("Expected %T.%s not to exist before migration %d", c.model, c.column, m.Version)
+			}
+		}
+		if err := m.Up(db); err != nil {
+			t.Fatalf("Migration %d failed: %v", m.Version, err)
+		}
+		for _, c := range added[m.Version] {
+			if !db.Migrator().HasColumn(c.model, c.column) {
+				t.Errorf("Expected migration %d to add %T.%s", m.Version, c.model, c.column)
+			}
+		}
+	}
+}
+
+func TestMigrationsBuildTheModels(t *testing.T) {
+	db := openMigrationsDB(t)
+	if err := MigrateUp(db); err != nil {
+		t.Fatalf("MigrateUp failed: %v", err)
+	}
+
+	// Every column and index of the models must come from a migration
+	for _, model := range []interface{}{
+		&models.User{}, &models.Group{}, &models.GroupUser{}, &models.Thread{},
+		&models.Expense{}, &models.ExpenseParticipant{}, &models.ExchangeRate{}, &models.ExpenseRevision{},
+		&models.RefreshToken{}, &models.RevokedToken{}, &models.UserToken{}, &models.RecoveryCode{},
+		&models.GroupInvitation{}, &models.RecurringExpense{}, &models.Attachment{},
+		&models.ExpenseComment{}, &models.Notification{}, &models.Activity{},
+		&models.Webhook{}, &models.WebhookDelivery{},
+	} {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatalf("Failed to parse %T: %v", model, err)
+		}
+		for _, column := range stmt.Schema.DBNames {
+			if !db.Migrator().HasColumn(model, column) {
+				t.Errorf("Expected the migrations to create %s.%s", stmt.Schema.Table, column)
+			}
+		}
+		columns, _ := db.Migrator().ColumnTypes(model)
+		for _, column := range columns {
+			if stmt.Schema.LookUpField(column.Name()) == nil {
+				t.Errorf("Expected %s.%s to be dropped, the model no longer has it", stmt.Schema.Table, column.Name())
+			}
+		}
+		for _, index := range stmt.Schema.ParseIndexes() {
+			if !db.Migrator().HasIndex(model, index.Name) {
+				t.Errorf("Expected the migrations to create index %s on %s", index.Name, stmt.Schema.Table)
+			}
+		}
+	}
+}
+
+// schemaColumns - Every table's columns and indexes, leaving out the migrations table
+func schemaColumns(t *testing.T, db *gorm.DB) map[string]string {
+	tables, err := db.Migrator().GetTables()
+	if err != nil {
+		t.Fatalf("Failed to list tables: %v", err)
+	}
+	schema := make(map[string]string)
+	for _, table := range tables {
+		if table == "schema_migrations" {
+			continue
+		}
+		columns, err := db.Migrator().ColumnTypes(table)
+		if err != nil {
+			t.Fatalf("Failed to list columns of %s: %v", table, err)
+		}
+		indexes, err := db.Migrator().GetIndexes(table)
+		if err != nil {
+			t.Fatalf("Failed to list indexes of %s: %v", table, err)
+		}
+		var names []string
+		for _, column := range columns {
+			names = append(names, column.Name()+" "+column.DatabaseTypeName())
+		}
+		for _, index := range indexes {
+			names = append(names, "index "+index.Name())
+		}
+		sort.Strings(names)
+		schema[table] = strings.Join(names, ", ")
+	}
+	return schema
+}
+
+func TestMigrateDownMatchesEveryVersion(t *testing.T) {
+	upgraded := openMigrationsDB(t)
+	if err := MigrateUp(upgraded); err != nil {
+		t.Fatalf("MigrateUp failed: %v", err)
+	}
+
+	// Rolling back to a version leaves the schema a fresh database has there
+	for version := LatestVersion() - 1; version >= 1; version-- {
+		if err := MigrateDown(upgraded, 1); err != nil {
+			t.Fatalf("MigrateDown to %d failed: %v", version, err)
+		}
+		fresh := openMigrationsDB(t)
+		for _, m := range migrations[:version] {
+			if err := m.Up(fresh); err != nil {
+				t.Fatalf("Migration %d failed: %v", m.Version, err)
+			}
+		}
+
+		got, want := schemaColumns(t, upgraded), schemaColumns(t, fresh)
+		for table := range want {
+			if got[table] != want[table] {
+				t.Errorf("Version %d: %s has %s after rolling back, %s when fresh", version, table, got[table], want[table])
+			}
+		}
+		for table := range got {
+			if _, ok := want[table]; !ok {
+				t.Errorf("Version %d: unexpected table %s after rolling back", version, table)
+			}
+		}
+	}
+}
+
+func TestUniqueExchangeRatesKeepsLatestImport(t *testing.T) {
+	db := openMigrationsDB(t)
+	for _, m := range migrations {
+		if m.Version == 18 {
+			break
+		}
+		if err := m.Up(db); err != nil {
+			t.Fatalf("Migration %d failed: %v", m.Version, err)
+		}
+	}
+
+	date := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for _, rate := range []float64{1.10, 1.20} {
+		db.Create(&initialExchangeRate{FromCurrency: "EUR", ToCurrency: "USD", Rate: rate, EffectiveDate: date})
+	}
+	db.Create(&initialExchangeRate{FromCurrency: "GBP", ToCurrency: "USD", Rate: 1.25, EffectiveDate: date})
+	unique, _ := findMigration(18)
+	if err := unique.Up(db); err != nil {
+		t.Fatalf("Migration 18 failed: %v", err)
+	}
+
+	var rates []initialExchangeRate
+	db.Order("from_currency").Find(&rates)
+	if len(rates) != 2 || rates[0].Rate != 1.20 {
+		t.Errorf("Expected the latest EUR rate to be kept, got %+v", rates)
+	}
+	if err := db.Create(&initialExchangeRate{FromCurrency: "GBP", ToCurrency: "USD", Rate: 1.30, EffectiveDate: date}).Error; err == nil {
+		t.Error("Expected a second rate for the same pair and day to be refused")
+	}
+}
+
+func TestUniqueExpenseRevisionsRenumbersDuplicates(t *testing.T) {
+	db := openMigrationsDB(t)
+	for _, m := range migrations {
+		if m.Version == 19 {
+			break
+		}
+		if err := m.Up(db); err != nil {
+			t.Fatalf("Migration %d failed: %v", m.Version, err)
+		}
+	}
+
+	// Two concurrent edits both recorded revision 2
+	for _, revision := range []int{1, 2, 2} {
+		db.Create(&initialExpenseRevision{ExpenseID: 1, Revision: revision, ChangedBy: 1})
+	}
+	db.Create(&initialExpenseRevision{ExpenseID: 2, Revision: 1, ChangedBy: 1})
+	unique, _ := findMigration(19)
+	if err := unique.Up(db); err != nil {
+		t.Fatalf("Migration 19 failed: %v", err)
+	}
+
+	var revisions []int
+	db.Model(&initialExpenseRevision{}).Where("expense_id = ?", 1).Order("id").Pluck("revision", &revisions)
+	if len(revisions) != 3 || revisions[0] != 1 || revisions[1] != 2 || revisions[2] != 3 {
+		t.Errorf("Expected revisions 1, 2, 3, got %v", revisions)
+	}
+}
+
+func TestUniqueGroupMembersKeepsHighestRole(t *testing.T) {
+	db := openMigrationsDB(t)
+	for _, m := range migrations {
+		if m.Version == 20 {
+			break
+		}
+		if err := m.Up(db); err != nil {
+			t.Fatalf("Migration %d failed: %v", m.Version, err)
+		}
+	}
+
+	// Two invitations accepted at the same time, then a promotion of one row
+	for _, role := range []string{"member", "admin"} {
+		db.Create(&initialGroupUser{GroupID: 1, UserID: 2, Role: role})
+	}
+	db.Create(&initialGroupUser{GroupID: 1, UserID: 3, Role: "member"})
+	unique, _ := findMigration(20)
+	if err := unique.Up(db); err != nil {
+		t.Fatalf("Migration 20 failed: %v", err)
+	}
+
+	var roles []string
+	db.Model(&initialGroupUser{}).Where("group_id = ? AND user_id = ?", 1, 2).Pluck("role", &roles)
+	if len(roles) != 1 || roles[0] != "admin" {
+		t.Errorf("Expected a single admin membership, got %v", roles)
+	}
+	if err := db.Create(&initialGroupUser{GroupID: 1, UserID: 3, Role: "member"}).Error; err == nil {
+		t.Error("Expected a second membership for the same user to be refused")
+	}
+}
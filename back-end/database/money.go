@@ -0,0 +1,69 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// moneyColumns lists every column that used to hold float64 amounts and now
+// holds integer cents
+var moneyColumns = map[string][]string{
+	"expenses":             {"amount"},
+	"expense_participants": {"amount_owed"},
+}
+
+// ConvertMoneyColumns rewrites legacy float amount columns to integer cents.
+// It runs as part of the initial migration and is a no-op once the columns are BIGINT.
+// Only PostgreSQL databases predate integer amounts, so other drivers are skipped.
+func ConvertMoneyColumns(db *gorm.DB) error {
+	if db.Dialector.Name() != DriverPostgres {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		for table, columns := range moneyColumns {
+			if !tx.Migrator().HasTable(table) {
+				continue
+			}
+
+			columnTypes, err := tx.Migrator().ColumnTypes(table)
+			if err != nil {
+				return err
+			}
+
+			for _, ct := range columnTypes {
+				if !contains(columns, ct.Name()) || !isFloatType(ct.DatabaseTypeName()) {
+					continue
+				}
+
+				fmt.Printf("💱 Converting %s.%s to integer cents\n", table, ct.Name())
+				stmt := fmt.Sprintf(
+					"ALTER TABLE %s ALTER COLUMN %s TYPE BIGINT USING ROUND(%s * 100)::BIGINT",
+					table, ct.Name(), ct.Name(),
+				)
+				if err := tx.Exec(stmt).Error; err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
+
+func isFloatType(typeName string) bool {
+	switch strings.ToLower(typeName) {
+	case "float4", "float8", "real", "double precision", "numeric", "decimal":
+		return true
+	}
+	return false
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
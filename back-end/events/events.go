@@ -0,0 +1,115 @@
+// Package events fans out real-time notifications about changes to the
+// clients listening for them: in-process through a Hub, and optionally across
+// server instances through PostgreSQL LISTEN/NOTIFY.
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Event - A committed change in a group
+type Event struct {
+	ID       uint            `json:"id"` // The activity log entry behind it; increases over time
+	Type     string          `json:"type"`
+	GroupID  uint            `json:"group_id"`
+	ActorID  *uint           `json:"actor_id"` // nil for changes made by the server itself
+	TargetID uint            `json:"target_id"`
+	Data     json.RawMessage `json:"data,omitempty"` // The target after the change, or before it when it was removed
+	At       time.Time       `json:"at"`
+}
+
+// Broadcaster - Carries events to every server instance, including this one,
+// whose hubs then deliver them
+type Broadcaster interface {
+	Broadcast(e Event) error
+}
+
+// bufferSize - Events a subscriber may fall behind by before it is dropped
+const bufferSize = 64
+
+// Hub - Delivers published events to every subscriber. Subscribers that do
+// not keep up are closed rather than slowing the publisher down; clients are
+// expected to reconnect and refetch.
+type Hub struct {
+	// Broadcaster, when set, routes published events through other instances
+	// too; they come back to this hub through Deliver
+	Broadcaster Broadcaster
+
+	mu   sync.Mutex
+	subs map[*Subscription]struct{}
+}
+
+// Subscription - The events delivered to one subscriber. C is closed once the
+// subscription ends, by Close or because the subscriber fell behind.
+type Subscription struct {
+	C <-chan Event
+
+	ch  chan Event
+	hub *Hub
+}
+
+// NewHub returns a hub without subscribers
+func NewHub() *Hub {
+	return &Hub{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscribe starts receiving every event delivered from now on
+func (h *Hub) Subscribe() *Subscription {
+	ch := make(chan Event, bufferSize)
+	s := &Subscription{C: ch, ch: ch, hub: h}
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+	return s
+}
+
+// Close ends the subscription; it is safe to call more than once
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.remove(s)
+}
+
+// remove - Drops the subscriber and closes its channel. The caller holds h.mu.
+func (h *Hub) remove(s *Subscription) {
+	if _, ok := h.subs[s]; ok {
+		delete(h.subs, s)
+		close(s.ch)
+	}
+}
+
+// Publish sends the event to the subscribers of every instance, or only of this
+// one when there is no broadcaster or it fails
+func (h *Hub) Publish(e Event) {
+	if h.Broadcaster != nil {
+		err := h.Broadcaster.Broadcast(e)
+		if err == nil {
+			return
+		}
+		fmt.Println("⚠️ Error broadcasting event, delivering it locally only:", err)
+	}
+	h.Deliver(e)
+}
+
+// Deliver sends the event to this instance's subscribers
+func (h *Hub) Deliver(e Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for s := range h.subs {
+		select {
+		case s.ch <- e:
+		default:
+			h.remove(s)
+		}
+	}
+}
+
+// Subscribers - How many subscriptions are open
+func (h *Hub) Subscribers() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.subs)
+}
@@ -0,0 +1,95 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+type fakeBroadcaster struct {
+	sent []Event
+	err  error
+}
+
+func (b *fakeBroadcaster) Broadcast(e Event) error {
+	if b.err != nil {
+		return b.err
+	}
+	b.sent = append(b.sent, e)
+	return nil
+}
+
+func TestHubDelivers(t *testing.T) {
+	hub := NewHub()
+	a, b := hub.Subscribe(), hub.Subscribe()
+
+	hub.Publish(Event{ID: 1, Type: "expense.created", GroupID: 7})
+	for _, s := range []*Subscription{a, b} {
+		if e := <-s.C; e.ID != 1 || e.Type != "expense.created" {
+			t.Errorf("Unexpected event %+v", e)
+		}
+	}
+
+	a.Close()
+	a.Close()
+	if _, ok := <-a.C; ok {
+		t.Error("Expected a closed subscription's channel to be closed")
+	}
+	if hub.Subscribers() != 1 {
+		t.Errorf("Expected 1 subscriber left, got %d", hub.Subscribers())
+	}
+}
+
+func TestHubDropsSlowSubscribers(t *testing.T) {
+	hub := NewHub()
+	slow := hub.Subscribe()
+	for i := 1; i <= bufferSize+1; i++ {
+		hub.Deliver(Event{ID: uint(i)})
+	}
+
+	received := 0
+	for range slow.C {
+		received++
+	}
+	if received != bufferSize || hub.Subscribers() != 0 {
+		t.Errorf("Expected the subscriber to be dropped after %d events, got %d", bufferSize, received)
+	}
+	slow.Close()
+}
+
+func TestHubBroadcaster(t *testing.T) {
+	broadcaster := &fakeBroadcaster{}
+	hub := NewHub()
+	hub.Broadcaster = broadcaster
+	s := hub.Subscribe()
+
+	// Broadcast events reach this hub through its listener, not directly
+	hub.Publish(Event{ID: 1})
+	if len(broadcaster.sent) != 1 || len(s.C) != 0 {
+		t.Errorf("Expected the event to be broadcast only, got %d sent and %d delivered", len(broadcaster.sent), len(s.C))
+	}
+
+	broadcaster.err = errors.New("connection refused")
+	hub.Publish(Event{ID: 2})
+	if e := <-s.C; e.ID != 2 {
+		t.Errorf("Expected a failed broadcast to be delivered locally, got %+v", e)
+	}
+}
+
+func TestEncodePayload(t *testing.T) {
+	small, err := encodePayload(Event{ID: 1, Type: "comment.created", Data: json.RawMessage(`{"body":"hi"}`)})
+	if err != nil || !strings.Contains(small, `"data":{"body":"hi"}`) {
+		t.Errorf("Expected the data to be kept, got %s (%v)", small, err)
+	}
+
+	body, _ := json.Marshal(map[string]string{"body": strings.Repeat("x", maxPayload)})
+	large, err := encodePayload(Event{ID: 2, Type: "comment.created", Data: body})
+	if err != nil || len(large) >= maxPayload || strings.Contains(large, `"data"`) {
+		t.Errorf("Expected the data to be dropped, got %d bytes (%v)", len(large), err)
+	}
+	var e Event
+	if err := json.Unmarshal([]byte(large), &e); err != nil || e.ID != 2 {
+		t.Errorf("Expected the event without its data, got %+v (%v)", e, err)
+	}
+}
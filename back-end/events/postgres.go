@@ -0,0 +1,95 @@
+package events
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Channel - The PostgreSQL notification channel events travel on
+const Channel = "gatorsplit_events"
+
+// maxPayload - PostgreSQL refuses notification payloads of 8000 bytes or more
+const maxPayload = 7900
+
+// Postgres - Fans events out to every instance sharing the database. Events
+// are sent with NOTIFY on DB and received by Listen on a dedicated connection.
+type Postgres struct {
+	DSN string
+	DB  *sql.DB
+}
+
+// Broadcast - Sends the event as a notification. Events too large for one
+// are sent without their data; clients refetch the target instead.
+func (p Postgres) Broadcast(e Event) error {
+	payload, err := encodePayload(e)
+	if err != nil {
+		return err
+	}
+	_, err = p.DB.Exec("SELECT pg_notify($1, $2)", Channel, payload)
+	return err
+}
+
+func encodePayload(e Event) (string, error) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return "", err
+	}
+	if len(payload) >= maxPayload {
+		e.Data = nil
+		if payload, err = json.Marshal(e); err != nil {
+			return "", err
+		}
+	}
+	return string(payload), nil
+}
+
+// Listen - Delivers the events of every instance to the hub until ctx is
+// cancelled, reconnecting when the connection drops. Events sent while it is
+// disconnected are lost.
+func (p Postgres) Listen(ctx context.Context, hub *Hub) {
+	wait := time.Second
+	for ctx.Err() == nil {
+		err := p.listen(ctx, hub, func() { wait = time.Second })
+		if ctx.Err() != nil {
+			return
+		}
+		fmt.Printf("⚠️ Lost the event listener connection, retrying in %s: %v\n", wait, err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(wait):
+		}
+		wait = min(wait*2, time.Minute)
+	}
+}
+
+// listen - Runs one listening connection; connected is called once it is set up
+func (p Postgres) listen(ctx context.Context, hub *Hub, connected func()) error {
+	conn, err := pgx.Connect(ctx, p.DSN)
+	if err != nil {
+		return err
+	}
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+pgx.Identifier{Channel}.Sanitize()); err != nil {
+		return err
+	}
+	connected()
+
+	for {
+		n, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+		var e Event
+		if err := json.Unmarshal([]byte(n.Payload), &e); err != nil {
+			fmt.Println("⚠️ Ignoring malformed event notification:", err)
+			continue
+		}
+		hub.Deliver(e)
+	}
+}
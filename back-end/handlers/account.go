@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/mailer"
+	"go-auth-app/models"
+	"net/http"
+	"net/url"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+// Mailer sends account emails; main replaces it with the configured mailer at startup
+var Mailer mailer.Mailer = mailer.LogMailer{From: "GatorSplit <noreply@localhost>"}
+
+// AppURL is the frontend base URL that email links point to
+var AppURL = "http://localhost:3000"
+
+// Lifetimes of emailed tokens
+const (
+	VerifyEmailTokenTTL   = 48 * time.Hour
+	PasswordResetTokenTTL = 1 * time.Hour
+)
+
+var errInvalidUserToken = errors.New("invalid or expired token")
+
+// issueUserToken - Creates a single-use token for the user, replacing any
+// unused token with the same purpose, and returns its plain value
+func issueUserToken(userID uint, purpose string, ttl time.Duration) (string, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+			Delete(&models.UserToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.UserToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: hashToken(token),
+			ExpiresAt: time.Now().Add(ttl),
+		}).Error
+	})
+	return token, err
+}
+
+// consumeUserToken - Marks a token as used and returns its user ID. Fails for
+// unknown, expired or already used tokens.
+func consumeUserToken(tx *gorm.DB, token, purpose string) (uint, error) {
+	var record models.UserToken
+	err := tx.Where("token_hash = ? AND purpose = ?", hashToken(token), purpose).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return 0, errInvalidUserToken
+	}
+	if err != nil {
+		return 0, err
+	}
+	if record.UsedAt != nil || time.Now().After(record.ExpiresAt) {
+		return 0, errInvalidUserToken
+	}
+
+	// The condition on used_at keeps two concurrent requests from both using the token
+	result := tx.Model(&models.UserToken{}).
+		Where("id = ? AND used_at IS NULL", record.ID).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return 0, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return 0, errInvalidUserToken
+	}
+	return record.UserID, nil
+}
+
+// appLink - Builds a frontend URL carrying the token
+func appLink(path, token string) string {
+	return AppURL + path + "?token=" + url.QueryEscape(token)
+}
+
+// sendVerificationEmail - Emails the user a link to confirm their address
+func sendVerificationEmail(user models.User) error {
+	token, err := issueUserToken(user.ID, models.TokenVerifyEmail, VerifyEmailTokenTTL)
+	if err != nil {
+		return err
+	}
+	return Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm your GatorSplit email address",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening this link:\n\n%s\n\nThe link expires in %d hours.\n",
+			user.Username, appLink("/verify-email", token), int(VerifyEmailTokenTTL.Hours())),
+	})
+}
+
+// VerifyEmail - Confirms the user's email address with the emailed token
+func VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token string `json:"token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" {
+		http.Error(w, "token is required", http.StatusBadRequest)
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		userID, err := consumeUserToken(tx, input.Token, models.TokenVerifyEmail)
+		if err != nil {
+			return err
+		}
+		return tx.Model(&models.User{}).Where("id = ?", userID).Update("email_verified_at", time.Now()).Error
+	})
+	if errors.Is(err, errInvalidUserToken) {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		fmt.Println("❌ Error verifying email:", err)
+		http.Error(w, "Error verifying email", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Email address verified"})
+}
+
+// ResendVerificationEmail - Sends a new verification link to the logged in user
+func ResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.EmailVerifiedAt != nil {
+		http.Error(w, "Email address is already verified", http.StatusConflict)
+		return
+	}
+
+	if err := sendVerificationEmail(user); err != nil {
+		fmt.Println("❌ Error sending verification email:", err)
+		http.Error(w, "Error sending verification email", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Verification email sent"})
+}
+
+// ForgotPassword - Emails a password reset link. The response is the same
+// whether or not the address is registered, so it cannot be used to probe for accounts.
+func ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Email == "" {
+		http.Error(w, "email is required", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := database.DB.Where("email = ?", input.Email).First(&user).Error; err == nil {
+		if err := sendPasswordResetEmail(user); err != nil {
+			fmt.Println("❌ Error sending password reset email:", err)
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "If the address is registered, a password reset link has been sent"})
+}
+
+func sendPasswordResetEmail(user models.User) error {
+	token, err := issueUserToken(user.ID, models.TokenPasswordReset, PasswordResetTokenTTL)
+	if err != nil {
+		return err
+	}
+	return Mailer.Send(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your GatorSplit password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset your password. If it was you, open this link:\n\n%s\n\nThe link expires in %d minutes. If you did not ask for it, you can ignore this email.\n",
+			user.Username, appLink("/reset-password", token), int(PasswordResetTokenTTL.Minutes())),
+	})
+}
+
+// ResetPassword - Sets a new password with an emailed reset token and ends all of the user's sessions
+func ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Token == "" || input.Password == "" {
+		http.Error(w, "token and password are required", http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Error hashing password", http.StatusInternalServerError)
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		userID, err := consumeUserToken(tx, input.Token, models.TokenPasswordReset)
+		if err != nil {
+			return err
+		}
+		// Receiving the email proves ownership of the address too, and lifts any lockout
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"password":          string(hashedPassword),
+			"email_verified_at": gorm.Expr("COALESCE(email_verified_at, ?)", time.Now()),
+			"failed_logins":     0,
+			"locked_until":      nil,
+		}).Error; err != nil {
+			return err
+		}
+		return revokeRefreshTokens(tx, "user_id = ?", userID)
+	})
+	if errors.Is(err, errInvalidUserToken) {
+		http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		fmt.Println("❌ Error resetting password:", err)
+		http.Error(w, "Error resetting password", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Password has been reset"})
+}
@@ -0,0 +1,140 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/mailer"
+	"go-auth-app/models"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fakeMailer - Records sent mails instead of delivering them
+type fakeMailer struct {
+	sent []mailer.Message
+}
+
+func (m *fakeMailer) Send(msg mailer.Message) error {
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// useFakeMailer - Swaps in a fakeMailer for the duration of the test
+func useFakeMailer(t *testing.T) *fakeMailer {
+	m := &fakeMailer{}
+	previous := handlers.Mailer
+	handlers.Mailer = m
+	t.Cleanup(func() { handlers.Mailer = previous })
+	return m
+}
+
+var tokenPattern = regexp.MustCompile(`token=(\S+)`)
+
+// mailedToken - Extracts the token from the link in the last sent mail
+func mailedToken(t *testing.T, m *fakeMailer) string {
+	if len(m.sent) == 0 {
+		t.Fatal("Expected a mail to be sent")
+	}
+	match := tokenPattern.FindStringSubmatch(m.sent[len(m.sent)-1].Body)
+	if match == nil {
+		t.Fatalf("No token link in mail: %s", m.sent[len(m.sent)-1].Body)
+	}
+	token, _ := url.QueryUnescape(match[1])
+	return token
+}
+
+func postJSON(handler http.HandlerFunc, body interface{}) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest("POST", "/", bytes.NewBuffer(data))
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestRegisterSendsVerificationEmail(t *testing.T) {
+	database.SetupMockDB()
+	m := useFakeMailer(t)
+
+	rr := postJSON(handlers.Register, map[string]string{"username": "alice", "email": "alice@example.com", "password": "password123"})
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 Created, got %d", rr.Code)
+	}
+	if m.sent[0].To != "alice@example.com" {
+		t.Errorf("Expected the mail to go to alice@example.com, got %s", m.sent[0].To)
+	}
+	token := mailedToken(t, m)
+
+	if rr := postJSON(handlers.VerifyEmail, map[string]string{"token": token}); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var user models.User
+	database.DB.Where("username = ?", "alice").First(&user)
+	if user.EmailVerifiedAt == nil {
+		t.Error("Expected the email address to be verified")
+	}
+
+	// Tokens are single use
+	if rr := postJSON(handlers.VerifyEmail, map[string]string{"token": token}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected a used token to be refused, got %d", rr.Code)
+	}
+}
+
+func TestPasswordReset(t *testing.T) {
+	database.SetupMockDB()
+	m := useFakeMailer(t)
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("old-password"), bcrypt.MinCost)
+	user := models.User{Username: "alice", Email: "alice@example.com", Password: string(hashedPassword)}
+	database.DB.Create(&user)
+
+	// Unknown addresses get the same answer and no mail
+	if rr := postJSON(handlers.ForgotPassword, map[string]string{"email": "nobody@example.com"}); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK for an unknown address, got %d", rr.Code)
+	}
+	if len(m.sent) != 0 {
+		t.Fatalf("Expected no mail for an unknown address, got %d", len(m.sent))
+	}
+
+	if rr := postJSON(handlers.ForgotPassword, map[string]string{"email": "alice@example.com"}); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d", rr.Code)
+	}
+	token := mailedToken(t, m)
+
+	rr := postJSON(handlers.ResetPassword, map[string]string{"token": token, "password": "new-password"})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	database.DB.First(&user, user.ID)
+	if bcrypt.CompareHashAndPassword([]byte(user.Password), []byte("new-password")) != nil {
+		t.Error("Expected the new password to be set")
+	}
+
+	if rr := postJSON(handlers.ResetPassword, map[string]string{"token": token, "password": "another"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected a used token to be refused, got %d", rr.Code)
+	}
+}
+
+func TestPasswordResetTokenExpires(t *testing.T) {
+	database.SetupMockDB()
+	m := useFakeMailer(t)
+
+	user := models.User{Username: "alice", Email: "alice@example.com", Password: "secret"}
+	database.DB.Create(&user)
+
+	postJSON(handlers.ForgotPassword, map[string]string{"email": "alice@example.com"})
+	token := mailedToken(t, m)
+	database.DB.Model(&models.UserToken{}).Where("user_id = ?", user.ID).Update("expires_at", time.Now().Add(-time.Minute))
+
+	if rr := postJSON(handlers.ResetPassword, map[string]string{"token": token, "password": "new-password"}); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected an expired token to be refused, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// activity - A change to record in a group's activity log
+type activity struct {
+	GroupID  *uint // Changes outside a group (personal expenses) are not logged
+	ActorID  uint  // 0 for changes made by the server itself
+	Action   string
+	TargetID uint
+	Before   interface{} // Snapshots of the target, encoded as JSON; nil when there is none
+	After    interface{}
+}
+
+// recordedKey - Context key of the entries recorded in an activityTransaction
+type recordedKey struct{}
+
+// activityTransaction - Runs fn in a transaction and, once it has committed,
+// publishes the activity it recorded to the real-time streams
+func activityTransaction(fn func(tx *gorm.DB) error) error {
+	var recorded []models.Activity
+	ctx := context.WithValue(context.Background(), recordedKey{}, &recorded)
+	if err := database.DB.WithContext(ctx).Transaction(fn); err != nil {
+		return err
+	}
+	for _, entry := range recorded {
+		Events.Publish(activityEvent(entry))
+	}
+	return nil
+}
+
+// recordActivity - Appends to the group's activity log. Pass the transaction
+// making the change, so the change and its entry are committed together; it
+// is only streamed to clients when that is an activityTransaction.
+func recordActivity(tx *gorm.DB, a activity) error {
+	if a.GroupID == nil {
+		return nil
+	}
+	targetType, _, _ := strings.Cut(a.Action, ".")
+	entry := models.Activity{
+		GroupID:    *a.GroupID,
+		Action:     a.Action,
+		TargetType: targetType,
+		TargetID:   a.TargetID,
+	}
+	if a.ActorID != 0 {
+		entry.ActorID = &a.ActorID
+	}
+
+	for _, s := range []struct {
+		value interface{}
+		dst   *string
+	}{{a.Before, &entry.Before}, {a.After, &entry.After}} {
+		if s.value == nil {
+			continue
+		}
+		data, err := json.Marshal(s.value)
+		if err != nil {
+			return err
+		}
+		*s.dst = string(data)
+	}
+	if err := tx.Create(&entry).Error; err != nil {
+		return err
+	}
+	if err := enqueueWebhooks(tx, entry); err != nil {
+		return err
+	}
+	if recorded, ok := tx.Statement.Context.Value(recordedKey{}).(*[]models.Activity); ok {
+		*recorded = append(*recorded, entry)
+	}
+	return nil
+}
+
+// actorOf - The authenticated caller, recorded as the actor of their changes
+func actorOf(r *http.Request) uint {
+	userID, _ := currentUserID(r)
+	return userID
+}
+
+// idVar - A numeric route variable, or nil if it is missing or invalid
+func idVar(r *http.Request, name string) *uint {
+	id, err := strconv.ParseUint(mux.Vars(r)[name], 10, 64)
+	if err != nil {
+		return nil
+	}
+	v := uint(id)
+	return &v
+}
+
+// Snapshots of the entities logged besides expenses
+type groupSnapshot struct {
+	Name         string `json:"name"`
+	BaseCurrency string `json:"base_currency"`
+}
+
+type threadSnapshot struct {
+	Name    string `json:"name"`
+	GroupID *uint  `json:"group_id"`
+}
+
+type memberSnapshot struct {
+	UserID uint   `json:"user_id"`
+	Role   string `json:"role"`
+}
+
+type commentSnapshot struct {
+	ExpenseID uint   `json:"expense_id"`
+	Body      string `json:"body"`
+}
+
+type invitationSnapshot struct {
+	Email     *string   `json:"email"`
+	MaxUses   int       `json:"max_uses"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// expenseGroupID - The group an expense belongs to, directly or through its thread
+func expenseGroupID(tx *gorm.DB, expense models.Expense) *uint {
+	if expense.GroupID != nil || expense.ThreadID == nil {
+		return expense.GroupID
+	}
+	var groupIDs []uint
+	tx.Unscoped().Model(&models.Thread{}).Where("id = ? AND group_id IS NOT NULL", *expense.ThreadID).Pluck("group_id", &groupIDs)
+	if len(groupIDs) == 0 {
+		return nil
+	}
+	return &groupIDs[0]
+}
+
+// groupOfExpense - The group of the expense with the given ID, if any
+func groupOfExpense(expenseID uint) *uint {
+	var expense models.Expense
+	if err := database.DB.Unscoped().First(&expense, expenseID).Error; err != nil {
+		return nil
+	}
+	return expenseGroupID(database.DB, expense)
+}
+
+// activityResponse - A log entry with its actor's name and decoded snapshots
+type activityResponse struct {
+	ID            uint            `json:"id"`
+	CreatedAt     time.Time       `json:"created_at"`
+	ActorID       *uint           `json:"actor_id"`
+	ActorUsername *string         `json:"actor_username"`
+	Action        string          `json:"action"`
+	TargetType    string          `json:"target_type"`
+	TargetID      uint            `json:"target_id"`
+	Before        json.RawMessage `json:"before"`
+	After         json.RawMessage `json:"after"`
+}
+
+// GetGroupActivity - Lists a group's activity log, newest first, a page at a
+// time. `?actor=` keeps one user's changes and `?action=` one action, either
+// exactly ("expense.deleted") or by target type ("expense").
+func GetGroupActivity(w http.ResponseWriter, r *http.Request) {
+	limit, cursor, err := pageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := database.DB.Table("activities a").
+		Select("a.id, a.created_at, a.actor_id, u.username AS actor_username, a.action, a.target_type, a.target_id, a.before_state, a.after_state").
+		Joins("LEFT JOIN users u ON u.id = a.actor_id").
+		Where("a.group_id = ?", mux.Vars(r)["group_id"])
+	if cursor > 0 {
+		query = query.Where("a.id < ?", cursor)
+	}
+	if actor := r.URL.Query().Get("actor"); actor != "" {
+		actorID, err := strconv.ParseUint(actor, 10, 64)
+		if err != nil {
+			http.Error(w, "actor must be a user ID", http.StatusBadRequest)
+			return
+		}
+		query = query.Where("a.actor_id = ?", actorID)
+	}
+	if action := r.URL.Query().Get("action"); strings.Contains(action, ".") {
+		query = query.Where("a.action = ?", action)
+	} else if action != "" {
+		query = query.Where("a.target_type = ?", action)
+	}
+
+	var rows []struct {
+		ID            uint
+		CreatedAt     time.Time
+		ActorID       *uint
+		ActorUsername *string
+		Action        string
+		TargetType    string
+		TargetID      uint
+		BeforeState   string
+		AfterState    string
+	}
+	if err := query.Order("a.id DESC").Limit(limit + 1).Scan(&rows).Error; err != nil {
+		http.Error(w, "Error retrieving activity", http.StatusInternalServerError)
+		return
+	}
+
+	next := nextCursor(len(rows), limit, func(i int) uint { return rows[i].ID })
+	if next != nil {
+		rows = rows[:limit]
+	}
+	response := make([]activityResponse, len(rows))
+	for i, row := range rows {
+		response[i] = activityResponse{
+			ID:            row.ID,
+			CreatedAt:     row.CreatedAt,
+			ActorID:       row.ActorID,
+			ActorUsername: row.ActorUsername,
+			Action:        row.Action,
+			TargetType:    row.TargetType,
+			TargetID:      row.TargetID,
+			Before:        rawSnapshot(row.BeforeState),
+			After:         rawSnapshot(row.AfterState),
+		}
+	}
+	json.NewEncoder(w).Encode(page{Items: response, NextCursor: next})
+}
+
+// rawSnapshot - A stored snapshot as JSON, null when there is none
+func rawSnapshot(s string) json.RawMessage {
+	if s == "" {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(s)
+}
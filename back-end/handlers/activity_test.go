@@ -0,0 +1,141 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+type activityPage struct {
+	Items []struct {
+		ActorID       *uint                  `json:"actor_id"`
+		ActorUsername *string                `json:"actor_username"`
+		Action        string                 `json:"action"`
+		TargetType    string                 `json:"target_type"`
+		TargetID      uint                   `json:"target_id"`
+		Before        map[string]interface{} `json:"before"`
+		After         map[string]interface{} `json:"after"`
+	} `json:"items"`
+	NextCursor *uint `json:"next_cursor"`
+}
+
+func groupActivity(t *testing.T, groupID, userID uint, query string) activityPage {
+	req, _ := http.NewRequest("GET", "/?"+query, nil)
+	req = mux.SetURLVars(req, map[string]string{"group_id": fmt.Sprint(groupID)})
+	rr := httptest.NewRecorder()
+	handlers.GetGroupActivity(rr, withUser(req, userID))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var page activityPage
+	json.NewDecoder(rr.Body).Decode(&page)
+	return page
+}
+
+func (p activityPage) actions() string {
+	actions := make([]string, len(p.Items))
+	for i, item := range p.Items {
+		actions[i] = item.Action
+	}
+	return strings.Join(actions, ",")
+}
+
+// activityFixture - Bob joins alice's group through a link, then alice adds,
+// edits and deletes an expense
+func activityFixture(t *testing.T) (models.Group, models.User, models.User) {
+	group, alice, bob, _ := invitationFixture(t)
+	token := createInvitation(t, group, alice.ID, `{"max_uses": 5}`)["token"].(string)
+	if rr := answerInvitation(handlers.AcceptInvitation, token, bob.ID); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	createGroupExpense(t, alice.ID, group.ID, "Dinnr", alice.ID, bob.ID)
+	var expense models.Expense
+	database.DB.Last(&expense)
+
+	vars := map[string]string{"expense_id": fmt.Sprint(expense.ID)}
+	req, _ := http.NewRequest("PUT", "/", strings.NewReader(`{"title": "Dinner"}`))
+	rr := httptest.NewRecorder()
+	handlers.UpdateExpense(rr, mux.SetURLVars(withUser(req, alice.ID), vars))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	req, _ = http.NewRequest("DELETE", "/", nil)
+	rr = httptest.NewRecorder()
+	handlers.DeleteExpense(rr, mux.SetURLVars(withUser(req, alice.ID), vars))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	return group, alice, bob
+}
+
+func TestGroupActivityRecordsChanges(t *testing.T) {
+	group, alice, bob := activityFixture(t)
+
+	page := groupActivity(t, group.ID, bob.ID, "")
+	if got := page.actions(); got != "expense.deleted,expense.updated,expense.created,member.joined,invitation.created" {
+		t.Fatalf("Unexpected activity, newest first: %s", got)
+	}
+
+	joined := page.Items[3]
+	if joined.ActorUsername == nil || *joined.ActorUsername != "bob" || joined.TargetType != "member" || joined.TargetID != bob.ID {
+		t.Errorf("Expected bob to be logged joining, got %+v", joined)
+	}
+
+	// Each write keeps the state before and after it
+	updated := page.Items[1]
+	if updated.Before["title"] != "Dinnr" || updated.After["title"] != "Dinner" || *updated.ActorID != alice.ID {
+		t.Errorf("Expected the rename with before/after snapshots, got %+v", updated)
+	}
+	if created := page.Items[2]; created.Before != nil || created.After["title"] != "Dinnr" {
+		t.Errorf("Expected only an after snapshot on creation, got %+v", created)
+	}
+	if deleted := page.Items[0]; deleted.Before["title"] != "Dinner" || deleted.After != nil {
+		t.Errorf("Expected only a before snapshot on deletion, got %+v", deleted)
+	}
+}
+
+func TestGroupActivityFiltersAndPages(t *testing.T) {
+	group, alice, bob := activityFixture(t)
+
+	if got := groupActivity(t, group.ID, alice.ID, fmt.Sprintf("actor=%d", bob.ID)).actions(); got != "member.joined" {
+		t.Errorf("Expected bob's changes only, got %s", got)
+	}
+	if got := groupActivity(t, group.ID, alice.ID, "action=expense").actions(); got != "expense.deleted,expense.updated,expense.created" {
+		t.Errorf("Expected the expense changes, got %s", got)
+	}
+	if got := groupActivity(t, group.ID, alice.ID, "action=expense.updated").actions(); got != "expense.updated" {
+		t.Errorf("Expected the expense update only, got %s", got)
+	}
+
+	req, _ := http.NewRequest("GET", "/?actor=bob", nil)
+	req = mux.SetURLVars(req, map[string]string{"group_id": fmt.Sprint(group.ID)})
+	rr := httptest.NewRecorder()
+	handlers.GetGroupActivity(rr, withUser(req, alice.ID))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a non-numeric actor, got %d", rr.Code)
+	}
+
+	var actions []string
+	cursor := ""
+	for pages := 0; pages < 5; pages++ {
+		page := groupActivity(t, group.ID, alice.ID, "limit=2&cursor="+cursor)
+		actions = append(actions, page.actions())
+		if page.NextCursor == nil {
+			break
+		}
+		cursor = fmt.Sprint(*page.NextCursor)
+	}
+	if got := strings.Join(actions, "|"); got != "expense.deleted,expense.updated|expense.created,member.joined|invitation.created" {
+		t.Errorf("Unexpected pages: %s", got)
+	}
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-auth-app/authz"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// RestoreWindow - How long a deleted group or thread can be restored before it is purged
+var RestoreWindow = 30 * 24 * time.Hour
+
+// ArchiveGroup - Makes a group read-only and hides it from the group list
+func ArchiveGroup(w http.ResponseWriter, r *http.Request) {
+	setArchived(w, r, &models.Group{}, mux.Vars(r)["group_id"], true, "Group archived successfully")
+}
+
+// UnarchiveGroup - Makes an archived group writable again
+func UnarchiveGroup(w http.ResponseWriter, r *http.Request) {
+	setArchived(w, r, &models.Group{}, mux.Vars(r)["group_id"], false, "Group unarchived successfully")
+}
+
+// ArchiveThread - Makes a thread read-only and hides it from the thread list
+func ArchiveThread(w http.ResponseWriter, r *http.Request) {
+	setArchived(w, r, &models.Thread{}, mux.Vars(r)["thread_id"], true, "Thread archived successfully")
+}
+
+// UnarchiveThread - Makes an archived thread writable again
+func UnarchiveThread(w http.ResponseWriter, r *http.Request) {
+	setArchived(w, r, &models.Thread{}, mux.Vars(r)["thread_id"], false, "Thread unarchived successfully")
+}
+
+func setArchived(w http.ResponseWriter, r *http.Request, model interface{}, id string, archived bool, message string) {
+	if err := database.DB.First(model, id).Error; err != nil {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	}
+	a := activity{ActorID: actorOf(r)}
+	switch m := model.(type) {
+	case *models.Group:
+		a.GroupID, a.TargetID, a.Action = &m.ID, m.ID, models.ActionGroupUnarchived
+		if archived {
+			a.Action = models.ActionGroupArchived
+		}
+	case *models.Thread:
+		a.GroupID, a.TargetID, a.Action = m.GroupID, m.ID, models.ActionThreadUnarchived
+		if archived {
+			a.Action = models.ActionThreadArchived
+		}
+	}
+
+	var archivedAt interface{}
+	if archived {
+		archivedAt = time.Now()
+	}
+	err := activityTransaction(func(tx *gorm.DB) error {
+		// Archiving twice keeps the original date, and is logged once
+		query := tx.Model(model).Where("archived_at IS NULL")
+		if !archived {
+			query = tx.Model(model).Where("archived_at IS NOT NULL")
+		}
+		result := query.Update("archived_at", archivedAt)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return recordActivity(tx, a)
+	})
+	if err != nil {
+		fmt.Println("❌ Error archiving:", err)
+		http.Error(w, "Error updating archive status", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// RestoreGroup - Undoes DeleteGroup within the restore window; only the owner may
+func RestoreGroup(w http.ResponseWriter, r *http.Request) {
+	groupID, err := strconv.ParseUint(mux.Vars(r)["group_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	// Deleted groups are invisible to the authorization middleware, so check here
+	var group models.Group
+	if err := database.DB.Unscoped().First(&group, groupID).Error; err != nil || !group.DeletedAt.Valid {
+		http.Error(w, "Deleted group not found", http.StatusNotFound)
+		return
+	}
+	if !authorizeRestore(w, r, authz.Scope{GroupID: &group.ID}, authz.Owner, group.DeletedAt.Time) {
+		return
+	}
+
+	err = activityTransaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Group{}).Where("id = ?", group.ID).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		// Threads deleted on their own before the group stay deleted
+		err := tx.Unscoped().Model(&models.Thread{}).
+			Where("group_id = ? AND deleted_at >= ?", group.ID, group.DeletedAt.Time).
+			Update("deleted_at", nil).Error
+		if err != nil {
+			return err
+		}
+		return recordActivity(tx, activity{GroupID: &group.ID, ActorID: actorOf(r), Action: models.ActionGroupRestored, TargetID: group.ID})
+	})
+	if err != nil {
+		fmt.Println("❌ Error restoring group:", err)
+		http.Error(w, "Error restoring group", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Group restored successfully"})
+}
+
+// RestoreThread - Undoes DeleteThread within the restore window
+func RestoreThread(w http.ResponseWriter, r *http.Request) {
+	threadID, err := strconv.ParseUint(mux.Vars(r)["thread_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid thread ID", http.StatusBadRequest)
+		return
+	}
+
+	var thread models.Thread
+	if err := database.DB.Unscoped().First(&thread, threadID).Error; err != nil || !thread.DeletedAt.Valid {
+		http.Error(w, "Deleted thread not found", http.StatusNotFound)
+		return
+	}
+	scope := authz.Scope{GroupID: thread.GroupID, Owners: []uint{thread.CreatedBy}}
+	if thread.GroupID != nil {
+		// Threads of a deleted group come back with the group
+		if scope, err = authz.GroupScope(*thread.GroupID); err != nil {
+			writeAuthzError(w, err)
+			return
+		}
+		scope.Owners = []uint{thread.CreatedBy}
+	}
+	if !authorizeRestore(w, r, scope, authz.Admin, thread.DeletedAt.Time) {
+		return
+	}
+
+	err = activityTransaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Model(&models.Thread{}).Where("id = ?", thread.ID).Update("deleted_at", nil).Error; err != nil {
+			return err
+		}
+		after := threadSnapshot{Name: thread.Name, GroupID: thread.GroupID}
+		return recordActivity(tx, activity{GroupID: thread.GroupID, ActorID: actorOf(r), Action: models.ActionThreadRestored, TargetID: thread.ID, After: after})
+	})
+	if err != nil {
+		fmt.Println("❌ Error restoring thread:", err)
+		http.Error(w, "Error restoring thread", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Thread restored successfully"})
+}
+
+// authorizeRestore - Checks the caller's access and that the restore window is still open
+func authorizeRestore(w http.ResponseWriter, r *http.Request, scope authz.Scope, level authz.Level, deletedAt time.Time) bool {
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return false
+	}
+	if err := authz.Check(userID, scope, level); err != nil {
+		writeAuthzError(w, err)
+		return false
+	}
+	if time.Since(deletedAt) > RestoreWindow {
+		http.Error(w, "The restore window has passed", http.StatusGone)
+		return false
+	}
+	return true
+}
+
+// groupExpenseIDs - The expenses of a group (both placeholders take its ID),
+// including those created in one of its threads without the group set
+const groupExpenseIDs = "SELECT id FROM expenses WHERE group_id = ? OR thread_id IN (SELECT id FROM threads WHERE group_id = ?)"
+
+// PurgeDeleted - Permanently removes groups and threads deleted before the
+// cutoff, with their expenses. Each one is purged in its own transaction.
+func PurgeDeleted(before time.Time) (int, error) {
+	var groupIDs, threadIDs []uint
+	if err := database.DB.Unscoped().Model(&models.Group{}).Where("deleted_at < ?", before).Pluck("id", &groupIDs).Error; err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, id := range groupIDs {
+		sums := attachmentSums("expense_id IN ("+groupExpenseIDs+")", id, id)
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			return execAll(tx, id,
+				"DELETE FROM expense_participants WHERE expense_id IN ("+groupExpenseIDs+")",
+				"DELETE FROM attachments WHERE expense_id IN ("+groupExpenseIDs+")",
+				"DELETE FROM expense_comments WHERE expense_id IN ("+groupExpenseIDs+")",
+				"DELETE FROM notifications WHERE expense_id IN ("+groupExpenseIDs+")",
+				"DELETE FROM expense_revisions WHERE expense_id IN ("+groupExpenseIDs+")",
+				"DELETE FROM expenses WHERE id IN ("+groupExpenseIDs+")",
+				"DELETE FROM recurring_expenses WHERE group_id = ? OR thread_id IN (SELECT id FROM threads WHERE group_id = ?)",
+				"DELETE FROM threads WHERE group_id = ?",
+				"DELETE FROM group_invitations WHERE group_id = ?",
+				"DELETE FROM group_users WHERE group_id = ?",
+				"DELETE FROM activities WHERE group_id = ?",
+				"DELETE FROM webhook_deliveries WHERE webhook_id IN (SELECT id FROM webhooks WHERE group_id = ?)",
+				"DELETE FROM webhooks WHERE group_id = ?",
+				"DELETE FROM groups WHERE id = ?",
+			)
+		})
+		if err != nil {
+			return purged, fmt.Errorf("purging group %d: %w", id, err)
+		}
+		releaseBlobs(sums)
+		purged++
+	}
+
+	// Threads deleted on their own; those of purged groups are gone already
+	if err := database.DB.Unscoped().Model(&models.Thread{}).Where("deleted_at < ?", before).Pluck("id", &threadIDs).Error; err != nil {
+		return purged, err
+	}
+	for _, id := range threadIDs {
+		sums := attachmentSums("expense_id IN (SELECT id FROM expenses WHERE thread_id = ?)", id)
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			return execAll(tx, id,
+				"DELETE FROM expense_participants WHERE expense_id IN (SELECT id FROM expenses WHERE thread_id = ?)",
+				"DELETE FROM attachments WHERE expense_id IN (SELECT id FROM expenses WHERE thread_id = ?)",
+				"DELETE FROM expense_comments WHERE expense_id IN (SELECT id FROM expenses WHERE thread_id = ?)",
+				"DELETE FROM notifications WHERE expense_id IN (SELECT id FROM expenses WHERE thread_id = ?)",
+				"DELETE FROM expense_revisions WHERE expense_id IN (SELECT id FROM expenses WHERE thread_id = ?)",
+				"DELETE FROM expenses WHERE thread_id = ?",
+				"DELETE FROM recurring_expenses WHERE thread_id = ?",
+				"DELETE FROM threads WHERE id = ?",
+			)
+		})
+		if err != nil {
+			return purged, fmt.Errorf("purging thread %d: %w", id, err)
+		}
+		releaseBlobs(sums)
+		purged++
+	}
+	return purged, nil
+}
+
+// execAll - Runs each statement with the same argument for every placeholder,
+// stopping at the first error
+func execAll(tx *gorm.DB, arg interface{}, statements ...string) error {
+	for _, stmt := range statements {
+		args := make([]interface{}, strings.Count(stmt, "?"))
+		for i := range args {
+			args[i] = arg
+		}
+		if err := tx.Exec(stmt, args...).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// groupRequest - Calls a handler routed by group_id on behalf of the user
+func groupRequest(handler http.HandlerFunc, groupID, userID uint, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"group_id": fmt.Sprint(groupID)})
+	rr := httptest.NewRecorder()
+	handler(rr, withUser(req, userID))
+	return rr
+}
+
+func userGroups(t *testing.T, userID uint, query string) []map[string]interface{} {
+	req, _ := http.NewRequest("GET", "/?"+query, nil)
+	rr := httptest.NewRecorder()
+	handlers.GetUserGroups(rr, withUser(req, userID))
+	var groups []map[string]interface{}
+	if err := json.NewDecoder(rr.Body).Decode(&groups); err != nil {
+		t.Fatalf("Failed to decode groups: %v", err)
+	}
+	return groups
+}
+
+func TestArchiveGroup(t *testing.T) {
+	group, alice, _, _ := invitationFixture(t)
+
+	if rr := groupRequest(handlers.ArchiveGroup, group.ID, alice.ID, ""); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d", rr.Code)
+	}
+
+	// Hidden from the group list unless asked for
+	if groups := userGroups(t, alice.ID, ""); len(groups) != 0 {
+		t.Errorf("Expected the archived group to be hidden, got %v", groups)
+	}
+	groups := userGroups(t, alice.ID, "archived=true")
+	if len(groups) != 1 || groups[0]["archived_at"] == nil {
+		t.Errorf("Expected the archived group with its archive date, got %v", groups)
+	}
+
+	// Read-only: nothing can be added to it
+	body := fmt.Sprintf(`{"name": "Day 2", "group_id": %d}`, group.ID)
+	if rr := groupRequest(handlers.CreateThread, group.ID, alice.ID, body); rr.Code != http.StatusConflict {
+		t.Errorf("Expected creating a thread in an archived group to be refused, got %d", rr.Code)
+	}
+
+	if rr := groupRequest(handlers.UnarchiveGroup, group.ID, alice.ID, ""); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d", rr.Code)
+	}
+	if rr := groupRequest(handlers.CreateThread, group.ID, alice.ID, body); rr.Code != http.StatusCreated {
+		t.Errorf("Expected the unarchived group to be writable again, got %d", rr.Code)
+	}
+}
+
+func TestRestoreGroup(t *testing.T) {
+	group, alice, bob, _ := invitationFixture(t)
+	addMembers(group.ID, bob.ID)
+
+	// A thread deleted on its own stays deleted when the group comes back
+	kept := models.Thread{Name: "Kept", GroupID: &group.ID, CreatedBy: alice.ID}
+	dropped := models.Thread{Name: "Dropped", GroupID: &group.ID, CreatedBy: alice.ID}
+	database.DB.Create(&kept)
+	database.DB.Create(&dropped)
+	database.DB.Delete(&dropped)
+
+	expense := models.Expense{Title: "Fuel", Amount: models.NewMoney(40), PaidBy: alice.ID, GroupID: &group.ID}
+	database.DB.Create(&expense)
+	database.DB.Create(&models.ExpenseParticipant{ExpenseID: expense.ID, UserID: bob.ID, AmountOwed: models.NewMoney(40)})
+
+	if rr := groupRequest(handlers.DeleteGroup, group.ID, alice.ID, ""); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d", rr.Code)
+	}
+
+	// The deleted group's expenses no longer count towards the dashboard
+	req, _ := http.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	handlers.GetDashboardBalances(rr, withUser(req, bob.ID))
+	var dashboard map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&dashboard)
+	if dashboard["total_due"] != 0.0 {
+		t.Errorf("Expected nothing due from a deleted group, got %v", dashboard["total_due"])
+	}
+
+	// Only the owner may restore it
+	if rr := groupRequest(handlers.RestoreGroup, group.ID, bob.ID, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 Forbidden for a member, got %d", rr.Code)
+	}
+	if rr := groupRequest(handlers.RestoreGroup, group.ID, alice.ID, ""); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := groupRequest(handlers.RestoreGroup, group.ID, alice.ID, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected restoring a live group to be not found, got %d", rr.Code)
+	}
+
+	var threads []models.Thread
+	database.DB.Where("group_id = ?", group.ID).Find(&threads)
+	if len(threads) != 1 || threads[0].ID != kept.ID {
+		t.Errorf("Expected only the group's own thread to be restored, got %+v", threads)
+	}
+}
+
+func TestRestoreWindow(t *testing.T) {
+	group, alice, _, _ := invitationFixture(t)
+	database.DB.Model(&models.Group{}).Where("id = ?", group.ID).Update("deleted_at", time.Now().Add(-handlers.RestoreWindow-time.Hour))
+
+	if rr := groupRequest(handlers.RestoreGroup, group.ID, alice.ID, ""); rr.Code != http.StatusGone {
+		t.Errorf("Expected 410 Gone after the restore window, got %d", rr.Code)
+	}
+
+	purged, err := handlers.PurgeDeleted(time.Now().Add(-handlers.RestoreWindow))
+	if err != nil || purged != 1 {
+		t.Fatalf("Expected the group to be purged, got %d, %v", purged, err)
+	}
+	var count int64
+	database.DB.Model(&models.GroupUser{}).Where("group_id = ?", group.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected the memberships to be purged, got %d", count)
+	}
+}
+
+func TestPurgeGroupRemovesThreadExpenses(t *testing.T) {
+	group, alice, bob, _ := invitationFixture(t)
+	addMembers(group.ID, bob.ID)
+	thread := models.Thread{Name: "Trip", GroupID: &group.ID, CreatedBy: alice.ID}
+	database.DB.Create(&thread)
+
+	// Expenses created with only a thread_id used to be stored without their group
+	expense := models.Expense{Title: "Hotel", Amount: models.NewMoney(90), PaidBy: alice.ID, ThreadID: &thread.ID}
+	database.DB.Create(&expense)
+	database.DB.Create(&models.ExpenseParticipant{ExpenseID: expense.ID, UserID: bob.ID, AmountOwed: models.NewMoney(45)})
+	database.DB.Create(&models.ExpenseComment{ExpenseID: expense.ID, AuthorID: bob.ID, Body: "Thanks!"})
+
+	if rr := groupRequest(handlers.DeleteGroup, group.ID, alice.ID, ""); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d", rr.Code)
+	}
+	if _, err := handlers.PurgeDeleted(time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("PurgeDeleted failed: %v", err)
+	}
+
+	for model, query := range map[interface{}]string{
+		&models.Expense{}:            "id = ?",
+		&models.ExpenseParticipant{}: "expense_id = ?",
+		&models.ExpenseComment{}:     "expense_id = ?",
+	} {
+		var count int64
+		database.DB.Unscoped().Model(model).Where(query, expense.ID).Count(&count)
+		if count != 0 {
+			t.Errorf("Expected the thread's expense to be purged, %T has %d rows left", model, count)
+		}
+	}
+
+	req, _ := http.NewRequest("GET", "/", nil)
+	rr := httptest.NewRecorder()
+	handlers.GetDashboardBalances(rr, withUser(req, bob.ID))
+	var dashboard map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&dashboard)
+	if dashboard["total_due"] != 0.0 {
+		t.Errorf("Expected nothing due from a purged group, got %v", dashboard["total_due"])
+	}
+}
@@ -0,0 +1,369 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-auth-app/authz"
+	"go-auth-app/blobstore"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"image"
+	"image/color"
+	_ "image/gif" // Registers the GIF decoder for thumbnails
+	"image/jpeg"
+	_ "image/png" // Registers the PNG decoder for thumbnails
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// Blobs - Where attachment contents are stored; set from the configuration in main
+var Blobs blobstore.Store = blobstore.LocalStore{Dir: "uploads"}
+
+// MaxAttachmentSize - Largest accepted upload, in bytes
+var MaxAttachmentSize int64 = 10 << 20
+
+const (
+	thumbnailSize      = 256        // Thumbnails fit in a square of this many pixels
+	maxThumbnailPixels = 25_000_000 // Larger images are stored without a thumbnail
+)
+
+// attachmentTypes - Accepted uploads, by the content type sniffed from their data
+var attachmentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/gif":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+// Blob keys are derived from the content, so identical files are stored once
+func attachmentKey(sum string) string { return "receipts/" + sum }
+func thumbnailKey(sum string) string  { return "thumbnails/" + sum + ".jpg" }
+
+// UploadAttachment - Attaches a file (multipart field `file`) to an expense.
+// Uploading a file the expense already has returns the existing attachment.
+func UploadAttachment(w http.ResponseWriter, r *http.Request) {
+	expenseID, err := strconv.ParseUint(mux.Vars(r)["expense_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid expense ID", http.StatusBadRequest)
+		return
+	}
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return
+	}
+
+	// Leave room for the multipart headers around the file
+	r.Body = http.MaxBytesReader(w, r.Body, MaxAttachmentSize+1<<20)
+	if err := r.ParseMultipartForm(1 << 20); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			http.Error(w, fmt.Sprintf("The file is larger than %d MB", MaxAttachmentSize>>20), http.StatusRequestEntityTooLarge)
+			return
+		}
+		http.Error(w, "Expected a multipart/form-data upload", http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		http.Error(w, "The upload needs a file field", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, MaxAttachmentSize+1))
+	if err != nil {
+		http.Error(w, "Error reading the upload", http.StatusBadRequest)
+		return
+	}
+	if int64(len(data)) > MaxAttachmentSize {
+		http.Error(w, fmt.Sprintf("The file is larger than %d MB", MaxAttachmentSize>>20), http.StatusRequestEntityTooLarge)
+		return
+	}
+	if len(data) == 0 {
+		http.Error(w, "The file is empty", http.StatusBadRequest)
+		return
+	}
+
+	// Trust the content, not the name or the declared type
+	contentType, _, _ := strings.Cut(http.DetectContentType(data), ";")
+	if !attachmentTypes[contentType] {
+		http.Error(w, "Unsupported file type "+contentType+"; upload a JPEG, PNG, GIF or WebP image, or a PDF", http.StatusUnsupportedMediaType)
+		return
+	}
+	digest := sha256.Sum256(data)
+	sum := hex.EncodeToString(digest[:])
+
+	var existing models.Attachment
+	if err := database.DB.Where("expense_id = ? AND sha256 = ?", expenseID, sum).First(&existing).Error; err == nil {
+		json.NewEncoder(w).Encode(existing)
+		return
+	}
+
+	// The content is stored even when another attachment already has it: keys
+	// are content-addressed, and releasing that attachment may delete it meanwhile
+	lock := blobLock(sum)
+	lock.Lock()
+	defer lock.Unlock()
+	if err := Blobs.Put(attachmentKey(sum), data, contentType); err != nil {
+		fmt.Println("❌ Error storing attachment:", err)
+		http.Error(w, "Error storing attachment", http.StatusInternalServerError)
+		return
+	}
+	hasThumbnail := false
+	if thumbnail, ok := makeThumbnail(data); ok {
+		if err := Blobs.Put(thumbnailKey(sum), thumbnail, "image/jpeg"); err != nil {
+			fmt.Println("⚠️ Error storing thumbnail:", err)
+		} else {
+			hasThumbnail = true
+		}
+	}
+
+	attachment := models.Attachment{
+		ExpenseID:    uint(expenseID),
+		UploadedBy:   userID,
+		FileName:     cleanFileName(header.Filename),
+		ContentType:  contentType,
+		Size:         int64(len(data)),
+		SHA256:       sum,
+		HasThumbnail: hasThumbnail,
+	}
+	groupID := groupOfExpense(attachment.ExpenseID)
+	err = activityTransaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&attachment).Error; err != nil {
+			return err
+		}
+		return recordActivity(tx, activity{GroupID: groupID, ActorID: userID, Action: models.ActionAttachmentAdded, TargetID: attachment.ID, After: attachment})
+	})
+	if err != nil {
+		fmt.Println("❌ Error saving attachment:", err)
+		http.Error(w, "Error saving attachment", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(attachment)
+}
+
+// GetExpenseAttachments - Lists the attachments of an expense
+func GetExpenseAttachments(w http.ResponseWriter, r *http.Request) {
+	var attachments []models.Attachment
+	if err := database.DB.Where("expense_id = ?", mux.Vars(r)["expense_id"]).Order("id").Find(&attachments).Error; err != nil {
+		http.Error(w, "Error retrieving attachments", http.StatusInternalServerError)
+		return
+	}
+
+	if len(attachments) == 0 {
+		json.NewEncoder(w).Encode([]struct{}{})
+		return
+	}
+	json.NewEncoder(w).Encode(attachments)
+}
+
+// DownloadAttachment - Sends the file, or its thumbnail with `?thumbnail=true`
+func DownloadAttachment(w http.ResponseWriter, r *http.Request) {
+	attachment, ok := findAttachment(w, r)
+	if !ok {
+		return
+	}
+
+	key, contentType, fileName := attachmentKey(attachment.SHA256), attachment.ContentType, attachment.FileName
+	if r.URL.Query().Get("thumbnail") == "true" {
+		if !attachment.HasThumbnail {
+			http.Error(w, "This attachment has no thumbnail", http.StatusNotFound)
+			return
+		}
+		key, contentType = thumbnailKey(attachment.SHA256), "image/jpeg"
+		fileName = strings.TrimSuffix(fileName, path.Ext(fileName)) + "-thumbnail.jpg"
+	}
+
+	blob, err := Blobs.Get(key)
+	if errors.Is(err, blobstore.ErrNotFound) {
+		http.Error(w, "Attachment content not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		fmt.Println("❌ Error reading attachment:", err)
+		http.Error(w, "Error reading attachment", http.StatusInternalServerError)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if key == attachmentKey(attachment.SHA256) {
+		w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	}
+	io.Copy(w, blob)
+}
+
+// DeleteAttachment - Removes an attachment. Allowed for its uploader, the
+// expense's payer and creator, and group admins.
+func DeleteAttachment(w http.ResponseWriter, r *http.Request) {
+	attachment, ok := findAttachment(w, r)
+	if !ok {
+		return
+	}
+	scope, err := authz.ExpenseScope(attachment.ExpenseID)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+	scope.Owners = append(scope.Owners, attachment.UploadedBy)
+	if !authorizeScope(w, r, scope, authz.Admin) {
+		return
+	}
+
+	groupID := groupOfExpense(attachment.ExpenseID)
+	err = activityTransaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Delete(&attachment).Error; err != nil {
+			return err
+		}
+		return recordActivity(tx, activity{GroupID: groupID, ActorID: actorOf(r), Action: models.ActionAttachmentDeleted, TargetID: attachment.ID, Before: attachment})
+	})
+	if err != nil {
+		fmt.Println("❌ Error deleting attachment:", err)
+		http.Error(w, "Error deleting attachment", http.StatusInternalServerError)
+		return
+	}
+	releaseBlobs([]string{attachment.SHA256})
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Attachment deleted successfully"})
+}
+
+func findAttachment(w http.ResponseWriter, r *http.Request) (models.Attachment, bool) {
+	vars := mux.Vars(r)
+	var attachment models.Attachment
+	err := database.DB.Where("id = ? AND expense_id = ?", vars["attachment_id"], vars["expense_id"]).First(&attachment).Error
+	if err != nil {
+		http.Error(w, "Attachment not found", http.StatusNotFound)
+		return attachment, false
+	}
+	return attachment, true
+}
+
+// attachmentSums - The content hashes of the attachments matching the condition,
+// to release once they are deleted
+func attachmentSums(query string, args ...interface{}) []string {
+	var sums []string
+	database.DB.Model(&models.Attachment{}).Where(query, args...).Distinct().Pluck("sha256", &sums)
+	return sums
+}
+
+// releaseBlobs - Deletes stored contents no attachment refers to anymore.
+// Failures are only logged: an orphaned blob wastes space but breaks nothing.
+func releaseBlobs(sums []string) {
+	for _, sum := range sums {
+		releaseBlob(sum)
+	}
+}
+
+func releaseBlob(sum string) {
+	lock := blobLock(sum)
+	lock.Lock()
+	defer lock.Unlock()
+
+	var count int64
+	if err := database.DB.Model(&models.Attachment{}).Where("sha256 = ?", sum).Count(&count).Error; err != nil || count > 0 {
+		return
+	}
+	for _, key := range []string{attachmentKey(sum), thumbnailKey(sum)} {
+		if err := Blobs.Delete(key); err != nil {
+			fmt.Println("⚠️ Error deleting blob", key+":", err)
+		}
+	}
+}
+
+// blobLocks - Held while content is stored and its attachment created, or
+// while unreferenced content is deleted, so a deletion never removes the
+// content of an attachment being created. Contents share a lock by their
+// first byte.
+var blobLocks [256]sync.Mutex
+
+func blobLock(sum string) *sync.Mutex {
+	b, _ := strconv.ParseUint(sum[:2], 16, 8)
+	return &blobLocks[b]
+}
+
+// cleanFileName - The base name of an uploaded file, without control or quote characters
+func cleanFileName(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name)
+	if len(name) > 255 {
+		name = name[:255]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "attachment"
+	}
+	return name
+}
+
+// makeThumbnail - A JPEG of the image scaled down to fit thumbnailSize. Returns
+// false for PDFs, WebP (no decoder in the standard library) and huge images.
+func makeThumbnail(data []byte) ([]byte, bool) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || config.Width*config.Height > maxThumbnailPixels {
+		return nil, false
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, false
+	}
+
+	bounds := src.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	tw, th := w, h
+	if w > thumbnailSize || h > thumbnailSize {
+		if w >= h {
+			tw, th = thumbnailSize, max(1, h*thumbnailSize/w)
+		} else {
+			tw, th = max(1, w*thumbnailSize/h), thumbnailSize
+		}
+	}
+
+	// Each thumbnail pixel averages the source pixels it covers, over a white
+	// background since JPEG has no transparency
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := bounds.Min.Y+y*h/th, bounds.Min.Y+max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := bounds.Min.X+x*w/tw, bounds.Min.X+max((x+1)*w/tw, x*w/tw+1)
+			var sr, sg, sb, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					r, g, b, a := src.At(sx, sy).RGBA()
+					white := uint64(0xffff - a)
+					sr, sg, sb, n = sr+uint64(r)+white, sg+uint64(g)+white, sb+uint64(b)+white, n+1
+				}
+			}
+			dst.Set(x, y, color.RGBA64{R: uint16(sr / n), G: uint16(sg / n), B: uint16(sb / n), A: 0xffff})
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80}); err != nil {
+		return nil, false
+	}
+	return buf.Bytes(), true
+}
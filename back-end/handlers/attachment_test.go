@@ -0,0 +1,181 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go-auth-app/blobstore"
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// useLocalBlobs - Stores attachments in a temporary directory for the test
+func useLocalBlobs(t *testing.T) string {
+	dir := t.TempDir()
+	previous := handlers.Blobs
+	handlers.Blobs = blobstore.LocalStore{Dir: dir}
+	t.Cleanup(func() { handlers.Blobs = previous })
+	return dir
+}
+
+func pngImage(t *testing.T, w, h int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		img.Set(x, 0, color.RGBA{R: 200, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatalf("Failed to encode PNG: %v", err)
+	}
+	return buf.Bytes()
+}
+
+// attachmentRequest - Calls an attachment handler on behalf of the user,
+// uploading data as the multipart `file` field when given
+func attachmentRequest(handler http.HandlerFunc, expenseID, attachmentID, userID uint, query string, data []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	contentType := ""
+	if data != nil {
+		mw := multipart.NewWriter(&body)
+		part, _ := mw.CreateFormFile("file", "receipt.png")
+		part.Write(data)
+		mw.Close()
+		contentType = mw.FormDataContentType()
+	}
+	req, _ := http.NewRequest("POST", "/?"+query, &body)
+	req.Header.Set("Content-Type", contentType)
+	req = mux.SetURLVars(req, map[string]string{"expense_id": fmt.Sprint(expenseID), "attachment_id": fmt.Sprint(attachmentID)})
+	rr := httptest.NewRecorder()
+	handler(rr, withUser(req, userID))
+	return rr
+}
+
+func attachmentFixture(t *testing.T) (expense models.Expense, alice, bob, carol models.User) {
+	group, alice, bob, carol := invitationFixture(t)
+	addMembers(group.ID, bob.ID, carol.ID)
+	expense = models.Expense{Title: "Dinner", Amount: models.NewMoney(60), PaidBy: alice.ID, CreatedBy: alice.ID, GroupID: &group.ID}
+	database.DB.Create(&expense)
+	return
+}
+
+func TestUploadAttachment(t *testing.T) {
+	dir := useLocalBlobs(t)
+	expense, alice, bob, _ := attachmentFixture(t)
+	receipt := pngImage(t, 800, 400)
+
+	rr := attachmentRequest(handlers.UploadAttachment, expense.ID, 0, bob.ID, "", receipt)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 Created, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var attachment models.Attachment
+	json.NewDecoder(rr.Body).Decode(&attachment)
+	if attachment.ContentType != "image/png" || attachment.Size != int64(len(receipt)) || !attachment.HasThumbnail {
+		t.Errorf("Unexpected attachment %+v", attachment)
+	}
+
+	// The same file again is the same attachment; on another expense it shares the stored content
+	if rr := attachmentRequest(handlers.UploadAttachment, expense.ID, 0, bob.ID, "", receipt); rr.Code != http.StatusOK {
+		t.Errorf("Expected the duplicate upload to return the existing attachment, got %d", rr.Code)
+	}
+	other := models.Expense{Title: "Taxi", Amount: models.NewMoney(20), PaidBy: alice.ID, GroupID: expense.GroupID}
+	database.DB.Create(&other)
+	if rr := attachmentRequest(handlers.UploadAttachment, other.ID, 0, alice.ID, "", receipt); rr.Code != http.StatusCreated {
+		t.Errorf("Expected 201 Created, got %d", rr.Code)
+	}
+	if files, _ := os.ReadDir(filepath.Join(dir, "receipts")); len(files) != 1 {
+		t.Errorf("Expected the content to be stored once, got %d files", len(files))
+	}
+
+	rr = attachmentRequest(handlers.DownloadAttachment, expense.ID, attachment.ID, alice.ID, "", nil)
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), receipt) {
+		t.Errorf("Expected the original file, got %d with %d bytes", rr.Code, rr.Body.Len())
+	}
+
+	rr = attachmentRequest(handlers.DownloadAttachment, expense.ID, attachment.ID, alice.ID, "thumbnail=true", nil)
+	thumbnail, err := jpeg.Decode(rr.Body)
+	if err != nil {
+		t.Fatalf("Expected a JPEG thumbnail: %v", err)
+	}
+	if size := thumbnail.Bounds().Size(); size.X != 256 || size.Y != 128 {
+		t.Errorf("Expected a 256x128 thumbnail, got %v", size)
+	}
+
+	// Attachments are only found through their own expense
+	if rr := attachmentRequest(handlers.DownloadAttachment, other.ID, attachment.ID, alice.ID, "", nil); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 Not Found, got %d", rr.Code)
+	}
+}
+
+func TestUploadAttachmentValidation(t *testing.T) {
+	useLocalBlobs(t)
+	expense, alice, _, _ := attachmentFixture(t)
+
+	if rr := attachmentRequest(handlers.UploadAttachment, expense.ID, 0, alice.ID, "", []byte("#!/bin/sh\necho hi\n")); rr.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("Expected 415 for a script, got %d", rr.Code)
+	}
+	if rr := attachmentRequest(handlers.UploadAttachment, expense.ID, 0, alice.ID, "", nil); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 without a file, got %d", rr.Code)
+	}
+
+	previous := handlers.MaxAttachmentSize
+	handlers.MaxAttachmentSize = 1024
+	defer func() { handlers.MaxAttachmentSize = previous }()
+	if rr := attachmentRequest(handlers.UploadAttachment, expense.ID, 0, alice.ID, "", bytes.Repeat([]byte("%PDF-1.4\n"), 200)); rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected 413 for a large file, got %d", rr.Code)
+	}
+}
+
+func TestDeleteAttachment(t *testing.T) {
+	dir := useLocalBlobs(t)
+	expense, _, bob, carol := attachmentFixture(t)
+
+	rr := attachmentRequest(handlers.UploadAttachment, expense.ID, 0, bob.ID, "", []byte("%PDF-1.4\nreceipt"))
+	var attachment models.Attachment
+	json.NewDecoder(rr.Body).Decode(&attachment)
+
+	if rr := attachmentRequest(handlers.DeleteAttachment, expense.ID, attachment.ID, carol.ID, "", nil); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 Forbidden for another member, got %d", rr.Code)
+	}
+	if rr := attachmentRequest(handlers.DeleteAttachment, expense.ID, attachment.ID, bob.ID, "", nil); rr.Code != http.StatusOK {
+		t.Fatalf("Expected the uploader to delete it, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// The content goes with its last attachment
+	if _, err := os.Stat(filepath.Join(dir, "receipts", attachment.SHA256)); !os.IsNotExist(err) {
+		t.Errorf("Expected the stored content to be deleted, got %v", err)
+	}
+}
+
+func TestUploadAttachmentRestoresSharedContent(t *testing.T) {
+	dir := useLocalBlobs(t)
+	expense, alice, bob, _ := attachmentFixture(t)
+	receipt := []byte("%PDF-1.4\nshared receipt")
+	attachmentRequest(handlers.UploadAttachment, expense.ID, 0, bob.ID, "", receipt)
+
+	// Releasing the last attachment may delete the content while another
+	// upload of it finds the old row; the upload must store it again
+	os.RemoveAll(filepath.Join(dir, "receipts"))
+	other := models.Expense{Title: "Taxi", Amount: models.NewMoney(20), PaidBy: alice.ID, GroupID: expense.GroupID}
+	database.DB.Create(&other)
+	rr := attachmentRequest(handlers.UploadAttachment, other.ID, 0, alice.ID, "", receipt)
+	var attachment models.Attachment
+	json.NewDecoder(rr.Body).Decode(&attachment)
+
+	rr = attachmentRequest(handlers.DownloadAttachment, other.ID, attachment.ID, alice.ID, "", nil)
+	if rr.Code != http.StatusOK || !bytes.Equal(rr.Body.Bytes(), receipt) {
+		t.Errorf("Expected the new attachment's content to be stored, got %d", rr.Code)
+	}
+}
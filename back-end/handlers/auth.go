@@ -2,18 +2,18 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
+	"go-auth-app/config"
 	"go-auth-app/database"
 	"go-auth-app/models"
 	"net/http"
-	"strconv"
-	"time"
 
 	"github.com/golang-jwt/jwt/v4"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// Define JwtKey for signing tokens
-var JwtKey = []byte("your_secret_key") // Use environment variables in production
+// Define JwtKey for signing tokens; main replaces it with the configured secret at startup
+var JwtKey = []byte(config.DefaultJWTSecret)
 
 type Credentials struct {
 	Username string `json:"username"`
@@ -63,6 +63,11 @@ func Register(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Registration succeeds even if the mail cannot be sent; the user can ask for a new link
+	if err := sendVerificationEmail(user); err != nil {
+		fmt.Println("❌ Error sending verification email:", err)
+	}
+
 	// Respond with success message
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Account successfully created!"})
@@ -79,34 +84,36 @@ func Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Locked accounts are refused before spending time on bcrypt
+	if wait := lockedFor(user); wait > 0 {
+		TooManyRequests(w, wait)
+		return
+	}
+
 	err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(creds.Password))
 	if err != nil {
+		recordLoginFailure(user.ID)
 		http.Error(w, "Invalid username/email or password", http.StatusUnauthorized)
 		return
 	}
 
-	expirationTime := time.Now().Add(1 * time.Hour)
-	claims := &Claims{
-		Username: user.Username,
-		Email:    user.Email,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(expirationTime),
-		},
-	}
-
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString(JwtKey)
-	if err != nil {
-		http.Error(w, "Error generating token", http.StatusInternalServerError)
+	// With 2FA enabled the password alone is not enough; LoginMFA finishes the login
+	if user.TOTPEnabledAt != nil {
+		challenge, err := issueMFAChallenge(user)
+		if err != nil {
+			http.Error(w, "Error generating token", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"mfa_required": true,
+			"mfa_token":    challenge,
+		})
 		return
 	}
 
-	// ✅ Ensure we return a valid JSON response with a string token
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{
-		"token": tokenString,
-		"id":    strconv.FormatUint(uint64(user.ID), 10), // Convert uint to string
-	})
+	// ✅ Respond with a short-lived access token and a refresh token to renew it
+	startSession(w, user)
 }
 
 func Profile(w http.ResponseWriter, r *http.Request) {
@@ -2,6 +2,7 @@ package handlers_test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"go-auth-app/database"
 	"go-auth-app/handlers"
@@ -62,3 +63,15 @@ func TestLogin(t *testing.T) {
 		t.Errorf("Expected 200 OK, got %d", rr.Code)
 	}
 }
+
+// withUser - Simulates AuthMiddleware by storing the user ID in the request context
+func withUser(req *http.Request, userID uint) *http.Request {
+	return req.WithContext(context.WithValue(req.Context(), "user_id", userID))
+}
+
+// addMembers - Adds users to a group as plain members
+func addMembers(groupID uint, userIDs ...uint) {
+	for _, userID := range userIDs {
+		database.DB.Create(&models.GroupUser{GroupID: groupID, UserID: userID, Role: "member"})
+	}
+}
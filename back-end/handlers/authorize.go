@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"go-auth-app/authz"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"net/http"
+)
+
+// currentUserID - The authenticated user stored in the context by AuthMiddleware
+func currentUserID(r *http.Request) (uint, bool) {
+	userID, ok := r.Context().Value("user_id").(uint)
+	return userID, ok
+}
+
+// authorizeScope - Checks the caller may add to a scope: access at the given
+// level, to a scope that is not archived. Writes the error response if denied.
+func authorizeScope(w http.ResponseWriter, r *http.Request, scope authz.Scope, level authz.Level) bool {
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return false
+	}
+	err := authz.Check(userID, scope, level)
+	if err == nil {
+		err = authz.Writable(scope)
+	}
+	if err != nil {
+		writeAuthzError(w, err)
+		return false
+	}
+	return true
+}
+
+// authorizeGroup - Same as authorizeScope for a group ID taken from the request body
+func authorizeGroup(w http.ResponseWriter, r *http.Request, groupID uint, level authz.Level) bool {
+	scope, err := authz.GroupScope(groupID)
+	if err != nil {
+		writeAuthzError(w, err)
+		return false
+	}
+	return authorizeScope(w, r, scope, level)
+}
+
+// resolveExpenseGroup - Works out which group an expense belongs to from its
+// group_id and/or thread_id, and checks the caller is a member of it
+func resolveExpenseGroup(w http.ResponseWriter, r *http.Request, groupID, threadID *uint) (*uint, bool) {
+	if threadID != nil {
+		scope, err := authz.ThreadScope(*threadID)
+		if err != nil {
+			writeAuthzError(w, err)
+			return nil, false
+		}
+		if groupID != nil && (scope.GroupID == nil || *scope.GroupID != *groupID) {
+			http.Error(w, "Thread does not belong to this group", http.StatusBadRequest)
+			return nil, false
+		}
+		if !authorizeScope(w, r, scope, authz.Member) {
+			return nil, false
+		}
+		return scope.GroupID, true
+	}
+
+	if groupID == nil {
+		http.Error(w, "group_id or thread_id is required", http.StatusBadRequest)
+		return nil, false
+	}
+	if !authorizeGroup(w, r, *groupID, authz.Member) {
+		return nil, false
+	}
+	return groupID, true
+}
+
+// checkGroupMembers - Ensures every user ID belongs to the group
+func checkGroupMembers(groupID uint, userIDs []uint) error {
+	var memberIDs []uint
+	if err := database.DB.Model(&models.GroupUser{}).
+		Where("group_id = ? AND user_id IN ?", groupID, userIDs).
+		Pluck("user_id", &memberIDs).Error; err != nil {
+		return err
+	}
+
+	members := make(map[uint]bool)
+	for _, id := range memberIDs {
+		members[id] = true
+	}
+	for _, id := range userIDs {
+		if !members[id] {
+			return fmt.Errorf("User %d is not a member of this group", id)
+		}
+	}
+	return nil
+}
+
+func writeAuthzError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, authz.ErrNotFound):
+		http.Error(w, "Not found", http.StatusNotFound)
+	case errors.Is(err, authz.ErrForbidden):
+		http.Error(w, "Forbidden: you do not have access to this resource", http.StatusForbidden)
+	case errors.Is(err, authz.ErrArchived):
+		http.Error(w, "This group or thread is archived and read-only", http.StatusConflict)
+	default:
+		http.Error(w, "Error checking permissions", http.StatusInternalServerError)
+	}
+}
+
+// resolvePayer - Defaults the payer to the caller. Recording an expense paid by
+// someone else is only allowed when that person is a member of the same group.
+// Returns the payer and the caller, who is recorded as the expense's creator.
+func resolvePayer(w http.ResponseWriter, r *http.Request, paidBy uint, groupID *uint) (uint, uint, bool) {
+	callerID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return 0, 0, false
+	}
+
+	if paidBy == 0 || paidBy == callerID {
+		return callerID, callerID, true
+	}
+	if groupID == nil {
+		http.Error(w, "Forbidden: you can only record expenses you paid yourself outside a group", http.StatusForbidden)
+		return 0, 0, false
+	}
+	if !authz.IsGroupMember(*groupID, paidBy) {
+		http.Error(w, "Payer must be a member of the group", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return paidBy, callerID, true
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"errors"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// ledgerRow - One participant's share of an expense, with what is needed to convert it
+type ledgerRow struct {
+	ExpenseID  uint
+	PaidBy     uint
+	UserID     uint
+	AmountOwed models.Money
+	Currency   string
+	CreatedAt  time.Time
+}
+
+// userBalance - Net position of one user within a group, thread or dashboard
+type userBalance struct {
+	UserID     uint         `json:"user_id"`
+	Username   string       `json:"username"`
+	AmountOwed models.Money `json:"amount_owed"`
+	AmountDue  models.Money `json:"amount_due"`
+	NetBalance models.Money `json:"net_balance"`
+}
+
+// loadLedger - Fetches every participant share of the expenses matching the condition.
+// Expenses of deleted groups and threads no longer count.
+func loadLedger(condition string, args ...interface{}) ([]ledgerRow, error) {
+	var rows []ledgerRow
+	err := database.DB.Raw(`
+		SELECT ep.expense_id, e.paid_by, ep.user_id, ep.amount_owed, e.currency, e.created_at
+		FROM expense_participants ep
+		JOIN expenses e ON ep.expense_id = e.id
+		LEFT JOIN groups g ON e.group_id = g.id
+		LEFT JOIN threads t ON e.thread_id = t.id
+		WHERE g.deleted_at IS NULL AND t.deleted_at IS NULL AND (`+condition+`)`, args...).Scan(&rows).Error
+	return rows, err
+}
+
+// convertLedger - Converts every share into the target currency at the rate of its expense date
+func convertLedger(rows []ledgerRow, currency string) error {
+	converter := newRateConverter(currency)
+	for i := range rows {
+		amount, err := converter.convert(rows[i].AmountOwed, rows[i].Currency, rows[i].CreatedAt)
+		if err != nil {
+			return err
+		}
+		rows[i].AmountOwed = amount
+		rows[i].Currency = currency
+	}
+	return nil
+}
+
+// netBalances - Sums what each user owes and is owed across the ledger.
+// Only users that appear as payer or participant are returned, ordered by user ID.
+func netBalances(rows []ledgerRow) []userBalance {
+	byUser := make(map[uint]*userBalance)
+	get := func(userID uint) *userBalance {
+		if b, ok := byUser[userID]; ok {
+			return b
+		}
+		b := &userBalance{UserID: userID}
+		byUser[userID] = b
+		return b
+	}
+
+	for _, row := range rows {
+		get(row.UserID).AmountOwed += row.AmountOwed
+		get(row.PaidBy).AmountDue += row.AmountOwed
+	}
+
+	var ids []uint
+	for id := range byUser {
+		ids = append(ids, id)
+	}
+	names := usernames(ids)
+
+	balances := make([]userBalance, 0, len(byUser))
+	for _, b := range byUser {
+		b.Username = names[b.UserID]
+		b.NetBalance = b.AmountDue - b.AmountOwed
+		balances = append(balances, *b)
+	}
+	sort.Slice(balances, func(i, j int) bool { return balances[i].UserID < balances[j].UserID })
+	return balances
+}
+
+// usernames - Maps user IDs to usernames
+func usernames(ids []uint) map[uint]string {
+	names := make(map[uint]string)
+	if len(ids) == 0 {
+		return names
+	}
+	var users []struct {
+		ID       uint
+		Username string
+	}
+	database.DB.Table("users").Select("id, username").Where("id IN ?", ids).Scan(&users)
+	for _, u := range users {
+		names[u.ID] = u.Username
+	}
+	return names
+}
+
+// writeBalanceError - Reports a ledger or conversion failure to the client
+func writeBalanceError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errMissingRate) {
+		http.Error(w, "Cannot convert balances: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	http.Error(w, "Failed to retrieve balances from database", http.StatusInternalServerError)
+}
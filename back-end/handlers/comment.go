@@ -0,0 +1,362 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-auth-app/authz"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// maxCommentLength - Longest accepted comment, in characters
+const maxCommentLength = 2000
+
+// commentResponse - A comment with its author's name
+type commentResponse struct {
+	ID             uint       `json:"id"`
+	ExpenseID      uint       `json:"expense_id"`
+	AuthorID       uint       `json:"author_id"`
+	AuthorUsername string     `json:"author_username"`
+	Body           string     `json:"body"`
+	CreatedAt      time.Time  `json:"created_at"`
+	EditedAt       *time.Time `json:"edited_at"`
+}
+
+// CreateComment - Adds a comment to an expense. Group members mentioned as
+// @username are notified.
+func CreateComment(w http.ResponseWriter, r *http.Request) {
+	expenseID, err := strconv.ParseUint(mux.Vars(r)["expense_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid expense ID", http.StatusBadRequest)
+		return
+	}
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return
+	}
+	body, ok := decodeCommentBody(w, r)
+	if !ok {
+		return
+	}
+
+	var expense models.Expense
+	if err := database.DB.First(&expense, expenseID).Error; err != nil {
+		http.Error(w, "Expense not found", http.StatusNotFound)
+		return
+	}
+	mentioned, err := mentionedUsers(expense, body, userID)
+	if err != nil {
+		http.Error(w, "Error resolving mentions", http.StatusInternalServerError)
+		return
+	}
+	groupID := expenseGroupID(database.DB, expense)
+
+	comment := models.ExpenseComment{ExpenseID: expense.ID, AuthorID: userID, Body: body}
+	err = activityTransaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&comment).Error; err != nil {
+			return err
+		}
+		after := commentSnapshot{ExpenseID: expense.ID, Body: body}
+		err := recordActivity(tx, activity{GroupID: groupID, ActorID: userID, Action: models.ActionCommentCreated, TargetID: comment.ID, After: after})
+		if err != nil {
+			return err
+		}
+		return notifyMentions(tx, expense, comment, mentioned)
+	})
+	if err != nil {
+		fmt.Println("❌ Error creating comment:", err)
+		http.Error(w, "Error creating comment", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(findCommentResponse(comment.ID))
+}
+
+// GetExpenseComments - Lists an expense's comments, oldest first, a page at a time
+func GetExpenseComments(w http.ResponseWriter, r *http.Request) {
+	limit, cursor, err := pageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	comments, err := loadComments(limit+1, "c.expense_id = ? AND c.id > ?", mux.Vars(r)["expense_id"], cursor)
+	if err != nil {
+		http.Error(w, "Error retrieving comments", http.StatusInternalServerError)
+		return
+	}
+
+	next := nextCursor(len(comments), limit, func(i int) uint { return comments[i].ID })
+	if next != nil {
+		comments = comments[:limit]
+	}
+	json.NewEncoder(w).Encode(page{Items: comments, NextCursor: next})
+}
+
+// UpdateComment - Edits a comment; only its author may. Members newly
+// mentioned by the edit are notified.
+func UpdateComment(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return
+	}
+	body, ok := decodeCommentBody(w, r)
+	if !ok {
+		return
+	}
+	comment, ok := findComment(w, r)
+	if !ok {
+		return
+	}
+	if comment.AuthorID != userID {
+		http.Error(w, "Only the author can edit a comment", http.StatusForbidden)
+		return
+	}
+
+	var expense models.Expense
+	if err := database.DB.First(&expense, comment.ExpenseID).Error; err != nil {
+		http.Error(w, "Expense not found", http.StatusNotFound)
+		return
+	}
+	before, err := mentionedUsers(expense, comment.Body, userID)
+	if err != nil {
+		http.Error(w, "Error resolving mentions", http.StatusInternalServerError)
+		return
+	}
+	after, err := mentionedUsers(expense, body, userID)
+	if err != nil {
+		http.Error(w, "Error resolving mentions", http.StatusInternalServerError)
+		return
+	}
+	var added []uint
+	for _, id := range after {
+		if !slices.Contains(before, id) {
+			added = append(added, id)
+		}
+	}
+
+	edited := activity{
+		GroupID:  expenseGroupID(database.DB, expense),
+		ActorID:  userID,
+		Action:   models.ActionCommentUpdated,
+		TargetID: comment.ID,
+		Before:   commentSnapshot{ExpenseID: expense.ID, Body: comment.Body},
+		After:    commentSnapshot{ExpenseID: expense.ID, Body: body},
+	}
+	now := time.Now()
+	comment.Body, comment.EditedAt = body, &now
+	err = activityTransaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&comment).Updates(map[string]interface{}{"body": body, "edited_at": now}).Error; err != nil {
+			return err
+		}
+		if err := recordActivity(tx, edited); err != nil {
+			return err
+		}
+		return notifyMentions(tx, expense, comment, added)
+	})
+	if err != nil {
+		fmt.Println("❌ Error updating comment:", err)
+		http.Error(w, "Error updating comment", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(findCommentResponse(comment.ID))
+}
+
+// DeleteComment - Removes a comment. Allowed for its author and group admins.
+func DeleteComment(w http.ResponseWriter, r *http.Request) {
+	comment, ok := findComment(w, r)
+	if !ok {
+		return
+	}
+	scope, err := authz.ExpenseScope(comment.ExpenseID)
+	if err != nil {
+		writeAuthzError(w, err)
+		return
+	}
+	// The expense's payer has no say over other people's comments
+	scope.Owners = []uint{comment.AuthorID}
+	if !authorizeScope(w, r, scope, authz.Admin) {
+		return
+	}
+
+	groupID := groupOfExpense(comment.ExpenseID)
+	err = activityTransaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&comment).Error; err != nil {
+			return err
+		}
+		before := commentSnapshot{ExpenseID: comment.ExpenseID, Body: comment.Body}
+		err := recordActivity(tx, activity{GroupID: groupID, ActorID: actorOf(r), Action: models.ActionCommentDeleted, TargetID: comment.ID, Before: before})
+		if err != nil {
+			return err
+		}
+		return tx.Where("comment_id = ?", comment.ID).Delete(&models.Notification{}).Error
+	})
+	if err != nil {
+		fmt.Println("❌ Error deleting comment:", err)
+		http.Error(w, "Error deleting comment", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Comment deleted successfully"})
+}
+
+func decodeCommentBody(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req struct {
+		Body string `json:"body"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return "", false
+	}
+	body := strings.TrimSpace(req.Body)
+	if body == "" {
+		http.Error(w, "Comment body is required", http.StatusBadRequest)
+		return "", false
+	}
+	if utf8.RuneCountInString(body) > maxCommentLength {
+		http.Error(w, fmt.Sprintf("Comments are limited to %d characters", maxCommentLength), http.StatusBadRequest)
+		return "", false
+	}
+	return body, true
+}
+
+func findComment(w http.ResponseWriter, r *http.Request) (models.ExpenseComment, bool) {
+	vars := mux.Vars(r)
+	var comment models.ExpenseComment
+	err := database.DB.Where("id = ? AND expense_id = ?", vars["comment_id"], vars["expense_id"]).First(&comment).Error
+	if err != nil {
+		http.Error(w, "Comment not found", http.StatusNotFound)
+		return comment, false
+	}
+	return comment, true
+}
+
+func findCommentResponse(commentID uint) commentResponse {
+	comments, _ := loadComments(1, "c.id = ?", commentID)
+	if len(comments) == 0 {
+		return commentResponse{}
+	}
+	return comments[0]
+}
+
+// loadComments - Up to limit comments matching the condition, oldest first
+func loadComments(limit int, query string, args ...interface{}) ([]commentResponse, error) {
+	comments := []commentResponse{}
+	q := database.DB.Table("expense_comments c").
+		Select("c.id, c.expense_id, c.author_id, u.username AS author_username, c.body, c.created_at, c.edited_at").
+		Joins("LEFT JOIN users u ON u.id = c.author_id").
+		Where("c.deleted_at IS NULL").
+		Where(query, args...).
+		Order("c.id")
+	if limit > 0 {
+		q = q.Limit(limit)
+	}
+	err := q.Scan(&comments).Error
+	return comments, err
+}
+
+// commentsByExpense - The comments of each expense, for the expense listings
+func commentsByExpense(expenseIDs []uint) map[uint][]commentResponse {
+	byExpense := map[uint][]commentResponse{}
+	if len(expenseIDs) == 0 {
+		return byExpense
+	}
+	comments, err := loadComments(0, "c.expense_id IN ?", expenseIDs)
+	if err != nil {
+		fmt.Println("❌ Error loading comments:", err)
+		return byExpense
+	}
+	for _, c := range comments {
+		byExpense[c.ExpenseID] = append(byExpense[c.ExpenseID], c)
+	}
+	return byExpense
+}
+
+// mentionedUsers - The people who can see the expense (its group's members, or
+// the participants of a personal expense) that the text mentions as @username,
+// other than the author
+func mentionedUsers(expense models.Expense, text string, authorID uint) ([]uint, error) {
+	if !strings.Contains(text, "@") {
+		return nil, nil
+	}
+
+	var candidates []models.User
+	query := database.DB.Model(&models.User{})
+	if groupID := expenseGroupID(database.DB, expense); groupID != nil {
+		query = query.Where("id IN (SELECT user_id FROM group_users WHERE group_id = ?)", *groupID)
+	} else {
+		query = query.Where("id = ? OR id IN (SELECT user_id FROM expense_participants WHERE expense_id = ?)", expense.PaidBy, expense.ID)
+	}
+	if err := query.Find(&candidates).Error; err != nil {
+		return nil, err
+	}
+
+	lower := strings.ToLower(text)
+	var ids []uint
+	for _, u := range candidates {
+		if u.ID != authorID && u.Username != "" && mentions(lower, strings.ToLower(u.Username)) {
+			ids = append(ids, u.ID)
+		}
+	}
+	return ids, nil
+}
+
+// mentions - Whether the lowercased text contains @username as a whole word
+func mentions(text, username string) bool {
+	token := "@" + username
+	for i := strings.Index(text, token); i >= 0; {
+		end := i + len(token)
+		if end == len(text) || !isUsernameChar(text[end]) {
+			if i == 0 || !isUsernameChar(text[i-1]) {
+				return true
+			}
+		}
+		next := strings.Index(text[i+1:], token)
+		if next < 0 {
+			break
+		}
+		i += next + 1
+	}
+	return false
+}
+
+func isUsernameChar(c byte) bool {
+	return c == '_' || c == '.' || c == '-' || '0' <= c && c <= '9' || 'a' <= c && c <= 'z' || c >= 0x80
+}
+
+// notifyMentions - Notifies each mentioned user about the comment
+func notifyMentions(tx *gorm.DB, expense models.Expense, comment models.ExpenseComment, userIDs []uint) error {
+	if len(userIDs) == 0 {
+		return nil
+	}
+	var author models.User
+	if err := tx.First(&author, comment.AuthorID).Error; err != nil {
+		return err
+	}
+	notifications := make([]models.Notification, len(userIDs))
+	for i, id := range userIDs {
+		notifications[i] = models.Notification{
+			UserID:    id,
+			ActorID:   comment.AuthorID,
+			Type:      models.NotificationMention,
+			GroupID:   expense.GroupID,
+			ExpenseID: &expense.ID,
+			CommentID: &comment.ID,
+			Message:   fmt.Sprintf("%s mentioned you on %q", author.Username, expense.Title),
+		}
+	}
+	return tx.Create(&notifications).Error
+}
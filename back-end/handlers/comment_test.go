@@ -0,0 +1,158 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// commentRequest - Calls a comment handler on behalf of the user
+func commentRequest(handler http.HandlerFunc, expenseID, commentID, userID uint, query, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/?"+query, strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"expense_id": fmt.Sprint(expenseID), "comment_id": fmt.Sprint(commentID)})
+	rr := httptest.NewRecorder()
+	handler(rr, withUser(req, userID))
+	return rr
+}
+
+func postComment(t *testing.T, expenseID, userID uint, body string) map[string]interface{} {
+	rr := commentRequest(handlers.CreateComment, expenseID, 0, userID, "", fmt.Sprintf(`{"body": %q}`, body))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 Created, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var comment map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&comment)
+	return comment
+}
+
+func notificationsOf(userID uint) []models.Notification {
+	var notifications []models.Notification
+	database.DB.Where("user_id = ?", userID).Order("id").Find(&notifications)
+	return notifications
+}
+
+func TestCommentMentions(t *testing.T) {
+	expense, alice, bob, carol := attachmentFixture(t)
+	outsider := models.User{Username: "dave", Email: "dave@example.com", Password: "secret"}
+	database.DB.Create(&outsider)
+
+	comment := postComment(t, expense.ID, alice.ID, "@Bob did this include tip? cc @dave, @alice")
+	if comment["author_username"] != "alice" || comment["body"] != "@Bob did this include tip? cc @dave, @alice" {
+		t.Errorf("Unexpected comment %v", comment)
+	}
+
+	// Only group members are notified, and never the author
+	notifications := notificationsOf(bob.ID)
+	if len(notifications) != 1 || notifications[0].Type != models.NotificationMention || notifications[0].ActorID != alice.ID {
+		t.Fatalf("Expected bob to be notified once, got %+v", notifications)
+	}
+	if len(notificationsOf(outsider.ID)) != 0 || len(notificationsOf(alice.ID)) != 0 {
+		t.Error("Expected no notifications for non-members or the author")
+	}
+
+	// Editing notifies only the newly mentioned
+	commentID := uint(comment["id"].(float64))
+	body := `{"body": "@bob @carol did this include tip?"}`
+	if rr := commentRequest(handlers.UpdateComment, expense.ID, commentID, alice.ID, "", body); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(notificationsOf(bob.ID)) != 1 || len(notificationsOf(carol.ID)) != 1 {
+		t.Errorf("Expected carol alone to get a new notification")
+	}
+
+	// Mark it read
+	req, _ := http.NewRequest("POST", "/", nil)
+	req = mux.SetURLVars(req, map[string]string{"notification_id": fmt.Sprint(notifications[0].ID)})
+	rr := httptest.NewRecorder()
+	handlers.MarkNotificationRead(rr, withUser(req, carol.ID))
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("Expected another user's notification to be not found, got %d", rr.Code)
+	}
+	rr = httptest.NewRecorder()
+	handlers.MarkNotificationRead(rr, withUser(req, bob.ID))
+	if rr.Code != http.StatusOK || notificationsOf(bob.ID)[0].ReadAt == nil {
+		t.Errorf("Expected the notification to be read, got %d", rr.Code)
+	}
+}
+
+func TestCommentMentionsInThread(t *testing.T) {
+	expense, alice, bob, carol := attachmentFixture(t)
+
+	// An expense stored with only its thread still mentions the whole group
+	thread := models.Thread{Name: "Trip", GroupID: expense.GroupID, CreatedBy: alice.ID}
+	database.DB.Create(&thread)
+	database.DB.Model(&expense).Updates(map[string]interface{}{"group_id": nil, "thread_id": thread.ID})
+	database.DB.Create(&models.ExpenseParticipant{ExpenseID: expense.ID, UserID: bob.ID, AmountOwed: models.NewMoney(30)})
+
+	postComment(t, expense.ID, alice.ID, "@carol can you check this?")
+	if len(notificationsOf(carol.ID)) != 1 {
+		t.Errorf("Expected carol to be notified although she is not in the split")
+	}
+}
+
+func TestCommentAuthorChecks(t *testing.T) {
+	expense, alice, bob, carol := attachmentFixture(t)
+	commentID := uint(postComment(t, expense.ID, bob.ID, "Was the tip included?")["id"].(float64))
+
+	// Only the author edits, even the group owner cannot
+	if rr := commentRequest(handlers.UpdateComment, expense.ID, commentID, alice.ID, "", `{"body": "changed"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 Forbidden, got %d", rr.Code)
+	}
+	if rr := commentRequest(handlers.UpdateComment, expense.ID, commentID, bob.ID, "", `{"body": "  "}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected an empty comment to be refused, got %d", rr.Code)
+	}
+
+	// Deleting: the author or an admin, not another member
+	if rr := commentRequest(handlers.DeleteComment, expense.ID, commentID, carol.ID, "", ""); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 Forbidden, got %d", rr.Code)
+	}
+	if rr := commentRequest(handlers.DeleteComment, expense.ID, commentID, alice.ID, "", ""); rr.Code != http.StatusOK {
+		t.Errorf("Expected the owner to delete it, got %d", rr.Code)
+	}
+}
+
+func TestGetExpenseCommentsPaginates(t *testing.T) {
+	expense, alice, bob, _ := attachmentFixture(t)
+	for i := 1; i <= 5; i++ {
+		postComment(t, expense.ID, alice.ID, fmt.Sprintf("Comment %d", i))
+	}
+
+	var bodies []string
+	cursor := ""
+	for pages := 0; pages < 5; pages++ {
+		rr := commentRequest(handlers.GetExpenseComments, expense.ID, 0, bob.ID, "limit=2&cursor="+cursor, "")
+		var page struct {
+			Items      []map[string]interface{} `json:"items"`
+			NextCursor *uint                    `json:"next_cursor"`
+		}
+		json.NewDecoder(rr.Body).Decode(&page)
+		for _, c := range page.Items {
+			bodies = append(bodies, c["body"].(string))
+		}
+		if page.NextCursor == nil {
+			break
+		}
+		cursor = fmt.Sprint(*page.NextCursor)
+	}
+	if strings.Join(bodies, ",") != "Comment 1,Comment 2,Comment 3,Comment 4,Comment 5" {
+		t.Errorf("Unexpected comments across pages: %v", bodies)
+	}
+
+	// Shown inline with the group's expenses
+	rr := groupRequest(handlers.GetGroupExpensesWithDetails, *expense.GroupID, bob.ID, "")
+	var expenses []struct {
+		Comments []map[string]interface{} `json:"comments"`
+	}
+	json.NewDecoder(rr.Body).Decode(&expenses)
+	if len(expenses) != 1 || len(expenses[0].Comments) != 5 {
+		t.Errorf("Expected the expense with its 5 comments, got %+v", expenses)
+	}
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"io"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+// DefaultCurrency is used when neither the request nor the group specifies one
+const DefaultCurrency = "USD"
+
+// rateDateLayout is the date format used for exchange rate payloads and CSV files
+const rateDateLayout = "2006-01-02"
+
+// normalizeCurrency - Upper-cases a currency code and checks it looks like ISO 4217
+func normalizeCurrency(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return "", fmt.Errorf("Invalid currency code %q", code)
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return "", fmt.Errorf("Invalid currency code %q", code)
+		}
+	}
+	return code, nil
+}
+
+// groupBaseCurrency - Looks up the base currency of a group, falling back to the default
+func groupBaseCurrency(groupID interface{}) string {
+	var currency string
+	database.DB.Table("groups").Select("base_currency").Where("id = ?", groupID).Scan(&currency)
+	if currency == "" {
+		return DefaultCurrency
+	}
+	return currency
+}
+
+// expenseCurrency - Resolves the currency for a new expense: explicit value first, then the group's base currency
+func expenseCurrency(requested string, groupID *uint) (string, error) {
+	if requested != "" {
+		return normalizeCurrency(requested)
+	}
+	if groupID != nil {
+		return groupBaseCurrency(*groupID), nil
+	}
+	return DefaultCurrency, nil
+}
+
+// errMissingRate is returned when no exchange rate covers a conversion
+var errMissingRate = errors.New("missing exchange rate")
+
+// rateConverter - Converts amounts into a single target currency using stored rates.
+// Lookups are cached per request since balances convert many rows at once.
+type rateConverter struct {
+	to    string
+	rates map[string][]models.ExchangeRate
+}
+
+func newRateConverter(to string) *rateConverter {
+	return &rateConverter{to: to, rates: make(map[string][]models.ExchangeRate)}
+}
+
+// convert - Converts amount from the given currency using the rate in effect at `at`
+func (c *rateConverter) convert(amount models.Money, from string, at time.Time) (models.Money, error) {
+	if from == "" || from == c.to {
+		return amount, nil
+	}
+
+	rate, err := c.rateAt(from, at)
+	if err != nil {
+		return 0, err
+	}
+	return models.Money(math.Round(float64(amount) * rate)), nil
+}
+
+// rateAt - Finds the latest rate for from→to on or before `at`, using the inverse pair if needed
+func (c *rateConverter) rateAt(from string, at time.Time) (float64, error) {
+	if r, ok := latestRate(c.pair(from, c.to), at); ok {
+		return r, nil
+	}
+	if r, ok := latestRate(c.pair(c.to, from), at); ok && r != 0 {
+		return 1 / r, nil
+	}
+	return 0, fmt.Errorf("%w from %s to %s on %s", errMissingRate, from, c.to, at.Format(rateDateLayout))
+}
+
+// pair - Loads (once) every rate for a currency pair, newest first
+func (c *rateConverter) pair(from, to string) []models.ExchangeRate {
+	key := from + "/" + to
+	if rates, ok := c.rates[key]; ok {
+		return rates
+	}
+	var rates []models.ExchangeRate
+	database.DB.
+		Where("from_currency = ? AND to_currency = ?", from, to).
+		Order("effective_date DESC").
+		Find(&rates)
+	c.rates[key] = rates
+	return rates
+}
+
+func latestRate(rates []models.ExchangeRate, at time.Time) (float64, bool) {
+	for _, r := range rates {
+		if !r.EffectiveDate.After(at) {
+			return r.Rate, true
+		}
+	}
+	return 0, false
+}
+
+// GetExchangeRates - Lists stored exchange rates, optionally filtered by currency
+func GetExchangeRates(w http.ResponseWriter, r *http.Request) {
+	query := database.DB.Model(&models.ExchangeRate{}).Order("effective_date DESC")
+	if from := r.URL.Query().Get("from"); from != "" {
+		query = query.Where("from_currency = ?", strings.ToUpper(from))
+	}
+	if to := r.URL.Query().Get("to"); to != "" {
+		query = query.Where("to_currency = ?", strings.ToUpper(to))
+	}
+
+	var rates []models.ExchangeRate
+	if err := query.Find(&rates).Error; err != nil {
+		http.Error(w, "Error retrieving exchange rates", http.StatusInternalServerError)
+		return
+	}
+
+	if len(rates) == 0 {
+		json.NewEncoder(w).Encode([]struct{}{})
+	} else {
+		json.NewEncoder(w).Encode(rates)
+	}
+}
+
+type exchangeRateInput struct {
+	FromCurrency  string  `json:"from_currency"`
+	ToCurrency    string  `json:"to_currency"`
+	Rate          float64 `json:"rate"`
+	EffectiveDate string  `json:"effective_date"` // YYYY-MM-DD
+}
+
+// ImportExchangeRates - Admin endpoint that stores exchange rates.
+// Accepts a JSON array or a CSV body (from,to,rate,date) with Content-Type text/csv.
+func ImportExchangeRates(w http.ResponseWriter, r *http.Request) {
+	var inputs []exchangeRateInput
+	var err error
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "text/csv") {
+		inputs, err = parseExchangeRateCSV(r.Body)
+	} else {
+		err = json.NewDecoder(r.Body).Decode(&inputs)
+	}
+	if err != nil {
+		http.Error(w, "Invalid request payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(inputs) == 0 {
+		http.Error(w, "No exchange rates provided", http.StatusBadRequest)
+		return
+	}
+
+	// A pair has one rate per day; a later row for the same day replaces it
+	var rates []models.ExchangeRate
+	seen := make(map[string]int)
+	for i, in := range inputs {
+		rate, err := in.toModel()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Rate %d: %v", i+1, err), http.StatusBadRequest)
+			return
+		}
+		key := rate.FromCurrency + "/" + rate.ToCurrency + "/" + rate.EffectiveDate.Format(rateDateLayout)
+		if j, ok := seen[key]; ok {
+			rates[j] = rate
+			continue
+		}
+		seen[key] = len(rates)
+		rates = append(rates, rate)
+	}
+
+	// Importing a rate again updates it
+	err = database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "from_currency"}, {Name: "to_currency"}, {Name: "effective_date"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_at", "deleted_at"}),
+	}).Create(&rates).Error
+	if err != nil {
+		http.Error(w, "Error saving exchange rates", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": fmt.Sprintf("%d exchange rates imported", len(rates)),
+	})
+}
+
+func (in exchangeRateInput) toModel() (models.ExchangeRate, error) {
+	from, err := normalizeCurrency(in.FromCurrency)
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+	to, err := normalizeCurrency(in.ToCurrency)
+	if err != nil {
+		return models.ExchangeRate{}, err
+	}
+	if from == to {
+		return models.ExchangeRate{}, errors.New("from and to currencies must differ")
+	}
+	if math.IsNaN(in.Rate) || math.IsInf(in.Rate, 0) || in.Rate <= 0 {
+		return models.ExchangeRate{}, errors.New("rate must be a finite number greater than zero")
+	}
+	date, err := time.Parse(rateDateLayout, strings.TrimSpace(in.EffectiveDate))
+	if err != nil {
+		return models.ExchangeRate{}, fmt.Errorf("effective_date must be YYYY-MM-DD")
+	}
+	return models.ExchangeRate{FromCurrency: from, ToCurrency: to, Rate: in.Rate, EffectiveDate: date}, nil
+}
+
+// parseExchangeRateCSV - Reads `from,to,rate,date` rows, skipping an optional header row
+func parseExchangeRateCSV(body io.Reader) ([]exchangeRateInput, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = 4
+	reader.TrimLeadingSpace = true
+
+	var inputs []exchangeRateInput
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rate, err := strconv.ParseFloat(record[2], 64)
+		if err != nil {
+			if line == 1 {
+				continue // header row
+			}
+			return nil, fmt.Errorf("line %d: invalid rate %q", line, record[2])
+		}
+		inputs = append(inputs, exchangeRateInput{
+			FromCurrency:  record[0],
+			ToCurrency:    record[1],
+			Rate:          rate,
+			EffectiveDate: record[3],
+		})
+	}
+	return inputs, nil
+}
@@ -0,0 +1,142 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+
+	"github.com/gorilla/mux"
+)
+
+func TestImportExchangeRatesCSV(t *testing.T) {
+	database.SetupMockDB()
+
+	csvBody := "from,to,rate,date\nEUR,USD,1.10,2024-01-01\nGBP,USD,1.25,2024-01-01\n"
+	req, _ := http.NewRequest("POST", "/admin/exchange-rates", strings.NewReader(csvBody))
+	req.Header.Set("Content-Type", "text/csv")
+	rr := httptest.NewRecorder()
+	handlers.ImportExchangeRates(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status code 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var count int64
+	database.DB.Model(&models.ExchangeRate{}).Count(&count)
+	if count != 2 {
+		t.Errorf("Expected 2 exchange rates, got %d", count)
+	}
+
+	// Invalid currency codes are rejected
+	bad, _ := json.Marshal([]map[string]interface{}{
+		{"from_currency": "EURO", "to_currency": "USD", "rate": 1.1, "effective_date": "2024-01-01"},
+	})
+	req, _ = http.NewRequest("POST", "/admin/exchange-rates", bytes.NewReader(bad))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	handlers.ImportExchangeRates(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code 400 for invalid currency, got %d", rr.Code)
+	}
+
+	// Rates that are not finite numbers are rejected
+	for _, rate := range []string{"NaN", "+Inf", "-1"} {
+		req, _ = http.NewRequest("POST", "/admin/exchange-rates", strings.NewReader("EUR,USD,"+rate+",2024-02-01\n"))
+		req.Header.Set("Content-Type", "text/csv")
+		rr = httptest.NewRecorder()
+		handlers.ImportExchangeRates(rr, req)
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected status code 400 for rate %s, got %d", rate, rr.Code)
+		}
+	}
+
+	// Importing a rate again replaces it instead of adding another one
+	req, _ = http.NewRequest("POST", "/admin/exchange-rates", strings.NewReader("EUR,USD,1.20,2024-01-01\nEUR,USD,1.15,2024-01-01\n"))
+	req.Header.Set("Content-Type", "text/csv")
+	rr = httptest.NewRecorder()
+	handlers.ImportExchangeRates(rr, req)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status code 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var rates []models.ExchangeRate
+	database.DB.Where("from_currency = ?", "EUR").Find(&rates)
+	if len(rates) != 1 || rates[0].Rate != 1.15 {
+		t.Errorf("Expected the EUR rate to be updated to 1.15, got %+v", rates)
+	}
+}
+
+func TestGetGroupBalancesConvertsCurrency(t *testing.T) {
+	database.SetupMockDB()
+
+	alice := models.User{Username: "alice", Email: "alice@example.com"}
+	bob := models.User{Username: "bob", Email: "bob@example.com"}
+	database.DB.Create(&alice)
+	database.DB.Create(&bob)
+
+	group := models.Group{Name: "Euro Trip", BaseCurrency: "USD"}
+	database.DB.Create(&group)
+
+	// The rate changed mid-trip; the expense must use the one in effect on its date
+	database.DB.Create(&[]models.ExchangeRate{
+		{FromCurrency: "EUR", ToCurrency: "USD", Rate: 1.10, EffectiveDate: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{FromCurrency: "EUR", ToCurrency: "USD", Rate: 1.50, EffectiveDate: time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)},
+	})
+
+	exp := models.Expense{
+		Title:    "Hotel",
+		Amount:   models.NewMoney(100),
+		Currency: "EUR",
+		PaidBy:   alice.ID,
+		GroupID:  &group.ID,
+	}
+	exp.CreatedAt = time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC)
+	database.DB.Create(&exp)
+	database.DB.Create(&models.ExpenseParticipant{ExpenseID: exp.ID, UserID: bob.ID, AmountOwed: models.NewMoney(100)})
+
+	req, _ := http.NewRequest("GET", "/groups/1/balances", nil)
+	req = mux.SetURLVars(req, map[string]string{"group_id": fmt.Sprintf("%d", group.ID)})
+	rr := httptest.NewRecorder()
+	handlers.GetGroupBalances(rr, req)
+
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var resp []struct {
+		UserID     uint         `json:"user_id"`
+		NetBalance models.Money `json:"net_balance"`
+	}
+	json.NewDecoder(rr.Body).Decode(&resp)
+
+	nets := make(map[uint]models.Money)
+	for _, b := range resp {
+		nets[b.UserID] = b.NetBalance
+	}
+	if nets[alice.ID] != models.NewMoney(110) {
+		t.Errorf("Alice net_balance: expected 110.00, got %s", nets[alice.ID])
+	}
+	if nets[bob.ID] != models.NewMoney(-110) {
+		t.Errorf("Bob net_balance: expected -110.00, got %s", nets[bob.ID])
+	}
+
+	// Without a rate for the currency the balances cannot be computed
+	other := models.Expense{Title: "Souvenir", Amount: models.NewMoney(5), Currency: "JPY", PaidBy: bob.ID, GroupID: &group.ID}
+	database.DB.Create(&other)
+	database.DB.Create(&models.ExpenseParticipant{ExpenseID: other.ID, UserID: alice.ID, AmountOwed: models.NewMoney(5)})
+
+	rr = httptest.NewRecorder()
+	handlers.GetGroupBalances(rr, req)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("Expected status 422 for missing rate, got %d", rr.Code)
+	}
+}
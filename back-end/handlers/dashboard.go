@@ -3,104 +3,120 @@ package handlers
 import (
 	"encoding/json"
 	"go-auth-app/database"
+	"go-auth-app/models"
 	"net/http"
 	"strconv"
 
 	"github.com/gorilla/mux"
 )
 
+// GetDashboardBalances - Balances of the authenticated user against everyone else.
+// The legacy {user_id} path variable is still accepted but must be the caller.
 func GetDashboardBalances(w http.ResponseWriter, r *http.Request) {
-	userIDStr := mux.Vars(r)["user_id"]
-	userID, err := strconv.Atoi(userIDStr)
-	if err != nil {
-		http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
 		return
 	}
 
-	// Struct for overall balance totals
-	var balanceTotals struct {
-		TotalOwed  float64
-		TotalDue   float64
-		NetBalance float64
+	if userIDStr, ok := mux.Vars(r)["user_id"]; ok {
+		requested, err := strconv.Atoi(userIDStr)
+		if err != nil {
+			http.Error(w, "Invalid user ID format", http.StatusBadRequest)
+			return
+		}
+		if uint(requested) != userID {
+			http.Error(w, "Forbidden: you can only view your own dashboard", http.StatusForbidden)
+			return
+		}
 	}
 
-	// Query for overall balances
-	result := database.DB.Raw(`
-		WITH UserOwes AS (
-			SELECT ep.user_id AS user_id, SUM(ep.amount_owed) AS amount_owed
-			FROM expense_participants ep
-			JOIN expenses e ON ep.expense_id = e.id
-			WHERE e.paid_by = ?
-			GROUP BY ep.user_id
-		),
-		UserIsOwed AS (
-			SELECT e.paid_by AS user_id, SUM(ep.amount_owed) AS amount_due
-			FROM expense_participants ep
-			JOIN expenses e ON ep.expense_id = e.id
-			WHERE ep.user_id = ?
-			GROUP BY e.paid_by
-		)
-		SELECT 
-			COALESCE(SUM(owes.amount_owed), 0) AS total_owed,
-			COALESCE(SUM(owed.amount_due), 0) AS total_due,
-			COALESCE(SUM(owed.amount_due), 0) - COALESCE(SUM(owes.amount_owed), 0) AS net_balance
-		FROM UserOwes owes
-		LEFT JOIN UserIsOwed owed ON owes.user_id = owed.user_id
-	`, userID, userID).Scan(&balanceTotals)
+	var err error
+
+	// Balances are reported in a single currency, USD unless asked otherwise
+	currency := DefaultCurrency
+	if requested := r.URL.Query().Get("currency"); requested != "" {
+		if currency, err = normalizeCurrency(requested); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
 
-	if result.Error != nil {
-		http.Error(w, "Failed to retrieve overall balances from database", http.StatusInternalServerError)
+	// Every share the user paid for or owes, converted at each expense's date
+	rows, err := loadLedger("e.paid_by = ? OR ep.user_id = ?", userID, userID)
+	if err == nil {
+		err = convertLedger(rows, currency)
+	}
+	if err != nil {
+		writeBalanceError(w, err)
 		return
 	}
 
-	// Struct for per-user balances
-	var userBalances []struct {
-		UserID     uint    `json:"user_id"`
-		Username   string  `json:"username"`
-		AmountOwed float64 `json:"amount_owed"`
-		AmountDue  float64 `json:"amount_due"`
-		NetBalance float64 `json:"net_balance"`
+	// Struct for overall balance totals
+	var balanceTotals struct {
+		TotalOwed  models.Money
+		TotalDue   models.Money
+		NetBalance models.Money
 	}
 
-	// Query for individual user balances
-	result = database.DB.Raw(`
-		WITH UserOwes AS (
-			SELECT ep.user_id AS user_id, SUM(ep.amount_owed) AS amount_owed
-			FROM expense_participants ep
-			JOIN expenses e ON ep.expense_id = e.id
-			WHERE e.paid_by = ?
-			GROUP BY ep.user_id
-		),
-		UserIsOwed AS (
-			SELECT e.paid_by AS user_id, SUM(ep.amount_owed) AS amount_due
-			FROM expense_participants ep
-			JOIN expenses e ON ep.expense_id = e.id
-			WHERE ep.user_id = ?
-			GROUP BY e.paid_by
-		)
-		SELECT 
-			u.id AS user_id,
-			u.username AS username,
-			COALESCE(owes.amount_owed, 0) AS amount_owed,
-			COALESCE(owed.amount_due, 0) AS amount_due,
-			COALESCE(owed.amount_due, 0) - COALESCE(owes.amount_owed, 0) AS net_balance
-		FROM users u
-		LEFT JOIN UserOwes owes ON u.id = owes.user_id
-		LEFT JOIN UserIsOwed owed ON u.id = owed.user_id
-	`, userID, userID).Scan(&userBalances)
+	// Per-user totals: what they owe on expenses this user paid, and what this user owes them
+	owes := make(map[uint]models.Money)
+	owed := make(map[uint]models.Money)
+	for _, row := range rows {
+		if row.PaidBy == userID {
+			owes[row.UserID] += row.AmountOwed
+			balanceTotals.TotalOwed += row.AmountOwed
+		}
+		if row.UserID == userID {
+			owed[row.PaidBy] += row.AmountOwed
+			balanceTotals.TotalDue += row.AmountOwed
+		}
+	}
+	balanceTotals.NetBalance = balanceTotals.TotalDue - balanceTotals.TotalOwed
 
-	if result.Error != nil {
+	var users []struct {
+		ID       uint
+		Username string
+	}
+	// Only the people the user shares a balance or a group with, never the whole user table
+	related := []uint{userID}
+	for id := range owes {
+		related = append(related, id)
+	}
+	for id := range owed {
+		related = append(related, id)
+	}
+	coMembers := database.DB.Table("group_users").Select("user_id").
+		Where("group_id IN (?)", database.DB.Table("group_users").Select("group_id").Where("user_id = ?", userID))
+	err = database.DB.Table("users").Select("id, username").
+		Where("id IN ? OR id IN (?)", related, coMembers).
+		Order("id").Scan(&users).Error
+	if err != nil {
 		http.Error(w, "Failed to retrieve user balances from database", http.StatusInternalServerError)
 		return
 	}
 
+	// Struct for per-user balances
+	var userBalances []userBalance
+	for _, u := range users {
+		userBalances = append(userBalances, userBalance{
+			UserID:     u.ID,
+			Username:   u.Username,
+			AmountOwed: owes[u.ID],
+			AmountDue:  owed[u.ID],
+			NetBalance: owed[u.ID] - owes[u.ID],
+		})
+	}
+
 	// Construct final response
 	response := struct {
-		TotalOwed  float64     `json:"total_owed"`
-		TotalDue   float64     `json:"total_due"`
-		NetBalance float64     `json:"net_balance"`
-		Users      interface{} `json:"users"` // Allow empty array override
+		Currency   string       `json:"currency"`
+		TotalOwed  models.Money `json:"total_owed"`
+		TotalDue   models.Money `json:"total_due"`
+		NetBalance models.Money `json:"net_balance"`
+		Users      interface{}  `json:"users"` // Allow empty array override
 	}{
+		Currency:   currency,
 		TotalOwed:  balanceTotals.TotalOwed,
 		TotalDue:   balanceTotals.TotalDue,
 		NetBalance: balanceTotals.NetBalance,
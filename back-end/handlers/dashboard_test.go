@@ -24,7 +24,7 @@ func TestGetDashboardBalances(t *testing.T) {
 	// Create test expense
 	expense := models.Expense{
 		Title:  "Test Expense",
-		Amount: 100,
+		Amount: models.NewMoney(100),
 		PaidBy: user1.ID,
 	}
 	database.DB.Create(&expense)
@@ -38,6 +38,7 @@ func TestGetDashboardBalances(t *testing.T) {
 
 	req, _ := http.NewRequest("GET", "/api/dashboard/balances/{user_id}", nil)
 	req = mux.SetURLVars(req, map[string]string{"user_id": "1"})
+	req = withUser(req, user1.ID)
 
 	rr := httptest.NewRecorder()
 	handlers.GetDashboardBalances(rr, req)
@@ -53,3 +54,49 @@ func TestGetDashboardBalances(t *testing.T) {
 		t.Errorf("Expected total_owed field in response")
 	}
 }
+
+func TestGetDashboardBalancesOtherUserForbidden(t *testing.T) {
+	database.SetupMockDB()
+
+	req, _ := http.NewRequest("GET", "/api/dashboard/balances/2", nil)
+	req = mux.SetURLVars(req, map[string]string{"user_id": "2"})
+	req = withUser(req, 1)
+
+	rr := httptest.NewRecorder()
+	handlers.GetDashboardBalances(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 Forbidden, got %d", rr.Code)
+	}
+}
+
+func TestGetDashboardBalancesOnlyListsRelatedUsers(t *testing.T) {
+	group, alice, bob, carol := invitationFixture(t)
+	addMembers(group.ID, bob.ID)
+	stranger := models.User{Username: "mallory", Email: "mallory@example.com"}
+	database.DB.Create(&stranger)
+
+	// Carol shares no group with alice but split a personal expense with her
+	expense := models.Expense{Title: "Taxi", Amount: models.NewMoney(20), PaidBy: carol.ID}
+	database.DB.Create(&expense)
+	database.DB.Create(&models.ExpenseParticipant{ExpenseID: expense.ID, UserID: alice.ID, AmountOwed: models.NewMoney(10)})
+
+	req, _ := http.NewRequest("GET", "/api/dashboard/balances", nil)
+	rr := httptest.NewRecorder()
+	handlers.GetDashboardBalances(rr, withUser(req, alice.ID))
+	var response struct {
+		Users []struct {
+			UserID   uint   `json:"user_id"`
+			Username string `json:"username"`
+		} `json:"users"`
+	}
+	json.NewDecoder(rr.Body).Decode(&response)
+
+	listed := map[uint]bool{}
+	for _, u := range response.Users {
+		listed[u.UserID] = true
+	}
+	if !listed[alice.ID] || !listed[bob.ID] || !listed[carol.ID] || listed[stranger.ID] {
+		t.Errorf("Expected alice, bob and carol but not mallory, got %+v", response.Users)
+	}
+}
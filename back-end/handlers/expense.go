@@ -2,20 +2,27 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"go-auth-app/authz"
 	"go-auth-app/database"
 	"go-auth-app/models"
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 )
 
 // CreatePersonalExpense - Creates an expense between users (not in a group or thread)
 func CreatePersonalExpense(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Title     string  `json:"title"`
-		Amount    float64 `json:"amount"`
-		PaidBy    uint    `json:"paid_by"`
-		SplitWith []uint  `json:"split_with"` // Includes payer as well
+		Title     string       `json:"title"`
+		Amount    models.Money `json:"amount"`
+		Currency  string       `json:"currency"`
+		PaidBy    uint         `json:"paid_by"`
+		SplitType string       `json:"split_type"`
+		SplitWith []uint       `json:"split_with"` // Includes payer as well
+		Splits    []SplitEntry `json:"splits"`
 	}
 
 	// Decode JSON request
@@ -24,16 +31,23 @@ func CreatePersonalExpense(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Validate input
-	if req.Amount <= 0 || len(req.SplitWith) == 0 {
-		http.Error(w, "Invalid amount or participants", http.StatusBadRequest)
+	// Outside a group the caller is always the payer
+	paidBy, createdBy, ok := resolvePayer(w, r, req.PaidBy, nil)
+	if !ok {
+		return
+	}
+
+	// Work out what each participant owes
+	participants, err := computeSplit(req.Amount, paidBy, req.SplitType, req.SplitWith, req.Splits)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Ensure the payer is in the `split_with` list
+	// Ensure the payer is one of the participants
 	found := false
-	for _, userID := range req.SplitWith {
-		if userID == req.PaidBy {
+	for _, p := range participants {
+		if p.UserID == paidBy {
 			found = true
 			break
 		}
@@ -43,34 +57,27 @@ func CreatePersonalExpense(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Create the expense record
-	expense := models.Expense{
-		Title:  req.Title,
-		Amount: req.Amount,
-		PaidBy: req.PaidBy,
-	}
-	if err := database.DB.Create(&expense).Error; err != nil {
-		http.Error(w, "Error creating expense", http.StatusInternalServerError)
+	currency, err := expenseCurrency(req.Currency, nil)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Calculate the equal split amount
-	splitCount := float64(len(req.SplitWith))
-	splitAmount := req.Amount / splitCount
-
-	// Add each participant (including payer) to `expense_participants`
-	var participants []models.ExpenseParticipant
-	for _, userID := range req.SplitWith {
-		participants = append(participants, models.ExpenseParticipant{
-			ExpenseID:  expense.ID,
-			UserID:     userID,
-			AmountOwed: splitAmount,
-		})
+	// Create the expense record
+	expense := models.Expense{
+		Title:     req.Title,
+		Amount:    req.Amount,
+		Currency:  currency,
+		PaidBy:    paidBy,
+		CreatedBy: createdBy,
 	}
-
-	// Insert participants into expense_participants table
-	if err := database.DB.Create(&participants).Error; err != nil {
-		http.Error(w, "Error assigning participants to expense", http.StatusInternalServerError)
+	// Insert the expense and its participants (including payer) together
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		return insertExpense(tx, &expense, participants)
+	})
+	if err != nil {
+		fmt.Println("❌ Error creating personal expense:", err)
+		http.Error(w, "Error creating expense", http.StatusInternalServerError)
 		return
 	}
 
@@ -82,12 +89,15 @@ func CreatePersonalExpense(w http.ResponseWriter, r *http.Request) {
 // CreateExpense - Adds an expense under a group/thread
 func CreateExpense(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Title     string  `json:"title"`
-		Amount    float64 `json:"amount"`
-		PaidBy    uint    `json:"paid_by"`
-		GroupID   *uint   `json:"group_id"`
-		ThreadID  *uint   `json:"thread_id"`
-		SplitWith []uint  `json:"split_with"`
+		Title     string       `json:"title"`
+		Amount    models.Money `json:"amount"`
+		Currency  string       `json:"currency"`
+		PaidBy    uint         `json:"paid_by"`
+		GroupID   *uint        `json:"group_id"`
+		ThreadID  *uint        `json:"thread_id"`
+		SplitType string       `json:"split_type"`
+		SplitWith []uint       `json:"split_with"`
+		Splits    []SplitEntry `json:"splits"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -95,39 +105,288 @@ func CreateExpense(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	expense := models.Expense{
-		Title:    req.Title,
-		Amount:   req.Amount,
-		PaidBy:   req.PaidBy,
-		GroupID:  req.GroupID,
-		ThreadID: req.ThreadID,
+	// Only members may add expenses, and only between members of the group
+	groupID, ok := resolveExpenseGroup(w, r, req.GroupID, req.ThreadID)
+	if !ok {
+		return
 	}
-	if err := database.DB.Create(&expense).Error; err != nil {
-		http.Error(w, "Error creating expense", http.StatusInternalServerError)
+
+	// The caller pays unless they record a payment made by another member
+	paidBy, createdBy, ok := resolvePayer(w, r, req.PaidBy, groupID)
+	if !ok {
 		return
 	}
 
 	// Split the expense among participants
-	splitAmount := req.Amount / float64(len(req.SplitWith))
-	var participants []models.ExpenseParticipant
-	for _, userID := range req.SplitWith {
-		participants = append(participants, models.ExpenseParticipant{
-			ExpenseID:  expense.ID,
-			UserID:     userID,
-			AmountOwed: splitAmount,
-		})
+	participants, err := computeSplit(req.Amount, paidBy, req.SplitType, req.SplitWith, req.Splits)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if groupID != nil {
+		var userIDs []uint
+		for _, p := range participants {
+			userIDs = append(userIDs, p.UserID)
+		}
+		if err := checkGroupMembers(*groupID, userIDs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Default to the group's base currency
+	currency, err := expenseCurrency(req.Currency, groupID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	expense := models.Expense{
+		Title:     req.Title,
+		Amount:    req.Amount,
+		Currency:  currency,
+		PaidBy:    paidBy,
+		CreatedBy: createdBy,
+		GroupID:   groupID, // Also set for expenses created in a thread
+		ThreadID:  req.ThreadID,
+	}
+	err = activityTransaction(func(tx *gorm.DB) error {
+		return createExpense(tx, &expense, participants, activity{GroupID: groupID, ActorID: createdBy, Action: models.ActionExpenseCreated})
+	})
+	if err != nil {
+		fmt.Println("❌ Error creating expense:", err)
+		http.Error(w, "Error creating expense", http.StatusInternalServerError)
+		return
 	}
-	database.DB.Create(&participants)
 
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Expense added successfully"})
 }
 
+// insertExpense - Creates an expense and its participants; callers run it inside a transaction
+func insertExpense(tx *gorm.DB, expense *models.Expense, participants []models.ExpenseParticipant) error {
+	if err := tx.Create(expense).Error; err != nil {
+		return err
+	}
+	for i := range participants {
+		participants[i].ExpenseID = expense.ID
+	}
+	return tx.Create(&participants).Error
+}
+
+// createExpense - Inserts an expense and records it in its group's activity log
+func createExpense(tx *gorm.DB, expense *models.Expense, participants []models.ExpenseParticipant, a activity) error {
+	if err := insertExpense(tx, expense, participants); err != nil {
+		return err
+	}
+	after, err := snapshotExpense(tx, *expense)
+	if err != nil {
+		return err
+	}
+	a.TargetID, a.After = expense.ID, after
+	return recordActivity(tx, a)
+}
+
+// UpdateExpense - Edits an expense and atomically replaces its split.
+// The previous version is kept in the expense's revision history.
+func UpdateExpense(w http.ResponseWriter, r *http.Request) {
+	expenseID := mux.Vars(r)["expense_id"]
+
+	callerID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return
+	}
+
+	// Every field is optional; only the ones sent are changed
+	var req struct {
+		Title     *string       `json:"title"`
+		Amount    *models.Money `json:"amount"`
+		Currency  *string       `json:"currency"`
+		PaidBy    *uint         `json:"paid_by"`
+		ThreadID  *uint         `json:"thread_id"` // 0 moves the expense out of its thread
+		SplitType string        `json:"split_type"`
+		SplitWith []uint        `json:"split_with"`
+		Splits    []SplitEntry  `json:"splits"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	var expense models.Expense
+	if err := database.DB.First(&expense, expenseID).Error; err != nil {
+		http.Error(w, "Expense not found", http.StatusNotFound)
+		return
+	}
+
+	before, err := snapshotExpense(database.DB, expense)
+	if err != nil {
+		http.Error(w, "Error loading expense", http.StatusInternalServerError)
+		return
+	}
+
+	// The group the expense belongs to, directly or through its thread
+	groupID := expense.GroupID
+	if groupID == nil && expense.ThreadID != nil {
+		if scope, err := authz.ThreadScope(*expense.ThreadID); err == nil {
+			groupID = scope.GroupID
+		}
+	}
+
+	if req.Title != nil {
+		if *req.Title == "" {
+			http.Error(w, "Title cannot be empty", http.StatusBadRequest)
+			return
+		}
+		expense.Title = *req.Title
+	}
+
+	if req.Currency != nil {
+		if expense.Currency, err = normalizeCurrency(*req.Currency); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Expenses can move between threads, but not out of their group
+	if req.ThreadID != nil {
+		if *req.ThreadID == 0 {
+			if groupID == nil {
+				http.Error(w, "Expense has no group to move to", http.StatusBadRequest)
+				return
+			}
+			expense.ThreadID = nil
+			expense.GroupID = groupID
+		} else {
+			scope, err := authz.ThreadScope(*req.ThreadID)
+			if err != nil {
+				writeAuthzError(w, err)
+				return
+			}
+			if groupID == nil || scope.GroupID == nil || *scope.GroupID != *groupID {
+				http.Error(w, "Thread does not belong to this expense's group", http.StatusBadRequest)
+				return
+			}
+			// The route only checked the thread it leaves
+			if !authorizeScope(w, r, scope, authz.Member) {
+				return
+			}
+			expense.ThreadID = req.ThreadID
+			expense.GroupID = groupID
+		}
+	}
+
+	if req.PaidBy != nil && *req.PaidBy != expense.PaidBy {
+		paidBy, _, ok := resolvePayer(w, r, *req.PaidBy, groupID)
+		if !ok {
+			return
+		}
+		expense.PaidBy = paidBy
+	}
+
+	if req.Amount != nil {
+		expense.Amount = *req.Amount
+	}
+
+	// Work out the new split: an explicit one, or the old proportions scaled to the new amount
+	var participants []models.ExpenseParticipant
+	switch {
+	case req.SplitType != "" || len(req.SplitWith) > 0 || len(req.Splits) > 0:
+		participants, err = computeSplit(expense.Amount, expense.PaidBy, req.SplitType, req.SplitWith, req.Splits)
+	case expense.Amount != before.Amount:
+		var splits []SplitEntry
+		for _, p := range before.Participants {
+			splits = append(splits, SplitEntry{UserID: p.UserID, Shares: float64(p.AmountOwed)})
+		}
+		participants, err = computeSplit(expense.Amount, expense.PaidBy, SplitShares, nil, splits)
+	default:
+		for _, p := range before.Participants {
+			participants = append(participants, models.ExpenseParticipant{UserID: p.UserID, AmountOwed: p.AmountOwed})
+		}
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if groupID != nil {
+		var userIDs []uint
+		for _, p := range participants {
+			userIDs = append(userIDs, p.UserID)
+		}
+		if err := checkGroupMembers(*groupID, userIDs); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	// Save the expense, swap its split and record the revision in one go
+	err = activityTransaction(func(tx *gorm.DB) error {
+		if err := tx.Save(&expense).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("expense_id = ?", expense.ID).Delete(&models.ExpenseParticipant{}).Error; err != nil {
+			return err
+		}
+		for i := range participants {
+			participants[i].ExpenseID = expense.ID
+		}
+		if len(participants) > 0 {
+			if err := tx.Create(&participants).Error; err != nil {
+				return err
+			}
+		}
+
+		after, err := snapshotExpense(tx, expense)
+		if err != nil {
+			return err
+		}
+		if len(changedFields(before, after)) == 0 {
+			return nil
+		}
+		if err := recordRevision(tx, expense.ID, callerID, before, after); err != nil {
+			return err
+		}
+		return recordActivity(tx, activity{GroupID: groupID, ActorID: callerID, Action: models.ActionExpenseUpdated, TargetID: expense.ID, Before: before, After: after})
+	})
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		// Another edit recorded the same revision first
+		http.Error(w, "The expense was changed at the same time; reload it and try again", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Error updating expense", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Expense updated successfully"})
+}
+
 // SettleExpense - Marks an expense as settled
 func SettleExpense(w http.ResponseWriter, r *http.Request) {
-	expenseID := mux.Vars(r)["expense_id"]
+	var expense models.Expense
+	if err := database.DB.First(&expense, mux.Vars(r)["expense_id"]).Error; err != nil {
+		http.Error(w, "Expense not found", http.StatusNotFound)
+		return
+	}
+	before, err := snapshotExpense(database.DB, expense)
+	if err != nil {
+		http.Error(w, "Error loading expense", http.StatusInternalServerError)
+		return
+	}
+	groupID := expenseGroupID(database.DB, expense)
 
-	if err := database.DB.Delete(&models.ExpenseParticipant{}, "expense_id = ?", expenseID).Error; err != nil {
+	err = activityTransaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.ExpenseParticipant{}, "expense_id = ?", expense.ID).Error; err != nil {
+			return err
+		}
+		return recordActivity(tx, activity{GroupID: groupID, ActorID: actorOf(r), Action: models.ActionExpenseSettled, TargetID: expense.ID, Before: before})
+	})
+	if err != nil {
+		fmt.Println("❌ Error settling expense:", err)
 		http.Error(w, "Error settling expense", http.StatusInternalServerError)
 		return
 	}
@@ -140,14 +399,42 @@ func SettleExpense(w http.ResponseWriter, r *http.Request) {
 func DeleteExpense(w http.ResponseWriter, r *http.Request) {
 	expenseID := mux.Vars(r)["expense_id"]
 
-	// Delete related records first
-	database.DB.Exec("DELETE FROM expense_participants WHERE expense_id = ?", expenseID)
+	callerID, _ := currentUserID(r) // Authenticated by the router
+	var expense models.Expense
+	if err := database.DB.First(&expense, expenseID).Error; err != nil {
+		http.Error(w, "Expense not found", http.StatusNotFound)
+		return
+	}
+	before, err := snapshotExpense(database.DB, expense)
+	if err != nil {
+		http.Error(w, "Error loading expense", http.StatusInternalServerError)
+		return
+	}
+	groupID := expenseGroupID(database.DB, expense)
+	sums := attachmentSums("expense_id = ?", expenseID)
 
-	// Delete the expense itself
-	if err := database.DB.Exec("DELETE FROM expenses WHERE id = ?", expenseID).Error; err != nil {
+	// Delete related records first, then the expense itself
+	err = activityTransaction(func(tx *gorm.DB) error {
+		for _, stmt := range []string{
+			"DELETE FROM expense_participants WHERE expense_id = ?",
+			"DELETE FROM attachments WHERE expense_id = ?",
+			"DELETE FROM expense_comments WHERE expense_id = ?",
+			"DELETE FROM notifications WHERE expense_id = ?",
+			"DELETE FROM expense_revisions WHERE expense_id = ?", // The activity log keeps the final state
+			"DELETE FROM expenses WHERE id = ?",
+		} {
+			if err := tx.Exec(stmt, expenseID).Error; err != nil {
+				return err
+			}
+		}
+		return recordActivity(tx, activity{GroupID: groupID, ActorID: callerID, Action: models.ActionExpenseDeleted, TargetID: expense.ID, Before: before})
+	})
+	if err != nil {
+		fmt.Println("❌ Error deleting expense:", err)
 		http.Error(w, "Error deleting expense", http.StatusInternalServerError)
 		return
 	}
+	releaseBlobs(sums)
 
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(map[string]string{"message": "Expense deleted successfully"})
@@ -156,11 +443,12 @@ func DeleteExpense(w http.ResponseWriter, r *http.Request) {
 // SettleGroupExpense - Records a settlement between two users in a group
 func SettleGroupExpense(w http.ResponseWriter, r *http.Request) {
 	var req struct {
-		Title       string  `json:"title"`
-		Amount      float64 `json:"amount"`
-		PaidBy      uint    `json:"paid_by"`
-		SettledWith uint    `json:"settled_with"`
-		GroupID     *uint   `json:"group_id"`
+		Title       string       `json:"title"`
+		Amount      models.Money `json:"amount"`
+		Currency    string       `json:"currency"`
+		PaidBy      uint         `json:"paid_by"`
+		SettledWith uint         `json:"settled_with"`
+		GroupID     *uint        `json:"group_id"`
 	}
 
 	// Decode request payload
@@ -170,33 +458,53 @@ func SettleGroupExpense(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Validate input
-	if req.Amount <= 0 || req.PaidBy == 0 || req.SettledWith == 0 || req.GroupID == nil {
+	if req.Amount <= 0 || req.SettledWith == 0 || req.GroupID == nil {
 		http.Error(w, "Missing or invalid fields in request", http.StatusBadRequest)
 		return
 	}
 
-	// Create the expense record
-	expense := models.Expense{
-		Title:   req.Title,
-		Amount:  req.Amount,
-		PaidBy:  req.PaidBy,
-		GroupID: req.GroupID,
+	// Settlements can only be recorded by and between group members
+	if !authorizeGroup(w, r, *req.GroupID, authz.Member) {
+		return
+	}
+	paidBy, createdBy, ok := resolvePayer(w, r, req.PaidBy, req.GroupID)
+	if !ok {
+		return
+	}
+	if paidBy == req.SettledWith {
+		http.Error(w, "Cannot settle up with yourself", http.StatusBadRequest)
+		return
+	}
+	if err := checkGroupMembers(*req.GroupID, []uint{req.SettledWith}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	if err := database.DB.Create(&expense).Error; err != nil {
-		http.Error(w, "Error creating settlement expense", http.StatusInternalServerError)
+	currency, err := expenseCurrency(req.Currency, req.GroupID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Add the recipient as the only participant
-	participant := models.ExpenseParticipant{
-		ExpenseID:  expense.ID,
-		UserID:     req.SettledWith,
-		AmountOwed: req.Amount,
+	// Create the expense record
+	expense := models.Expense{
+		Title:     req.Title,
+		Amount:    req.Amount,
+		Currency:  currency,
+		PaidBy:    paidBy,
+		CreatedBy: createdBy,
+		GroupID:   req.GroupID,
 	}
 
-	if err := database.DB.Create(&participant).Error; err != nil {
-		http.Error(w, "Error assigning participant", http.StatusInternalServerError)
+	// The recipient is the only participant
+	participants := []models.ExpenseParticipant{{UserID: req.SettledWith, AmountOwed: req.Amount}}
+
+	err = activityTransaction(func(tx *gorm.DB) error {
+		return createExpense(tx, &expense, participants, activity{GroupID: req.GroupID, ActorID: createdBy, Action: models.ActionExpenseSettled})
+	})
+	if err != nil {
+		fmt.Println("❌ Error creating settlement:", err)
+		http.Error(w, "Error creating settlement expense", http.StatusInternalServerError)
 		return
 	}
 
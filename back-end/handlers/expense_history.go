@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// expenseSnapshot - Full state of an expense at one point of its history
+type expenseSnapshot struct {
+	Title        string                `json:"title"`
+	Amount       models.Money          `json:"amount"`
+	Currency     string                `json:"currency"`
+	PaidBy       uint                  `json:"paid_by"`
+	GroupID      *uint                 `json:"group_id"`
+	ThreadID     *uint                 `json:"thread_id"`
+	Participants []participantSnapshot `json:"participants"`
+}
+
+type participantSnapshot struct {
+	UserID     uint         `json:"user_id"`
+	AmountOwed models.Money `json:"amount_owed"`
+}
+
+// snapshotExpense - Captures an expense and its split as they are stored now
+func snapshotExpense(tx *gorm.DB, expense models.Expense) (expenseSnapshot, error) {
+	snapshot := expenseSnapshot{
+		Title:    expense.Title,
+		Amount:   expense.Amount,
+		Currency: expense.Currency,
+		PaidBy:   expense.PaidBy,
+		GroupID:  expense.GroupID,
+		ThreadID: expense.ThreadID,
+	}
+	err := tx.Model(&models.ExpenseParticipant{}).
+		Select("user_id, amount_owed").
+		Where("expense_id = ?", expense.ID).
+		Order("user_id").
+		Scan(&snapshot.Participants).Error
+	return snapshot, err
+}
+
+// recordRevision - Appends an edit to the history of an expense. The first
+// revision's before snapshot preserves the expense as it was originally created.
+func recordRevision(tx *gorm.DB, expenseID, changedBy uint, before, after expenseSnapshot) error {
+	fields := changedFields(before, after)
+	if len(fields) == 0 {
+		return nil // Nothing actually changed
+	}
+
+	var last int
+	if err := tx.Model(&models.ExpenseRevision{}).
+		Select("COALESCE(MAX(revision), 0)").
+		Where("expense_id = ?", expenseID).
+		Scan(&last).Error; err != nil {
+		return err
+	}
+
+	beforeJSON, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+	afterJSON, err := json.Marshal(after)
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&models.ExpenseRevision{
+		ExpenseID:     expenseID,
+		Revision:      last + 1,
+		ChangedBy:     changedBy,
+		ChangedFields: strings.Join(fields, ","),
+		Before:        string(beforeJSON),
+		After:         string(afterJSON),
+	}).Error
+}
+
+// changedFields - Lists the JSON names of the snapshot fields that differ
+func changedFields(before, after expenseSnapshot) []string {
+	var fields []string
+	b, a := reflect.ValueOf(before), reflect.ValueOf(after)
+	for i := 0; i < b.NumField(); i++ {
+		if !reflect.DeepEqual(b.Field(i).Interface(), a.Field(i).Interface()) {
+			name := strings.Split(b.Type().Field(i).Tag.Get("json"), ",")[0]
+			fields = append(fields, name)
+		}
+	}
+	return fields
+}
+
+// GetExpenseHistory - Lists every edit of an expense, oldest first
+func GetExpenseHistory(w http.ResponseWriter, r *http.Request) {
+	expenseID := mux.Vars(r)["expense_id"]
+
+	var revisions []struct {
+		Revision      int
+		ChangedBy     uint
+		Username      string
+		ChangedAt     time.Time
+		ChangedFields string
+		BeforeState   string
+		AfterState    string
+	}
+
+	if err := database.DB.Raw(`
+		SELECT er.revision, er.changed_by, u.username, er.created_at AS changed_at,
+			er.changed_fields, er.before_state, er.after_state
+		FROM expense_revisions er
+		LEFT JOIN users u ON er.changed_by = u.id
+		WHERE er.expense_id = ?
+		ORDER BY er.revision
+	`, expenseID).Scan(&revisions).Error; err != nil {
+		http.Error(w, "Error retrieving expense history", http.StatusInternalServerError)
+		return
+	}
+
+	type revisionResponse struct {
+		Revision      int             `json:"revision"`
+		ChangedBy     uint            `json:"changed_by"`
+		Username      string          `json:"changed_by_username"`
+		ChangedAt     time.Time       `json:"changed_at"`
+		ChangedFields []string        `json:"changed_fields"`
+		Before        json.RawMessage `json:"before"`
+		After         json.RawMessage `json:"after"`
+	}
+
+	response := []revisionResponse{}
+	for _, rev := range revisions {
+		item := revisionResponse{
+			Revision:      rev.Revision,
+			ChangedBy:     rev.ChangedBy,
+			Username:      rev.Username,
+			ChangedAt:     rev.ChangedAt,
+			ChangedFields: []string{},
+			Before:        json.RawMessage(rev.BeforeState),
+			After:         json.RawMessage(rev.AfterState),
+		}
+		if rev.ChangedFields != "" {
+			item.ChangedFields = strings.Split(rev.ChangedFields, ",")
+		}
+		response = append(response, item)
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
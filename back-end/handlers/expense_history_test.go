@@ -0,0 +1,183 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+func TestUpdateExpenseRecordsHistory(t *testing.T) {
+	database.SetupMockDB()
+
+	alice := models.User{Username: "alice", Email: "alice@example.com"}
+	bob := models.User{Username: "bob", Email: "bob@example.com"}
+	database.DB.Create(&alice)
+	database.DB.Create(&bob)
+
+	group := models.Group{Name: "Flat"}
+	database.DB.Create(&group)
+	addMembers(group.ID, alice.ID, bob.ID)
+
+	expense := models.Expense{Title: "Dinnr", Amount: models.NewMoney(100), PaidBy: alice.ID, GroupID: &group.ID}
+	database.DB.Create(&expense)
+	database.DB.Create(&[]models.ExpenseParticipant{
+		{ExpenseID: expense.ID, UserID: alice.ID, AmountOwed: models.NewMoney(50)},
+		{ExpenseID: expense.ID, UserID: bob.ID, AmountOwed: models.NewMoney(50)},
+	})
+	vars := map[string]string{"expense_id": fmt.Sprintf("%d", expense.ID)}
+
+	update := func(payload map[string]interface{}) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(payload)
+		req, _ := http.NewRequest("PUT", "/expenses/1", bytes.NewReader(body))
+		req = mux.SetURLVars(withUser(req, alice.ID), vars)
+		rr := httptest.NewRecorder()
+		handlers.UpdateExpense(rr, req)
+		return rr
+	}
+
+	// Fix the typo and the amount; the 50/50 split is scaled to the new amount
+	if rr := update(map[string]interface{}{"title": "Dinner", "amount": 120}); rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var parts []models.ExpenseParticipant
+	database.DB.Where("expense_id = ?", expense.ID).Order("user_id").Find(&parts)
+	if len(parts) != 2 || parts[0].AmountOwed != models.NewMoney(60) || parts[1].AmountOwed != models.NewMoney(60) {
+		t.Errorf("Expected split to be scaled to 60/60, got %+v", parts)
+	}
+
+	// Replace the split with exact amounts
+	rr := update(map[string]interface{}{
+		"split_type": "exact",
+		"splits":     []map[string]interface{}{{"user_id": alice.ID, "amount": 20}, {"user_id": bob.ID, "amount": 100}},
+	})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Splits that do not add up are rejected and leave the expense untouched
+	rr = update(map[string]interface{}{
+		"split_type": "exact",
+		"splits":     []map[string]interface{}{{"user_id": alice.ID, "amount": 1}},
+	})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status 400 for invalid split, got %d", rr.Code)
+	}
+
+	// Two revisions, each recording who changed what
+	req, _ := http.NewRequest("GET", "/expenses/1/history", nil)
+	req = mux.SetURLVars(req, vars)
+	rr = httptest.NewRecorder()
+	handlers.GetExpenseHistory(rr, req)
+
+	var history []struct {
+		Revision      int      `json:"revision"`
+		ChangedBy     uint     `json:"changed_by"`
+		Username      string   `json:"changed_by_username"`
+		ChangedFields []string `json:"changed_fields"`
+		Before        struct {
+			Title string `json:"title"`
+		} `json:"before"`
+		After struct {
+			Title  string       `json:"title"`
+			Amount models.Money `json:"amount"`
+		} `json:"after"`
+	}
+	if err := json.NewDecoder(rr.Body).Decode(&history); err != nil {
+		t.Fatalf("Failed to decode history: %v", err)
+	}
+	if len(history) != 2 {
+		t.Fatalf("Expected 2 revisions, got %d", len(history))
+	}
+
+	first := history[0]
+	if first.Revision != 1 || first.Username != "alice" {
+		t.Errorf("Unexpected first revision: %+v", first)
+	}
+	if first.Before.Title != "Dinnr" || first.After.Title != "Dinner" || first.After.Amount != models.NewMoney(120) {
+		t.Errorf("Unexpected first revision snapshots: %+v", first)
+	}
+	if fmt.Sprint(first.ChangedFields) != "[title amount participants]" {
+		t.Errorf("Unexpected changed fields: %v", first.ChangedFields)
+	}
+	if fmt.Sprint(history[1].ChangedFields) != "[participants]" {
+		t.Errorf("Unexpected changed fields in second revision: %v", history[1].ChangedFields)
+	}
+}
+
+func TestUpdateExpenseKeepsItsGroup(t *testing.T) {
+	group, alice, bob, _ := invitationFixture(t)
+	addMembers(group.ID, bob.ID)
+	thread := models.Thread{Name: "Trip", GroupID: &group.ID, CreatedBy: alice.ID}
+	database.DB.Create(&thread)
+
+	// Created with only the thread, the expense still gets its group
+	body := fmt.Sprintf(`{"title": "Hotel", "amount": 90, "thread_id": %d, "split_with": [%d, %d]}`, thread.ID, alice.ID, bob.ID)
+	req, _ := http.NewRequest("POST", "/expenses", bytes.NewBufferString(body))
+	rr := httptest.NewRecorder()
+	handlers.CreateExpense(rr, withUser(req, alice.ID))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 Created, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var expense models.Expense
+	database.DB.Last(&expense)
+	if expense.GroupID == nil || *expense.GroupID != group.ID {
+		t.Fatalf("Expected the thread's group to be stored, got %v", expense.GroupID)
+	}
+
+	// A legacy thread-only expense taken out of its thread stays in the group
+	database.DB.Model(&expense).Update("group_id", nil)
+	req, _ = http.NewRequest("PUT", "/", bytes.NewBufferString(`{"thread_id": 0}`))
+	req = mux.SetURLVars(withUser(req, alice.ID), map[string]string{"expense_id": fmt.Sprint(expense.ID)})
+	rr = httptest.NewRecorder()
+	handlers.UpdateExpense(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	database.DB.First(&expense, expense.ID)
+	if expense.ThreadID != nil || expense.GroupID == nil || *expense.GroupID != group.ID {
+		t.Errorf("Expected the expense to leave the thread but not the group, got thread %v group %v", expense.ThreadID, expense.GroupID)
+	}
+}
+
+func TestUpdateExpenseRefusesArchivedThread(t *testing.T) {
+	group, alice, _, _ := invitationFixture(t)
+	archived := models.Thread{Name: "Last trip", GroupID: &group.ID, CreatedBy: alice.ID}
+	database.DB.Create(&archived)
+	database.DB.Model(&archived).Update("archived_at", time.Now())
+	expense := models.Expense{Title: "Hotel", Amount: models.NewMoney(90), PaidBy: alice.ID, CreatedBy: alice.ID, GroupID: &group.ID}
+	database.DB.Create(&expense)
+
+	req, _ := http.NewRequest("PUT", "/", bytes.NewBufferString(fmt.Sprintf(`{"thread_id": %d}`, archived.ID)))
+	req = mux.SetURLVars(withUser(req, alice.ID), map[string]string{"expense_id": fmt.Sprint(expense.ID)})
+	rr := httptest.NewRecorder()
+	handlers.UpdateExpense(rr, req)
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected moving into an archived thread to be refused, got %d: %s", rr.Code, rr.Body.String())
+	}
+	database.DB.First(&expense, expense.ID)
+	if expense.ThreadID != nil {
+		t.Errorf("Expected the expense to stay out of the thread, got %v", *expense.ThreadID)
+	}
+}
+
+func TestExpenseRevisionsAreUnique(t *testing.T) {
+	database.SetupMockDB()
+	database.DB.Create(&models.ExpenseRevision{ExpenseID: 1, Revision: 1, ChangedBy: 1})
+	err := database.DB.Create(&models.ExpenseRevision{ExpenseID: 1, Revision: 1, ChangedBy: 2}).Error
+	if !errors.Is(err, gorm.ErrDuplicatedKey) {
+		t.Errorf("Expected a second revision 1 to be refused as a duplicate, got %v", err)
+	}
+}
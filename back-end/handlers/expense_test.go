@@ -21,7 +21,7 @@ func TestDeleteExpense(t *testing.T) {
 	// Create an expense record.
 	expense := models.Expense{
 		Title:  "Test Expense",
-		Amount: 50,
+		Amount: models.NewMoney(50),
 		PaidBy: 1,
 	}
 	if err := database.DB.Create(&expense).Error; err != nil {
@@ -32,9 +32,10 @@ func TestDeleteExpense(t *testing.T) {
 	expParticipant := models.ExpenseParticipant{
 		ExpenseID:  expense.ID,
 		UserID:     1,
-		AmountOwed: 25,
+		AmountOwed: models.NewMoney(25),
 	}
 	database.DB.Create(&expParticipant)
+	database.DB.Create(&models.ExpenseRevision{ExpenseID: expense.ID, Revision: 1, ChangedBy: 1})
 
 	// Prepare DELETE request for the expense.
 	req, _ := http.NewRequest("DELETE", "/expenses/"+strconv.Itoa(int(expense.ID)), nil)
@@ -65,6 +66,11 @@ func TestDeleteExpense(t *testing.T) {
 	if count != 0 {
 		t.Errorf("Expense participants were not deleted, count: %d", count)
 	}
+	// And so is its edit history
+	database.DB.Model(&models.ExpenseRevision{}).Where("expense_id = ?", expense.ID).Count(&count)
+	if count != 0 {
+		t.Errorf("Expense revisions were not deleted, count: %d", count)
+	}
 }
 
 func TestSettleGroupExpense(t *testing.T) {
@@ -78,6 +84,7 @@ func TestSettleGroupExpense(t *testing.T) {
 	if err := database.DB.Create(&group).Error; err != nil {
 		t.Fatalf("Failed to create group: %v", err)
 	}
+	addMembers(group.ID, 2, 3)
 
 	// Prepare the request payload
 	reqBody := map[string]interface{}{
@@ -95,6 +102,7 @@ func TestSettleGroupExpense(t *testing.T) {
 		t.Fatalf("Failed to create request: %v", err)
 	}
 	req.Header.Set("Content-Type", "application/json")
+	req = withUser(req, 2)
 
 	// Record the response
 	rr := httptest.NewRecorder()
@@ -119,7 +127,7 @@ func TestSettleGroupExpense(t *testing.T) {
 	if err := database.DB.Where("title = ? AND paid_by = ?", "Dinner Split", uint(2)).First(&exp).Error; err != nil {
 		t.Fatalf("Expected expense record not found: %v", err)
 	}
-	if exp.Amount != 120.50 {
+	if exp.Amount != models.NewMoney(120.50) {
 		t.Errorf("Expected expense amount 120.50, got %v", exp.Amount)
 	}
 	if exp.GroupID == nil || *exp.GroupID != group.ID {
@@ -133,7 +141,236 @@ func TestSettleGroupExpense(t *testing.T) {
 		First(&part).Error; err != nil {
 		t.Fatalf("Expected participant record not found: %v", err)
 	}
-	if part.AmountOwed != 120.50 {
+	if part.AmountOwed != models.NewMoney(120.50) {
 		t.Errorf("Expected AmountOwed 120.50, got %v", part.AmountOwed)
 	}
 }
+
+func TestCreateExpenseExactSplit(t *testing.T) {
+	database.SetupMockDB()
+
+	group := models.Group{Name: "Steak Night"}
+	if err := database.DB.Create(&group).Error; err != nil {
+		t.Fatalf("Failed to create group: %v", err)
+	}
+	addMembers(group.ID, 1, 2)
+
+	reqBody := map[string]interface{}{
+		"title":      "Dinner",
+		"amount":     100,
+		"paid_by":    1,
+		"group_id":   group.ID,
+		"split_type": "exact",
+		"splits": []map[string]interface{}{
+			{"user_id": 1, "amount": 70},
+			{"user_id": 2, "amount": 30},
+		},
+	}
+	bodyBytes, _ := json.Marshal(reqBody)
+
+	req, _ := http.NewRequest("POST", "/expenses", bytes.NewReader(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req = withUser(req, 1)
+	rr := httptest.NewRecorder()
+	handlers.CreateExpense(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	// Verify each participant owes their exact amount
+	var parts []models.ExpenseParticipant
+	database.DB.Order("user_id").Find(&parts)
+	if len(parts) != 2 {
+		t.Fatalf("Expected 2 participants, got %d", len(parts))
+	}
+	if parts[0].AmountOwed != models.NewMoney(70) || parts[1].AmountOwed != models.NewMoney(30) {
+		t.Errorf("Expected amounts 70/30, got %v/%v", parts[0].AmountOwed, parts[1].AmountOwed)
+	}
+}
+
+func TestCreateExpenseRejectsInvalidSplits(t *testing.T) {
+	database.SetupMockDB()
+
+	group := models.Group{Name: "Dinner Club"}
+	database.DB.Create(&group)
+	addMembers(group.ID, 1, 2)
+
+	payloads := map[string]map[string]interface{}{
+		"exact does not add up": {
+			"title": "Dinner", "amount": 100, "paid_by": 1, "split_type": "exact",
+			"splits": []map[string]interface{}{{"user_id": 1, "amount": 70}, {"user_id": 2, "amount": 20}},
+		},
+		"percent does not add up": {
+			"title": "Dinner", "amount": 100, "paid_by": 1, "split_type": "percent",
+			"splits": []map[string]interface{}{{"user_id": 1, "percent": 50}, {"user_id": 2, "percent": 40}},
+		},
+		"unknown split type": {
+			"title": "Dinner", "amount": 100, "paid_by": 1, "split_type": "random",
+			"split_with": []uint{1, 2},
+		},
+	}
+
+	for name, payload := range payloads {
+		payload["group_id"] = group.ID
+		bodyBytes, _ := json.Marshal(payload)
+		req, _ := http.NewRequest("POST", "/expenses", bytes.NewReader(bodyBytes))
+		req.Header.Set("Content-Type", "application/json")
+		req = withUser(req, 1)
+		rr := httptest.NewRecorder()
+		handlers.CreateExpense(rr, req)
+
+		if rr.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status code 400, got %d", name, rr.Code)
+		}
+	}
+
+	// Nothing should have been written
+	var count int64
+	database.DB.Model(&models.Expense{}).Count(&count)
+	if count != 0 {
+		t.Errorf("Expected no expenses to be created, got %d", count)
+	}
+}
+
+func TestCreateExpensePayerAbsorbsRemainder(t *testing.T) {
+	database.SetupMockDB()
+
+	group := models.Group{Name: "House"}
+	database.DB.Create(&group)
+	addMembers(group.ID, 1, 2, 3)
+
+	// $100 split three ways does not divide evenly into cents
+	reqBody := map[string]interface{}{
+		"title":      "Groceries",
+		"amount":     100,
+		"paid_by":    2,
+		"group_id":   group.ID,
+		"split_with": []uint{1, 2, 3},
+	}
+	bodyBytes, _ := json.Marshal(reqBody)
+
+	req, _ := http.NewRequest("POST", "/expenses", bytes.NewReader(bodyBytes))
+	req.Header.Set("Content-Type", "application/json")
+	req = withUser(req, 2)
+	rr := httptest.NewRecorder()
+	handlers.CreateExpense(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status code %d, got %d: %s", http.StatusCreated, rr.Code, rr.Body.String())
+	}
+
+	var parts []models.ExpenseParticipant
+	database.DB.Order("user_id").Find(&parts)
+	if len(parts) != 3 {
+		t.Fatalf("Expected 3 participants, got %d", len(parts))
+	}
+
+	var total models.Money
+	for _, p := range parts {
+		total += p.AmountOwed
+	}
+	if total != models.NewMoney(100) {
+		t.Errorf("Expected participants to owe exactly 100.00, got %s", total)
+	}
+	// The payer (user 2) picks up the extra cent
+	if parts[0].AmountOwed != 3333 || parts[1].AmountOwed != 3334 || parts[2].AmountOwed != 3333 {
+		t.Errorf("Unexpected split: %s/%s/%s", parts[0].AmountOwed, parts[1].AmountOwed, parts[2].AmountOwed)
+	}
+}
+
+func TestCreateExpenseRequiresMembership(t *testing.T) {
+	database.SetupMockDB()
+
+	group := models.Group{Name: "Private Club"}
+	database.DB.Create(&group)
+	addMembers(group.ID, 1, 2)
+
+	reqBody := map[string]interface{}{
+		"title":      "Snacks",
+		"amount":     10,
+		"paid_by":    1,
+		"group_id":   group.ID,
+		"split_with": []uint{1, 2},
+	}
+	bodyBytes, _ := json.Marshal(reqBody)
+
+	// User 3 is not part of the group
+	req, _ := http.NewRequest("POST", "/expenses", bytes.NewReader(bodyBytes))
+	req = withUser(req, 3)
+	rr := httptest.NewRecorder()
+	handlers.CreateExpense(rr, req)
+
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("Expected status code 403 for non-member, got %d", rr.Code)
+	}
+
+	// Members cannot split with people outside the group either
+	reqBody["split_with"] = []uint{1, 3}
+	bodyBytes, _ = json.Marshal(reqBody)
+	req, _ = http.NewRequest("POST", "/expenses", bytes.NewReader(bodyBytes))
+	req = withUser(req, 1)
+	rr = httptest.NewRecorder()
+	handlers.CreateExpense(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code 400 for non-member participant, got %d", rr.Code)
+	}
+}
+
+func TestCreateExpenseDefaultsPayerToCaller(t *testing.T) {
+	database.SetupMockDB()
+
+	group := models.Group{Name: "Road Trip"}
+	database.DB.Create(&group)
+	addMembers(group.ID, 1, 2)
+
+	// No paid_by: the authenticated user paid
+	bodyBytes, _ := json.Marshal(map[string]interface{}{
+		"title": "Fuel", "amount": 40, "group_id": group.ID, "split_with": []uint{1, 2},
+	})
+	req, _ := http.NewRequest("POST", "/expenses", bytes.NewReader(bodyBytes))
+	req = withUser(req, 2)
+	rr := httptest.NewRecorder()
+	handlers.CreateExpense(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status code 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var exp models.Expense
+	database.DB.Where("title = ?", "Fuel").First(&exp)
+	if exp.PaidBy != 2 || exp.CreatedBy != 2 {
+		t.Errorf("Expected paid_by 2 and created_by 2, got %d and %d", exp.PaidBy, exp.CreatedBy)
+	}
+
+	// Recording a payment by another member keeps the caller as creator
+	bodyBytes, _ = json.Marshal(map[string]interface{}{
+		"title": "Tolls", "amount": 10, "paid_by": 1, "group_id": group.ID, "split_with": []uint{1, 2},
+	})
+	req, _ = http.NewRequest("POST", "/expenses", bytes.NewReader(bodyBytes))
+	req = withUser(req, 2)
+	rr = httptest.NewRecorder()
+	handlers.CreateExpense(rr, req)
+
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected status code 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var tolls models.Expense
+	database.DB.Where("title = ?", "Tolls").First(&tolls)
+	if tolls.PaidBy != 1 || tolls.CreatedBy != 2 {
+		t.Errorf("Expected paid_by 1 and created_by 2, got %d and %d", tolls.PaidBy, tolls.CreatedBy)
+	}
+
+	// A payer outside the group is rejected
+	bodyBytes, _ = json.Marshal(map[string]interface{}{
+		"title": "Snacks", "amount": 5, "paid_by": 3, "group_id": group.ID, "split_with": []uint{1, 2},
+	})
+	req, _ = http.NewRequest("POST", "/expenses", bytes.NewReader(bodyBytes))
+	req = withUser(req, 2)
+	rr = httptest.NewRecorder()
+	handlers.CreateExpense(rr, req)
+
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected status code 400 for payer outside the group, got %d", rr.Code)
+	}
+}
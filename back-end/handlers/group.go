@@ -3,16 +3,25 @@ package handlers
 import (
 	"encoding/json"
 	"fmt"
+	"go-auth-app/authz"
 	"go-auth-app/database"
 	"go-auth-app/models"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 )
 
-// GetAllUsers - Fetch all available users
+// GetAllUsers - Fetch the users the caller shares a group with; anyone else has to be invited by email
 func GetAllUsers(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return
+	}
 
 	type userResponse struct {
 		ID       uint   `json:"id"`
@@ -22,6 +31,9 @@ func GetAllUsers(w http.ResponseWriter, r *http.Request) {
 	result := database.DB.
 		Table("users"). // ✅ Explicitly use the correct table name
 		Select("id, username").
+		Where("id IN (?)", database.DB.Table("group_users").Select("user_id").
+			Where("group_id IN (?)", database.DB.Table("group_users").Select("group_id").Where("user_id = ?", userID))).
+		Order("id").
 		Scan(&users)
 
 	// Handle errors
@@ -37,11 +49,18 @@ func GetAllUsers(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// CreateGroup - Create a new group and add users to it
+// CreateGroup - Create a new group and invite users to it
 func CreateGroup(w http.ResponseWriter, r *http.Request) {
+	creatorID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return
+	}
+
 	var req struct {
-		Name    string `json:"name"`
-		UserIDs []uint `json:"user_ids"`
+		Name         string `json:"name"`
+		BaseCurrency string `json:"base_currency"`
+		UserIDs      []uint `json:"user_ids"`
 	}
 
 	// Decode JSON request
@@ -56,47 +75,54 @@ func CreateGroup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Balances are reported in the base currency, USD unless chosen otherwise
+	baseCurrency := DefaultCurrency
+	if req.BaseCurrency != "" {
+		var err error
+		if baseCurrency, err = normalizeCurrency(req.BaseCurrency); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	fmt.Println("✅ Creating group with name:", req.Name)
-	fmt.Println("📌 Users to be added:", req.UserIDs)
+	fmt.Println("📌 Users to be invited:", req.UserIDs)
+
+	// Create the group with its creator as owner; everyone else has to accept an invitation
+	group := models.Group{Name: req.Name, BaseCurrency: baseCurrency}
+	var invitations []sentInvitation
+	err := activityTransaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&group).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.GroupUser{GroupID: group.ID, UserID: creatorID, Role: authz.RoleOwner}).Error; err != nil {
+			return err
+		}
+		after := groupSnapshot{Name: group.Name, BaseCurrency: group.BaseCurrency}
+		if err := recordActivity(tx, activity{GroupID: &group.ID, ActorID: creatorID, Action: models.ActionGroupCreated, TargetID: group.ID, After: after}); err != nil {
+			return err
+		}
 
-	// Create the group
-	group := models.Group{Name: req.Name}
-	if err := database.DB.Create(&group).Error; err != nil {
+		var err error
+		invitations, err = inviteUsers(tx, group.ID, creatorID, withoutID(req.UserIDs, creatorID))
+		return err
+	})
+	if err != nil {
 		fmt.Println("❌ Error creating group:", err)
 		http.Error(w, "Error creating group", http.StatusInternalServerError)
 		return
 	}
+	sendInvitationEmails(group.ID, creatorID, invitations)
 
-	// Ensure that at least one user is provided
-	if len(req.UserIDs) == 0 {
-		fmt.Println("⚠️ No users provided. Group created without members.")
-		json.NewEncoder(w).Encode(map[string]string{
-			"message": "Group created successfully (without members)",
-		})
-		return
-	}
-
-	// Insert users into the `group_users` association table
-	var groupUsers []models.GroupUser
-	for _, userID := range req.UserIDs {
-		groupUsers = append(groupUsers, models.GroupUser{GroupID: group.ID, UserID: userID})
-	}
-
-	fmt.Println("📌 Adding users to group:", groupUsers)
-
-	if err := database.DB.Create(&groupUsers).Error; err != nil {
-		fmt.Println("❌ Error adding users to group:", err)
-		http.Error(w, "Error adding users to group", http.StatusInternalServerError)
-		return
-	}
-
-	fmt.Println("✅ Group created successfully with users:", req.UserIDs)
+	fmt.Println("✅ Group created successfully; invitations sent:", len(invitations))
 
 	json.NewEncoder(w).Encode(map[string]string{
-		"message": "Group created successfully",
+		"message":  "Group created successfully",
+		"group_id": strconv.FormatUint(uint64(group.ID), 10),
 	})
 }
 
+// UpdateGroupMembers - Invites users to the group; they join once they accept
 func UpdateGroupMembers(w http.ResponseWriter, r *http.Request) {
 	var req struct {
 		UserIDs []uint `json:"user_ids"`
@@ -114,22 +140,27 @@ func UpdateGroupMembers(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	for _, userID := range req.UserIDs {
-		var count int64
-		database.DB.Model(&models.GroupUser{}).
-			Where("group_id = ? AND user_id = ?", groupID, userID).
-			Count(&count)
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return
+	}
 
-		if count == 0 {
-			newMember := models.GroupUser{
-				GroupID: uint(groupID),
-				UserID:  userID,
-			}
-			database.DB.Create(&newMember)
-		}
+	// Either every invitation is created or none are
+	var invitations []sentInvitation
+	err = activityTransaction(func(tx *gorm.DB) error {
+		var err error
+		invitations, err = inviteUsers(tx, uint(groupID), userID, req.UserIDs)
+		return err
+	})
+	if err != nil {
+		fmt.Println("❌ Error inviting members to group:", err)
+		http.Error(w, "Error inviting members to group", http.StatusInternalServerError)
+		return
 	}
+	sendInvitationEmails(uint(groupID), userID, invitations)
 
-	json.NewEncoder(w).Encode(map[string]string{"message": "New members added successfully"})
+	json.NewEncoder(w).Encode(map[string]string{"message": "Invitations sent successfully"})
 }
 
 func GetUserGroups(w http.ResponseWriter, r *http.Request) {
@@ -140,17 +171,22 @@ func GetUserGroups(w http.ResponseWriter, r *http.Request) {
 	}
 
 	type GroupResponse struct {
-		ID   uint   `json:"id"`
-		Name string `json:"name"`
+		ID         uint       `json:"id"`
+		Name       string     `json:"name"`
+		ArchivedAt *time.Time `json:"archived_at"`
 	}
 
 	var groups []GroupResponse
-	database.DB.
+	query := database.DB.
 		Table("groups").
-		Select("groups.id, groups.name"). // 👈 Exclude timestamps here
+		Select("groups.id, groups.name, groups.archived_at"). // 👈 Exclude timestamps here
 		Joins("JOIN group_users ON groups.id = group_users.group_id").
-		Where("group_users.user_id = ?", userID).
-		Scan(&groups)
+		Where("group_users.user_id = ? AND groups.deleted_at IS NULL", userID)
+	// Archived groups are hidden unless asked for with ?archived=true
+	if r.URL.Query().Get("archived") != "true" {
+		query = query.Where("groups.archived_at IS NULL")
+	}
+	query.Scan(&groups)
 
 	if len(groups) == 0 {
 		json.NewEncoder(w).Encode([]struct{}{})
@@ -163,9 +199,14 @@ func GetUserGroups(w http.ResponseWriter, r *http.Request) {
 func GetGroupUsers(w http.ResponseWriter, r *http.Request) {
 	groupID := mux.Vars(r)["id"]
 
+	type member struct {
+		models.User
+		Role string `json:"role"`
+	}
 	var result struct {
-		GroupName string        `json:"group_name"`
-		Users     []models.User `json:"users"`
+		GroupName    string   `json:"group_name"`
+		BaseCurrency string   `json:"base_currency"`
+		Users        []member `json:"users"`
 	}
 
 	database.DB.
@@ -173,10 +214,11 @@ func GetGroupUsers(w http.ResponseWriter, r *http.Request) {
 		Select("name").
 		Where("id = ?", groupID).
 		Scan(&result.GroupName)
+	result.BaseCurrency = groupBaseCurrency(groupID)
 
 	database.DB.
 		Table("users").
-		Select("users.id, users.username").
+		Select("users.id, users.username, group_users.role").
 		Joins("JOIN group_users ON users.id = group_users.user_id").
 		Where("group_users.group_id = ?", groupID).
 		Scan(&result.Users)
@@ -189,16 +231,17 @@ func GetUserGroupsWithBalances(w http.ResponseWriter, r *http.Request) {
 	userID := mux.Vars(r)["user_id"]
 
 	var groups []struct {
-		GroupID      uint    `json:"group_id"`
-		GroupName    string  `json:"group_name"`
-		TotalBalance float64 `json:"total_balance"`
+		GroupID      uint         `json:"group_id"`
+		GroupName    string       `json:"group_name"`
+		TotalBalance models.Money `json:"total_balance"`
 	}
 
 	database.DB.Raw(`
-		SELECT g.id AS group_id, g.name AS group_name, COALESCE(SUM(ep.amount_owed), 0) AS total_balance 
+		SELECT g.id AS group_id, g.name AS group_name, COALESCE(CAST(SUM(ep.amount_owed) AS BIGINT), 0) AS total_balance 
 		FROM groups g
 		LEFT JOIN expenses e ON g.id = e.group_id
 		LEFT JOIN expense_participants ep ON e.id = ep.expense_id AND ep.user_id = ?
+		WHERE g.deleted_at IS NULL
 		GROUP BY g.id, g.name
 	`, userID).Scan(&groups)
 
@@ -213,32 +256,35 @@ func GetGroupExpensesWithDetails(w http.ResponseWriter, r *http.Request) {
 	groupID := mux.Vars(r)["group_id"]
 
 	var expenses []struct {
-		ID           uint    `json:"id"`
-		Title        string  `json:"title"`
-		Amount       float64 `json:"amount"`
-		PaidBy       uint    `json:"paid_by"`
-		GroupID      *uint   `json:"group_id"`
-		ThreadID     *uint   `json:"thread_id"`
-		ThreadName   *string `json:"thread_name"`
+		ID           uint         `json:"id"`
+		Title        string       `json:"title"`
+		Amount       models.Money `json:"amount"`
+		Currency     string       `json:"currency"`
+		PaidBy       uint         `json:"paid_by"`
+		CreatedBy    uint         `json:"created_by"`
+		GroupID      *uint        `json:"group_id"`
+		ThreadID     *uint        `json:"thread_id"`
+		ThreadName   *string      `json:"thread_name"`
 		Participants []struct {
-			UserID     uint    `json:"user_id"`
-			Username   string  `json:"username"`
-			AmountOwed float64 `json:"amount_owed"`
+			UserID     uint         `json:"user_id"`
+			Username   string       `json:"username"`
+			AmountOwed models.Money `json:"amount_owed"`
 		} `json:"participants"`
+		Comments []commentResponse `json:"comments"`
 	}
 
 	database.DB.Raw(`
-		SELECT e.id, e.title, e.amount, e.paid_by, e.group_id, e.thread_id, t.name AS thread_name
+		SELECT e.id, e.title, e.amount, e.currency, e.paid_by, e.created_by, e.group_id, e.thread_id, t.name AS thread_name
 		FROM expenses e
 		LEFT JOIN threads t ON e.thread_id = t.id
-		WHERE e.group_id = ?
+		WHERE e.group_id = ? AND t.deleted_at IS NULL
 	`, groupID).Scan(&expenses)
 
 	for i := range expenses {
 		var participants []struct {
-			UserID     uint    `json:"user_id"`
-			Username   string  `json:"username"`
-			AmountOwed float64 `json:"amount_owed"`
+			UserID     uint         `json:"user_id"`
+			Username   string       `json:"username"`
+			AmountOwed models.Money `json:"amount_owed"`
 		}
 		database.DB.Raw(`
 			SELECT ep.user_id, u.username, ep.amount_owed
@@ -249,6 +295,18 @@ func GetGroupExpensesWithDetails(w http.ResponseWriter, r *http.Request) {
 		expenses[i].Participants = participants
 	}
 
+	expenseIDs := make([]uint, len(expenses))
+	for i := range expenses {
+		expenseIDs[i] = expenses[i].ID
+	}
+	comments := commentsByExpense(expenseIDs)
+	for i := range expenses {
+		expenses[i].Comments = comments[expenses[i].ID]
+		if expenses[i].Comments == nil {
+			expenses[i].Comments = []commentResponse{}
+		}
+	}
+
 	if len(expenses) == 0 {
 		json.NewEncoder(w).Encode([]struct{}{})
 	} else {
@@ -256,45 +314,16 @@ func GetGroupExpensesWithDetails(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// GetGroupBalances - Retrieves total balances within a group
+// GetGroupBalances - Retrieves total balances within a group, in the group's base currency
 func GetGroupBalances(w http.ResponseWriter, r *http.Request) {
 	groupID := mux.Vars(r)["group_id"]
 
-	var balances []struct {
-		UserID     uint    `json:"user_id"`
-		Username   string  `json:"username"`
-		AmountOwed float64 `json:"amount_owed"`
-		AmountDue  float64 `json:"amount_due"`
-		NetBalance float64 `json:"net_balance"`
+	balances, _, err := groupNetBalances(groupID)
+	if err != nil {
+		writeBalanceError(w, err)
+		return
 	}
 
-	database.DB.Raw(`
-		WITH UserOwes AS (
-			SELECT ep.user_id AS user_id, u.username AS username, SUM(ep.amount_owed) AS amount_owed
-			FROM expense_participants ep
-			JOIN expenses e ON ep.expense_id = e.id
-			JOIN users u ON ep.user_id = u.id
-			WHERE e.group_id = ?
-			GROUP BY ep.user_id, u.username
-		),
-		UserIsOwed AS (
-			SELECT e.paid_by AS user_id, u.username AS username, SUM(ep.amount_owed) AS amount_due
-			FROM expense_participants ep
-			JOIN expenses e ON ep.expense_id = e.id
-			JOIN users u ON e.paid_by = u.id
-			WHERE e.group_id = ?
-			GROUP BY e.paid_by, u.username
-		)
-		SELECT 
-			COALESCE(owes.user_id, owed.user_id) AS user_id,
-			COALESCE(owes.username, owed.username) AS username,
-			COALESCE(owes.amount_owed, 0) AS amount_owed,
-			COALESCE(owed.amount_due, 0) AS amount_due,
-			COALESCE(owed.amount_due, 0) - COALESCE(owes.amount_owed, 0) AS net_balance
-		FROM UserOwes owes
-		FULL OUTER JOIN UserIsOwed owed ON owes.user_id = owed.user_id
-	`, groupID, groupID).Scan(&balances)
-
 	if len(balances) == 0 {
 		json.NewEncoder(w).Encode([]struct{}{})
 	} else {
@@ -302,22 +331,92 @@ func GetGroupBalances(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// DeleteGroup - Deletes a group by ID
-func DeleteGroup(w http.ResponseWriter, r *http.Request) {
+// RenameGroup - Changes the group's name, which must stay unique
+func RenameGroup(w http.ResponseWriter, r *http.Request) {
 	groupID := mux.Vars(r)["group_id"]
 
-	// Delete all related records first
-	database.DB.Exec("DELETE FROM expense_participants WHERE expense_id IN (SELECT id FROM expenses WHERE group_id = ?)", groupID)
-	database.DB.Exec("DELETE FROM expenses WHERE group_id = ?", groupID)
-	database.DB.Exec("DELETE FROM threads WHERE group_id = ?", groupID)
-	database.DB.Exec("DELETE FROM group_users WHERE group_id = ?", groupID)
+	var req struct {
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		http.Error(w, "Group name is required", http.StatusBadRequest)
+		return
+	}
 
-	// Finally, delete the group itself
-	if err := database.DB.Exec("DELETE FROM groups WHERE id = ?", groupID).Error; err != nil {
+	var taken int64
+	// Deleted groups keep their name until they are purged
+	database.DB.Unscoped().Model(&models.Group{}).Where("name = ? AND id <> ?", name, groupID).Count(&taken)
+	if taken > 0 {
+		http.Error(w, "A group with this name already exists", http.StatusConflict)
+		return
+	}
+
+	var group models.Group
+	if err := database.DB.First(&group, groupID).Error; err != nil {
+		http.Error(w, "Group not found", http.StatusNotFound)
+		return
+	}
+	err := activityTransaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Group{}).Where("id = ?", group.ID).Update("name", name).Error; err != nil {
+			return err
+		}
+		before := groupSnapshot{Name: group.Name, BaseCurrency: group.BaseCurrency}
+		after := groupSnapshot{Name: name, BaseCurrency: group.BaseCurrency}
+		return recordActivity(tx, activity{GroupID: &group.ID, ActorID: actorOf(r), Action: models.ActionGroupRenamed, TargetID: group.ID, Before: before, After: after})
+	})
+	if err != nil {
+		fmt.Println("❌ Error renaming group:", err)
+		http.Error(w, "Error renaming group", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Group renamed successfully"})
+}
+
+// DeleteGroup - Soft deletes a group and its threads. Nothing else changes, so
+// RestoreGroup can bring it back until PurgeDeleted removes it for good.
+func DeleteGroup(w http.ResponseWriter, r *http.Request) {
+	groupID := mux.Vars(r)["group_id"]
+
+	// Threads are stamped with the group's deletion time so restoring the group restores them too
+	now := time.Now()
+	err := activityTransaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Thread{}).Where("group_id = ?", groupID).Update("deleted_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Group{}).Where("id = ?", groupID).Update("deleted_at", now).Error; err != nil {
+			return err
+		}
+		if id := idVar(r, "group_id"); id != nil {
+			return recordActivity(tx, activity{GroupID: id, ActorID: actorOf(r), Action: models.ActionGroupDeleted, TargetID: *id})
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println("❌ Error deleting group:", err)
 		http.Error(w, "Error deleting group", http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Group deleted successfully"})
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":          "Group deleted successfully",
+		"restorable_until": now.Add(RestoreWindow).Format(time.RFC3339),
+	})
+}
+
+// withoutID - Returns the IDs except the given one
+func withoutID(ids []uint, id uint) []uint {
+	var result []uint
+	for _, v := range ids {
+		if v != id {
+			result = append(result, v)
+		}
+	}
+	return result
 }
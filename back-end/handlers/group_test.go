@@ -11,6 +11,7 @@ import (
 	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/gorilla/mux"
 )
@@ -46,7 +47,7 @@ func TestGetGroupBalances(t *testing.T) {
 	// Expense 1: Alice pays $100, Bob owes $100.
 	exp1 := models.Expense{
 		Title:   "Dinner",
-		Amount:  100,
+		Amount:  models.NewMoney(100),
 		PaidBy:  alice.ID,
 		GroupID: &group.ID,
 	}
@@ -56,7 +57,7 @@ func TestGetGroupBalances(t *testing.T) {
 	part1 := models.ExpenseParticipant{
 		ExpenseID:  exp1.ID,
 		UserID:     bob.ID,
-		AmountOwed: 100,
+		AmountOwed: models.NewMoney(100),
 	}
 	if err := database.DB.Create(&part1).Error; err != nil {
 		t.Fatalf("Failed to create participant1: %v", err)
@@ -65,7 +66,7 @@ func TestGetGroupBalances(t *testing.T) {
 	// Expense 2: Bob pays $40, Alice owes $40.
 	exp2 := models.Expense{
 		Title:   "Taxi",
-		Amount:  40,
+		Amount:  models.NewMoney(40),
 		PaidBy:  bob.ID,
 		GroupID: &group.ID,
 	}
@@ -75,7 +76,7 @@ func TestGetGroupBalances(t *testing.T) {
 	part2 := models.ExpenseParticipant{
 		ExpenseID:  exp2.ID,
 		UserID:     alice.ID,
-		AmountOwed: 40,
+		AmountOwed: models.NewMoney(40),
 	}
 	if err := database.DB.Create(&part2).Error; err != nil {
 		t.Fatalf("Failed to create participant2: %v", err)
@@ -198,7 +199,7 @@ func TestGetGroupExpensesWithDetails(t *testing.T) {
 	// Create an expense linked to the group & thread
 	exp := models.Expense{
 		Title:    "Test Expense",
-		Amount:   200,
+		Amount:   models.NewMoney(200),
 		PaidBy:   payer.ID,
 		GroupID:  &group.ID,
 		ThreadID: &thread.ID,
@@ -211,7 +212,7 @@ func TestGetGroupExpensesWithDetails(t *testing.T) {
 	expPart := models.ExpenseParticipant{
 		ExpenseID:  exp.ID,
 		UserID:     participant.ID,
-		AmountOwed: 100,
+		AmountOwed: models.NewMoney(100),
 	}
 	if err := database.DB.Create(&expPart).Error; err != nil {
 		t.Fatalf("Failed to create expense participant: %v", err)
@@ -235,17 +236,17 @@ func TestGetGroupExpensesWithDetails(t *testing.T) {
 
 	// Decode JSON response
 	var resp []struct {
-		ID           uint    `json:"id"`
-		Title        string  `json:"title"`
-		Amount       float64 `json:"amount"`
-		PaidBy       uint    `json:"paid_by"`
-		GroupID      *uint   `json:"group_id"`
-		ThreadID     *uint   `json:"thread_id"`
-		ThreadName   *string `json:"thread_name"`
+		ID           uint         `json:"id"`
+		Title        string       `json:"title"`
+		Amount       models.Money `json:"amount"`
+		PaidBy       uint         `json:"paid_by"`
+		GroupID      *uint        `json:"group_id"`
+		ThreadID     *uint        `json:"thread_id"`
+		ThreadName   *string      `json:"thread_name"`
 		Participants []struct {
-			UserID     uint    `json:"user_id"`
-			Username   string  `json:"username"`
-			AmountOwed float64 `json:"amount_owed"`
+			UserID     uint         `json:"user_id"`
+			Username   string       `json:"username"`
+			AmountOwed models.Money `json:"amount_owed"`
 		} `json:"participants"`
 	}
 	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
@@ -300,14 +301,16 @@ func TestGetGroupExpensesWithDetails(t *testing.T) {
 func TestUpdateGroupMembers(t *testing.T) {
 	// Initialize in‑memory SQLite DB.
 	database.SetupMockDB()
+	mails := useFakeMailer(t)
 
-	// Create a group record.
+	// Create users 1-3 and a group with user 1 as its only member.
+	for _, name := range []string{"alice", "bob", "carol"} {
+		database.DB.Create(&models.User{Username: name, Email: name + "@example.com", Password: "secret"})
+	}
 	group := models.Group{Name: "Test Group"}
 	if err := database.DB.Create(&group).Error; err != nil {
 		t.Fatalf("Failed to create group: %v", err)
 	}
-
-	// Insert an initial member (user 1) for the group.
 	initialMember := models.GroupUser{GroupID: group.ID, UserID: 1}
 	if err := database.DB.Create(&initialMember).Error; err != nil {
 		t.Fatalf("Failed to insert initial member: %v", err)
@@ -324,7 +327,7 @@ func TestUpdateGroupMembers(t *testing.T) {
 	req = mux.SetURLVars(req, map[string]string{"group_id": fmt.Sprintf("%d", group.ID)})
 
 	rr := httptest.NewRecorder()
-	handlers.UpdateGroupMembers(rr, req)
+	handlers.UpdateGroupMembers(rr, withUser(req, 1))
 
 	if rr.Code != http.StatusOK {
 		t.Errorf("Expected status code 200, got %d", rr.Code)
@@ -334,17 +337,20 @@ func TestUpdateGroupMembers(t *testing.T) {
 	if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
 		t.Fatalf("Failed to decode response: %v", err)
 	}
-	if msg, ok := resp["message"]; !ok || msg != "New members added successfully" {
+	if msg, ok := resp["message"]; !ok || msg != "Invitations sent successfully" {
 		t.Errorf("Unexpected response message: %v", resp)
 	}
 
-	// Verify that group now has members 1, 2, and 3 (without duplicates).
+	// Nobody joins without consent: 2 and 3 are invited, 1 is already a member.
 	var members []models.GroupUser
 	if err := database.DB.Where("group_id = ?", group.ID).Find(&members).Error; err != nil {
 		t.Fatalf("Error querying group users: %v", err)
 	}
-	if len(members) != 3 {
-		t.Errorf("Expected 3 group members, got %d", len(members))
+	if len(members) != 1 {
+		t.Errorf("Expected 1 group member until invitations are accepted, got %d", len(members))
+	}
+	if len(mails.sent) != 2 || mails.sent[0].To != "bob@example.com" || mails.sent[1].To != "carol@example.com" {
+		t.Errorf("Expected invitations to bob and carol, got %+v", mails.sent)
 	}
 }
 
@@ -364,7 +370,7 @@ func TestDeleteGroup(t *testing.T) {
 	// 2. Expense.
 	expense := models.Expense{
 		Title:   "Test Expense",
-		Amount:  100,
+		Amount:  models.NewMoney(100),
 		PaidBy:  1,
 		GroupID: &group.ID,
 	}
@@ -373,7 +379,7 @@ func TestDeleteGroup(t *testing.T) {
 	expParticipant := models.ExpenseParticipant{
 		ExpenseID:  expense.ID,
 		UserID:     1,
-		AmountOwed: 50,
+		AmountOwed: models.NewMoney(50),
 	}
 	database.DB.Create(&expParticipant)
 	// 4. Thread.
@@ -402,13 +408,29 @@ func TestDeleteGroup(t *testing.T) {
 		t.Errorf("Unexpected response message: %v", resp)
 	}
 
-	// Verify that the group and its associated records are deleted.
+	// The group and its thread are hidden, but nothing is gone yet
 	var g models.Group
 	if err := database.DB.First(&g, group.ID).Error; err == nil {
 		t.Errorf("Group was not deleted")
 	}
-
+	var th models.Thread
+	if err := database.DB.First(&th, thread.ID).Error; err == nil {
+		t.Errorf("Thread of the deleted group was not deleted")
+	}
 	var count int64
+	database.DB.Model(&models.Expense{}).Where("group_id = ?", group.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected the expense to be kept until the group is purged, got %d", count)
+	}
+
+	// Once the restore window has passed, purging removes everything
+	if _, err := handlers.PurgeDeleted(time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("PurgeDeleted failed: %v", err)
+	}
+	if err := database.DB.Unscoped().First(&g, group.ID).Error; err == nil {
+		t.Errorf("Group was not purged")
+	}
+
 	database.DB.Model(&models.GroupUser{}).Where("group_id = ?", group.ID).Count(&count)
 	if count != 0 {
 		t.Errorf("Expected 0 group_users for deleted group, got %d", count)
@@ -417,7 +439,7 @@ func TestDeleteGroup(t *testing.T) {
 	if count != 0 {
 		t.Errorf("Expected 0 expenses for deleted group, got %d", count)
 	}
-	database.DB.Model(&models.Thread{}).Where("group_id = ?", group.ID).Count(&count)
+	database.DB.Unscoped().Model(&models.Thread{}).Where("group_id = ?", group.ID).Count(&count)
 	if count != 0 {
 		t.Errorf("Expected 0 threads for deleted group, got %d", count)
 	}
@@ -426,3 +448,43 @@ func TestDeleteGroup(t *testing.T) {
 		t.Errorf("Expected 0 expense participants after deletion, got %d", count)
 	}
 }
+
+func TestDeleteGroupRollsBackOnError(t *testing.T) {
+	database.SetupMockDB()
+
+	group := models.Group{Name: "Test Group"}
+	database.DB.Create(&group)
+	database.DB.Create(&models.GroupUser{GroupID: group.ID, UserID: 1})
+	expense := models.Expense{Title: "Test Expense", Amount: models.NewMoney(100), PaidBy: 1, GroupID: &group.ID}
+	database.DB.Create(&expense)
+	database.DB.Create(&models.ExpenseParticipant{ExpenseID: expense.ID, UserID: 1, AmountOwed: models.NewMoney(100)})
+
+	// Make the first statement (deleting threads) fail before the group is deleted
+	if err := database.DB.Migrator().DropTable(&models.Thread{}); err != nil {
+		t.Fatalf("Failed to drop threads table: %v", err)
+	}
+
+	req, _ := http.NewRequest("DELETE", "/groups/"+strconv.Itoa(int(group.ID)), nil)
+	req = mux.SetURLVars(req, map[string]string{"group_id": fmt.Sprintf("%d", group.ID)})
+	rr := httptest.NewRecorder()
+	handlers.DeleteGroup(rr, req)
+
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("Expected status code 500, got %d", rr.Code)
+	}
+
+	// Nothing was deleted
+	var g models.Group
+	if err := database.DB.First(&g, group.ID).Error; err != nil {
+		t.Errorf("Expected the group to survive the failed delete: %v", err)
+	}
+	var count int64
+	database.DB.Model(&models.Expense{}).Where("group_id = ?", group.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected the expense to survive the failed delete, got %d", count)
+	}
+	database.DB.Model(&models.ExpenseParticipant{}).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected the participant to survive the failed delete, got %d", count)
+	}
+}
@@ -0,0 +1,496 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-auth-app/authz"
+	"go-auth-app/database"
+	"go-auth-app/mailer"
+	"go-auth-app/models"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// DefaultInvitationTTL - How long an invitation stays valid unless the inviter chooses otherwise
+const DefaultInvitationTTL = 7 * 24 * time.Hour
+
+// sentInvitation - An email invitation to send once its transaction has committed
+type sentInvitation struct {
+	Email string
+	Token string
+}
+
+// invitationStatus - The effective status: pending invitations past their expiry are expired
+func invitationStatus(inv models.GroupInvitation) string {
+	if inv.Status == models.InvitationPending && time.Now().After(inv.ExpiresAt) {
+		return models.InvitationExpired
+	}
+	return inv.Status
+}
+
+func invitationLink(token string) string {
+	return AppURL + "/invitations/" + token
+}
+
+// createEmailInvitation - Invites an address to the group, replacing any
+// pending invitation for the same address
+func createEmailInvitation(tx *gorm.DB, groupID, invitedBy uint, email string, ttl time.Duration) (models.GroupInvitation, string, error) {
+	if err := tx.Model(&models.GroupInvitation{}).
+		Where("group_id = ? AND LOWER(email) = ? AND status = ?", groupID, strings.ToLower(email), models.InvitationPending).
+		Update("status", models.InvitationRevoked).Error; err != nil {
+		return models.GroupInvitation{}, "", err
+	}
+
+	token, err := randomToken(24)
+	if err != nil {
+		return models.GroupInvitation{}, "", err
+	}
+	inv := models.GroupInvitation{
+		GroupID:   groupID,
+		InvitedBy: invitedBy,
+		Email:     &email,
+		TokenHash: hashToken(token),
+		Status:    models.InvitationPending,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := tx.Create(&inv).Error; err != nil {
+		return models.GroupInvitation{}, "", err
+	}
+	return inv, token, recordInvitation(tx, inv)
+}
+
+// recordInvitation - Logs a new invitation in the group's activity log
+func recordInvitation(tx *gorm.DB, inv models.GroupInvitation) error {
+	after := invitationSnapshot{Email: inv.Email, MaxUses: inv.MaxUses, ExpiresAt: inv.ExpiresAt}
+	return recordActivity(tx, activity{GroupID: &inv.GroupID, ActorID: inv.InvitedBy, Action: models.ActionInvitationCreated, TargetID: inv.ID, After: after})
+}
+
+// inviteUsers - Invites existing users by their email address. Users already
+// in the group are skipped, and so are unknown IDs, so the answer does not
+// tell which users exist.
+func inviteUsers(tx *gorm.DB, groupID, invitedBy uint, userIDs []uint) ([]sentInvitation, error) {
+	var users []models.User
+	if err := tx.Where("id IN ?", userIDs).Find(&users).Error; err != nil {
+		return nil, err
+	}
+
+	var memberIDs []uint
+	if err := tx.Model(&models.GroupUser{}).Where("group_id = ?", groupID).Pluck("user_id", &memberIDs).Error; err != nil {
+		return nil, err
+	}
+	members := uniqueIDs(memberIDs)
+
+	var sent []sentInvitation
+	for _, user := range users {
+		if members[user.ID] {
+			continue
+		}
+		_, token, err := createEmailInvitation(tx, groupID, invitedBy, user.Email, DefaultInvitationTTL)
+		if err != nil {
+			return nil, err
+		}
+		sent = append(sent, sentInvitation{Email: user.Email, Token: token})
+	}
+	return sent, nil
+}
+
+func uniqueIDs(ids []uint) map[uint]bool {
+	unique := make(map[uint]bool)
+	for _, id := range ids {
+		unique[id] = true
+	}
+	return unique
+}
+
+// sendInvitationEmails - Mails invitations; a failed mail is logged, the invitation stays valid
+func sendInvitationEmails(groupID, invitedBy uint, invitations []sentInvitation) {
+	if len(invitations) == 0 {
+		return
+	}
+
+	var group models.Group
+	database.DB.First(&group, groupID)
+	var inviter models.User
+	database.DB.First(&inviter, invitedBy)
+
+	for _, inv := range invitations {
+		err := Mailer.Send(mailer.Message{
+			To:      inv.Email,
+			Subject: fmt.Sprintf("%s invited you to %s on GatorSplit", inviter.Username, group.Name),
+			Body: fmt.Sprintf("Hi,\n\n%s invited you to split expenses in the group \"%s\".\n\nAccept or decline the invitation here:\n\n%s\n\nThe invitation expires in %d days.\n",
+				inviter.Username, group.Name, invitationLink(inv.Token), int(DefaultInvitationTTL.Hours()/24)),
+		})
+		if err != nil {
+			fmt.Println("❌ Error sending invitation email:", err)
+		}
+	}
+}
+
+// CreateInvitation - Invites someone to a group, either by email or as a
+// shareable link. Link invitations return their token; email invitations are only mailed.
+func CreateInvitation(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return
+	}
+	groupID, err := strconv.ParseUint(mux.Vars(r)["group_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Email          string `json:"email"`
+		MaxUses        int    `json:"max_uses"`         // Link invitations only; 0 = unlimited
+		ExpiresInHours int    `json:"expires_in_hours"` // Defaults to 7 days
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.MaxUses < 0 || req.ExpiresInHours < 0 {
+		http.Error(w, "max_uses and expires_in_hours must not be negative", http.StatusBadRequest)
+		return
+	}
+	ttl := DefaultInvitationTTL
+	if req.ExpiresInHours > 0 {
+		ttl = time.Duration(req.ExpiresInHours) * time.Hour
+	}
+
+	var inv models.GroupInvitation
+	var token string
+	if req.Email != "" {
+		address, err := mail.ParseAddress(req.Email)
+		if err != nil {
+			http.Error(w, "Invalid email address", http.StatusBadRequest)
+			return
+		}
+		email := address.Address
+
+		var existing models.User
+		if database.DB.Where("LOWER(email) = ?", strings.ToLower(email)).First(&existing).Error == nil &&
+			authz.IsGroupMember(uint(groupID), existing.ID) {
+			http.Error(w, "User is already a member of this group", http.StatusConflict)
+			return
+		}
+
+		err = activityTransaction(func(tx *gorm.DB) error {
+			var err error
+			inv, token, err = createEmailInvitation(tx, uint(groupID), userID, email, ttl)
+			return err
+		})
+		if err == nil {
+			sendInvitationEmails(uint(groupID), userID, []sentInvitation{{Email: email, Token: token}})
+		}
+	} else {
+		if token, err = randomToken(24); err == nil {
+			inv = models.GroupInvitation{
+				GroupID:   uint(groupID),
+				InvitedBy: userID,
+				TokenHash: hashToken(token),
+				Status:    models.InvitationPending,
+				ExpiresAt: time.Now().Add(ttl),
+				MaxUses:   req.MaxUses,
+			}
+			err = activityTransaction(func(tx *gorm.DB) error {
+				if err := tx.Create(&inv).Error; err != nil {
+					return err
+				}
+				return recordInvitation(tx, inv)
+			})
+		}
+	}
+	if err != nil {
+		fmt.Println("❌ Error creating invitation:", err)
+		http.Error(w, "Error creating invitation", http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"id":         inv.ID,
+		"group_id":   inv.GroupID,
+		"email":      inv.Email,
+		"status":     inv.Status,
+		"expires_at": inv.ExpiresAt,
+		"max_uses":   inv.MaxUses,
+	}
+	if inv.Email == nil {
+		response["token"] = token
+		response["url"] = invitationLink(token)
+	}
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetGroupInvitations - Lists a group's invitations; pending ones unless ?status= asks for another state or "all"
+func GetGroupInvitations(w http.ResponseWriter, r *http.Request) {
+	groupID := mux.Vars(r)["group_id"]
+	status := r.URL.Query().Get("status")
+	if status == "" {
+		status = models.InvitationPending
+	}
+
+	var invitations []models.GroupInvitation
+	if err := database.DB.Where("group_id = ?", groupID).Order("created_at DESC").Find(&invitations).Error; err != nil {
+		http.Error(w, "Error retrieving invitations", http.StatusInternalServerError)
+		return
+	}
+
+	type invitationResponse struct {
+		ID          uint       `json:"id"`
+		Type        string     `json:"type"` // "email" or "link"
+		Email       *string    `json:"email"`
+		Status      string     `json:"status"`
+		InvitedBy   uint       `json:"invited_by"`
+		CreatedAt   time.Time  `json:"created_at"`
+		ExpiresAt   time.Time  `json:"expires_at"`
+		MaxUses     int        `json:"max_uses"`
+		Uses        int        `json:"uses"`
+		AcceptedBy  *uint      `json:"accepted_by"`
+		RespondedAt *time.Time `json:"responded_at"`
+	}
+
+	response := []invitationResponse{}
+	for _, inv := range invitations {
+		effective := invitationStatus(inv)
+		if status != "all" && effective != status {
+			continue
+		}
+		kind := "link"
+		if inv.Email != nil {
+			kind = "email"
+		}
+		response = append(response, invitationResponse{
+			ID:          inv.ID,
+			Type:        kind,
+			Email:       inv.Email,
+			Status:      effective,
+			InvitedBy:   inv.InvitedBy,
+			CreatedAt:   inv.CreatedAt,
+			ExpiresAt:   inv.ExpiresAt,
+			MaxUses:     inv.MaxUses,
+			Uses:        inv.Uses,
+			AcceptedBy:  inv.AcceptedBy,
+			RespondedAt: inv.RespondedAt,
+		})
+	}
+
+	json.NewEncoder(w).Encode(response)
+}
+
+// RevokeInvitation - Cancels a pending invitation so its token can no longer be used
+func RevokeInvitation(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+
+	var inv models.GroupInvitation
+	if err := database.DB.Where("id = ? AND group_id = ?", vars["invitation_id"], vars["group_id"]).First(&inv).Error; err != nil {
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return
+	}
+	if invitationStatus(inv) != models.InvitationPending {
+		http.Error(w, "Only pending invitations can be revoked", http.StatusConflict)
+		return
+	}
+
+	err := activityTransaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&inv).Update("status", models.InvitationRevoked).Error; err != nil {
+			return err
+		}
+		before := invitationSnapshot{Email: inv.Email, MaxUses: inv.MaxUses, ExpiresAt: inv.ExpiresAt}
+		return recordActivity(tx, activity{GroupID: &inv.GroupID, ActorID: actorOf(r), Action: models.ActionInvitationRevoked, TargetID: inv.ID, Before: before})
+	})
+	if err != nil {
+		http.Error(w, "Error revoking invitation", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Invitation revoked"})
+}
+
+// findInvitation - Looks up an invitation by its token, writing 404 if there is none
+func findInvitation(w http.ResponseWriter, tx *gorm.DB, token string) (models.GroupInvitation, bool) {
+	var inv models.GroupInvitation
+	if err := tx.Where("token_hash = ?", hashToken(token)).First(&inv).Error; err != nil {
+		http.Error(w, "Invitation not found", http.StatusNotFound)
+		return inv, false
+	}
+	return inv, true
+}
+
+// GetInvitation - Shows what an invitation is for, so the invitee can decide
+func GetInvitation(w http.ResponseWriter, r *http.Request) {
+	inv, ok := findInvitation(w, database.DB, mux.Vars(r)["token"])
+	if !ok {
+		return
+	}
+
+	var details struct {
+		GroupName string
+		Username  string
+	}
+	database.DB.Raw(`
+		SELECT g.name AS group_name, u.username
+		FROM groups g
+		LEFT JOIN users u ON u.id = ?
+		WHERE g.id = ?
+	`, inv.InvitedBy, inv.GroupID).Scan(&details)
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"group_id":            inv.GroupID,
+		"group_name":          details.GroupName,
+		"invited_by":          inv.InvitedBy,
+		"invited_by_username": details.Username,
+		"email":               inv.Email,
+		"status":              invitationStatus(inv),
+		"expires_at":          inv.ExpiresAt,
+	})
+}
+
+// errInvitation - A reason an invitation cannot be answered, with its HTTP status
+type errInvitation struct {
+	status  int
+	message string
+}
+
+func (e errInvitation) Error() string { return e.message }
+
+// checkInvitation - Ensures the invitation can still be answered by the user
+func checkInvitation(inv models.GroupInvitation, user models.User) error {
+	switch invitationStatus(inv) {
+	case models.InvitationPending:
+	case models.InvitationExpired:
+		return errInvitation{http.StatusGone, "Invitation has expired"}
+	default:
+		return errInvitation{http.StatusGone, "Invitation is no longer valid"}
+	}
+
+	if inv.Email != nil && !strings.EqualFold(*inv.Email, user.Email) {
+		return errInvitation{http.StatusForbidden, "This invitation was sent to a different email address"}
+	}
+	// Anyone can register with the invited address; only its owner can verify it
+	if inv.Email != nil && user.EmailVerifiedAt == nil {
+		return errInvitation{http.StatusForbidden, "Verify your email address to accept this invitation"}
+	}
+	if inv.MaxUses > 0 && inv.Uses >= inv.MaxUses {
+		return errInvitation{http.StatusGone, "Invitation has been used up"}
+	}
+	return nil
+}
+
+// AcceptInvitation - Joins the group the invitation is for
+func AcceptInvitation(w http.ResponseWriter, r *http.Request) {
+	respondToInvitation(w, r, true)
+}
+
+// DeclineInvitation - Turns down an email invitation
+func DeclineInvitation(w http.ResponseWriter, r *http.Request) {
+	respondToInvitation(w, r, false)
+}
+
+func respondToInvitation(w http.ResponseWriter, r *http.Request, accept bool) {
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return
+	}
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	inv, ok := findInvitation(w, database.DB, mux.Vars(r)["token"])
+	if !ok {
+		return
+	}
+	if !accept && inv.Email == nil {
+		http.Error(w, "Link invitations cannot be declined", http.StatusBadRequest)
+		return
+	}
+	if accept && authz.IsGroupMember(inv.GroupID, userID) {
+		http.Error(w, "You are already a member of this group", http.StatusConflict)
+		return
+	}
+	if accept {
+		// Deleted and archived groups take no new members
+		scope, err := authz.GroupScope(inv.GroupID)
+		if err == nil {
+			err = authz.Writable(scope)
+		}
+		if errors.Is(err, authz.ErrNotFound) {
+			http.Error(w, "This group no longer exists", http.StatusGone)
+			return
+		}
+		if err != nil {
+			writeAuthzError(w, err)
+			return
+		}
+	}
+
+	err := activityTransaction(func(tx *gorm.DB) error {
+		if err := checkInvitation(inv, user); err != nil {
+			return err
+		}
+
+		now := time.Now()
+		update := tx.Model(&models.GroupInvitation{}).Where("id = ? AND status = ?", inv.ID, models.InvitationPending)
+		var result *gorm.DB
+		switch {
+		case !accept:
+			result = update.Updates(map[string]interface{}{"status": models.InvitationDeclined, "responded_at": now})
+		case inv.Email != nil:
+			result = update.Updates(map[string]interface{}{"status": models.InvitationAccepted, "accepted_by": userID, "responded_at": now})
+		default:
+			// Counted atomically so concurrent joins cannot exceed max_uses
+			result = update.Where("max_uses = 0 OR uses < max_uses").Update("uses", gorm.Expr("uses + 1"))
+		}
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvitation{http.StatusGone, "Invitation is no longer valid"}
+		}
+
+		if !accept {
+			return recordActivity(tx, activity{GroupID: &inv.GroupID, ActorID: userID, Action: models.ActionInvitationDeclined, TargetID: inv.ID})
+		}
+		// Another invitation may have been accepted meanwhile
+		err := tx.Create(&models.GroupUser{GroupID: inv.GroupID, UserID: userID, Role: authz.RoleMember}).Error
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return errInvitation{http.StatusConflict, "You are already a member of this group"}
+		}
+		if err != nil {
+			return err
+		}
+		after := memberSnapshot{UserID: userID, Role: authz.RoleMember}
+		return recordActivity(tx, activity{GroupID: &inv.GroupID, ActorID: userID, Action: models.ActionMemberJoined, TargetID: userID, After: after})
+	})
+
+	var invErr errInvitation
+	if errors.As(err, &invErr) {
+		http.Error(w, invErr.message, invErr.status)
+		return
+	}
+	if err != nil {
+		fmt.Println("❌ Error answering invitation:", err)
+		http.Error(w, "Error answering invitation", http.StatusInternalServerError)
+		return
+	}
+
+	if !accept {
+		json.NewEncoder(w).Encode(map[string]string{"message": "Invitation declined"})
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":  "You have joined the group",
+		"group_id": strconv.FormatUint(uint64(inv.GroupID), 10),
+	})
+}
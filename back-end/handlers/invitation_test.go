@@ -0,0 +1,232 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// invitationFixture - A group owned by alice, plus bob and carol who are not members
+func invitationFixture(t *testing.T) (group models.Group, alice, bob, carol models.User) {
+	database.SetupMockDB()
+	alice = models.User{Username: "alice", Email: "alice@example.com", Password: "secret"}
+	bob = models.User{Username: "bob", Email: "bob@example.com", Password: "secret"}
+	carol = models.User{Username: "carol", Email: "carol@example.com", Password: "secret"}
+	for _, u := range []*models.User{&alice, &bob, &carol} {
+		database.DB.Create(u)
+	}
+	group = models.Group{Name: "Trip"}
+	database.DB.Create(&group)
+	database.DB.Create(&models.GroupUser{GroupID: group.ID, UserID: alice.ID, Role: "owner"})
+	return
+}
+
+func verifyEmail(user models.User) {
+	database.DB.Model(&user).Update("email_verified_at", time.Now())
+}
+
+func createInvitation(t *testing.T, group models.Group, userID uint, body string) map[string]interface{} {
+	req, _ := http.NewRequest("POST", "/", bytes.NewBufferString(body))
+	req = mux.SetURLVars(req, map[string]string{"group_id": fmt.Sprint(group.ID)})
+	rr := httptest.NewRecorder()
+	handlers.CreateInvitation(rr, withUser(req, userID))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 Created, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var response map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&response)
+	return response
+}
+
+func answerInvitation(handler http.HandlerFunc, token string, userID uint) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/", nil)
+	req = mux.SetURLVars(req, map[string]string{"token": token})
+	rr := httptest.NewRecorder()
+	handler(rr, withUser(req, userID))
+	return rr
+}
+
+func TestEmailInvitation(t *testing.T) {
+	group, alice, bob, carol := invitationFixture(t)
+	mails := useFakeMailer(t)
+
+	response := createInvitation(t, group, alice.ID, `{"email": "bob@example.com"}`)
+	if _, ok := response["token"]; ok {
+		t.Error("Expected email invitations not to return their token")
+	}
+	token := strings.TrimPrefix(tokenFromLink(t, mails), handlers.AppURL+"/invitations/")
+
+	// Only the invited address can use it
+	if rr := answerInvitation(handlers.AcceptInvitation, token, carol.ID); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected another user to be refused, got %d", rr.Code)
+	}
+
+	// Registering with the address is not enough; it must be verified
+	if rr := answerInvitation(handlers.AcceptInvitation, token, bob.ID); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected an unverified address to be refused, got %d", rr.Code)
+	}
+	verifyEmail(bob)
+
+	if rr := answerInvitation(handlers.AcceptInvitation, token, bob.ID); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var count int64
+	database.DB.Model(&models.GroupUser{}).Where("group_id = ? AND user_id = ? AND role = ?", group.ID, bob.ID, "member").Count(&count)
+	if count != 1 {
+		t.Error("Expected bob to join as a member")
+	}
+
+	var inv models.GroupInvitation
+	database.DB.First(&inv)
+	if inv.Status != models.InvitationAccepted || inv.AcceptedBy == nil || *inv.AcceptedBy != bob.ID {
+		t.Errorf("Expected the invitation to be accepted by bob, got %+v", inv)
+	}
+}
+
+func TestDeclineAndRevokeInvitation(t *testing.T) {
+	group, alice, bob, carol := invitationFixture(t)
+	mails := useFakeMailer(t)
+
+	createInvitation(t, group, alice.ID, `{"email": "bob@example.com"}`)
+	bobToken := strings.TrimPrefix(tokenFromLink(t, mails), handlers.AppURL+"/invitations/")
+	verifyEmail(bob)
+	if rr := answerInvitation(handlers.DeclineInvitation, bobToken, bob.ID); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d", rr.Code)
+	}
+	if rr := answerInvitation(handlers.AcceptInvitation, bobToken, bob.ID); rr.Code != http.StatusGone {
+		t.Errorf("Expected a declined invitation to be unusable, got %d", rr.Code)
+	}
+
+	link := createInvitation(t, group, alice.ID, `{}`)
+
+	// Admins see outstanding invitations only by default
+	req, _ := http.NewRequest("GET", "/", nil)
+	req = mux.SetURLVars(req, map[string]string{"group_id": fmt.Sprint(group.ID)})
+	rr := httptest.NewRecorder()
+	handlers.GetGroupInvitations(rr, req)
+	var pending []map[string]interface{}
+	json.NewDecoder(rr.Body).Decode(&pending)
+	if len(pending) != 1 || pending[0]["type"] != "link" {
+		t.Fatalf("Expected only the link invitation to be pending, got %v", pending)
+	}
+
+	req, _ = http.NewRequest("DELETE", "/", nil)
+	req = mux.SetURLVars(req, map[string]string{"group_id": fmt.Sprint(group.ID), "invitation_id": fmt.Sprint(pending[0]["id"])})
+	rr = httptest.NewRecorder()
+	handlers.RevokeInvitation(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d", rr.Code)
+	}
+
+	if rr := answerInvitation(handlers.AcceptInvitation, link["token"].(string), carol.ID); rr.Code != http.StatusGone {
+		t.Errorf("Expected a revoked invitation to be unusable, got %d", rr.Code)
+	}
+}
+
+func TestLinkInvitationLimits(t *testing.T) {
+	group, alice, bob, carol := invitationFixture(t)
+
+	link := createInvitation(t, group, alice.ID, `{"max_uses": 1}`)
+	token := link["token"].(string)
+
+	if rr := answerInvitation(handlers.AcceptInvitation, token, bob.ID); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := answerInvitation(handlers.AcceptInvitation, token, carol.ID); rr.Code != http.StatusGone {
+		t.Errorf("Expected a used up link to be refused, got %d", rr.Code)
+	}
+
+	expiring := createInvitation(t, group, alice.ID, `{}`)
+	database.DB.Model(&models.GroupInvitation{}).Where("id = ?", expiring["id"]).Update("expires_at", time.Now().Add(-time.Minute))
+	if rr := answerInvitation(handlers.AcceptInvitation, expiring["token"].(string), carol.ID); rr.Code != http.StatusGone {
+		t.Errorf("Expected an expired link to be refused, got %d", rr.Code)
+	}
+}
+
+func TestGetAllUsersOnlyListsGroupmates(t *testing.T) {
+	group, alice, bob, carol := invitationFixture(t)
+	addMembers(group.ID, bob.ID)
+
+	req, _ := http.NewRequest("GET", "/api/users", nil)
+	rr := httptest.NewRecorder()
+	handlers.GetAllUsers(rr, withUser(req, alice.ID))
+
+	var users []struct {
+		ID uint `json:"id"`
+	}
+	json.NewDecoder(rr.Body).Decode(&users)
+	for _, u := range users {
+		if u.ID == carol.ID {
+			t.Error("Expected users outside the caller's groups to be hidden")
+		}
+	}
+	if len(users) != 2 {
+		t.Errorf("Expected alice and bob, got %v", users)
+	}
+}
+
+// tokenFromLink - The invitation link in the last sent mail
+func tokenFromLink(t *testing.T, m *fakeMailer) string {
+	if len(m.sent) == 0 {
+		t.Fatal("Expected a mail to be sent")
+	}
+	for _, field := range strings.Fields(m.sent[len(m.sent)-1].Body) {
+		if strings.HasPrefix(field, handlers.AppURL+"/invitations/") {
+			return field
+		}
+	}
+	t.Fatalf("No invitation link in mail: %s", m.sent[len(m.sent)-1].Body)
+	return ""
+}
+
+func TestInvitingUnknownUsersLooksLikeSuccess(t *testing.T) {
+	group, alice, bob, _ := invitationFixture(t)
+	mails := useFakeMailer(t)
+
+	req, _ := http.NewRequest("PUT", "/", bytes.NewBufferString(fmt.Sprintf(`{"user_ids": [%d, 9999]}`, bob.ID)))
+	req = mux.SetURLVars(req, map[string]string{"group_id": fmt.Sprint(group.ID)})
+	rr := httptest.NewRecorder()
+	handlers.UpdateGroupMembers(rr, withUser(req, alice.ID))
+
+	// The answer must not tell admins which user IDs exist
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if len(mails.sent) != 1 || mails.sent[0].To != "bob@example.com" {
+		t.Errorf("Expected only bob to be invited, got %+v", mails.sent)
+	}
+}
+
+func TestAcceptingTwiceKeepsOneMembership(t *testing.T) {
+	group, alice, bob, _ := invitationFixture(t)
+
+	first := createInvitation(t, group, alice.ID, `{}`)
+	second := createInvitation(t, group, alice.ID, `{}`)
+	if rr := answerInvitation(handlers.AcceptInvitation, first["token"].(string), bob.ID); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := answerInvitation(handlers.AcceptInvitation, second["token"].(string), bob.ID); rr.Code != http.StatusConflict {
+		t.Errorf("Expected 409 Conflict for an existing member, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	var count int64
+	database.DB.Model(&models.GroupUser{}).Where("group_id = ? AND user_id = ?", group.ID, bob.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected bob to be a member once, got %d memberships", count)
+	}
+	var unused models.GroupInvitation
+	database.DB.First(&unused, second["id"])
+	if unused.Uses != 0 {
+		t.Errorf("Expected the refused link not to be counted, got %d uses", unused.Uses)
+	}
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Account lockout after repeated failed logins; main overrides these from the config.
+// From the threshold on, every further failure doubles the lock, up to the maximum.
+var (
+	LoginLockoutThreshold = 5
+	LoginLockoutBase      = time.Minute
+	LoginLockoutMax       = time.Hour
+)
+
+// TooManyRequests - Responds 429 telling the client how many seconds to wait
+func TooManyRequests(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "Too many requests, please try again later", http.StatusTooManyRequests)
+}
+
+// lockedFor - How long the account is still locked; zero when it is not
+func lockedFor(user models.User) time.Duration {
+	if user.LockedUntil == nil {
+		return 0
+	}
+	if wait := time.Until(*user.LockedUntil); wait > 0 {
+		return wait
+	}
+	return 0
+}
+
+// lockoutDuration - Lock length after the given number of consecutive failures
+func lockoutDuration(failures int) time.Duration {
+	if LoginLockoutThreshold <= 0 || failures < LoginLockoutThreshold {
+		return 0
+	}
+	lock := LoginLockoutBase
+	for i := LoginLockoutThreshold; i < failures && lock < LoginLockoutMax; i++ {
+		lock *= 2
+	}
+	if lock > LoginLockoutMax {
+		lock = LoginLockoutMax
+	}
+	return lock
+}
+
+// recordLoginFailure - Counts a wrong password or 2FA code and locks the account when due
+func recordLoginFailure(userID uint) {
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).
+			Update("failed_logins", gorm.Expr("failed_logins + 1")).Error; err != nil {
+			return err
+		}
+		var user models.User
+		if err := tx.Select("id", "failed_logins").First(&user, userID).Error; err != nil {
+			return err
+		}
+		if lock := lockoutDuration(user.FailedLogins); lock > 0 {
+			fmt.Printf("🔒 Locking user %d for %v after %d failed logins\n", userID, lock, user.FailedLogins)
+			return tx.Model(&models.User{}).Where("id = ?", userID).Update("locked_until", time.Now().Add(lock)).Error
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println("❌ Error recording failed login:", err)
+	}
+}
+
+// resetLoginFailures - Clears the failure count once the user has fully logged in
+func resetLoginFailures(user models.User) {
+	if user.FailedLogins == 0 && user.LockedUntil == nil {
+		return
+	}
+	err := database.DB.Model(&models.User{}).Where("id = ?", user.ID).
+		Updates(map[string]interface{}{"failed_logins": 0, "locked_until": nil}).Error
+	if err != nil {
+		fmt.Println("❌ Error resetting failed logins:", err)
+	}
+}
@@ -0,0 +1,62 @@
+package handlers_test
+
+import (
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestLoginLockout(t *testing.T) {
+	database.SetupMockDB()
+	login(t, "alice")
+
+	wrong := map[string]string{"username": "alice", "password": "wrong"}
+	for i := 0; i < handlers.LoginLockoutThreshold; i++ {
+		if rr := postJSON(handlers.Login, wrong); rr.Code != http.StatusUnauthorized {
+			t.Fatalf("Attempt %d: expected 401 Unauthorized, got %d", i+1, rr.Code)
+		}
+	}
+
+	// Even the right password is refused while the account is locked
+	rr := postJSON(handlers.Login, map[string]string{"username": "alice", "password": "password123"})
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 Too Many Requests, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected Retry-After of 60 seconds, got %q", rr.Header().Get("Retry-After"))
+	}
+
+	// Once the lock expires the user can log in, which clears the failures
+	database.DB.Model(&models.User{}).Where("username = ?", "alice").Update("locked_until", time.Now().Add(-time.Second))
+	if rr := postJSON(handlers.Login, map[string]string{"username": "alice", "password": "password123"}); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK after the lock expired, got %d", rr.Code)
+	}
+	var user models.User
+	database.DB.Where("username = ?", "alice").First(&user)
+	if user.FailedLogins != 0 || user.LockedUntil != nil {
+		t.Errorf("Expected failures to be cleared, got %d (locked until %v)", user.FailedLogins, user.LockedUntil)
+	}
+}
+
+func TestLoginLockoutDoubles(t *testing.T) {
+	database.SetupMockDB()
+	login(t, "alice")
+
+	wrong := map[string]string{"username": "alice", "password": "wrong"}
+	for i := 0; i < handlers.LoginLockoutThreshold+2; i++ {
+		postJSON(handlers.Login, wrong)
+		// Skip the wait between attempts
+		database.DB.Model(&models.User{}).Where("username = ?", "alice").Update("locked_until", nil)
+	}
+	postJSON(handlers.Login, wrong)
+
+	var user models.User
+	database.DB.Where("username = ?", "alice").First(&user)
+	lock := time.Until(*user.LockedUntil)
+	if lock < 7*time.Minute || lock > 8*time.Minute {
+		t.Errorf("Expected an 8 minute lock after %d failures, got %v", user.FailedLogins, lock)
+	}
+}
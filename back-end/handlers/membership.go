@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-auth-app/authz"
+	"go-auth-app/models"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+var (
+	// errOwnerStays - The owner cannot leave members behind without an owner
+	errOwnerStays = errors.New("owner must transfer ownership first")
+	// errRoleChanged - The membership changed while updating it
+	errRoleChanged = errors.New("role changed concurrently")
+)
+
+// groupNetBalances - Balances of everyone in a group's expenses, as GetGroupBalances reports them
+func groupNetBalances(groupID interface{}) ([]userBalance, string, error) {
+	currency := groupBaseCurrency(groupID)
+	rows, err := loadLedger("e.group_id = ?", groupID)
+	if err == nil {
+		err = convertLedger(rows, currency)
+	}
+	if err != nil {
+		return nil, currency, err
+	}
+	return netBalances(rows), currency, nil
+}
+
+// RemoveGroupMember - Removes a user from the group. Refused while they have an
+// outstanding balance, unless the admin passes ?force=true. Admins can only be
+// removed by the owner, and the owner not at all.
+func RemoveGroupMember(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return
+	}
+	groupID, userID, ok := memberVars(w, r)
+	if !ok {
+		return
+	}
+
+	callerRole, _ := authz.GroupRole(groupID, callerID)
+	targetRole, isMember := authz.GroupRole(groupID, userID)
+	if isMember && userID != callerID {
+		if targetRole == authz.RoleOwner {
+			http.Error(w, "The group owner cannot be removed", http.StatusForbidden)
+			return
+		}
+		if targetRole == authz.RoleAdmin && callerRole != authz.RoleOwner {
+			http.Error(w, "Only the owner can remove an admin", http.StatusForbidden)
+			return
+		}
+	}
+
+	removeMember(w, groupID, userID, callerID, r.URL.Query().Get("force") == "true")
+}
+
+// LeaveGroup - Removes the caller from the group. Refused while they have an
+// outstanding balance; only admins may force it with ?force=true.
+func LeaveGroup(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return
+	}
+	groupID, err := strconv.ParseUint(mux.Vars(r)["group_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+
+	force := r.URL.Query().Get("force") == "true"
+	if force {
+		if role, _ := authz.GroupRole(uint(groupID), userID); authz.RoleLevel(role) < authz.Admin {
+			http.Error(w, "Only an admin can leave with an outstanding balance", http.StatusForbidden)
+			return
+		}
+	}
+
+	removeMember(w, uint(groupID), userID, userID, force)
+}
+
+// removeMember - Deletes the membership. Expenses and balances keep referring to
+// the user, so past expenses still show their name. Logged as member.left when
+// the actor removes themselves.
+func removeMember(w http.ResponseWriter, groupID, userID, actorID uint, force bool) {
+	role, ok := authz.GroupRole(groupID, userID)
+	if !ok {
+		http.Error(w, "User is not a member of this group", http.StatusNotFound)
+		return
+	}
+
+	if !force {
+		balances, currency, err := groupNetBalances(groupID)
+		if err != nil {
+			writeBalanceError(w, err)
+			return
+		}
+		for _, b := range balances {
+			if b.UserID == userID && b.NetBalance != 0 {
+				http.Error(w, fmt.Sprintf("User has an outstanding balance of %s %s; settle up first", b.NetBalance, currency), http.StatusConflict)
+				return
+			}
+		}
+	}
+
+	err := activityTransaction(func(tx *gorm.DB) error {
+		if role == authz.RoleOwner {
+			var others int64
+			if err := tx.Model(&models.GroupUser{}).Where("group_id = ? AND user_id <> ?", groupID, userID).Count(&others).Error; err != nil {
+				return err
+			}
+			if others > 0 {
+				return errOwnerStays
+			}
+		}
+		if err := tx.Where("group_id = ? AND user_id = ?", groupID, userID).Delete(&models.GroupUser{}).Error; err != nil {
+			return err
+		}
+		action := models.ActionMemberRemoved
+		if actorID == userID {
+			action = models.ActionMemberLeft
+		}
+		return recordActivity(tx, activity{
+			GroupID:  &groupID,
+			ActorID:  actorID,
+			Action:   action,
+			TargetID: userID,
+			Before:   memberSnapshot{UserID: userID, Role: role},
+		})
+	})
+	if errors.Is(err, errOwnerStays) {
+		http.Error(w, "The owner has to transfer ownership before leaving", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		fmt.Println("❌ Error removing group member:", err)
+		http.Error(w, "Error removing group member", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Member removed from group"})
+}
+
+// UpdateMemberRole - Promotes or demotes a member. Admins manage members and
+// their own role; demoting other admins and transferring ownership (role
+// "owner") is up to the owner, who becomes an admin.
+func UpdateMemberRole(w http.ResponseWriter, r *http.Request) {
+	callerID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return
+	}
+	groupID, userID, ok := memberVars(w, r)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Role string `json:"role"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if input.Role != authz.RoleMember && input.Role != authz.RoleAdmin && input.Role != authz.RoleOwner {
+		http.Error(w, "role must be member, admin or owner", http.StatusBadRequest)
+		return
+	}
+
+	callerRole, _ := authz.GroupRole(groupID, callerID)
+	targetRole, isMember := authz.GroupRole(groupID, userID)
+	switch {
+	case !isMember:
+		http.Error(w, "User is not a member of this group", http.StatusNotFound)
+		return
+	case targetRole == input.Role:
+		json.NewEncoder(w).Encode(map[string]string{"message": "Role updated successfully"})
+		return
+	case input.Role == authz.RoleOwner && callerRole != authz.RoleOwner:
+		http.Error(w, "Only the owner can transfer ownership", http.StatusForbidden)
+		return
+	case targetRole == authz.RoleOwner:
+		http.Error(w, "The owner's role only changes by transferring ownership", http.StatusConflict)
+		return
+	case targetRole == authz.RoleAdmin && userID != callerID && callerRole != authz.RoleOwner:
+		http.Error(w, "Only the owner can demote another admin", http.StatusForbidden)
+		return
+	}
+
+	err := activityTransaction(func(tx *gorm.DB) error {
+		if input.Role == authz.RoleOwner {
+			// The previous owner stays on as an admin
+			result := tx.Model(&models.GroupUser{}).
+				Where("group_id = ? AND user_id = ? AND role = ?", groupID, callerID, authz.RoleOwner).
+				Update("role", authz.RoleAdmin)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errRoleChanged
+			}
+			err := recordActivity(tx, activity{
+				GroupID:  &groupID,
+				ActorID:  callerID,
+				Action:   models.ActionMemberRoleChanged,
+				TargetID: callerID,
+				Before:   memberSnapshot{UserID: callerID, Role: authz.RoleOwner},
+				After:    memberSnapshot{UserID: callerID, Role: authz.RoleAdmin},
+			})
+			if err != nil {
+				return err
+			}
+		}
+		result := tx.Model(&models.GroupUser{}).
+			Where("group_id = ? AND user_id = ?", groupID, userID).
+			Update("role", input.Role)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errRoleChanged
+		}
+		return recordActivity(tx, activity{
+			GroupID:  &groupID,
+			ActorID:  callerID,
+			Action:   models.ActionMemberRoleChanged,
+			TargetID: userID,
+			Before:   memberSnapshot{UserID: userID, Role: targetRole},
+			After:    memberSnapshot{UserID: userID, Role: input.Role},
+		})
+	})
+	if errors.Is(err, errRoleChanged) {
+		http.Error(w, "Membership changed; please try again", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		fmt.Println("❌ Error updating member role:", err)
+		http.Error(w, "Error updating member role", http.StatusInternalServerError)
+		return
+	}
+
+	fmt.Printf("✅ User %d is now %s of group %d\n", userID, input.Role, groupID)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Role updated successfully"})
+}
+
+// memberVars - Parses the group_id and user_id route variables
+func memberVars(w http.ResponseWriter, r *http.Request) (uint, uint, bool) {
+	vars := mux.Vars(r)
+	groupID, err := strconv.ParseUint(vars["group_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	userID, err := strconv.ParseUint(vars["user_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, 0, false
+	}
+	return uint(groupID), uint(userID), true
+}
@@ -0,0 +1,207 @@
+package handlers_test
+
+import (
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// membershipFixture - alice (owner) paid 60 for a dinner that bob owes 30 of; carol owes nothing
+func membershipFixture(t *testing.T) (group models.Group, alice, bob, carol models.User) {
+	group, alice, bob, carol = invitationFixture(t)
+	addMembers(group.ID, bob.ID, carol.ID)
+
+	expense := models.Expense{Title: "Dinner", Amount: models.NewMoney(60), PaidBy: alice.ID, GroupID: &group.ID}
+	if err := database.DB.Create(&expense).Error; err != nil {
+		t.Fatalf("Failed to create expense: %v", err)
+	}
+	database.DB.Create(&models.ExpenseParticipant{ExpenseID: expense.ID, UserID: alice.ID, AmountOwed: models.NewMoney(30)})
+	database.DB.Create(&models.ExpenseParticipant{ExpenseID: expense.ID, UserID: bob.ID, AmountOwed: models.NewMoney(30)})
+	return
+}
+
+func removeMember(group models.Group, userID, callerID uint, query string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("DELETE", "/?"+query, nil)
+	req = mux.SetURLVars(req, map[string]string{"group_id": fmt.Sprint(group.ID), "user_id": fmt.Sprint(userID)})
+	rr := httptest.NewRecorder()
+	handlers.RemoveGroupMember(rr, withUser(req, callerID))
+	return rr
+}
+
+func leaveGroup(group models.Group, userID uint, query string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/?"+query, nil)
+	req = mux.SetURLVars(req, map[string]string{"group_id": fmt.Sprint(group.ID)})
+	rr := httptest.NewRecorder()
+	handlers.LeaveGroup(rr, withUser(req, userID))
+	return rr
+}
+
+func isMember(groupID, userID uint) bool {
+	var count int64
+	database.DB.Model(&models.GroupUser{}).Where("group_id = ? AND user_id = ?", groupID, userID).Count(&count)
+	return count > 0
+}
+
+func TestRemoveGroupMemberChecksBalance(t *testing.T) {
+	group, alice, bob, carol := membershipFixture(t)
+
+	rr := removeMember(group, bob.ID, alice.ID, "")
+	if rr.Code != http.StatusConflict {
+		t.Fatalf("Expected 409 Conflict for an outstanding balance, got %d", rr.Code)
+	}
+	if !strings.Contains(rr.Body.String(), "-30") {
+		t.Errorf("Expected the outstanding balance in the error, got %q", rr.Body.String())
+	}
+
+	// A settled member can be removed right away
+	if rr := removeMember(group, carol.ID, alice.ID, ""); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if isMember(group.ID, carol.ID) {
+		t.Error("Expected carol to be removed")
+	}
+
+	// Admins may force the removal
+	if rr := removeMember(group, bob.ID, alice.ID, "force=true"); rr.Code != http.StatusOK {
+		t.Fatalf("Expected forced removal to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if isMember(group.ID, bob.ID) {
+		t.Error("Expected bob to be removed")
+	}
+
+	// Past expenses still show the departed member
+	req, _ := http.NewRequest("GET", "/", nil)
+	req = mux.SetURLVars(req, map[string]string{"group_id": fmt.Sprint(group.ID)})
+	rr = httptest.NewRecorder()
+	handlers.GetGroupExpensesWithDetails(rr, req)
+	if !strings.Contains(rr.Body.String(), `"bob"`) {
+		t.Errorf("Expected bob's name in the group's expenses, got %s", rr.Body.String())
+	}
+}
+
+func TestLeaveGroup(t *testing.T) {
+	group, alice, bob, carol := membershipFixture(t)
+
+	// Members cannot force their way out of a debt
+	if rr := leaveGroup(group, bob.ID, ""); rr.Code != http.StatusConflict {
+		t.Errorf("Expected 409 Conflict, got %d", rr.Code)
+	}
+	if rr := leaveGroup(group, bob.ID, "force=true"); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 Forbidden for a member forcing, got %d", rr.Code)
+	}
+
+	if rr := leaveGroup(group, carol.ID, ""); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := leaveGroup(group, carol.ID, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 after leaving, got %d", rr.Code)
+	}
+
+	// The owner has to hand over before leaving
+	rr := leaveGroup(group, alice.ID, "force=true")
+	if rr.Code != http.StatusConflict {
+		t.Errorf("Expected the owner to be kept, got %d", rr.Code)
+	}
+	if !isMember(group.ID, alice.ID) {
+		t.Error("Expected alice to still be a member")
+	}
+}
+
+func setRole(group models.Group, userID, callerID uint, role string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("PUT", "/", strings.NewReader(fmt.Sprintf(`{"role": %q}`, role)))
+	req = mux.SetURLVars(req, map[string]string{"group_id": fmt.Sprint(group.ID), "user_id": fmt.Sprint(userID)})
+	rr := httptest.NewRecorder()
+	handlers.UpdateMemberRole(rr, withUser(req, callerID))
+	return rr
+}
+
+func roleOf(groupID, userID uint) string {
+	var membership models.GroupUser
+	database.DB.Where("group_id = ? AND user_id = ?", groupID, userID).First(&membership)
+	return membership.Role
+}
+
+func TestUpdateMemberRole(t *testing.T) {
+	group, alice, bob, carol := invitationFixture(t)
+	addMembers(group.ID, bob.ID, carol.ID)
+
+	if rr := setRole(group, bob.ID, alice.ID, "admin"); rr.Code != http.StatusOK {
+		t.Fatalf("Expected the owner to promote bob, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := setRole(group, carol.ID, bob.ID, "admin"); rr.Code != http.StatusOK {
+		t.Fatalf("Expected an admin to promote carol, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Admins cannot demote each other, the owner or take over the group
+	cases := []struct {
+		name     string
+		target   uint
+		role     string
+		wantCode int
+	}{
+		{"demote another admin", carol.ID, "member", http.StatusForbidden},
+		{"demote the owner", alice.ID, "member", http.StatusConflict},
+		{"transfer ownership", bob.ID, "owner", http.StatusForbidden},
+		{"unknown role", carol.ID, "superuser", http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		if rr := setRole(group, c.target, bob.ID, c.role); rr.Code != c.wantCode {
+			t.Errorf("%s: expected %d, got %d", c.name, c.wantCode, rr.Code)
+		}
+	}
+
+	// Only the owner removes admins
+	if rr := removeMember(group, carol.ID, bob.ID, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected an admin removing an admin to be refused, got %d", rr.Code)
+	}
+	if rr := removeMember(group, alice.ID, bob.ID, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected removing the owner to be refused, got %d", rr.Code)
+	}
+
+	// Transferring ownership keeps the previous owner on as an admin
+	if rr := setRole(group, carol.ID, alice.ID, "owner"); rr.Code != http.StatusOK {
+		t.Fatalf("Expected ownership transfer to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if roleOf(group.ID, carol.ID) != "owner" || roleOf(group.ID, alice.ID) != "admin" {
+		t.Errorf("Expected carol to own the group and alice to be admin, got %q and %q", roleOf(group.ID, carol.ID), roleOf(group.ID, alice.ID))
+	}
+
+	// Admins may step down themselves
+	if rr := setRole(group, alice.ID, alice.ID, "member"); rr.Code != http.StatusOK {
+		t.Errorf("Expected alice to step down, got %d", rr.Code)
+	}
+}
+
+func TestRenameGroup(t *testing.T) {
+	group, _, _, _ := invitationFixture(t)
+	database.DB.Create(&models.Group{Name: "Rent"})
+
+	rename := func(body string) int {
+		req, _ := http.NewRequest("PUT", "/", strings.NewReader(body))
+		req = mux.SetURLVars(req, map[string]string{"group_id": fmt.Sprint(group.ID)})
+		rr := httptest.NewRecorder()
+		handlers.RenameGroup(rr, req)
+		return rr.Code
+	}
+
+	if code := rename(`{"name": "Rent"}`); code != http.StatusConflict {
+		t.Errorf("Expected a taken name to be refused, got %d", code)
+	}
+	if code := rename(`{"name": "  "}`); code != http.StatusBadRequest {
+		t.Errorf("Expected an empty name to be refused, got %d", code)
+	}
+	if code := rename(`{"name": "Road trip"}`); code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d", code)
+	}
+	database.DB.First(&group, group.ID)
+	if group.Name != "Road trip" {
+		t.Errorf("Expected the group to be renamed, got %q", group.Name)
+	}
+}
@@ -0,0 +1,335 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"go-auth-app/totp"
+	"math/big"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+// TOTPIssuer is shown next to the account in authenticator apps
+const TOTPIssuer = "GatorSplit"
+
+// MFAChallengeTTL - How long a user has to enter their code after the password
+const MFAChallengeTTL = 5 * time.Minute
+
+// mfaAudience marks challenge tokens so they can never be used as access tokens
+const mfaAudience = "mfa"
+
+const recoveryCodeCount = 10
+
+var errInvalidMFACode = errors.New("invalid code")
+
+// issueMFAChallenge - Signs the token proving the password step succeeded
+func issueMFAChallenge(user models.User) (string, error) {
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		Subject:   strconv.FormatUint(uint64(user.ID), 10),
+		Audience:  jwt.ClaimStrings{mfaAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(MFAChallengeTTL)),
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(JwtKey)
+}
+
+// parseMFAChallenge - Returns the user ID of a valid, unexpired challenge token
+func parseMFAChallenge(tokenString string) (uint, error) {
+	claims := &jwt.RegisteredClaims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		return JwtKey, nil
+	})
+	if err != nil || !token.Valid || !claims.VerifyAudience(mfaAudience, true) {
+		return 0, errors.New("invalid challenge token")
+	}
+	userID, err := strconv.ParseUint(claims.Subject, 10, 64)
+	if err != nil {
+		return 0, errors.New("invalid challenge token")
+	}
+	return uint(userID), nil
+}
+
+// newRecoveryCodes - Generates codes such as "k3v9q-x7m2p"; only their hashes are kept
+func newRecoveryCodes() (codes []string, hashes []string, err error) {
+	const alphabet = "abcdefghjkmnpqrstuvwxyz23456789" // No look-alikes (0/o, 1/l/i)
+	for i := 0; i < recoveryCodeCount; i++ {
+		var b strings.Builder
+		for j := 0; j < 10; j++ {
+			if j == 5 {
+				b.WriteByte('-')
+			}
+			n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+			if err != nil {
+				return nil, nil, err
+			}
+			b.WriteByte(alphabet[n.Int64()])
+		}
+		code := b.String()
+		codes = append(codes, code)
+		hashes = append(hashes, hashToken(normalizeRecoveryCode(code)))
+	}
+	return codes, hashes, nil
+}
+
+// normalizeRecoveryCode - Codes are accepted regardless of case, spaces and dashes
+func normalizeRecoveryCode(code string) string {
+	return strings.NewReplacer("-", "", " ", "").Replace(strings.ToLower(strings.TrimSpace(code)))
+}
+
+// verifySecondFactor - Accepts a TOTP code or an unused recovery code for the user.
+// Both are consumed, so the same code can never be replayed.
+func verifySecondFactor(tx *gorm.DB, user models.User, code, recoveryCode string) error {
+	if code != "" {
+		step, ok := totp.Validate(user.TOTPSecret, code, time.Now())
+		if !ok {
+			return errInvalidMFACode
+		}
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidMFACode // Already used
+		}
+		return nil
+	}
+
+	if recoveryCode != "" {
+		result := tx.Model(&models.RecoveryCode{}).
+			Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, hashToken(normalizeRecoveryCode(recoveryCode))).
+			Update("used_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidMFACode
+		}
+		return nil
+	}
+
+	return errInvalidMFACode
+}
+
+// EnrollTOTP - Starts 2FA enrollment: returns a new secret, its otpauth:// URI
+// and recovery codes. 2FA is only enforced after ConfirmTOTP.
+func EnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		http.Error(w, "Error generating secret", http.StatusInternalServerError)
+		return
+	}
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Error generating recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&user).Updates(map[string]interface{}{"totp_secret": secret, "totp_last_step": 0}).Error; err != nil {
+			return err
+		}
+		// Codes from an earlier, unfinished enrollment are replaced
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		for _, hash := range hashes {
+			if err := tx.Create(&models.RecoveryCode{UserID: user.ID, CodeHash: hash}).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println("❌ Error enrolling TOTP:", err)
+		http.Error(w, "Error enrolling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"secret":         secret,
+		"otpauth_uri":    totp.URI(TOTPIssuer, user.Email, secret),
+		"recovery_codes": codes,
+	})
+}
+
+// ConfirmTOTP - Enables 2FA once the user proves their app generates valid codes
+func ConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Code string `json:"code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.Code == "" {
+		http.Error(w, "code is required", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.TOTPEnabledAt != nil {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if user.TOTPSecret == "" {
+		http.Error(w, "Start enrollment first", http.StatusBadRequest)
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(tx, user, input.Code, ""); err != nil {
+			return err
+		}
+		return tx.Model(&user).Update("totp_enabled_at", time.Now()).Error
+	})
+	if errors.Is(err, errInvalidMFACode) {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		fmt.Println("❌ Error confirming TOTP:", err)
+		http.Error(w, "Error enabling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication enabled"})
+}
+
+// DisableTOTP - Turns 2FA off; requires a current TOTP code or a recovery code
+func DisableTOTP(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.TOTPEnabledAt == nil {
+		http.Error(w, "Two-factor authentication is not enabled", http.StatusConflict)
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := verifySecondFactor(tx, user, input.Code, input.RecoveryCode); err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&user).Updates(map[string]interface{}{
+			"totp_secret":     "",
+			"totp_enabled_at": nil,
+			"totp_last_step":  0,
+		}).Error
+	})
+	if errors.Is(err, errInvalidMFACode) {
+		http.Error(w, "Invalid code", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		fmt.Println("❌ Error disabling TOTP:", err)
+		http.Error(w, "Error disabling two-factor authentication", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Two-factor authentication disabled"})
+}
+
+// LoginMFA - Second login step: exchanges the mfa_token from Login and a TOTP
+// code (or a recovery code) for the real access and refresh tokens
+func LoginMFA(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		MFAToken     string `json:"mfa_token"`
+		Code         string `json:"code"`
+		RecoveryCode string `json:"recovery_code"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.MFAToken == "" {
+		http.Error(w, "mfa_token is required", http.StatusBadRequest)
+		return
+	}
+	if input.Code == "" && input.RecoveryCode == "" {
+		http.Error(w, "code or recovery_code is required", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := parseMFAChallenge(input.MFAToken)
+	if err != nil {
+		http.Error(w, "Invalid or expired mfa_token", http.StatusUnauthorized)
+		return
+	}
+
+	var user models.User
+	if err := database.DB.First(&user, userID).Error; err != nil || user.TOTPEnabledAt == nil {
+		http.Error(w, "Invalid or expired mfa_token", http.StatusUnauthorized)
+		return
+	}
+
+	// Wrong codes count towards the same lockout as wrong passwords
+	if wait := lockedFor(user); wait > 0 {
+		TooManyRequests(w, wait)
+		return
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		return verifySecondFactor(tx, user, input.Code, input.RecoveryCode)
+	})
+	if errors.Is(err, errInvalidMFACode) {
+		recordLoginFailure(user.ID)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		fmt.Println("❌ Error verifying second factor:", err)
+		http.Error(w, "Error verifying code", http.StatusInternalServerError)
+		return
+	}
+
+	startSession(w, user)
+}
@@ -0,0 +1,127 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+	"go-auth-app/totp"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// enrollTOTP - Enrolls and confirms 2FA for the user, returning the secret and recovery codes
+func enrollTOTP(t *testing.T, userID uint) (string, []string) {
+	req, _ := http.NewRequest("POST", "/api/2fa/enroll", nil)
+	rr := httptest.NewRecorder()
+	handlers.EnrollTOTP(rr, withUser(req, userID))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Enroll failed: %d %s", rr.Code, rr.Body.String())
+	}
+
+	var enrollment struct {
+		Secret        string   `json:"secret"`
+		URI           string   `json:"otpauth_uri"`
+		RecoveryCodes []string `json:"recovery_codes"`
+	}
+	json.NewDecoder(rr.Body).Decode(&enrollment)
+	if !strings.HasPrefix(enrollment.URI, "otpauth://totp/") || len(enrollment.RecoveryCodes) != 10 {
+		t.Fatalf("Unexpected enrollment: %+v", enrollment)
+	}
+
+	// Use the previous step so the login test below can still use the current one
+	code, _ := totp.CodeAt(enrollment.Secret, totp.Step(time.Now())-1)
+	body, _ := json.Marshal(map[string]string{"code": code})
+	req, _ = http.NewRequest("POST", "/api/2fa/confirm", bytes.NewBuffer(body))
+	rr = httptest.NewRecorder()
+	handlers.ConfirmTOTP(rr, withUser(req, userID))
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Confirm failed: %d %s", rr.Code, rr.Body.String())
+	}
+	return enrollment.Secret, enrollment.RecoveryCodes
+}
+
+// mfaChallenge - Logs in with the password and returns the mfa_token
+func mfaChallenge(t *testing.T) string {
+	body, _ := json.Marshal(map[string]string{"username": "alice", "password": "password123"})
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handlers.Login(rr, req)
+
+	var response struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+		Token       string `json:"token"`
+	}
+	json.NewDecoder(rr.Body).Decode(&response)
+	if !response.MFARequired || response.MFAToken == "" || response.Token != "" {
+		t.Fatalf("Expected an MFA challenge instead of a token, got %+v", response)
+	}
+	return response.MFAToken
+}
+
+func TestLoginWithTOTP(t *testing.T) {
+	database.SetupMockDB()
+	login(t, "alice")
+	var user models.User
+	database.DB.Where("username = ?", "alice").First(&user)
+
+	secret, recoveryCodes := enrollTOTP(t, user.ID)
+	challenge := mfaChallenge(t)
+
+	// The challenge token is not an access token
+	if rr := postJSON(handlers.LoginMFA, map[string]string{"mfa_token": challenge, "code": "000000"}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a wrong code to be refused, got %d", rr.Code)
+	}
+
+	code, _ := totp.CodeAt(secret, totp.Step(time.Now()))
+	rr := postJSON(handlers.LoginMFA, map[string]string{"mfa_token": challenge, "code": code})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var tokens map[string]string
+	json.NewDecoder(rr.Body).Decode(&tokens)
+	if tokens["token"] == "" || tokens["refresh_token"] == "" {
+		t.Errorf("Expected access and refresh tokens, got %v", tokens)
+	}
+
+	// A code is only accepted once
+	if rr := postJSON(handlers.LoginMFA, map[string]string{"mfa_token": challenge, "code": code}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a replayed code to be refused, got %d", rr.Code)
+	}
+
+	// Recovery codes work once, in any case and without the dash
+	recovery := strings.ToUpper(strings.ReplaceAll(recoveryCodes[0], "-", ""))
+	if rr := postJSON(handlers.LoginMFA, map[string]string{"mfa_token": challenge, "recovery_code": recovery}); rr.Code != http.StatusOK {
+		t.Errorf("Expected the recovery code to be accepted, got %d", rr.Code)
+	}
+	if rr := postJSON(handlers.LoginMFA, map[string]string{"mfa_token": challenge, "recovery_code": recovery}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a used recovery code to be refused, got %d", rr.Code)
+	}
+}
+
+func TestConfirmTOTPRejectsWrongCode(t *testing.T) {
+	database.SetupMockDB()
+	user := models.User{Username: "alice", Email: "alice@example.com", Password: "secret"}
+	database.DB.Create(&user)
+
+	req, _ := http.NewRequest("POST", "/api/2fa/enroll", nil)
+	handlers.EnrollTOTP(httptest.NewRecorder(), withUser(req, user.ID))
+
+	body, _ := json.Marshal(map[string]string{"code": "123456x"})
+	req, _ = http.NewRequest("POST", "/api/2fa/confirm", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handlers.ConfirmTOTP(rr, withUser(req, user.ID))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 Bad Request, got %d", rr.Code)
+	}
+
+	database.DB.First(&user, user.ID)
+	if user.TOTPEnabledAt != nil {
+		t.Error("Expected 2FA to stay disabled until confirmed")
+	}
+}
@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// GetNotifications - Lists the caller's notifications, newest first, a page at
+// a time. `?unread=true` leaves out those already read.
+func GetNotifications(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return
+	}
+	limit, cursor, err := pageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := database.DB.Where("user_id = ?", userID)
+	if cursor > 0 {
+		query = query.Where("id < ?", cursor)
+	}
+	if r.URL.Query().Get("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+	notifications := []models.Notification{}
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&notifications).Error; err != nil {
+		http.Error(w, "Error retrieving notifications", http.StatusInternalServerError)
+		return
+	}
+
+	next := nextCursor(len(notifications), limit, func(i int) uint { return notifications[i].ID })
+	if next != nil {
+		notifications = notifications[:limit]
+	}
+	json.NewEncoder(w).Encode(page{Items: notifications, NextCursor: next})
+}
+
+// MarkNotificationRead - Marks one of the caller's notifications as read
+func MarkNotificationRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return
+	}
+
+	var notification models.Notification
+	if err := database.DB.Where("id = ? AND user_id = ?", mux.Vars(r)["notification_id"], userID).First(&notification).Error; err != nil {
+		http.Error(w, "Notification not found", http.StatusNotFound)
+		return
+	}
+	if notification.ReadAt == nil {
+		if err := database.DB.Model(&notification).Update("read_at", time.Now()).Error; err != nil {
+			fmt.Println("❌ Error updating notification:", err)
+			http.Error(w, "Error updating notification", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Notification marked as read"})
+}
+
+// MarkAllNotificationsRead - Marks every unread notification of the caller as read
+func MarkAllNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return
+	}
+
+	err := database.DB.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userID).
+		Update("read_at", time.Now()).Error
+	if err != nil {
+		fmt.Println("❌ Error updating notifications:", err)
+		http.Error(w, "Error updating notifications", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "All notifications marked as read"})
+}
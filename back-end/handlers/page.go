@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+// page - One page of a list. Pass NextCursor as `?cursor=` to get the next
+// page; it is null on the last one.
+type page struct {
+	Items      interface{} `json:"items"`
+	NextCursor *uint       `json:"next_cursor"`
+}
+
+// pageParams - Reads `?limit=` (default 50, at most 100) and `?cursor=`, the ID
+// the previous page ended at (0 for the first page)
+func pageParams(r *http.Request) (limit int, cursor uint, err error) {
+	limit = defaultPageSize
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 {
+			return 0, 0, errors.New("limit must be a positive number")
+		}
+		limit = min(limit, maxPageSize)
+	}
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		c, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return 0, 0, errors.New("invalid cursor")
+		}
+		cursor = uint(c)
+	}
+	return limit, cursor, nil
+}
+
+// nextCursor - The cursor after a page fetched with limit+1 rows: the ID of
+// its last item when there are more rows, nil otherwise
+func nextCursor(fetched, limit int, lastID func(i int) uint) *uint {
+	if fetched <= limit {
+		return nil
+	}
+	id := lastID(limit - 1)
+	return &id
+}
@@ -0,0 +1,580 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-auth-app/authz"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"go-auth-app/recurrence"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// maxCatchUp - Occurrences created for one recurring expense per scheduler run,
+// so a long outage is caught up over a few runs instead of one long one
+const maxCatchUp = 500
+
+// errRecurringChanged - The recurring expense changed since it was read: the
+// scheduler on another instance ran it, or another request edited it
+var errRecurringChanged = errors.New("recurring expense changed concurrently")
+
+// errNoRecurringGroup - Recurring splits are checked against a group's
+// members, so the expense must belong to one, directly or through its thread
+var errNoRecurringGroup = errors.New("recurring expenses must belong to a group")
+
+// splitSpec - How a recurring expense is split, as sent when it was created
+type splitSpec struct {
+	SplitWith []uint       `json:"split_with,omitempty"`
+	Splits    []SplitEntry `json:"splits,omitempty"`
+}
+
+// recurringExpenseResponse - A recurring expense with its split decoded
+type recurringExpenseResponse struct {
+	models.RecurringExpense
+	SplitWith []uint       `json:"split_with"`
+	Splits    []SplitEntry `json:"splits"`
+}
+
+func newRecurringExpenseResponse(rec models.RecurringExpense) recurringExpenseResponse {
+	var spec splitSpec
+	json.Unmarshal([]byte(rec.Split), &spec)
+	return recurringExpenseResponse{RecurringExpense: rec, SplitWith: spec.SplitWith, Splits: spec.Splits}
+}
+
+// CreateRecurringExpense - Creates a recurring expense in a group or thread. It
+// takes the fields of CreateExpense plus an RRULE-style `rule`, `starts_at`
+// (default now) and an optional `ends_at`.
+func CreateRecurringExpense(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Title     string       `json:"title"`
+		Amount    models.Money `json:"amount"`
+		Currency  string       `json:"currency"`
+		PaidBy    uint         `json:"paid_by"`
+		GroupID   *uint        `json:"group_id"`
+		ThreadID  *uint        `json:"thread_id"`
+		SplitType string       `json:"split_type"`
+		SplitWith []uint       `json:"split_with"`
+		Splits    []SplitEntry `json:"splits"`
+		Rule      string       `json:"rule"`
+		StartsAt  *time.Time   `json:"starts_at"`
+		EndsAt    *time.Time   `json:"ends_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.Title == "" {
+		http.Error(w, "Title is required", http.StatusBadRequest)
+		return
+	}
+
+	groupID, ok := resolveExpenseGroup(w, r, req.GroupID, req.ThreadID)
+	if !ok {
+		return
+	}
+	// Splits are checked against the group's members, so threads outside a group cannot recur
+	if groupID == nil {
+		http.Error(w, errNoRecurringGroup.Error(), http.StatusBadRequest)
+		return
+	}
+	paidBy, createdBy, ok := resolvePayer(w, r, req.PaidBy, groupID)
+	if !ok {
+		return
+	}
+
+	splitType := req.SplitType
+	if splitType == "" {
+		splitType = SplitEqual
+	}
+	spec := splitSpec{SplitWith: req.SplitWith, Splits: req.Splits}
+	if err := checkRecurringSplit(*groupID, req.Amount, paidBy, splitType, spec); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	currency, err := expenseCurrency(req.Currency, groupID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	rule, err := recurrence.Parse(req.Rule)
+	if err != nil {
+		http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	startsAt := time.Now().UTC().Truncate(time.Second)
+	if req.StartsAt != nil {
+		startsAt = req.StartsAt.UTC()
+	}
+
+	split, _ := json.Marshal(spec)
+	rec := models.RecurringExpense{
+		Title:     req.Title,
+		Amount:    req.Amount,
+		Currency:  currency,
+		PaidBy:    paidBy,
+		CreatedBy: createdBy,
+		GroupID:   groupID,
+		ThreadID:  req.ThreadID,
+		SplitType: splitType,
+		Split:     string(split),
+		Rule:      rule.String(),
+		StartsAt:  startsAt,
+		EndsAt:    req.EndsAt,
+	}
+	rec.NextRunAt = scheduleAfter(rec, nil)
+	if rec.NextRunAt == nil {
+		http.Error(w, "The schedule has no occurrences", http.StatusBadRequest)
+		return
+	}
+
+	err = activityTransaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&rec).Error; err != nil {
+			return err
+		}
+		a := recurringActivity(r, rec, models.ActionRecurringCreated)
+		a.After = newRecurringExpenseResponse(rec)
+		return recordActivity(tx, a)
+	})
+	if err != nil {
+		fmt.Println("❌ Error creating recurring expense:", err)
+		http.Error(w, "Error creating recurring expense", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(newRecurringExpenseResponse(rec))
+}
+
+// GetGroupRecurringExpenses - Lists the recurring expenses of a group
+func GetGroupRecurringExpenses(w http.ResponseWriter, r *http.Request) {
+	groupID := mux.Vars(r)["group_id"]
+
+	var recs []models.RecurringExpense
+	if err := database.DB.Where("group_id = ?", groupID).Order("id").Find(&recs).Error; err != nil {
+		http.Error(w, "Error retrieving recurring expenses", http.StatusInternalServerError)
+		return
+	}
+
+	if len(recs) == 0 {
+		json.NewEncoder(w).Encode([]struct{}{})
+		return
+	}
+	response := make([]recurringExpenseResponse, len(recs))
+	for i, rec := range recs {
+		response[i] = newRecurringExpenseResponse(rec)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpdateRecurringExpense - Edits a recurring expense. Every field is optional;
+// changes apply to future occurrences only, expenses already created stay as they are.
+func UpdateRecurringExpense(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Title     *string       `json:"title"`
+		Amount    *models.Money `json:"amount"`
+		Currency  *string       `json:"currency"`
+		PaidBy    *uint         `json:"paid_by"`
+		SplitType string        `json:"split_type"`
+		SplitWith []uint        `json:"split_with"`
+		Splits    []SplitEntry  `json:"splits"`
+		Rule      *string       `json:"rule"`
+		EndsAt    *time.Time    `json:"ends_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	rec, ok := findRecurringExpense(w, r)
+	if !ok {
+		return
+	}
+	updated := recurringActivity(r, rec, models.ActionRecurringUpdated)
+	updated.Before = newRecurringExpenseResponse(rec)
+
+	changes := map[string]interface{}{}
+	if req.Title != nil {
+		if *req.Title == "" {
+			http.Error(w, "Title cannot be empty", http.StatusBadRequest)
+			return
+		}
+		rec.Title = *req.Title
+		changes["title"] = rec.Title
+	}
+	if req.Currency != nil {
+		currency, err := normalizeCurrency(*req.Currency)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		rec.Currency = currency
+		changes["currency"] = currency
+	}
+	if req.PaidBy != nil && *req.PaidBy != rec.PaidBy {
+		paidBy, _, ok := resolvePayer(w, r, *req.PaidBy, rec.GroupID)
+		if !ok {
+			return
+		}
+		rec.PaidBy = paidBy
+		changes["paid_by"] = paidBy
+	}
+	if req.Amount != nil {
+		rec.Amount = *req.Amount
+		changes["amount"] = rec.Amount
+	}
+
+	// The split is checked again whenever it or what it depends on changes
+	var spec splitSpec
+	json.Unmarshal([]byte(rec.Split), &spec)
+	if req.SplitType != "" || len(req.SplitWith) > 0 || len(req.Splits) > 0 {
+		rec.SplitType = req.SplitType
+		if rec.SplitType == "" {
+			rec.SplitType = SplitEqual
+		}
+		spec = splitSpec{SplitWith: req.SplitWith, Splits: req.Splits}
+		split, _ := json.Marshal(spec)
+		changes["split_type"] = rec.SplitType
+		changes["split"] = string(split)
+	}
+	if rec.GroupID == nil {
+		http.Error(w, errNoRecurringGroup.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := checkRecurringSplit(*rec.GroupID, rec.Amount, rec.PaidBy, rec.SplitType, spec); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Rule != nil || req.EndsAt != nil {
+		if req.Rule != nil {
+			rule, err := recurrence.Parse(*req.Rule)
+			if err != nil {
+				http.Error(w, "Invalid rule: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			rec.Rule = rule.String()
+			changes["rule"] = rec.Rule
+		}
+		if req.EndsAt != nil {
+			rec.EndsAt = req.EndsAt
+			changes["ends_at"] = rec.EndsAt
+		}
+		// The new schedule continues after the last occurrence, without catching up
+		rec.NextRunAt = upcomingRun(rec, time.Now().UTC())
+		changes["next_run_at"] = rec.NextRunAt
+	}
+
+	if len(changes) == 0 {
+		json.NewEncoder(w).Encode(newRecurringExpenseResponse(rec))
+		return
+	}
+	updated.After = newRecurringExpenseResponse(rec)
+	if !saveRecurringChanges(w, rec, changes, updated) {
+		return
+	}
+	json.NewEncoder(w).Encode(newRecurringExpenseResponse(rec))
+}
+
+// PauseRecurringExpense - Stops creating expenses until the recurrence is resumed
+func PauseRecurringExpense(w http.ResponseWriter, r *http.Request) {
+	rec, ok := findRecurringExpense(w, r)
+	if !ok {
+		return
+	}
+	if rec.PausedAt == nil {
+		now := time.Now()
+		rec.PausedAt = &now
+		paused := recurringActivity(r, rec, models.ActionRecurringPaused)
+		if !saveRecurringChanges(w, rec, map[string]interface{}{"paused_at": now}, paused) {
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(newRecurringExpenseResponse(rec))
+}
+
+// ResumeRecurringExpense - Restarts a paused recurrence. Occurrences that fell
+// while it was paused are not created.
+func ResumeRecurringExpense(w http.ResponseWriter, r *http.Request) {
+	rec, ok := findRecurringExpense(w, r)
+	if !ok {
+		return
+	}
+	if rec.PausedAt != nil {
+		rec.PausedAt = nil
+		rec.NextRunAt = upcomingRun(rec, time.Now().UTC())
+		changes := map[string]interface{}{"paused_at": nil, "next_run_at": rec.NextRunAt}
+		if !saveRecurringChanges(w, rec, changes, recurringActivity(r, rec, models.ActionRecurringResumed)) {
+			return
+		}
+	}
+	json.NewEncoder(w).Encode(newRecurringExpenseResponse(rec))
+}
+
+// SkipRecurringExpense - Skips the next occurrence without creating its expense
+func SkipRecurringExpense(w http.ResponseWriter, r *http.Request) {
+	rec, ok := findRecurringExpense(w, r)
+	if !ok {
+		return
+	}
+	if rec.NextRunAt == nil {
+		http.Error(w, "The schedule has ended", http.StatusConflict)
+		return
+	}
+
+	skipped := *rec.NextRunAt
+	rec.LastRunAt = &skipped
+	rec.NextRunAt = scheduleAfter(rec, &skipped)
+	changes := map[string]interface{}{"runs": rec.Runs + 1, "last_run_at": skipped, "next_run_at": rec.NextRunAt}
+	skip := recurringActivity(r, rec, models.ActionRecurringSkipped)
+	skip.After = map[string]interface{}{"skipped": skipped, "next_run_at": rec.NextRunAt}
+	if !saveRecurringChanges(w, rec, changes, skip) {
+		return
+	}
+	rec.Runs++
+
+	fmt.Printf("⏭️ Skipped occurrence %s of recurring expense %d\n", skipped.Format(time.RFC3339), rec.ID)
+	json.NewEncoder(w).Encode(newRecurringExpenseResponse(rec))
+}
+
+// DeleteRecurringExpense - Ends a recurrence; expenses it created are kept
+func DeleteRecurringExpense(w http.ResponseWriter, r *http.Request) {
+	rec, ok := findRecurringExpense(w, r)
+	if !ok {
+		return
+	}
+
+	err := activityTransaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&models.RecurringExpense{}, rec.ID).Error; err != nil {
+			return err
+		}
+		a := recurringActivity(r, rec, models.ActionRecurringDeleted)
+		a.Before = newRecurringExpenseResponse(rec)
+		return recordActivity(tx, a)
+	})
+	if err != nil {
+		fmt.Println("❌ Error deleting recurring expense:", err)
+		http.Error(w, "Error deleting recurring expense", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Recurring expense deleted successfully"})
+}
+
+func findRecurringExpense(w http.ResponseWriter, r *http.Request) (models.RecurringExpense, bool) {
+	var rec models.RecurringExpense
+	if err := database.DB.First(&rec, mux.Vars(r)["recurring_id"]).Error; err != nil {
+		http.Error(w, "Recurring expense not found", http.StatusNotFound)
+		return rec, false
+	}
+	return rec, true
+}
+
+// recurringActivity - The activity log entry for a change to the recurring expense
+func recurringActivity(r *http.Request, rec models.RecurringExpense, action string) activity {
+	return activity{GroupID: rec.GroupID, ActorID: actorOf(r), Action: action, TargetID: rec.ID}
+}
+
+// saveRecurringChanges - Writes the changes and logs them, refusing them when
+// the scheduler or another request got there first
+func saveRecurringChanges(w http.ResponseWriter, rec models.RecurringExpense, changes map[string]interface{}, a activity) bool {
+	err := activityTransaction(func(tx *gorm.DB) error {
+		if err := updateRecurring(tx, rec, changes); err != nil {
+			return err
+		}
+		return recordActivity(tx, a)
+	})
+	if errors.Is(err, errRecurringChanged) {
+		http.Error(w, "The recurring expense changed in the meantime; please try again", http.StatusConflict)
+		return false
+	}
+	if err != nil {
+		fmt.Println("❌ Error updating recurring expense:", err)
+		http.Error(w, "Error updating recurring expense", http.StatusInternalServerError)
+		return false
+	}
+	return true
+}
+
+// updateRecurring - Applies the changes only if no occurrence ran since rec was
+// read. Runs acts as the version: two schedulers can never create the same occurrence.
+func updateRecurring(db *gorm.DB, rec models.RecurringExpense, changes map[string]interface{}) error {
+	result := db.Model(&models.RecurringExpense{}).Where("id = ? AND runs = ?", rec.ID, rec.Runs).Updates(changes)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return errRecurringChanged
+	}
+	return nil
+}
+
+// checkRecurringSplit - Validates a split the way CreateExpense would
+func checkRecurringSplit(groupID uint, amount models.Money, paidBy uint, splitType string, spec splitSpec) error {
+	participants, err := computeSplit(amount, paidBy, splitType, spec.SplitWith, spec.Splits)
+	if err != nil {
+		return err
+	}
+	userIDs := []uint{paidBy}
+	for _, p := range participants {
+		userIDs = append(userIDs, p.UserID)
+	}
+	return checkGroupMembers(groupID, userIDs)
+}
+
+// scheduleAfter - The first occurrence after the given one (or the very first),
+// or nil once the schedule has ended
+func scheduleAfter(rec models.RecurringExpense, after *time.Time) *time.Time {
+	rule, err := recurrence.Parse(rec.Rule)
+	if err != nil {
+		return nil
+	}
+
+	start := rec.StartsAt.UTC()
+	var next time.Time
+	var ok bool
+	if after == nil {
+		next, ok = rule.First(start)
+	} else {
+		next, ok = rule.After(start, after.UTC())
+	}
+	if !ok || (rec.EndsAt != nil && next.After(*rec.EndsAt)) {
+		return nil
+	}
+	return &next
+}
+
+// upcomingRun - The next occurrence after the last one, skipping any already in the past
+func upcomingRun(rec models.RecurringExpense, now time.Time) *time.Time {
+	next := scheduleAfter(rec, rec.LastRunAt)
+	if next != nil && next.Before(now) {
+		next = scheduleAfter(rec, &now)
+	}
+	return next
+}
+
+// RunRecurringExpenses - Creates the expenses of every occurrence that is due.
+// Safe to run on several instances at once and to re-run after a crash: each
+// occurrence is claimed by advancing its recurrence, in the same transaction
+// that creates its expense.
+func RunRecurringExpenses(now time.Time) (int, error) {
+	var due []models.RecurringExpense
+	if err := database.DB.Where("next_run_at <= ? AND paused_at IS NULL", now).Order("next_run_at").Find(&due).Error; err != nil {
+		return 0, err
+	}
+
+	created := 0
+	var firstErr error
+	for _, rec := range due {
+		for i := 0; i < maxCatchUp && rec.NextRunAt != nil && !rec.NextRunAt.After(now) && rec.PausedAt == nil; i++ {
+			ok, err := runOccurrence(&rec)
+			if errors.Is(err, errRecurringChanged) {
+				// Someone else moved it on; carry on from where they left it
+				if err := database.DB.First(&rec, rec.ID).Error; err != nil {
+					break
+				}
+				continue
+			}
+			if err != nil {
+				if firstErr == nil {
+					firstErr = fmt.Errorf("recurring expense %d: %w", rec.ID, err)
+				}
+				break
+			}
+			if ok {
+				created++
+			}
+		}
+	}
+	return created, firstErr
+}
+
+// runOccurrence - Claims the next occurrence and creates its expense. Returns
+// false when the occurrence was skipped because the expense can no longer be created.
+func runOccurrence(rec *models.RecurringExpense) (bool, error) {
+	occurrence := rec.NextRunAt.UTC()
+	next := scheduleAfter(*rec, &occurrence)
+
+	expense, participants, err := occurrenceExpense(*rec, occurrence)
+	if err != nil {
+		fmt.Printf("⏭️ Skipping occurrence %s of recurring expense %d: %v\n", occurrence.Format(time.RFC3339), rec.ID, err)
+	}
+
+	err = activityTransaction(func(tx *gorm.DB) error {
+		changes := map[string]interface{}{"runs": rec.Runs + 1, "last_run_at": occurrence, "next_run_at": next}
+		if err := updateRecurring(tx, *rec, changes); err != nil {
+			return err
+		}
+		if expense == nil {
+			return nil
+		}
+		// The unique index guarantees it too, but an existing expense is not an error
+		var existing int64
+		if err := tx.Unscoped().Model(&models.Expense{}).
+			Where("recurring_expense_id = ? AND occurrence_at = ?", rec.ID, occurrence).
+			Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			expense = nil
+			return nil
+		}
+		// Logged as created by the server
+		return createExpense(tx, expense, participants, activity{GroupID: rec.GroupID, Action: models.ActionExpenseCreated})
+	})
+	if err != nil {
+		return false, err
+	}
+
+	rec.Runs++
+	rec.LastRunAt = &occurrence
+	rec.NextRunAt = next
+	return expense != nil, nil
+}
+
+// occurrenceExpense - Builds the expense of one occurrence, dated at the occurrence.
+// Fails when its group or thread is archived or deleted, or the split no longer
+// fits the group's members.
+func occurrenceExpense(rec models.RecurringExpense, occurrence time.Time) (*models.Expense, []models.ExpenseParticipant, error) {
+	scope, err := authz.RecurringExpenseScope(rec.ID)
+	if err == nil {
+		err = authz.Writable(scope)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var spec splitSpec
+	if err := json.Unmarshal([]byte(rec.Split), &spec); err != nil {
+		return nil, nil, err
+	}
+	if rec.GroupID == nil {
+		return nil, nil, errNoRecurringGroup
+	}
+	if err := checkRecurringSplit(*rec.GroupID, rec.Amount, rec.PaidBy, rec.SplitType, spec); err != nil {
+		return nil, nil, err
+	}
+	participants, err := computeSplit(rec.Amount, rec.PaidBy, rec.SplitType, spec.SplitWith, spec.Splits)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	expense := &models.Expense{
+		Title:              rec.Title,
+		Amount:             rec.Amount,
+		Currency:           rec.Currency,
+		PaidBy:             rec.PaidBy,
+		CreatedBy:          rec.CreatedBy,
+		GroupID:            rec.GroupID,
+		ThreadID:           rec.ThreadID,
+		RecurringExpenseID: &rec.ID,
+		OccurrenceAt:       &occurrence,
+	}
+	// Dated at the occurrence, so a late run converts currencies at the right rate
+	expense.CreatedAt = occurrence
+	return expense, participants, nil
+}
@@ -0,0 +1,182 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// createRecurring - Creates a monthly rent split between alice and bob, starting on January 1st
+func createRecurring(t *testing.T, group models.Group, alice, bob models.User) models.RecurringExpense {
+	body := fmt.Sprintf(`{"title": "Rent", "amount": 1000, "group_id": %d, "split_with": [%d, %d],
+		"rule": "FREQ=MONTHLY", "starts_at": "2026-01-01T09:00:00Z"}`, group.ID, alice.ID, bob.ID)
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handlers.CreateRecurringExpense(rr, withUser(req, alice.ID))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 Created, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var rec models.RecurringExpense
+	json.NewDecoder(rr.Body).Decode(&rec)
+	return rec
+}
+
+// recurringRequest - Calls a handler routed by recurring_id on behalf of the user
+func recurringRequest(handler http.HandlerFunc, recurringID, userID uint, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{"recurring_id": fmt.Sprint(recurringID)})
+	rr := httptest.NewRecorder()
+	handler(rr, withUser(req, userID))
+	return rr
+}
+
+func occurrences(recurringID uint) []string {
+	var expenses []models.Expense
+	database.DB.Where("recurring_expense_id = ?", recurringID).Order("occurrence_at").Find(&expenses)
+	var dates []string
+	for _, e := range expenses {
+		dates = append(dates, e.OccurrenceAt.UTC().Format("2006-01-02"))
+	}
+	return dates
+}
+
+func TestRunRecurringExpenses(t *testing.T) {
+	group, alice, bob, _ := invitationFixture(t)
+	addMembers(group.ID, bob.ID)
+	rec := createRecurring(t, group, alice, bob)
+
+	// Three months are due; running again, as another instance would, creates nothing more
+	now := time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)
+	for i, want := range []int{3, 0} {
+		created, err := handlers.RunRecurringExpenses(now)
+		if err != nil || created != want {
+			t.Fatalf("Run %d: expected %d expenses, got %d, %v", i+1, want, created, err)
+		}
+	}
+	if got := strings.Join(occurrences(rec.ID), ","); got != "2026-01-01,2026-02-01,2026-03-01" {
+		t.Errorf("Unexpected occurrences %s", got)
+	}
+
+	var participants []models.ExpenseParticipant
+	database.DB.Joins("JOIN expenses ON expenses.id = expense_participants.expense_id").
+		Where("expenses.recurring_expense_id = ?", rec.ID).Find(&participants)
+	if len(participants) != 6 || participants[0].AmountOwed != models.NewMoney(500) {
+		t.Errorf("Expected each occurrence split in two, got %+v", participants)
+	}
+
+	database.DB.First(&rec, rec.ID)
+	if rec.Runs != 3 || rec.NextRunAt == nil || rec.NextRunAt.UTC().Format("2006-01-02") != "2026-04-01" {
+		t.Errorf("Expected the next run on April 1st after 3 runs, got %v after %d", rec.NextRunAt, rec.Runs)
+	}
+}
+
+func TestPauseSkipAndResumeRecurringExpense(t *testing.T) {
+	group, alice, bob, _ := invitationFixture(t)
+	addMembers(group.ID, bob.ID)
+	rec := createRecurring(t, group, alice, bob)
+
+	if rr := recurringRequest(handlers.SkipRecurringExpense, rec.ID, alice.ID, ""); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := recurringRequest(handlers.PauseRecurringExpense, rec.ID, alice.ID, ""); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if created, _ := handlers.RunRecurringExpenses(time.Date(2026, 3, 15, 0, 0, 0, 0, time.UTC)); created != 0 {
+		t.Errorf("Expected nothing created while paused, got %d", created)
+	}
+
+	// Resuming continues from now: occurrences missed while paused are not created
+	if rr := recurringRequest(handlers.ResumeRecurringExpense, rec.ID, alice.ID, ""); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	database.DB.First(&rec, rec.ID)
+	if rec.PausedAt != nil || rec.NextRunAt == nil || !rec.NextRunAt.After(time.Now()) {
+		t.Errorf("Expected the next run in the future, got %v", rec.NextRunAt)
+	}
+	if got := occurrences(rec.ID); len(got) != 0 {
+		t.Errorf("Expected no occurrences, got %v", got)
+	}
+}
+
+func TestUpdateRecurringExpense(t *testing.T) {
+	group, alice, bob, _ := invitationFixture(t)
+	addMembers(group.ID, bob.ID)
+	rec := createRecurring(t, group, alice, bob)
+	handlers.RunRecurringExpenses(time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC))
+
+	// The occurrence already created keeps the old amount
+	body := `{"amount": 1200, "rule": "FREQ=MONTHLY;BYMONTHDAY=15"}`
+	rr := recurringRequest(handlers.UpdateRecurringExpense, rec.ID, alice.ID, body)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var expense models.Expense
+	database.DB.Where("recurring_expense_id = ?", rec.ID).First(&expense)
+	if expense.Amount != models.NewMoney(1000) {
+		t.Errorf("Expected the past occurrence to keep its amount, got %v", expense.Amount)
+	}
+
+	database.DB.First(&rec, rec.ID)
+	if rec.Amount != models.NewMoney(1200) || rec.NextRunAt == nil || rec.NextRunAt.Day() != 15 {
+		t.Errorf("Expected the new amount and schedule, got %v on %v", rec.Amount, rec.NextRunAt)
+	}
+
+	// A split that no longer adds up is refused
+	body = fmt.Sprintf(`{"split_type": "exact", "splits": [{"user_id": %d, "amount": 10}]}`, bob.ID)
+	if rr := recurringRequest(handlers.UpdateRecurringExpense, rec.ID, alice.ID, body); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 Bad Request, got %d", rr.Code)
+	}
+}
+
+func TestRecurringExpenseSkipsArchivedGroup(t *testing.T) {
+	group, alice, bob, _ := invitationFixture(t)
+	addMembers(group.ID, bob.ID)
+	rec := createRecurring(t, group, alice, bob)
+	database.DB.Model(&models.Group{}).Where("id = ?", group.ID).Update("archived_at", time.Now())
+
+	created, err := handlers.RunRecurringExpenses(time.Date(2026, 1, 15, 0, 0, 0, 0, time.UTC))
+	if err != nil || created != 0 {
+		t.Fatalf("Expected nothing created in an archived group, got %d, %v", created, err)
+	}
+	database.DB.First(&rec, rec.ID)
+	if rec.Runs != 1 {
+		t.Errorf("Expected the occurrence to be skipped, got %d runs", rec.Runs)
+	}
+}
+
+func TestRecurringExpenseRequiresGroup(t *testing.T) {
+	_, alice, _, _ := invitationFixture(t)
+	thread := models.Thread{Name: "Loose ends", CreatedBy: alice.ID}
+	database.DB.Create(&thread)
+
+	body := fmt.Sprintf(`{"title": "Rent", "amount": 1000, "thread_id": %d, "split_with": [%d],
+		"rule": "FREQ=MONTHLY", "starts_at": "2026-01-01T09:00:00Z"}`, thread.ID, alice.ID)
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handlers.CreateRecurringExpense(rr, withUser(req, alice.ID))
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for a thread outside any group, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// One left over without a group is skipped by the scheduler rather than crashing it
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+	rec := models.RecurringExpense{Title: "Rent", Amount: models.NewMoney(1000), Currency: "USD", PaidBy: alice.ID, CreatedBy: alice.ID,
+		ThreadID: &thread.ID, SplitType: handlers.SplitEqual, Split: fmt.Sprintf(`{"split_with": [%d]}`, alice.ID),
+		Rule: "FREQ=MONTHLY", StartsAt: start, NextRunAt: &start}
+	database.DB.Create(&rec)
+	if created, _ := handlers.RunRecurringExpenses(start.Add(time.Hour)); created != 0 {
+		t.Errorf("Expected nothing created, got %d", created)
+	}
+	if rr := recurringRequest(handlers.UpdateRecurringExpense, rec.ID, alice.ID, `{"amount": 900}`); rr.Code != http.StatusBadRequest {
+		t.Errorf("Expected 400 updating it, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"encoding/json"
+	"go-auth-app/models"
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+)
+
+// Values for the `mode` query parameter of the settle-plan endpoints
+const (
+	SettleModeSimplify = "simplify" // Net everyone's balance, then match debtors to creditors
+	SettleModePairwise = "pairwise" // Only settle debts between people who actually shared expenses
+)
+
+// transfer - One payment in a settle-up plan
+type transfer struct {
+	From         uint         `json:"from"`
+	FromUsername string       `json:"from_username"`
+	To           uint         `json:"to"`
+	ToUsername   string       `json:"to_username"`
+	Amount       models.Money `json:"amount"`
+}
+
+// GetGroupSettlePlan - Suggests the transfers that settle every balance in a group
+func GetGroupSettlePlan(w http.ResponseWriter, r *http.Request) {
+	groupID := mux.Vars(r)["group_id"]
+	writeSettlePlan(w, r, groupBaseCurrency(groupID), "e.group_id = ?", groupID)
+}
+
+// GetThreadSettlePlan - Suggests the transfers that settle every balance in a thread
+func GetThreadSettlePlan(w http.ResponseWriter, r *http.Request) {
+	threadID := mux.Vars(r)["thread_id"]
+	writeSettlePlan(w, r, threadBaseCurrency(threadID), "e.thread_id = ?", threadID)
+}
+
+func writeSettlePlan(w http.ResponseWriter, r *http.Request, currency string, condition string, args ...interface{}) {
+	mode := r.URL.Query().Get("mode")
+	if mode == "" {
+		mode = SettleModeSimplify
+	}
+	if mode != SettleModeSimplify && mode != SettleModePairwise {
+		http.Error(w, "Invalid mode, expected simplify or pairwise", http.StatusBadRequest)
+		return
+	}
+
+	rows, err := loadLedger(condition, args...)
+	if err == nil {
+		err = convertLedger(rows, currency)
+	}
+	if err != nil {
+		writeBalanceError(w, err)
+		return
+	}
+
+	var transfers []transfer
+	if mode == SettleModePairwise {
+		transfers = pairwiseDebts(rows)
+	} else {
+		transfers = simplifyDebts(netBalances(rows))
+	}
+	fillTransferNames(transfers)
+
+	if transfers == nil {
+		transfers = []transfer{}
+	}
+	json.NewEncoder(w).Encode(struct {
+		Currency  string     `json:"currency"`
+		Mode      string     `json:"mode"`
+		Transfers []transfer `json:"transfers"`
+	}{currency, mode, transfers})
+}
+
+// simplifyDebts - Greedily pays the largest creditor from the largest debtor.
+// This zeroes every balance in at most n-1 transfers.
+func simplifyDebts(balances []userBalance) []transfer {
+	type position struct {
+		userID uint
+		amount models.Money
+	}
+	var debtors, creditors []position
+	for _, b := range balances {
+		switch {
+		case b.NetBalance < 0:
+			debtors = append(debtors, position{b.UserID, -b.NetBalance})
+		case b.NetBalance > 0:
+			creditors = append(creditors, position{b.UserID, b.NetBalance})
+		}
+	}
+
+	byAmount := func(p []position) func(i, j int) bool {
+		return func(i, j int) bool {
+			if p[i].amount != p[j].amount {
+				return p[i].amount > p[j].amount
+			}
+			return p[i].userID < p[j].userID
+		}
+	}
+
+	var transfers []transfer
+	for len(debtors) > 0 && len(creditors) > 0 {
+		sort.Slice(debtors, byAmount(debtors))
+		sort.Slice(creditors, byAmount(creditors))
+
+		amount := debtors[0].amount
+		if creditors[0].amount < amount {
+			amount = creditors[0].amount
+		}
+		transfers = append(transfers, transfer{From: debtors[0].userID, To: creditors[0].userID, Amount: amount})
+
+		debtors[0].amount -= amount
+		creditors[0].amount -= amount
+		if debtors[0].amount == 0 {
+			debtors = debtors[1:]
+		}
+		if creditors[0].amount == 0 {
+			creditors = creditors[1:]
+		}
+	}
+	return transfers
+}
+
+// pairwiseDebts - Nets what each pair of users owes one another, without
+// routing money through anyone else
+func pairwiseDebts(rows []ledgerRow) []transfer {
+	type pair struct{ a, b uint } // a < b; positive amount means a owes b
+	owed := make(map[pair]models.Money)
+
+	for _, row := range rows {
+		if row.UserID == row.PaidBy {
+			continue
+		}
+		if row.UserID < row.PaidBy {
+			owed[pair{row.UserID, row.PaidBy}] += row.AmountOwed
+		} else {
+			owed[pair{row.PaidBy, row.UserID}] -= row.AmountOwed
+		}
+	}
+
+	var transfers []transfer
+	for p, amount := range owed {
+		switch {
+		case amount > 0:
+			transfers = append(transfers, transfer{From: p.a, To: p.b, Amount: amount})
+		case amount < 0:
+			transfers = append(transfers, transfer{From: p.b, To: p.a, Amount: -amount})
+		}
+	}
+	sort.Slice(transfers, func(i, j int) bool {
+		if transfers[i].From != transfers[j].From {
+			return transfers[i].From < transfers[j].From
+		}
+		return transfers[i].To < transfers[j].To
+	})
+	return transfers
+}
+
+func fillTransferNames(transfers []transfer) {
+	var ids []uint
+	for _, t := range transfers {
+		ids = append(ids, t.From, t.To)
+	}
+	names := usernames(ids)
+	for i := range transfers {
+		transfers[i].FromUsername = names[transfers[i].From]
+		transfers[i].ToUsername = names[transfers[i].To]
+	}
+}
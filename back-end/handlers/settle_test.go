@@ -0,0 +1,83 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+
+	"github.com/gorilla/mux"
+)
+
+func TestGetGroupSettlePlan(t *testing.T) {
+	database.SetupMockDB()
+
+	// Alice paid 30 for Bob, Bob paid 30 for Carol.
+	alice := models.User{Username: "alice", Email: "alice@example.com"}
+	bob := models.User{Username: "bob", Email: "bob@example.com"}
+	carol := models.User{Username: "carol", Email: "carol@example.com"}
+	database.DB.Create(&alice)
+	database.DB.Create(&bob)
+	database.DB.Create(&carol)
+
+	group := models.Group{Name: "Flatmates"}
+	database.DB.Create(&group)
+
+	exp1 := models.Expense{Title: "Lunch", Amount: models.NewMoney(30), PaidBy: alice.ID, GroupID: &group.ID}
+	database.DB.Create(&exp1)
+	database.DB.Create(&models.ExpenseParticipant{ExpenseID: exp1.ID, UserID: bob.ID, AmountOwed: models.NewMoney(30)})
+
+	exp2 := models.Expense{Title: "Cinema", Amount: models.NewMoney(30), PaidBy: bob.ID, GroupID: &group.ID}
+	database.DB.Create(&exp2)
+	database.DB.Create(&models.ExpenseParticipant{ExpenseID: exp2.ID, UserID: carol.ID, AmountOwed: models.NewMoney(30)})
+
+	type planResponse struct {
+		Mode      string `json:"mode"`
+		Transfers []struct {
+			From   uint         `json:"from"`
+			To     uint         `json:"to"`
+			Amount models.Money `json:"amount"`
+		} `json:"transfers"`
+	}
+
+	getPlan := func(mode string) planResponse {
+		req, _ := http.NewRequest("GET", "/groups/1/settle-plan?mode="+mode, nil)
+		req = mux.SetURLVars(req, map[string]string{"group_id": fmt.Sprintf("%d", group.ID)})
+		rr := httptest.NewRecorder()
+		handlers.GetGroupSettlePlan(rr, req)
+		if rr.Code != http.StatusOK {
+			t.Fatalf("Expected status 200, got %d: %s", rr.Code, rr.Body.String())
+		}
+		var plan planResponse
+		if err := json.NewDecoder(rr.Body).Decode(&plan); err != nil {
+			t.Fatalf("Failed to decode response: %v", err)
+		}
+		return plan
+	}
+
+	// Simplified: Bob is even, so Carol pays Alice directly.
+	plan := getPlan("simplify")
+	if len(plan.Transfers) != 1 {
+		t.Fatalf("Expected 1 simplified transfer, got %d", len(plan.Transfers))
+	}
+	if got := plan.Transfers[0]; got.From != carol.ID || got.To != alice.ID || got.Amount != models.NewMoney(30) {
+		t.Errorf("Unexpected simplified transfer: %+v", got)
+	}
+
+	// Pairwise: each debt is settled with the person it was incurred with.
+	plan = getPlan("pairwise")
+	if len(plan.Transfers) != 2 {
+		t.Fatalf("Expected 2 pairwise transfers, got %d", len(plan.Transfers))
+	}
+	if got := plan.Transfers[0]; got.From != bob.ID || got.To != alice.ID {
+		t.Errorf("Unexpected first pairwise transfer: %+v", got)
+	}
+	if got := plan.Transfers[1]; got.From != carol.ID || got.To != bob.ID {
+		t.Errorf("Unexpected second pairwise transfer: %+v", got)
+	}
+}
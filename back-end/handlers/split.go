@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"go-auth-app/models"
+	"math"
+)
+
+// Supported values for the `split_type` field of an expense request
+const (
+	SplitEqual   = "equal"
+	SplitExact   = "exact"
+	SplitPercent = "percent"
+	SplitShares  = "shares"
+)
+
+// percentTolerance absorbs float rounding when checking that percentages add up
+const percentTolerance = 0.01
+
+// SplitEntry - Per-participant payload for unequal splits
+type SplitEntry struct {
+	UserID  uint         `json:"user_id"`
+	Amount  models.Money `json:"amount"`  // used by "exact"
+	Percent float64      `json:"percent"` // used by "percent"
+	Shares  float64      `json:"shares"`  // used by "shares"
+}
+
+// computeSplit - Works out how much each participant owes for an expense.
+// splitWith is used for equal splits, splits for every other split type.
+// Cents that cannot be divided evenly are absorbed by the payer, or by the
+// first participant when the payer is not part of the split.
+func computeSplit(amount models.Money, paidBy uint, splitType string, splitWith []uint, splits []SplitEntry) ([]models.ExpenseParticipant, error) {
+	if amount <= 0 {
+		return nil, errors.New("Amount must be greater than zero")
+	}
+
+	if splitType == "" {
+		splitType = SplitEqual
+	}
+
+	// Equal splits may still be sent as a list of entries
+	if splitType == SplitEqual && len(splitWith) == 0 {
+		for _, s := range splits {
+			splitWith = append(splitWith, s.UserID)
+		}
+	}
+
+	var participants []models.ExpenseParticipant
+	seen := make(map[uint]bool)
+
+	switch splitType {
+	case SplitEqual:
+		if len(splitWith) == 0 {
+			return nil, errors.New("At least one participant is required")
+		}
+		for _, userID := range splitWith {
+			if seen[userID] {
+				return nil, fmt.Errorf("User %d is listed more than once", userID)
+			}
+			seen[userID] = true
+		}
+		splitAmount := amount / models.Money(len(splitWith))
+		for _, userID := range splitWith {
+			participants = append(participants, models.ExpenseParticipant{UserID: userID, AmountOwed: splitAmount})
+		}
+
+	case SplitExact, SplitPercent, SplitShares:
+		if len(splits) == 0 {
+			return nil, errors.New("At least one participant is required")
+		}
+
+		var total float64
+		for _, s := range splits {
+			if seen[s.UserID] {
+				return nil, fmt.Errorf("User %d is listed more than once", s.UserID)
+			}
+			seen[s.UserID] = true
+
+			value := splitValue(splitType, s)
+			if value < 0 {
+				return nil, fmt.Errorf("Split for user %d cannot be negative", s.UserID)
+			}
+			total += value
+		}
+
+		switch splitType {
+		case SplitExact:
+			if models.Money(total) != amount {
+				return nil, fmt.Errorf("Exact amounts add up to %s but the expense amount is %s", models.Money(total), amount)
+			}
+		case SplitPercent:
+			if math.Abs(total-100) > percentTolerance {
+				return nil, fmt.Errorf("Percentages add up to %.2f, expected 100", total)
+			}
+		case SplitShares:
+			if total <= 0 {
+				return nil, errors.New("Total shares must be greater than zero")
+			}
+		}
+
+		for _, s := range splits {
+			var owed models.Money
+			switch splitType {
+			case SplitExact:
+				owed = s.Amount
+			case SplitPercent:
+				owed = models.Money(math.Floor(float64(amount) * s.Percent / 100))
+			case SplitShares:
+				owed = models.Money(math.Floor(float64(amount) * s.Shares / total))
+			}
+			participants = append(participants, models.ExpenseParticipant{UserID: s.UserID, AmountOwed: owed})
+		}
+
+	default:
+		return nil, fmt.Errorf("Unknown split_type %q", splitType)
+	}
+
+	absorbRemainder(participants, amount, paidBy)
+	return participants, nil
+}
+
+// absorbRemainder - Hands any leftover cents to the payer (or the first
+// participant) so the split always adds up to the expense amount exactly
+func absorbRemainder(participants []models.ExpenseParticipant, amount models.Money, paidBy uint) {
+	var sum models.Money
+	for _, p := range participants {
+		sum += p.AmountOwed
+	}
+	remainder := amount - sum
+	if remainder == 0 || len(participants) == 0 {
+		return
+	}
+
+	target := 0
+	for i, p := range participants {
+		if p.UserID == paidBy {
+			target = i
+			break
+		}
+	}
+	participants[target].AmountOwed += remainder
+}
+
+// splitValue - Picks the field of a split entry that matters for the split type
+func splitValue(splitType string, s SplitEntry) float64 {
+	switch splitType {
+	case SplitExact:
+		return float64(s.Amount)
+	case SplitPercent:
+		return s.Percent
+	case SplitShares:
+		return s.Shares
+	}
+	return 0
+}
@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/events"
+	"go-auth-app/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+// Events - Delivers committed changes to the open event streams
+var Events = events.NewHub()
+
+// Event types that differ from the activity log action they come from
+const (
+	EventSettlementRecorded = "settlement.recorded"
+	EventMemberAdded        = "member.added"
+)
+
+var eventTypes = map[string]string{
+	models.ActionExpenseSettled: EventSettlementRecorded,
+	models.ActionMemberJoined:   EventMemberAdded,
+}
+
+// StreamHeartbeat - How often an idle stream sends a comment, so proxies keep it open
+var StreamHeartbeat = 25 * time.Second
+
+// StreamAudience marks stream tokens, which can only open the event stream
+const StreamAudience = "stream"
+
+// maxReplay - Most missed events replayed to a reconnecting client; past that
+// it is told to reload instead
+const maxReplay = 500
+
+// activityEvent - The event streamed for an activity log entry
+func activityEvent(entry models.Activity) events.Event {
+	eventType, ok := eventTypes[entry.Action]
+	if !ok {
+		eventType = entry.Action
+	}
+	data := entry.After
+	if data == "" {
+		data = entry.Before
+	}
+	return events.Event{
+		ID:       entry.ID,
+		Type:     eventType,
+		GroupID:  entry.GroupID,
+		ActorID:  entry.ActorID,
+		TargetID: entry.TargetID,
+		Data:     json.RawMessage(data),
+		At:       entry.CreatedAt,
+	}
+}
+
+// CreateStreamToken - Issues a token for opening the event stream from a
+// browser, whose EventSource cannot send the Authorization header: it goes in
+// the URL as ?token=. It can only open the stream, and it expires and is
+// revoked together with the access token it was issued for.
+func CreateStreamToken(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value("claims").(*Claims)
+	if !ok || claims.ExpiresAt == nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	streamClaims := &Claims{
+		Username: claims.Username,
+		Email:    claims.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        claims.ID, // Revoking the access token revokes this one too
+			Audience:  jwt.ClaimStrings{StreamAudience},
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+			ExpiresAt: claims.ExpiresAt,
+		},
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, streamClaims).SignedString(JwtKey)
+	if err != nil {
+		http.Error(w, "Error creating token", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]interface{}{"token": token, "expires_at": claims.ExpiresAt.Time})
+}
+
+// StreamEvents - Streams the changes in the caller's groups as Server-Sent
+// Events: each has the event type (expense.created, expense.deleted,
+// settlement.recorded, member.added, ...) as `event` and the JSON event as
+// `data`. A client reconnecting with Last-Event-ID first gets the events it
+// missed, or a `resync` event when too many were missed and it should reload.
+// The stream ends with an `expired` event once the token it was opened with
+// expires or is revoked; the client reconnects with a new one.
+func StreamEvents(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return
+	}
+	claims, _ := r.Context().Value("claims").(*Claims)
+	var expired <-chan time.Time
+	if claims != nil && claims.ExpiresAt != nil {
+		timer := time.NewTimer(time.Until(claims.ExpiresAt.Time))
+		defer timer.Stop()
+		expired = timer.C
+	}
+
+	var groupIDs []uint
+	if err := database.DB.Model(&models.GroupUser{}).Where("user_id = ?", userID).Pluck("group_id", &groupIDs).Error; err != nil {
+		http.Error(w, "Error retrieving groups", http.StatusInternalServerError)
+		return
+	}
+	groups := make(map[uint]bool, len(groupIDs))
+	for _, id := range groupIDs {
+		groups[id] = true
+	}
+
+	// Subscribe before replaying so nothing falls in between
+	sub := Events.Subscribe()
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	rc.SetWriteDeadline(time.Time{})
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Stop nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprint(w, "retry: 5000\n\n")
+
+	lastID, _ := strconv.ParseUint(r.Header.Get("Last-Event-ID"), 10, 64)
+	if lastID > 0 {
+		missed, err := missedEvents(uint(lastID), groupIDs)
+		switch {
+		case err != nil:
+			fmt.Println("❌ Error replaying events:", err)
+			return
+		case len(missed) > maxReplay:
+			fmt.Fprint(w, "event: resync\ndata: {}\n\n")
+		default:
+			for _, e := range missed {
+				if writeEvent(w, e) != nil {
+					return
+				}
+				lastID = uint64(e.ID)
+			}
+		}
+	}
+	if rc.Flush() != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(StreamHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-expired:
+			endStream(w, rc)
+			return
+		case <-heartbeat.C:
+			// Logging out revokes the token; the check waits for the heartbeat to stay cheap
+			if claims != nil && claims.ID != "" {
+				if revoked, err := IsTokenRevoked(claims.ID); err == nil && revoked {
+					endStream(w, rc)
+					return
+				}
+			}
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+		case e, ok := <-sub.C:
+			if !ok {
+				// Fell behind; the client reconnects and catches up from Last-Event-ID
+				return
+			}
+			if uint64(e.ID) <= lastID || !followMembership(groups, e, userID) {
+				continue
+			}
+			if writeEvent(w, e) != nil {
+				return
+			}
+		}
+		if rc.Flush() != nil {
+			return
+		}
+	}
+}
+
+// followMembership - Whether the user should get the event, keeping track of
+// the groups they join and leave while the stream is open
+func followMembership(groups map[uint]bool, e events.Event, userID uint) bool {
+	switch {
+	case e.Type == EventMemberAdded && e.TargetID == userID,
+		e.Type == models.ActionGroupCreated && e.ActorID != nil && *e.ActorID == userID:
+		groups[e.GroupID] = true
+	case (e.Type == models.ActionMemberRemoved || e.Type == models.ActionMemberLeft) && e.TargetID == userID:
+		// They still hear about their own removal
+		delete(groups, e.GroupID)
+		return true
+	}
+	return groups[e.GroupID]
+}
+
+// missedEvents - The events after lastID in the groups, up to one more than maxReplay
+func missedEvents(lastID uint, groupIDs []uint) ([]events.Event, error) {
+	if len(groupIDs) == 0 {
+		return nil, nil
+	}
+	var entries []models.Activity
+	err := database.DB.Where("id > ? AND group_id IN ?", lastID, groupIDs).Order("id").Limit(maxReplay + 1).Find(&entries).Error
+	if err != nil {
+		return nil, err
+	}
+	missed := make([]events.Event, len(entries))
+	for i, entry := range entries {
+		missed[i] = activityEvent(entry)
+	}
+	return missed, nil
+}
+
+// endStream - Tells the client its token is no longer valid before closing the stream
+func endStream(w http.ResponseWriter, rc *http.ResponseController) {
+	fmt.Fprint(w, "event: expired\ndata: {}\n\n")
+	rc.Flush()
+}
+
+// writeEvent - Writes one Server-Sent Event
+func writeEvent(w http.ResponseWriter, e events.Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", e.ID, e.Type, data)
+	return err
+}
@@ -0,0 +1,217 @@
+package handlers_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+type sseEvent struct {
+	ID    string
+	Event string
+	Data  map[string]interface{}
+}
+
+// openStream - Connects to the event stream as the user and returns the events it receives
+func openStream(t *testing.T, userID uint, lastEventID string) <-chan sseEvent {
+	return openStreamWith(t, func(r *http.Request) *http.Request { return withUser(r, userID) }, lastEventID)
+}
+
+// openStreamWith - Connects to the event stream, authenticating requests with auth
+func openStreamWith(t *testing.T, auth func(*http.Request) *http.Request, lastEventID string) <-chan sseEvent {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handlers.StreamEvents(w, auth(r))
+	}))
+	subscribers := handlers.Events.Subscribers()
+
+	req, _ := http.NewRequest("GET", server.URL, nil)
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Error opening the stream: %v", err)
+	}
+	t.Cleanup(func() {
+		resp.Body.Close()
+		server.Close()
+	})
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("Expected an event stream, got %d %s", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+	for handlers.Events.Subscribers() == subscribers {
+		time.Sleep(time.Millisecond)
+	}
+
+	received := make(chan sseEvent, 16)
+	go readEvents(resp.Body, received)
+	return received
+}
+
+// readEvents - Parses Server-Sent Events, skipping comments and frames without data
+func readEvents(body io.Reader, received chan<- sseEvent) {
+	defer close(received)
+	var e sseEvent
+	scanner := bufio.NewScanner(body)
+	for scanner.Scan() {
+		field, value, _ := strings.Cut(scanner.Text(), ": ")
+		switch field {
+		case "id":
+			e.ID = value
+		case "event":
+			e.Event = value
+		case "data":
+			json.Unmarshal([]byte(value), &e.Data)
+		case "":
+			if e.Data != nil {
+				received <- e
+			}
+			e = sseEvent{}
+		}
+	}
+}
+
+func nextEvent(t *testing.T, received <-chan sseEvent) sseEvent {
+	t.Helper()
+	select {
+	case e := <-received:
+		return e
+	case <-time.After(2 * time.Second):
+		t.Fatal("Timed out waiting for an event")
+		return sseEvent{}
+	}
+}
+
+func createGroupExpense(t *testing.T, userID, groupID uint, title string, splitWith ...uint) {
+	t.Helper()
+	split, _ := json.Marshal(splitWith)
+	body := fmt.Sprintf(`{"title": %q, "amount": 60, "paid_by": %d, "group_id": %d, "split_with": %s}`, title, userID, groupID, split)
+	req, _ := http.NewRequest("POST", "/expenses", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handlers.CreateExpense(rr, withUser(req, userID))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 Created, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	group, alice, bob, carol := invitationFixture(t)
+	addMembers(group.ID, bob.ID)
+	other := models.Group{Name: "Office"}
+	database.DB.Create(&other)
+	database.DB.Create(&models.GroupUser{GroupID: other.ID, UserID: alice.ID, Role: "owner"})
+
+	received := openStream(t, bob.ID, "")
+
+	// Changes in bob's groups only
+	createGroupExpense(t, alice.ID, other.ID, "Printer", alice.ID)
+	createGroupExpense(t, alice.ID, group.ID, "Dinner", alice.ID, bob.ID)
+	e := nextEvent(t, received)
+	if e.Event != "expense.created" || e.Data["group_id"] != float64(group.ID) || e.Data["actor_id"] != float64(alice.ID) {
+		t.Fatalf("Expected the dinner to be streamed, got %+v", e)
+	}
+	if data := e.Data["data"].(map[string]interface{}); data["title"] != "Dinner" {
+		t.Errorf("Expected the expense in the event, got %+v", data)
+	}
+
+	body := fmt.Sprintf(`{"group_id": %d, "settled_with": %d, "amount": 30}`, group.ID, alice.ID)
+	req, _ := http.NewRequest("POST", "/", strings.NewReader(body))
+	rr := httptest.NewRecorder()
+	handlers.SettleGroupExpense(rr, withUser(req, bob.ID))
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected the settlement to be recorded, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if e := nextEvent(t, received); e.Event != handlers.EventSettlementRecorded {
+		t.Errorf("Expected a settlement event, got %+v", e)
+	}
+
+	// Carol starts hearing about the group once she joins it
+	carolReceived := openStream(t, carol.ID, "")
+	token := createInvitation(t, other, alice.ID, `{"max_uses": 5}`)["token"].(string)
+	if rr := answerInvitation(handlers.AcceptInvitation, token, carol.ID); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if e := nextEvent(t, carolReceived); e.Event != handlers.EventMemberAdded || e.Data["group_id"] != float64(other.ID) {
+		t.Errorf("Expected carol to see herself join, got %+v", e)
+	}
+	createGroupExpense(t, alice.ID, other.ID, "Toner", alice.ID, carol.ID)
+	if e := nextEvent(t, carolReceived); e.Event != "expense.created" {
+		t.Errorf("Expected carol to see the new group's expense, got %+v", e)
+	}
+}
+
+func TestStreamEventsReplaysMissedEvents(t *testing.T) {
+	group, alice, bob, _ := invitationFixture(t)
+	addMembers(group.ID, bob.ID)
+	for _, title := range []string{"Taxi", "Lunch", "Museum"} {
+		createGroupExpense(t, alice.ID, group.ID, title, alice.ID, bob.ID)
+	}
+	var first models.Activity
+	database.DB.Where("action = ?", models.ActionExpenseCreated).Order("id").First(&first)
+
+	received := openStream(t, bob.ID, fmt.Sprint(first.ID))
+	var titles []string
+	for i := 0; i < 2; i++ {
+		e := nextEvent(t, received)
+		titles = append(titles, e.Data["data"].(map[string]interface{})["title"].(string))
+	}
+	if strings.Join(titles, ",") != "Lunch,Museum" {
+		t.Errorf("Expected the expenses after the last event seen, got %v", titles)
+	}
+}
+
+func TestStreamEventsEndsWithItsToken(t *testing.T) {
+	_, alice, _, _ := invitationFixture(t)
+	heartbeat := handlers.StreamHeartbeat
+	handlers.StreamHeartbeat = 20 * time.Millisecond
+	t.Cleanup(func() { handlers.StreamHeartbeat = heartbeat })
+
+	withClaims := func(claims *handlers.Claims) func(*http.Request) *http.Request {
+		return func(r *http.Request) *http.Request {
+			r = withUser(r, alice.ID)
+			return r.WithContext(context.WithValue(r.Context(), "claims", claims))
+		}
+	}
+	expectEnd := func(received <-chan sseEvent) {
+		t.Helper()
+		var got []string
+		timeout := time.After(5 * time.Second)
+		for {
+			select {
+			case e, open := <-received:
+				if open {
+					got = append(got, e.Event)
+					continue
+				}
+				if strings.Join(got, ",") != "expired" {
+					t.Errorf("Expected the stream to end with an expired event, got %v", got)
+				}
+				return
+			case <-timeout:
+				t.Fatal("Timed out waiting for the stream to end")
+			}
+		}
+	}
+
+	// Closed when the token expires (token times are whole seconds)
+	expiring := &handlers.Claims{RegisteredClaims: jwt.RegisteredClaims{ID: "expiring", ExpiresAt: jwt.NewNumericDate(time.Now().Add(2 * time.Second))}}
+	expectEnd(openStreamWith(t, withClaims(expiring), ""))
+
+	// And when it is revoked
+	revoked := &handlers.Claims{RegisteredClaims: jwt.RegisteredClaims{ID: "revoked", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}}
+	received := openStreamWith(t, withClaims(revoked), "")
+	database.DB.Create(&models.RevokedToken{JTI: "revoked", ExpiresAt: time.Now().Add(time.Hour)})
+	expectEnd(received)
+}
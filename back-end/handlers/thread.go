@@ -2,19 +2,29 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
+	"go-auth-app/authz"
 	"go-auth-app/database"
 	"go-auth-app/models"
 	"net/http"
+	"time"
 
 	"github.com/gorilla/mux"
+	"gorm.io/gorm"
 )
 
 // CreateThread - Allows a user to create a thread in a group
 func CreateThread(w http.ResponseWriter, r *http.Request) {
+	// The creator is always the authenticated user
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return
+	}
+
 	var req struct {
 		Name    string `json:"name"`
 		GroupID uint   `json:"group_id"`
-		UserID  uint   `json:"created_by"`
 	}
 
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -22,8 +32,20 @@ func CreateThread(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	thread := models.Thread{Name: req.Name, GroupID: &req.GroupID, CreatedBy: req.UserID}
-	if err := database.DB.Create(&thread).Error; err != nil {
+	// Threads can only be opened inside a group the caller belongs to
+	if !authorizeGroup(w, r, req.GroupID, authz.Member) {
+		return
+	}
+
+	thread := models.Thread{Name: req.Name, GroupID: &req.GroupID, CreatedBy: userID}
+	err := activityTransaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&thread).Error; err != nil {
+			return err
+		}
+		after := threadSnapshot{Name: thread.Name, GroupID: thread.GroupID}
+		return recordActivity(tx, activity{GroupID: thread.GroupID, ActorID: userID, Action: models.ActionThreadCreated, TargetID: thread.ID, After: after})
+	})
+	if err != nil {
 		http.Error(w, "Error creating thread", http.StatusInternalServerError)
 		return
 	}
@@ -37,14 +59,19 @@ func GetThreadsByGroup(w http.ResponseWriter, r *http.Request) {
 	groupID := mux.Vars(r)["group_id"]
 
 	var threads []struct {
-		ThreadID   uint   `json:"thread_id"`
-		ThreadName string `json:"thread_name"`
+		ThreadID   uint       `json:"thread_id"`
+		ThreadName string     `json:"thread_name"`
+		ArchivedAt *time.Time `json:"archived_at"`
 	}
 
+	// Archived threads are hidden unless asked for with ?archived=true
+	archived := "AND archived_at IS NULL"
+	if r.URL.Query().Get("archived") == "true" {
+		archived = ""
+	}
 	database.DB.Raw(`
-		SELECT id AS thread_id, name AS thread_name FROM threads
-		WHERE group_id = ?
-	`, groupID).Scan(&threads)
+		SELECT id AS thread_id, name AS thread_name, archived_at FROM threads
+		WHERE group_id = ? AND deleted_at IS NULL `+archived, groupID).Scan(&threads)
 
 	if len(threads) == 0 {
 		json.NewEncoder(w).Encode([]struct{}{})
@@ -58,16 +85,17 @@ func GetUserThreadsWithBalances(w http.ResponseWriter, r *http.Request) {
 	userID := mux.Vars(r)["user_id"]
 
 	var threads []struct {
-		ThreadID     uint    `json:"thread_id"`
-		ThreadName   string  `json:"thread_name"`
-		TotalBalance float64 `json:"total_balance"`
+		ThreadID     uint         `json:"thread_id"`
+		ThreadName   string       `json:"thread_name"`
+		TotalBalance models.Money `json:"total_balance"`
 	}
 
 	database.DB.Raw(`
-		SELECT t.id AS thread_id, t.name AS thread_name, COALESCE(SUM(ep.amount_owed), 0) AS total_balance 
+		SELECT t.id AS thread_id, t.name AS thread_name, COALESCE(CAST(SUM(ep.amount_owed) AS BIGINT), 0) AS total_balance 
 		FROM threads t
 		LEFT JOIN expenses e ON t.id = e.thread_id
 		LEFT JOIN expense_participants ep ON e.id = ep.expense_id AND ep.user_id = ?
+		WHERE t.deleted_at IS NULL
 		GROUP BY t.id, t.name
 	`, userID).Scan(&threads)
 
@@ -83,30 +111,33 @@ func GetThreadExpensesWithDetails(w http.ResponseWriter, r *http.Request) {
 	threadID := mux.Vars(r)["thread_id"]
 
 	var expenses []struct {
-		ID           uint    `json:"id"`
-		Title        string  `json:"title"`
-		Amount       float64 `json:"amount"`
-		PaidBy       uint    `json:"paid_by"`
-		GroupID      *uint   `json:"group_id"`
-		ThreadID     *uint   `json:"thread_id"`
+		ID           uint         `json:"id"`
+		Title        string       `json:"title"`
+		Amount       models.Money `json:"amount"`
+		Currency     string       `json:"currency"`
+		PaidBy       uint         `json:"paid_by"`
+		CreatedBy    uint         `json:"created_by"`
+		GroupID      *uint        `json:"group_id"`
+		ThreadID     *uint        `json:"thread_id"`
 		Participants []struct {
-			UserID     uint    `json:"user_id"`
-			Username   string  `json:"username"`
-			AmountOwed float64 `json:"amount_owed"`
+			UserID     uint         `json:"user_id"`
+			Username   string       `json:"username"`
+			AmountOwed models.Money `json:"amount_owed"`
 		} `json:"participants"`
+		Comments []commentResponse `json:"comments"`
 	}
 
 	database.DB.Raw(`
-		SELECT e.id, e.title, e.amount, e.paid_by, e.group_id, e.thread_id
+		SELECT e.id, e.title, e.amount, e.currency, e.paid_by, e.created_by, e.group_id, e.thread_id
 		FROM expenses e
 		WHERE e.thread_id = ?
 	`, threadID).Scan(&expenses)
 
 	for i := range expenses {
 		var participants []struct {
-			UserID     uint    `json:"user_id"`
-			Username   string  `json:"username"`
-			AmountOwed float64 `json:"amount_owed"`
+			UserID     uint         `json:"user_id"`
+			Username   string       `json:"username"`
+			AmountOwed models.Money `json:"amount_owed"`
 		}
 		database.DB.Raw(`
 			SELECT ep.user_id, u.username, ep.amount_owed
@@ -117,6 +148,18 @@ func GetThreadExpensesWithDetails(w http.ResponseWriter, r *http.Request) {
 		expenses[i].Participants = participants
 	}
 
+	expenseIDs := make([]uint, len(expenses))
+	for i := range expenses {
+		expenseIDs[i] = expenses[i].ID
+	}
+	comments := commentsByExpense(expenseIDs)
+	for i := range expenses {
+		expenses[i].Comments = comments[expenses[i].ID]
+		if expenses[i].Comments == nil {
+			expenses[i].Comments = []commentResponse{}
+		}
+	}
+
 	if len(expenses) == 0 {
 		json.NewEncoder(w).Encode([]struct{}{})
 	} else {
@@ -124,45 +167,20 @@ func GetThreadExpensesWithDetails(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// GetThreadBalances - Retrieves total balances within a thread
+// GetThreadBalances - Retrieves total balances within a thread, in its group's base currency
 func GetThreadBalances(w http.ResponseWriter, r *http.Request) {
 	threadID := mux.Vars(r)["thread_id"]
 
-	var balances []struct {
-		UserID     uint    `json:"user_id"`
-		Username   string  `json:"username"`
-		AmountOwed float64 `json:"amount_owed"`
-		AmountDue  float64 `json:"amount_due"`
-		NetBalance float64 `json:"net_balance"`
+	rows, err := loadLedger("e.thread_id = ?", threadID)
+	if err == nil {
+		err = convertLedger(rows, threadBaseCurrency(threadID))
+	}
+	if err != nil {
+		writeBalanceError(w, err)
+		return
 	}
 
-	database.DB.Raw(`
-		WITH UserOwes AS (
-			SELECT ep.user_id AS user_id, u.username AS username, SUM(ep.amount_owed) AS amount_owed
-			FROM expense_participants ep
-			JOIN expenses e ON ep.expense_id = e.id
-			JOIN users u ON ep.user_id = u.id
-			WHERE e.thread_id = ?
-			GROUP BY ep.user_id, u.username
-		),
-		UserIsOwed AS (
-			SELECT e.paid_by AS user_id, u.username AS username, SUM(ep.amount_owed) AS amount_due
-			FROM expense_participants ep
-			JOIN expenses e ON ep.expense_id = e.id
-			JOIN users u ON e.paid_by = u.id
-			WHERE e.thread_id = ?
-			GROUP BY e.paid_by, u.username
-		)
-		SELECT 
-			COALESCE(owes.user_id, owed.user_id) AS user_id,
-			COALESCE(owes.username, owed.username) AS username,
-			COALESCE(owes.amount_owed, 0) AS amount_owed,
-			COALESCE(owed.amount_due, 0) AS amount_due,
-			COALESCE(owed.amount_due, 0) - COALESCE(owes.amount_owed, 0) AS net_balance
-		FROM UserOwes owes
-		FULL OUTER JOIN UserIsOwed owed ON owes.user_id = owed.user_id
-	`, threadID, threadID).Scan(&balances)
-
+	balances := netBalances(rows)
 	if len(balances) == 0 {
 		json.NewEncoder(w).Encode([]struct{}{})
 	} else {
@@ -170,20 +188,41 @@ func GetThreadBalances(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
-// DeleteThread - Deletes a specific thread and its related expenses
-func DeleteThread(w http.ResponseWriter, r *http.Request) {
-	threadID := mux.Vars(r)["thread_id"]
+// threadBaseCurrency - Threads inherit the base currency of their group
+func threadBaseCurrency(threadID interface{}) string {
+	var groupID *uint
+	database.DB.Table("threads").Select("group_id").Where("id = ?", threadID).Scan(&groupID)
+	if groupID == nil {
+		return DefaultCurrency
+	}
+	return groupBaseCurrency(*groupID)
+}
 
-	// Delete related expense records first
-	database.DB.Exec("DELETE FROM expense_participants WHERE expense_id IN (SELECT id FROM expenses WHERE thread_id = ?)", threadID)
-	database.DB.Exec("DELETE FROM expenses WHERE thread_id = ?", threadID)
+// DeleteThread - Soft deletes a thread; its expenses stay until it is purged
+func DeleteThread(w http.ResponseWriter, r *http.Request) {
+	var thread models.Thread
+	if err := database.DB.First(&thread, mux.Vars(r)["thread_id"]).Error; err != nil {
+		http.Error(w, "Thread not found", http.StatusNotFound)
+		return
+	}
 
-	// Delete the thread itself
-	if err := database.DB.Exec("DELETE FROM threads WHERE id = ?", threadID).Error; err != nil {
+	now := time.Now()
+	err := activityTransaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Thread{}).Where("id = ?", thread.ID).Update("deleted_at", now).Error; err != nil {
+			return err
+		}
+		before := threadSnapshot{Name: thread.Name, GroupID: thread.GroupID}
+		return recordActivity(tx, activity{GroupID: thread.GroupID, ActorID: actorOf(r), Action: models.ActionThreadDeleted, TargetID: thread.ID, Before: before})
+	})
+	if err != nil {
+		fmt.Println("❌ Error deleting thread:", err)
 		http.Error(w, "Error deleting thread", http.StatusInternalServerError)
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Thread deleted successfully"})
+	json.NewEncoder(w).Encode(map[string]string{
+		"message":          "Thread deleted successfully",
+		"restorable_until": now.Add(RestoreWindow).Format(time.RFC3339),
+	})
 }
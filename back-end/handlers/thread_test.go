@@ -8,6 +8,7 @@ import (
 	"net/http/httptest"
 	"strconv"
 	"testing"
+	"time"
 
 	"go-auth-app/database"
 	"go-auth-app/handlers"
@@ -25,10 +26,12 @@ func TestCreateThread(t *testing.T) {
 	// Provide a unique email for the user to satisfy the UNIQUE constraint.
 	user := models.User{Username: "testuser", Email: "testuser@example.com"}
 	database.DB.Create(&user)
+	addMembers(group.ID, user.ID)
 
 	payload := fmt.Sprintf(`{"name": "Test Thread", "group_id": %d, "created_by": %d}`, group.ID, user.ID)
 	req, _ := http.NewRequest("POST", "/threads", bytes.NewBuffer([]byte(payload)))
 	req.Header.Set("Content-Type", "application/json")
+	req = withUser(req, user.ID)
 	rr := httptest.NewRecorder()
 	handlers.CreateThread(rr, req)
 
@@ -94,7 +97,7 @@ func TestGetUserThreadsWithBalances(t *testing.T) {
 	database.DB.Create(&thread)
 	expense := models.Expense{
 		Title:    "Expense in Thread",
-		Amount:   100,
+		Amount:   models.NewMoney(100),
 		PaidBy:   user.ID,
 		ThreadID: &thread.ID,
 	}
@@ -103,7 +106,7 @@ func TestGetUserThreadsWithBalances(t *testing.T) {
 	expParticipant := models.ExpenseParticipant{
 		ExpenseID:  expense.ID,
 		UserID:     user.ID,
-		AmountOwed: 100,
+		AmountOwed: models.NewMoney(100),
 	}
 	database.DB.Create(&expParticipant)
 
@@ -156,7 +159,7 @@ func TestGetThreadBalances(t *testing.T) {
 	// Create an expense in the thread with user1 as the payer.
 	expense := models.Expense{
 		Title:    "Test Expense",
-		Amount:   100,
+		Amount:   models.NewMoney(100),
 		PaidBy:   user1.ID,
 		ThreadID: &thread.ID,
 	}
@@ -167,12 +170,12 @@ func TestGetThreadBalances(t *testing.T) {
 	participant1 := models.ExpenseParticipant{
 		ExpenseID:  expense.ID,
 		UserID:     user1.ID,
-		AmountOwed: 50,
+		AmountOwed: models.NewMoney(50),
 	}
 	participant2 := models.ExpenseParticipant{
 		ExpenseID:  expense.ID,
 		UserID:     user2.ID,
-		AmountOwed: 50,
+		AmountOwed: models.NewMoney(50),
 	}
 	if err := database.DB.Create(&participant1).Error; err != nil {
 		t.Fatalf("Failed to create participant1: %v", err)
@@ -236,7 +239,7 @@ func TestDeleteThread(t *testing.T) {
 	// Create an expense under the thread.
 	expense := models.Expense{
 		Title:    "Test Expense",
-		Amount:   100,
+		Amount:   models.NewMoney(100),
 		PaidBy:   1,
 		ThreadID: &thread.ID,
 	}
@@ -245,7 +248,7 @@ func TestDeleteThread(t *testing.T) {
 	participant := models.ExpenseParticipant{
 		ExpenseID:  expense.ID,
 		UserID:     1,
-		AmountOwed: 100,
+		AmountOwed: models.NewMoney(100),
 	}
 	database.DB.Create(&participant)
 
@@ -272,9 +275,20 @@ func TestDeleteThread(t *testing.T) {
 	if err := database.DB.First(&th, thread.ID).Error; err == nil {
 		t.Errorf("Thread was not deleted")
 	}
-	// Verify that expenses under the thread are deleted.
+	// Its expenses are only removed once it is purged
 	var count int64
 	database.DB.Model(&models.Expense{}).Where("thread_id = ?", thread.ID).Count(&count)
+	if count != 1 {
+		t.Errorf("Expected the expense to be kept until the thread is purged, got %d", count)
+	}
+	if _, err := handlers.PurgeDeleted(time.Now().Add(time.Second)); err != nil {
+		t.Fatalf("PurgeDeleted failed: %v", err)
+	}
+	if err := database.DB.Unscoped().First(&th, thread.ID).Error; err == nil {
+		t.Errorf("Thread was not purged")
+	}
+	// Verify that expenses under the thread are deleted.
+	database.DB.Model(&models.Expense{}).Where("thread_id = ?", thread.ID).Count(&count)
 	if count != 0 {
 		t.Errorf("Expected 0 expenses for deleted thread, got %d", count)
 	}
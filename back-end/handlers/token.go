@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"gorm.io/gorm"
+)
+
+// Token lifetimes: access tokens are short-lived and renewed with the refresh token
+const (
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 30 * 24 * time.Hour
+)
+
+var errInvalidRefreshToken = errors.New("invalid refresh token")
+
+// randomToken - Returns n random bytes encoded for use in URLs and JSON
+func randomToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken - Tokens are stored as SHA-256 hashes so a database leak does not leak sessions
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomID - Returns a random 128-bit identifier as 32 hex characters
+func randomID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// issueAccessToken - Signs a JWT for the user with a unique ID (jti) so it can be revoked
+func issueAccessToken(user models.User) (string, error) {
+	jti, err := randomID()
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		Username: user.Username,
+		Email:    user.Email,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        jti,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+		},
+	}
+	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(JwtKey)
+}
+
+// issueRefreshToken - Stores a new refresh token in the family and returns its plain value
+func issueRefreshToken(tx *gorm.DB, userID uint, familyID string) (string, *models.RefreshToken, error) {
+	token, err := randomToken(32)
+	if err != nil {
+		return "", nil, err
+	}
+	record := &models.RefreshToken{
+		UserID:    userID,
+		TokenHash: hashToken(token),
+		FamilyID:  familyID,
+		ExpiresAt: time.Now().Add(RefreshTokenTTL),
+	}
+	if err := tx.Create(record).Error; err != nil {
+		return "", nil, err
+	}
+	return token, record, nil
+}
+
+// startSession - Issues the tokens of a new login, with its own refresh token family
+func startSession(w http.ResponseWriter, user models.User) {
+	familyID, err := randomID()
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	refreshToken, _, err := issueRefreshToken(database.DB, user.ID, familyID)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+	resetLoginFailures(user)
+	writeTokens(w, user, refreshToken)
+}
+
+// writeTokens - Responds with a new access token alongside the refresh token
+func writeTokens(w http.ResponseWriter, user models.User, refreshToken string) {
+	accessToken, err := issueAccessToken(user)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"id":            strconv.FormatUint(uint64(user.ID), 10), // Convert uint to string
+	})
+}
+
+// Refresh - Exchanges a refresh token for a new access token and a new refresh token.
+// The presented token is consumed; reusing it later revokes every token of that session.
+func Refresh(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&input); err != nil || input.RefreshToken == "" {
+		http.Error(w, "refresh_token is required", http.StatusBadRequest)
+		return
+	}
+
+	var user models.User
+	var refreshToken, reusedFamily string
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var current models.RefreshToken
+		if err := tx.Where("token_hash = ?", hashToken(input.RefreshToken)).First(&current).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errInvalidRefreshToken
+			}
+			return err
+		}
+
+		now := time.Now()
+		if current.RevokedAt != nil {
+			reusedFamily = current.FamilyID
+			return errInvalidRefreshToken
+		}
+		if now.After(current.ExpiresAt) {
+			return errInvalidRefreshToken
+		}
+
+		if err := tx.First(&user, current.UserID).Error; err != nil {
+			return errInvalidRefreshToken
+		}
+
+		var next *models.RefreshToken
+		var err error
+		refreshToken, next, err = issueRefreshToken(tx, current.UserID, current.FamilyID)
+		if err != nil {
+			return err
+		}
+		// Guard against two concurrent refreshes both consuming the same token
+		result := tx.Model(&models.RefreshToken{}).
+			Where("id = ? AND revoked_at IS NULL", current.ID).
+			Updates(map[string]interface{}{"revoked_at": now, "replaced_by": next.ID})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return errInvalidRefreshToken
+		}
+		return nil
+	})
+	if reusedFamily != "" {
+		// A rotated token came back: it was stolen, or the client replayed it. Kill the session.
+		fmt.Println("🚨 Refresh token reused; revoking its session")
+		if err := revokeRefreshTokens(database.DB, "family_id = ?", reusedFamily); err != nil {
+			fmt.Println("❌ Error revoking session:", err)
+		}
+	}
+	if errors.Is(err, errInvalidRefreshToken) {
+		http.Error(w, "Invalid or expired refresh token", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		fmt.Println("❌ Error refreshing token:", err)
+		http.Error(w, "Error refreshing token", http.StatusInternalServerError)
+		return
+	}
+
+	writeTokens(w, user, refreshToken)
+}
+
+// Logout - Revokes the access token used for the request and the session's refresh tokens.
+// With "all": true every session of the user is ended.
+func Logout(w http.ResponseWriter, r *http.Request) {
+	userID, ok := currentUserID(r)
+	claims, hasClaims := r.Context().Value("claims").(*Claims)
+	if !ok || !hasClaims {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var input struct {
+		RefreshToken string `json:"refresh_token"`
+		All          bool   `json:"all"`
+	}
+	if r.Body != nil && r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
+			http.Error(w, "Invalid request payload", http.StatusBadRequest)
+			return
+		}
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := revokeAccessToken(tx, claims); err != nil {
+			return err
+		}
+
+		if input.All {
+			return revokeRefreshTokens(tx, "user_id = ?", userID)
+		}
+		if input.RefreshToken != "" {
+			var token models.RefreshToken
+			err := tx.Where("token_hash = ? AND user_id = ?", hashToken(input.RefreshToken), userID).First(&token).Error
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil // Already gone; the access token is revoked regardless
+			}
+			if err != nil {
+				return err
+			}
+			return revokeRefreshTokens(tx, "family_id = ?", token.FamilyID)
+		}
+		return nil
+	})
+	if err != nil {
+		fmt.Println("❌ Error logging out:", err)
+		http.Error(w, "Error logging out", http.StatusInternalServerError)
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{"message": "Logged out successfully"})
+}
+
+// revokeRefreshTokens - Revokes every still active refresh token matching the condition
+func revokeRefreshTokens(tx *gorm.DB, condition string, args ...interface{}) error {
+	return tx.Model(&models.RefreshToken{}).
+		Where(condition, args...).
+		Where("revoked_at IS NULL").
+		Update("revoked_at", time.Now()).Error
+}
+
+// revokeAccessToken - Adds the token's jti to the revocation list until it expires anyway
+func revokeAccessToken(tx *gorm.DB, claims *Claims) error {
+	if claims.ID == "" {
+		return nil
+	}
+	expiresAt := time.Now().Add(AccessTokenTTL)
+	if claims.ExpiresAt != nil {
+		expiresAt = claims.ExpiresAt.Time
+	}
+
+	// Entries for tokens that have expired since are no longer needed
+	if err := tx.Where("expires_at < ?", time.Now()).Delete(&models.RevokedToken{}).Error; err != nil {
+		return err
+	}
+	return tx.Where(models.RevokedToken{JTI: claims.ID}).
+		Attrs(models.RevokedToken{ExpiresAt: expiresAt}).
+		FirstOrCreate(&models.RevokedToken{}).Error
+}
+
+// IsTokenRevoked - Reports whether the access token with this jti was revoked
+func IsTokenRevoked(jti string) (bool, error) {
+	var count int64
+	err := database.DB.Model(&models.RevokedToken{}).Where("jti = ?", jti).Count(&count).Error
+	return count > 0, err
+}
@@ -0,0 +1,81 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// login - Creates a user and logs them in, returning the decoded token response
+func login(t *testing.T, username string) map[string]string {
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	database.DB.Create(&models.User{Username: username, Email: username + "@example.com", Password: string(hashedPassword)})
+
+	body, _ := json.Marshal(map[string]string{"username": username, "password": "password123"})
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handlers.Login(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Login failed: %d %s", rr.Code, rr.Body.String())
+	}
+
+	var tokens map[string]string
+	json.NewDecoder(rr.Body).Decode(&tokens)
+	if tokens["token"] == "" || tokens["refresh_token"] == "" {
+		t.Fatalf("Expected an access and a refresh token, got %v", tokens)
+	}
+	return tokens
+}
+
+func refresh(refreshToken string) *httptest.ResponseRecorder {
+	body, _ := json.Marshal(map[string]string{"refresh_token": refreshToken})
+	req, _ := http.NewRequest("POST", "/refresh", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handlers.Refresh(rr, req)
+	return rr
+}
+
+func TestRefreshRotatesToken(t *testing.T) {
+	database.SetupMockDB()
+	tokens := login(t, "alice")
+
+	rr := refresh(tokens["refresh_token"])
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var rotated map[string]string
+	json.NewDecoder(rr.Body).Decode(&rotated)
+	if rotated["refresh_token"] == "" || rotated["refresh_token"] == tokens["refresh_token"] {
+		t.Fatalf("Expected a new refresh token, got %q", rotated["refresh_token"])
+	}
+
+	// Only hashes are stored
+	var stored int64
+	database.DB.Model(&models.RefreshToken{}).Where("token_hash = ?", rotated["refresh_token"]).Count(&stored)
+	if stored != 0 {
+		t.Error("Expected refresh tokens to be stored hashed")
+	}
+
+	// Reusing the consumed token is refused and ends the whole session
+	if rr := refresh(tokens["refresh_token"]); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected reused refresh token to be refused, got %d", rr.Code)
+	}
+	if rr := refresh(rotated["refresh_token"]); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the rotated token to be revoked after reuse, got %d", rr.Code)
+	}
+}
+
+func TestRefreshRejectsUnknownToken(t *testing.T) {
+	database.SetupMockDB()
+
+	if rr := refresh("not-a-token"); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 Unauthorized, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,532 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/events"
+	"go-auth-app/models"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gorm.io/gorm"
+)
+
+// Webhook delivery settings
+var (
+	// WebhookClient - Sends the deliveries. Redirects are not followed; they
+	// count as failures. Internal addresses are refused when connecting, after
+	// DNS resolution, and no proxy is used so that check sees the real target.
+	WebhookClient = &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout: 5 * time.Second,
+				Control: checkWebhookAddress,
+			}).DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	// WebhookAllowedNetworks - Internal networks webhooks may still be sent to
+	// (loopback, private, link-local and unspecified addresses are refused otherwise)
+	WebhookAllowedNetworks []netip.Prefix
+	// WebhookMaxAttempts - Attempts before a delivery is given up as dead
+	WebhookMaxAttempts = 10
+	// WebhookBackoff - Wait after the first failed attempt, doubled after every other one
+	WebhookBackoff = time.Minute
+)
+
+const (
+	maxWebhookBackoff = 6 * time.Hour
+	webhookLease      = 2 * time.Minute // How long a claimed attempt may take before another instance retries it
+	webhookBatchSize  = 100             // Deliveries attempted per run
+	webhookPing       = "ping"
+)
+
+// webhookEventPattern - An event type ("expense.created") or a prefix of some ("expense")
+var webhookEventPattern = regexp.MustCompile(`^[a-z_]+(\.[a-z_]+)?$`)
+
+// webhookResponse - A webhook with its event filter decoded. The secret is
+// only included when the webhook is created.
+type webhookResponse struct {
+	models.Webhook
+	Events []string `json:"events"`
+	Secret string   `json:"secret,omitempty"`
+}
+
+func newWebhookResponse(hook models.Webhook) webhookResponse {
+	return webhookResponse{Webhook: hook, Events: splitList(hook.Events)}
+}
+
+// webhookRequest - The fields of a webhook that can be set
+type webhookRequest struct {
+	URL    *string  `json:"url"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+// CreateWebhook - Subscribes a URL to the group's events (`events` filters
+// them by type or prefix, e.g. ["expense", "settlement.recorded"]; all by
+// default). Deliveries are signed with the returned secret, which is not
+// shown again.
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	groupID, err := strconv.ParseUint(mux.Vars(r)["group_id"], 10, 64)
+	if err != nil {
+		http.Error(w, "Invalid group ID", http.StatusBadRequest)
+		return
+	}
+	userID, ok := currentUserID(r)
+	if !ok {
+		http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+		return
+	}
+
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.URL == nil {
+		http.Error(w, "url is required", http.StatusBadRequest)
+		return
+	}
+	hook := models.Webhook{GroupID: uint(groupID), CreatedBy: userID, Active: true}
+	if err := applyWebhookRequest(&hook, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	secret, err := randomToken(32)
+	if err != nil {
+		http.Error(w, "Error creating webhook", http.StatusInternalServerError)
+		return
+	}
+	hook.Secret = "whsec_" + secret
+
+	if err := database.DB.Create(&hook).Error; err != nil {
+		fmt.Println("❌ Error creating webhook:", err)
+		http.Error(w, "Error creating webhook", http.StatusInternalServerError)
+		return
+	}
+
+	response := newWebhookResponse(hook)
+	response.Secret = hook.Secret
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(response)
+}
+
+// GetGroupWebhooks - Lists the group's webhooks
+func GetGroupWebhooks(w http.ResponseWriter, r *http.Request) {
+	var hooks []models.Webhook
+	if err := database.DB.Where("group_id = ?", mux.Vars(r)["group_id"]).Order("id").Find(&hooks).Error; err != nil {
+		http.Error(w, "Error retrieving webhooks", http.StatusInternalServerError)
+		return
+	}
+
+	response := make([]webhookResponse, len(hooks))
+	for i, hook := range hooks {
+		response[i] = newWebhookResponse(hook)
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// UpdateWebhook - Changes a webhook's URL or events, or pauses it with
+// `"active": false`. Events are not queued while it is inactive.
+func UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := findWebhook(w, r)
+	if !ok {
+		return
+	}
+	var req webhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if err := applyWebhookRequest(&hook, req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	changes := map[string]interface{}{"url": hook.URL, "events": hook.Events, "active": hook.Active}
+	if err := database.DB.Model(&hook).Updates(changes).Error; err != nil {
+		fmt.Println("❌ Error updating webhook:", err)
+		http.Error(w, "Error updating webhook", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(newWebhookResponse(hook))
+}
+
+// DeleteWebhook - Removes a webhook; its pending deliveries are given up
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := findWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&hook).Error; err != nil {
+			return err
+		}
+		return tx.Model(&models.WebhookDelivery{}).
+			Where("webhook_id = ? AND status = ?", hook.ID, models.DeliveryPending).
+			Updates(map[string]interface{}{"status": models.DeliveryDead, "next_attempt_at": nil, "error": "The webhook was deleted"}).Error
+	})
+	if err != nil {
+		fmt.Println("❌ Error deleting webhook:", err)
+		http.Error(w, "Error deleting webhook", http.StatusInternalServerError)
+		return
+	}
+	json.NewEncoder(w).Encode(map[string]string{"message": "Webhook deleted successfully"})
+}
+
+// PingWebhook - Queues a `ping` event, to check that the endpoint receives
+// and verifies deliveries
+func PingWebhook(w http.ResponseWriter, r *http.Request) {
+	hook, ok := findWebhook(w, r)
+	if !ok {
+		return
+	}
+
+	ping := events.Event{Type: webhookPing, GroupID: hook.GroupID, At: time.Now()}
+	if userID, ok := currentUserID(r); ok {
+		ping.ActorID = &userID
+	}
+	delivery, err := queueDelivery(database.DB, hook, ping)
+	if err != nil {
+		fmt.Println("❌ Error queueing webhook ping:", err)
+		http.Error(w, "Error queueing ping", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
+
+// GetWebhookDeliveries - The webhook's delivery log, newest first, a page at a
+// time. `?status=` keeps pending, delivered or dead deliveries only.
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	hook, ok := findWebhook(w, r)
+	if !ok {
+		return
+	}
+	limit, cursor, err := pageParams(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	query := database.DB.Where("webhook_id = ?", hook.ID)
+	if cursor > 0 {
+		query = query.Where("id < ?", cursor)
+	}
+	switch status := r.URL.Query().Get("status"); status {
+	case "":
+	case models.DeliveryPending, models.DeliveryDelivered, models.DeliveryDead:
+		query = query.Where("status = ?", status)
+	default:
+		http.Error(w, "status must be pending, delivered or dead", http.StatusBadRequest)
+		return
+	}
+
+	deliveries := []models.WebhookDelivery{}
+	if err := query.Order("id DESC").Limit(limit + 1).Find(&deliveries).Error; err != nil {
+		http.Error(w, "Error retrieving deliveries", http.StatusInternalServerError)
+		return
+	}
+	next := nextCursor(len(deliveries), limit, func(i int) uint { return deliveries[i].ID })
+	if next != nil {
+		deliveries = deliveries[:limit]
+	}
+	json.NewEncoder(w).Encode(page{Items: deliveries, NextCursor: next})
+}
+
+// RedeliverWebhookDelivery - Queues a delivery again with a fresh set of
+// attempts, e.g. once a dead endpoint is fixed
+func RedeliverWebhookDelivery(w http.ResponseWriter, r *http.Request) {
+	hook, ok := findWebhook(w, r)
+	if !ok {
+		return
+	}
+	var delivery models.WebhookDelivery
+	if err := database.DB.Where("id = ? AND webhook_id = ?", mux.Vars(r)["delivery_id"], hook.ID).First(&delivery).Error; err != nil {
+		http.Error(w, "Delivery not found", http.StatusNotFound)
+		return
+	}
+	if delivery.Status == models.DeliveryPending {
+		http.Error(w, "The delivery is still pending", http.StatusConflict)
+		return
+	}
+
+	now := time.Now()
+	delivery.Status, delivery.Attempts, delivery.NextAttemptAt = models.DeliveryPending, 0, &now
+	changes := map[string]interface{}{"status": delivery.Status, "attempts": 0, "next_attempt_at": now}
+	if err := database.DB.Model(&delivery).Updates(changes).Error; err != nil {
+		fmt.Println("❌ Error queueing webhook redelivery:", err)
+		http.Error(w, "Error queueing redelivery", http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(delivery)
+}
+
+func findWebhook(w http.ResponseWriter, r *http.Request) (models.Webhook, bool) {
+	vars := mux.Vars(r)
+	var hook models.Webhook
+	if err := database.DB.Where("id = ? AND group_id = ?", vars["webhook_id"], vars["group_id"]).First(&hook).Error; err != nil {
+		http.Error(w, "Webhook not found", http.StatusNotFound)
+		return hook, false
+	}
+	return hook, true
+}
+
+// applyWebhookRequest - Validates the fields that were sent and sets them on the webhook
+func applyWebhookRequest(hook *models.Webhook, req webhookRequest) error {
+	if req.URL != nil {
+		u, err := url.Parse(strings.TrimSpace(*req.URL))
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("url must be an http or https URL")
+		}
+		// Hostnames are checked again on every delivery, once resolved
+		host := u.Hostname()
+		if strings.EqualFold(host, "localhost") {
+			host = "127.0.0.1"
+		}
+		if addr, err := netip.ParseAddr(host); err == nil && !webhookAddressAllowed(addr) {
+			return fmt.Errorf("url must not point to an internal address")
+		}
+		hook.URL = u.String()
+	}
+	if req.Events != nil {
+		for _, e := range req.Events {
+			if !webhookEventPattern.MatchString(e) {
+				return fmt.Errorf("invalid event type %q", e)
+			}
+		}
+		hook.Events = strings.Join(req.Events, ",")
+	}
+	if req.Active != nil {
+		hook.Active = *req.Active
+	}
+	return nil
+}
+
+// webhookWants - Whether the webhook's event filter takes the event type
+func webhookWants(hook models.Webhook, eventType string) bool {
+	if hook.Events == "" {
+		return true
+	}
+	for _, f := range splitList(hook.Events) {
+		if f == eventType || strings.HasPrefix(eventType, f+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// enqueueWebhooks - Queues the activity for the group's webhooks in the same
+// transaction, so they are sent exactly the changes that were committed
+func enqueueWebhooks(tx *gorm.DB, entry models.Activity) error {
+	var hooks []models.Webhook
+	if err := tx.Where("group_id = ? AND active = ?", entry.GroupID, true).Find(&hooks).Error; err != nil {
+		return err
+	}
+	event := activityEvent(entry)
+	for _, hook := range hooks {
+		if !webhookWants(hook, event.Type) {
+			continue
+		}
+		if _, err := queueDelivery(tx, hook, event); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func queueDelivery(tx *gorm.DB, hook models.Webhook, event events.Event) (models.WebhookDelivery, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return models.WebhookDelivery{}, err
+	}
+	now := time.Now()
+	delivery := models.WebhookDelivery{
+		WebhookID:     hook.ID,
+		EventID:       event.ID,
+		EventType:     event.Type,
+		Payload:       string(payload),
+		Status:        models.DeliveryPending,
+		NextAttemptAt: &now,
+	}
+	return delivery, tx.Create(&delivery).Error
+}
+
+// RunWebhookDeliveries - Attempts the deliveries that are due, oldest first.
+// Returns how many were attempted.
+func RunWebhookDeliveries(now time.Time) (int, error) {
+	var due []models.WebhookDelivery
+	err := database.DB.Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, now).
+		Order("next_attempt_at, id").Limit(webhookBatchSize).Find(&due).Error
+	if err != nil {
+		return 0, err
+	}
+
+	attempted := 0
+	for i := range due {
+		ok, err := attemptDelivery(&due[i], now)
+		if err != nil {
+			return attempted, fmt.Errorf("delivery %d: %w", due[i].ID, err)
+		}
+		if ok {
+			attempted++
+		}
+	}
+	return attempted, nil
+}
+
+// attemptDelivery - Claims the next attempt of the delivery and makes it.
+// Returns false when another instance claimed it first.
+func attemptDelivery(d *models.WebhookDelivery, now time.Time) (bool, error) {
+	// Attempts acts as the version; an attempt that never finishes is retried once the lease runs out
+	result := database.DB.Model(&models.WebhookDelivery{}).
+		Where("id = ? AND attempts = ? AND status = ?", d.ID, d.Attempts, models.DeliveryPending).
+		Updates(map[string]interface{}{"attempts": d.Attempts + 1, "next_attempt_at": now.Add(webhookLease)})
+	if result.Error != nil || result.RowsAffected == 0 {
+		return false, result.Error
+	}
+	d.Attempts++
+
+	var hook models.Webhook
+	var code int
+	gone := false
+	err := database.DB.First(&hook, d.WebhookID).Error
+	if err != nil {
+		// Deleted since the delivery was queued
+		err, gone = fmt.Errorf("webhook not found"), true
+	} else {
+		code, err = sendWebhook(hook, *d)
+	}
+
+	changes := map[string]interface{}{"last_attempt_at": now, "response_code": code, "error": ""}
+	switch {
+	case err == nil:
+		changes["status"] = models.DeliveryDelivered
+		changes["next_attempt_at"] = nil
+		changes["delivered_at"] = now
+	case gone || d.Attempts >= WebhookMaxAttempts:
+		changes["status"] = models.DeliveryDead
+		changes["next_attempt_at"] = nil
+		changes["error"] = err.Error()
+		fmt.Printf("⚠️ Giving up webhook delivery %d after %d attempts: %v\n", d.ID, d.Attempts, err)
+	default:
+		changes["next_attempt_at"] = now.Add(webhookBackoff(d.Attempts))
+		changes["error"] = err.Error()
+	}
+	// Unless the lease ran out and another instance made the next attempt already
+	err = database.DB.Model(&models.WebhookDelivery{}).Where("id = ? AND attempts = ?", d.ID, d.Attempts).Updates(changes).Error
+	return true, err
+}
+
+// webhookBackoff - The wait after the given number of failed attempts
+func webhookBackoff(attempts int) time.Duration {
+	wait := WebhookBackoff
+	for i := 1; i < attempts && wait < maxWebhookBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, maxWebhookBackoff)
+}
+
+// sendWebhook - POSTs the payload, signed with the webhook's secret. Anything
+// but a 2xx answer is an error. Returns the response status; the body is not
+// kept, so webhooks cannot be used to read other services' responses.
+func sendWebhook(hook models.Webhook, d models.WebhookDelivery) (int, error) {
+	req, err := http.NewRequest("POST", hook.URL, strings.NewReader(d.Payload))
+	if err != nil {
+		return 0, err
+	}
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "GatorSplit-Webhooks")
+	req.Header.Set("X-GatorSplit-Event", d.EventType)
+	req.Header.Set("X-GatorSplit-Delivery", strconv.FormatUint(uint64(d.ID), 10))
+	req.Header.Set("X-GatorSplit-Timestamp", timestamp)
+	req.Header.Set("X-GatorSplit-Signature", "sha256="+signWebhook(hook.Secret, timestamp, d.Payload))
+
+	resp, err := WebhookClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096)) // Lets the connection be reused
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("the endpoint answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// checkWebhookAddress - Dialer hook refusing connections to internal
+// addresses, whatever the webhook's hostname resolved to
+func checkWebhookAddress(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	if !webhookAddressAllowed(addr) {
+		return fmt.Errorf("webhooks cannot be sent to the internal address %s", addr)
+	}
+	return nil
+}
+
+// webhookAddressAllowed - Whether webhooks may connect to the address
+func webhookAddressAllowed(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	for _, network := range WebhookAllowedNetworks {
+		if network.Contains(addr) {
+			return true
+		}
+	}
+	return !(addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() || addr.IsUnspecified() ||
+		sharedAddressSpace.Contains(addr))
+}
+
+// sharedAddressSpace - Carrier-grade NAT range (RFC 6598), internal to many cloud networks
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// signWebhook - HMAC-SHA256 of "<timestamp>.<payload>" with the secret, in
+// hex. Receivers compute it the same way and compare in constant time.
+func signWebhook(secret, timestamp, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// splitList - The items of a comma separated list
+func splitList(v string) []string {
+	items := []string{}
+	for _, item := range strings.Split(v, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,243 @@
+package handlers_test
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/models"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// receiver - A local endpoint recording the webhook requests it gets. Loopback
+// addresses are allowed while it runs.
+type receiver struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	requests []receivedWebhook
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   string
+}
+
+func newReceiver(t *testing.T) *receiver {
+	rec := &receiver{status: http.StatusOK}
+	rec.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		rec.mu.Lock()
+		defer rec.mu.Unlock()
+		rec.requests = append(rec.requests, receivedWebhook{r.Header, string(body)})
+		w.WriteHeader(rec.status)
+	}))
+	t.Cleanup(rec.Close)
+	allowed := handlers.WebhookAllowedNetworks
+	handlers.WebhookAllowedNetworks = []netip.Prefix{netip.MustParsePrefix("127.0.0.0/8")}
+	t.Cleanup(func() { handlers.WebhookAllowedNetworks = allowed })
+	return rec
+}
+
+func (rec *receiver) received() []receivedWebhook {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]receivedWebhook(nil), rec.requests...)
+}
+
+func (rec *receiver) answer(status int) {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	rec.status = status
+}
+
+// webhookRequest - Calls a webhook handler on behalf of the user
+func webhookRequest(handler http.HandlerFunc, groupID, webhookID, deliveryID, userID uint, query, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/?"+query, strings.NewReader(body))
+	req = mux.SetURLVars(req, map[string]string{
+		"group_id":    fmt.Sprint(groupID),
+		"webhook_id":  fmt.Sprint(webhookID),
+		"delivery_id": fmt.Sprint(deliveryID),
+	})
+	rr := httptest.NewRecorder()
+	handler(rr, withUser(req, userID))
+	return rr
+}
+
+func createWebhook(t *testing.T, groupID, userID uint, body string) (id uint, secret string) {
+	rr := webhookRequest(handlers.CreateWebhook, groupID, 0, 0, userID, "", body)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("Expected 201 Created, got %d: %s", rr.Code, rr.Body.String())
+	}
+	var hook struct {
+		ID     uint   `json:"ID"`
+		Secret string `json:"secret"`
+	}
+	json.NewDecoder(rr.Body).Decode(&hook)
+	return hook.ID, hook.Secret
+}
+
+func runWebhooks(t *testing.T, now time.Time) int {
+	t.Helper()
+	n, err := handlers.RunWebhookDeliveries(now)
+	if err != nil {
+		t.Fatalf("RunWebhookDeliveries failed: %v", err)
+	}
+	return n
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	group, alice, bob, carol := invitationFixture(t)
+	addMembers(group.ID, bob.ID)
+	endpoint := newReceiver(t)
+
+	for _, body := range []string{`{}`, `{"url": "ftp://example.com"}`, `{"url": "http://localhost", "events": ["Expense!"]}`} {
+		if rr := webhookRequest(handlers.CreateWebhook, group.ID, 0, 0, alice.ID, "", body); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be refused, got %d", body, rr.Code)
+		}
+	}
+	_, secret := createWebhook(t, group.ID, alice.ID, fmt.Sprintf(`{"url": %q, "events": ["expense", "settlement.recorded"]}`, endpoint.URL))
+	if !strings.HasPrefix(secret, "whsec_") {
+		t.Fatalf("Expected the secret to be returned, got %q", secret)
+	}
+
+	// Only the events the webhook asked for are queued
+	createGroupExpense(t, alice.ID, group.ID, "Groceries", alice.ID, bob.ID)
+	token := createInvitation(t, group, alice.ID, `{"max_uses": 5}`)["token"].(string)
+	answerInvitation(handlers.AcceptInvitation, token, carol.ID)
+	if n := runWebhooks(t, time.Now()); n != 1 {
+		t.Fatalf("Expected 1 delivery, got %d", n)
+	}
+
+	requests := endpoint.received()
+	if len(requests) != 1 {
+		t.Fatalf("Expected the endpoint to get 1 request, got %d", len(requests))
+	}
+	got := requests[0]
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(got.header.Get("X-GatorSplit-Timestamp") + "." + got.body))
+	if got.header.Get("X-GatorSplit-Signature") != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+		t.Errorf("Expected a valid signature, got %q", got.header.Get("X-GatorSplit-Signature"))
+	}
+	var event struct {
+		Type    string                 `json:"type"`
+		GroupID uint                   `json:"group_id"`
+		Data    map[string]interface{} `json:"data"`
+	}
+	json.Unmarshal([]byte(got.body), &event)
+	if got.header.Get("X-GatorSplit-Event") != "expense.created" || event.Type != "expense.created" || event.GroupID != group.ID || event.Data["title"] != "Groceries" {
+		t.Errorf("Unexpected delivery %v: %s", got.header, got.body)
+	}
+
+	var delivery models.WebhookDelivery
+	database.DB.First(&delivery)
+	if delivery.Status != models.DeliveryDelivered || delivery.Attempts != 1 || delivery.ResponseCode != http.StatusOK || delivery.NextAttemptAt != nil {
+		t.Errorf("Expected the delivery to be logged as delivered, got %+v", delivery)
+	}
+	if n := runWebhooks(t, time.Now()); n != 0 {
+		t.Errorf("Expected nothing left to deliver, got %d", n)
+	}
+}
+
+func TestWebhookRetriesUntilDead(t *testing.T) {
+	group, alice, bob, _ := invitationFixture(t)
+	addMembers(group.ID, bob.ID)
+	endpoint := newReceiver(t)
+	endpoint.answer(http.StatusInternalServerError)
+	maxAttempts := handlers.WebhookMaxAttempts
+	handlers.WebhookMaxAttempts = 3
+	t.Cleanup(func() { handlers.WebhookMaxAttempts = maxAttempts })
+
+	hookID, _ := createWebhook(t, group.ID, alice.ID, fmt.Sprintf(`{"url": %q}`, endpoint.URL))
+	if rr := webhookRequest(handlers.PingWebhook, group.ID, hookID, 0, alice.ID, "", ""); rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202 Accepted, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Retried after 1, then 2 more minutes
+	now := time.Now()
+	for i, at := range []time.Duration{0, 30 * time.Second, time.Minute, 2 * time.Minute, 3 * time.Minute} {
+		want := map[int]int{0: 1, 2: 1, 4: 1}[i]
+		if n := runWebhooks(t, now.Add(at)); n != want {
+			t.Errorf("Expected %d attempts at +%s, got %d", want, at, n)
+		}
+	}
+	if len(endpoint.received()) != 3 {
+		t.Errorf("Expected 3 attempts, got %d", len(endpoint.received()))
+	}
+
+	// The delivery log shows the dead letter and why
+	rr := webhookRequest(handlers.GetWebhookDeliveries, group.ID, hookID, 0, alice.ID, "status=dead", "")
+	var deliveries struct {
+		Items []models.WebhookDelivery `json:"items"`
+	}
+	json.NewDecoder(rr.Body).Decode(&deliveries)
+	if len(deliveries.Items) != 1 {
+		t.Fatalf("Expected 1 dead delivery, got %s", rr.Body.String())
+	}
+	dead := deliveries.Items[0]
+	if dead.EventType != "ping" || dead.Attempts != 3 || dead.ResponseCode != http.StatusInternalServerError || dead.Error == "" {
+		t.Errorf("Unexpected dead delivery %+v", dead)
+	}
+
+	// Once the endpoint is fixed it can be sent again
+	endpoint.answer(http.StatusNoContent)
+	if rr := webhookRequest(handlers.RedeliverWebhookDelivery, group.ID, hookID, dead.ID, alice.ID, "", ""); rr.Code != http.StatusAccepted {
+		t.Fatalf("Expected 202 Accepted, got %d: %s", rr.Code, rr.Body.String())
+	}
+	runWebhooks(t, time.Now())
+	var delivery models.WebhookDelivery
+	database.DB.First(&delivery, dead.ID)
+	if delivery.Status != models.DeliveryDelivered || delivery.Attempts != 1 {
+		t.Errorf("Expected the redelivery to succeed, got %+v", delivery)
+	}
+
+	// Inactive and deleted webhooks are sent nothing new
+	if rr := webhookRequest(handlers.UpdateWebhook, group.ID, hookID, 0, alice.ID, "", `{"active": false}`); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	createGroupExpense(t, alice.ID, group.ID, "Groceries", alice.ID, bob.ID)
+	if rr := webhookRequest(handlers.DeleteWebhook, group.ID, hookID, 0, alice.ID, "", ""); rr.Code != http.StatusOK {
+		t.Fatalf("Expected 200 OK, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if n := runWebhooks(t, time.Now().Add(time.Hour)); n != 0 {
+		t.Errorf("Expected no deliveries, got %d", n)
+	}
+	if rr := webhookRequest(handlers.GetWebhookDeliveries, group.ID, hookID, 0, alice.ID, "", ""); rr.Code != http.StatusNotFound {
+		t.Errorf("Expected the deleted webhook to be gone, got %d", rr.Code)
+	}
+}
+
+func TestWebhookRefusesInternalAddresses(t *testing.T) {
+	group, alice, _, _ := invitationFixture(t)
+	for _, target := range []string{"http://169.254.169.254/latest/meta-data", "http://localhost:5432", "http://10.0.0.8", "http://[::1]:8080"} {
+		body := fmt.Sprintf(`{"url": %q}`, target)
+		if rr := webhookRequest(handlers.CreateWebhook, group.ID, 0, 0, alice.ID, "", body); rr.Code != http.StatusBadRequest {
+			t.Errorf("Expected %s to be refused, got %d", target, rr.Code)
+		}
+	}
+
+	// A hostname that resolves to an internal address is refused when connecting
+	endpoint := newReceiver(t)
+	hookID, _ := createWebhook(t, group.ID, alice.ID, fmt.Sprintf(`{"url": %q}`, endpoint.URL))
+	handlers.WebhookAllowedNetworks = nil
+	webhookRequest(handlers.PingWebhook, group.ID, hookID, 0, alice.ID, "", "")
+	runWebhooks(t, time.Now())
+
+	var delivery models.WebhookDelivery
+	database.DB.First(&delivery)
+	if len(endpoint.received()) != 0 || delivery.Status != models.DeliveryPending || !strings.Contains(delivery.Error, "internal address") {
+		t.Errorf("Expected the delivery to be refused, got %+v", delivery)
+	}
+}
@@ -0,0 +1,96 @@
+package mailer
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// Message - A plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer sends emails; handlers only depend on this interface
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// SMTPMailer - Delivers mail through an SMTP server, using STARTTLS when the
+// server offers it and PLAIN auth when a username is set
+type SMTPMailer struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string // May include a display name, e.g. "GatorSplit <noreply@example.com>"
+}
+
+func (m SMTPMailer) Send(msg Message) error {
+	from, err := mail.ParseAddress(m.From)
+	if err != nil {
+		return fmt.Errorf("invalid from address %q: %w", m.From, err)
+	}
+
+	addr := net.JoinHostPort(m.Host, strconv.Itoa(m.Port))
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+	if err := smtp.SendMail(addr, auth, from.Address, []string{msg.To}, format(m.From, msg)); err != nil {
+		return fmt.Errorf("sending mail to %s: %w", msg.To, err)
+	}
+	return nil
+}
+
+// LogMailer - Development mailer. Writes every message as an .eml file in Dir,
+// or prints it to stdout when Dir is empty.
+type LogMailer struct {
+	Dir  string
+	From string
+}
+
+// fileCounter keeps file names unique when several mails are sent in the same instant
+var fileCounter uint64
+
+func (m LogMailer) Send(msg Message) error {
+	data := format(m.From, msg)
+	if m.Dir == "" {
+		fmt.Printf("📧 Mail to %s\n%s\n", msg.To, data)
+		return nil
+	}
+
+	if err := os.MkdirAll(m.Dir, 0o755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s-%d.eml", time.Now().UTC().Format("20060102T150405.000000000"), atomic.AddUint64(&fileCounter, 1))
+	return os.WriteFile(filepath.Join(m.Dir, name), data, 0o600)
+}
+
+// format - Renders the message in RFC 5322 format
+func format(from string, msg Message) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", headerValue(from))
+	fmt.Fprintf(&b, "To: %s\r\n", headerValue(msg.To))
+	fmt.Fprintf(&b, "Subject: %s\r\n", headerValue(msg.Subject))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("\r\n")
+	b.WriteString(strings.ReplaceAll(msg.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+// headerValue - Drops line breaks so user input cannot inject extra headers
+func headerValue(v string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(v)
+}
@@ -0,0 +1,110 @@
+package mailer_test
+
+import (
+	"bufio"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"go-auth-app/mailer"
+)
+
+// fakeSMTPServer - Accepts one SMTP session on localhost and returns what it received
+func fakeSMTPServer(t *testing.T) (host string, port int, received chan string) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %v", err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	received = make(chan string, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		reply := func(s string) { conn.Write([]byte(s + "\r\n")) }
+		var session strings.Builder
+
+		reply("220 localhost ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			cmd := strings.ToUpper(strings.TrimSpace(line))
+			session.WriteString(line)
+			switch {
+			case strings.HasPrefix(cmd, "EHLO"):
+				reply("250-localhost")
+				reply("250 AUTH PLAIN")
+			case strings.HasPrefix(cmd, "AUTH"):
+				reply("235 Authenticated")
+			case strings.HasPrefix(cmd, "DATA"):
+				reply("354 Go ahead")
+				for {
+					dataLine, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if dataLine == ".\r\n" {
+						break
+					}
+					session.WriteString(dataLine)
+				}
+				reply("250 Queued")
+			case strings.HasPrefix(cmd, "QUIT"):
+				reply("221 Bye")
+				received <- session.String()
+				return
+			default:
+				reply("250 OK")
+			}
+		}
+	}()
+
+	addr := ln.Addr().(*net.TCPAddr)
+	return "127.0.0.1", addr.Port, received
+}
+
+func TestSMTPMailer(t *testing.T) {
+	host, port, received := fakeSMTPServer(t)
+	m := mailer.SMTPMailer{Host: host, Port: port, Username: "user", Password: "pass", From: "GatorSplit <noreply@gatorsplit.test>"}
+
+	err := m.Send(mailer.Message{To: "alice@example.com", Subject: "Hello", Body: "Line one\nLine two"})
+	if err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	session := <-received
+	for _, want := range []string{"MAIL FROM:<noreply@gatorsplit.test>", "RCPT TO:<alice@example.com>", "Subject: Hello", "Line two"} {
+		if !strings.Contains(session, want) {
+			t.Errorf("Expected SMTP session to contain %q:\n%s", want, session)
+		}
+	}
+}
+
+func TestLogMailerWritesFiles(t *testing.T) {
+	dir := t.TempDir()
+	m := mailer.LogMailer{Dir: dir, From: "GatorSplit <noreply@gatorsplit.test>"}
+
+	if err := m.Send(mailer.Message{To: "alice@example.com", Subject: "Hi\r\nBcc: evil@example.com", Body: "Body"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Fatalf("Expected one mail file, got %d", len(entries))
+	}
+	data, _ := os.ReadFile(dir + "/" + entries[0].Name())
+	if strings.Contains(string(data), "\r\nBcc:") {
+		t.Errorf("Expected header injection to be stripped:\n%s", data)
+	}
+	if !strings.Contains(string(data), "To: alice@example.com") {
+		t.Errorf("Expected the recipient header:\n%s", data)
+	}
+}
@@ -1,75 +1,299 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
+	"go-auth-app/blobstore"
+	"go-auth-app/config"
 	"go-auth-app/database"
+	"go-auth-app/events"
 	"go-auth-app/handlers"
+	"go-auth-app/mailer"
 	"go-auth-app/middleware"
+	"go-auth-app/ratelimit"
+	"log"
 	"net/http"
+	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 )
 
-// CORS middleware function
-func enableCORS(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Access-Control-Allow-Origin", "http://localhost:3000") // React Frontend
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+// CORS middleware function; only the configured origins (or "*") are allowed
+func enableCORS(allowedOrigins []string) mux.MiddlewareFunc {
+	allowed := make(map[string]bool)
+	for _, origin := range allowedOrigins {
+		allowed[origin] = true
+	}
 
-		if r.Method == "OPTIONS" {
-			w.WriteHeader(http.StatusOK)
-			return
-		}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if allowed["*"] {
+				w.Header().Set("Access-Control-Allow-Origin", "*")
+			} else if allowed[origin] {
+				w.Header().Set("Access-Control-Allow-Origin", origin) // e.g. the React Frontend
+				w.Header().Add("Vary", "Origin")
+			}
+			w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+			w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
 
-		next.ServeHTTP(w, r)
-	})
+			if r.Method == "OPTIONS" {
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
 }
 
-func main() {
-	// Connect to the database
-	database.ConnectDatabase()
+// limitBy - Rate limiting middleware allowing perMinute requests per key, or a no-op when it is 0
+func limitBy(perMinute int, by func(*ratelimit.Limiter) func(http.Handler) http.Handler) mux.MiddlewareFunc {
+	if perMinute <= 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	return by(ratelimit.PerMinute(perMinute))
+}
 
-	// Create a new router
+// newMailer - Builds the mailer selected by the mail driver setting
+func newMailer(cfg config.Mail) mailer.Mailer {
+	if cfg.Driver == config.MailDriverSMTP {
+		return mailer.SMTPMailer{Host: cfg.Host, Port: cfg.Port, Username: cfg.Username, Password: cfg.Password, From: cfg.From}
+	}
+	return mailer.LogMailer{Dir: cfg.Dir, From: cfg.From}
+}
+
+// newBlobStore - Builds the attachment store selected by the storage driver setting
+func newBlobStore(cfg config.Storage) blobstore.Store {
+	if cfg.Driver == config.StorageDriverS3 {
+		return blobstore.S3Store{Endpoint: cfg.Endpoint, Region: cfg.Region, Bucket: cfg.Bucket, AccessKey: cfg.AccessKey, SecretKey: cfg.SecretKey}
+	}
+	return blobstore.LocalStore{Dir: cfg.Dir}
+}
+
+// runEvery - Runs a background job on a fixed interval, logging what it did
+func runEvery(every time.Duration, name string, job func(now time.Time) (int, error)) {
+	for {
+		n, err := job(time.Now())
+		if err != nil {
+			fmt.Printf("❌ Error %s: %v\n", name, err)
+		} else if n > 0 {
+			fmt.Printf("⏱️ Done %s: %d\n", name, n)
+		}
+		time.Sleep(every)
+	}
+}
+
+// purgeDeleted - Permanently removes deleted groups and threads once their restore window has passed
+func purgeDeleted(now time.Time) (int, error) {
+	return handlers.PurgeDeleted(now.Add(-handlers.RestoreWindow))
+}
+
+// newRouter - Builds the API routes with their authentication, authorization and rate limits
+func newRouter(cfg config.Config) *mux.Router {
 	r := mux.NewRouter()
-	r.Use(enableCORS)
+	r.Use(enableCORS(cfg.CORSOrigins))
+	r.Use(limitBy(cfg.RateLimit.IPPerMinute, middleware.RateLimitByIP))
+
+	// Public Routes (No authentication needed); the stricter limit slows down password guessing
+	authLimit := limitBy(cfg.RateLimit.AuthPerMinute, middleware.RateLimitByIP)
+	authRoute := func(h http.HandlerFunc) http.Handler { return authLimit(h) }
+	r.Handle("/register", authRoute(handlers.Register)).Methods("POST", "OPTIONS")
+	r.Handle("/login", authRoute(handlers.Login)).Methods("POST", "OPTIONS")
+	r.Handle("/login/mfa", authRoute(handlers.LoginMFA)).Methods("POST", "OPTIONS")
+	r.Handle("/refresh", authRoute(handlers.Refresh)).Methods("POST", "OPTIONS")
+	r.Handle("/verify-email", authRoute(handlers.VerifyEmail)).Methods("POST", "OPTIONS")
+	r.Handle("/password/forgot", authRoute(handlers.ForgotPassword)).Methods("POST", "OPTIONS")
+	r.Handle("/password/reset", authRoute(handlers.ResetPassword)).Methods("POST", "OPTIONS")
 
-	// Public Routes (No authentication needed)
-	r.HandleFunc("/register", handlers.Register).Methods("POST", "OPTIONS")
-	r.HandleFunc("/login", handlers.Login).Methods("POST", "OPTIONS")
+	// Real-time updates; EventSource clients pass a token from /api/stream/token as ?token=
+	streamAuth := func(h http.HandlerFunc) http.Handler {
+		return middleware.StreamAuthMiddleware(limitBy(cfg.RateLimit.UserPerMinute, middleware.RateLimitByUser)(h))
+	}
+	r.Handle("/api/stream", streamAuth(handlers.StreamEvents)).Methods("GET", "OPTIONS")
 
 	// Protected Routes (Require authentication)
 	protected := r.PathPrefix("/api").Subrouter()
 	protected.Use(middleware.AuthMiddleware)
+	protected.Use(limitBy(cfg.RateLimit.UserPerMinute, middleware.RateLimitByUser))
+
+	// Group authorization: the group is resolved from the route's group/thread/expense ID
+	groupMember := func(h http.HandlerFunc) http.Handler { return middleware.RequireGroupMember(h) }
+	groupAdmin := func(h http.HandlerFunc) http.Handler { return middleware.RequireGroupAdmin(h) }
+	groupOwner := func(h http.HandlerFunc) http.Handler { return middleware.RequireGroupOwner(h) }
+	// Changes to archived groups and threads are refused
+	writable := func(h http.HandlerFunc) http.HandlerFunc { return middleware.RequireWritable(h).ServeHTTP }
 
 	// User Profile
 	protected.HandleFunc("/profile", handlers.Profile).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/logout", handlers.Logout).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/verify-email/resend", handlers.ResendVerificationEmail).Methods("POST", "OPTIONS")
+
+	// Two-factor authentication
+	protected.HandleFunc("/2fa/enroll", handlers.EnrollTOTP).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/2fa/confirm", handlers.ConfirmTOTP).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/2fa/disable", handlers.DisableTOTP).Methods("POST", "OPTIONS")
 
 	// User and Group Management
 	protected.HandleFunc("/users", handlers.GetAllUsers).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/groups", handlers.CreateGroup).Methods("POST", "OPTIONS")
-	protected.HandleFunc("/groups/{group_id}/editusers", handlers.UpdateGroupMembers).Methods("POST", "OPTIONS")
+	protected.Handle("/groups/{group_id}/editusers", groupMember(writable(handlers.UpdateGroupMembers))).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/users/groups", handlers.GetUserGroups).Methods("GET", "OPTIONS")
-	protected.HandleFunc("/groups/{id}/users", handlers.GetGroupUsers).Methods("GET", "OPTIONS")
-	protected.HandleFunc("/groups/{group_id}/expenses", handlers.GetGroupExpensesWithDetails).Methods("GET", "OPTIONS")
-	protected.HandleFunc("/groups/{group_id}/balances", handlers.GetGroupBalances).Methods("GET", "OPTIONS")
-	protected.HandleFunc("/groups/{group_id}", handlers.DeleteGroup).Methods("DELETE", "OPTIONS")
+	protected.Handle("/groups/{id}/users", groupMember(handlers.GetGroupUsers)).Methods("GET", "OPTIONS")
+	protected.Handle("/groups/{group_id}/members/{user_id}", groupAdmin(writable(handlers.RemoveGroupMember))).Methods("DELETE", "OPTIONS")
+	protected.Handle("/groups/{group_id}/members/{user_id}/role", groupAdmin(writable(handlers.UpdateMemberRole))).Methods("PUT", "OPTIONS")
+	protected.Handle("/groups/{group_id}/leave", groupMember(writable(handlers.LeaveGroup))).Methods("POST", "OPTIONS")
+
+	// Invitations: members invite, admins manage outstanding invitations
+	protected.Handle("/groups/{group_id}/invitations", groupMember(writable(handlers.CreateInvitation))).Methods("POST", "OPTIONS")
+	protected.Handle("/groups/{group_id}/invitations", groupAdmin(handlers.GetGroupInvitations)).Methods("GET", "OPTIONS")
+	protected.Handle("/groups/{group_id}/invitations/{invitation_id}", groupAdmin(handlers.RevokeInvitation)).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/invitations/{token}", handlers.GetInvitation).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/invitations/{token}/accept", handlers.AcceptInvitation).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/invitations/{token}/decline", handlers.DeclineInvitation).Methods("POST", "OPTIONS")
+	protected.Handle("/groups/{group_id}/expenses", groupMember(handlers.GetGroupExpensesWithDetails)).Methods("GET", "OPTIONS")
+	protected.Handle("/groups/{group_id}/balances", groupMember(handlers.GetGroupBalances)).Methods("GET", "OPTIONS")
+	protected.Handle("/groups/{group_id}/activity", groupMember(handlers.GetGroupActivity)).Methods("GET", "OPTIONS")
+	protected.Handle("/groups/{group_id}/settle-plan", groupMember(handlers.GetGroupSettlePlan)).Methods("GET", "OPTIONS")
+	protected.Handle("/groups/{group_id}", groupAdmin(writable(handlers.RenameGroup))).Methods("PUT", "OPTIONS")
+	protected.Handle("/groups/{group_id}", groupOwner(handlers.DeleteGroup)).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/groups/{group_id}/restore", handlers.RestoreGroup).Methods("POST", "OPTIONS")
+	protected.Handle("/groups/{group_id}/archive", groupAdmin(handlers.ArchiveGroup)).Methods("POST", "OPTIONS")
+	protected.Handle("/groups/{group_id}/unarchive", groupAdmin(handlers.UnarchiveGroup)).Methods("POST", "OPTIONS")
 
 	// Thread Management
 	protected.HandleFunc("/threads", handlers.CreateThread).Methods("POST", "OPTIONS")
-	protected.HandleFunc("/groups/{group_id}/threads", handlers.GetThreadsByGroup).Methods("GET", "OPTIONS")
-	protected.HandleFunc("/threads/{thread_id}/expenses", handlers.GetThreadExpensesWithDetails).Methods("GET", "OPTIONS")
-	protected.HandleFunc("/threads/{thread_id}/balances", handlers.GetThreadBalances).Methods("GET", "OPTIONS")
-	protected.HandleFunc("/threads/{thread_id}", handlers.DeleteThread).Methods("DELETE", "OPTIONS")
+	protected.Handle("/groups/{group_id}/threads", groupMember(handlers.GetThreadsByGroup)).Methods("GET", "OPTIONS")
+	protected.Handle("/threads/{thread_id}/expenses", groupMember(handlers.GetThreadExpensesWithDetails)).Methods("GET", "OPTIONS")
+	protected.Handle("/threads/{thread_id}/balances", groupMember(handlers.GetThreadBalances)).Methods("GET", "OPTIONS")
+	protected.Handle("/threads/{thread_id}/settle-plan", groupMember(handlers.GetThreadSettlePlan)).Methods("GET", "OPTIONS")
+	protected.Handle("/threads/{thread_id}", groupAdmin(handlers.DeleteThread)).Methods("DELETE", "OPTIONS")
+	protected.HandleFunc("/threads/{thread_id}/restore", handlers.RestoreThread).Methods("POST", "OPTIONS")
+	protected.Handle("/threads/{thread_id}/archive", groupAdmin(handlers.ArchiveThread)).Methods("POST", "OPTIONS")
+	protected.Handle("/threads/{thread_id}/unarchive", groupAdmin(handlers.UnarchiveThread)).Methods("POST", "OPTIONS")
 
 	// Expense Management
 	protected.HandleFunc("/expenses", handlers.CreateExpense).Methods("POST", "OPTIONS")
 	protected.HandleFunc("/personal-expense", handlers.CreatePersonalExpense).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/dashboard/balances", handlers.GetDashboardBalances).Methods("GET", "OPTIONS")
 	protected.HandleFunc("/dashboard/balances/{user_id}", handlers.GetDashboardBalances).Methods("GET", "OPTIONS")
 	//protected.HandleFunc("/expenses/{expense_id}/settle", handlers.SettleExpense).Methods("POST", "OPTIONS")
-	protected.HandleFunc("/expenses/{expense_id}", handlers.DeleteExpense).Methods("DELETE", "OPTIONS")
+	protected.Handle("/expenses/{expense_id}", groupAdmin(writable(handlers.UpdateExpense))).Methods("PUT", "OPTIONS")
+	protected.Handle("/expenses/{expense_id}", groupAdmin(writable(handlers.DeleteExpense))).Methods("DELETE", "OPTIONS")
+	protected.Handle("/expenses/{expense_id}/history", groupMember(handlers.GetExpenseHistory)).Methods("GET", "OPTIONS")
+	protected.Handle("/expenses/{expense_id}/attachments", groupMember(writable(handlers.UploadAttachment))).Methods("POST", "OPTIONS")
+	protected.Handle("/expenses/{expense_id}/attachments", groupMember(handlers.GetExpenseAttachments)).Methods("GET", "OPTIONS")
+	protected.Handle("/expenses/{expense_id}/attachments/{attachment_id}", groupMember(handlers.DownloadAttachment)).Methods("GET", "OPTIONS")
+	protected.Handle("/expenses/{expense_id}/attachments/{attachment_id}", groupMember(writable(handlers.DeleteAttachment))).Methods("DELETE", "OPTIONS")
+	protected.Handle("/expenses/{expense_id}/comments", groupMember(writable(handlers.CreateComment))).Methods("POST", "OPTIONS")
+	protected.Handle("/expenses/{expense_id}/comments", groupMember(handlers.GetExpenseComments)).Methods("GET", "OPTIONS")
+	protected.Handle("/expenses/{expense_id}/comments/{comment_id}", groupMember(writable(handlers.UpdateComment))).Methods("PUT", "OPTIONS")
+	protected.Handle("/expenses/{expense_id}/comments/{comment_id}", groupMember(writable(handlers.DeleteComment))).Methods("DELETE", "OPTIONS")
 	protected.HandleFunc("/expenses/group/settle", handlers.SettleGroupExpense).Methods("POST", "OPTIONS")
 
+	// Recurring Expenses
+	protected.HandleFunc("/recurring-expenses", handlers.CreateRecurringExpense).Methods("POST", "OPTIONS")
+	protected.Handle("/groups/{group_id}/recurring-expenses", groupMember(handlers.GetGroupRecurringExpenses)).Methods("GET", "OPTIONS")
+	protected.Handle("/recurring-expenses/{recurring_id}", groupAdmin(writable(handlers.UpdateRecurringExpense))).Methods("PUT", "OPTIONS")
+	protected.Handle("/recurring-expenses/{recurring_id}", groupAdmin(writable(handlers.DeleteRecurringExpense))).Methods("DELETE", "OPTIONS")
+	protected.Handle("/recurring-expenses/{recurring_id}/pause", groupAdmin(writable(handlers.PauseRecurringExpense))).Methods("POST", "OPTIONS")
+	protected.Handle("/recurring-expenses/{recurring_id}/resume", groupAdmin(writable(handlers.ResumeRecurringExpense))).Methods("POST", "OPTIONS")
+	protected.Handle("/recurring-expenses/{recurring_id}/skip", groupAdmin(writable(handlers.SkipRecurringExpense))).Methods("POST", "OPTIONS")
+
+	// Webhooks: group admins subscribe URLs to the group's events
+	protected.Handle("/groups/{group_id}/webhooks", groupAdmin(writable(handlers.CreateWebhook))).Methods("POST", "OPTIONS")
+	protected.Handle("/groups/{group_id}/webhooks", groupAdmin(handlers.GetGroupWebhooks)).Methods("GET", "OPTIONS")
+	protected.Handle("/groups/{group_id}/webhooks/{webhook_id}", groupAdmin(writable(handlers.UpdateWebhook))).Methods("PUT", "OPTIONS")
+	protected.Handle("/groups/{group_id}/webhooks/{webhook_id}", groupAdmin(writable(handlers.DeleteWebhook))).Methods("DELETE", "OPTIONS")
+	protected.Handle("/groups/{group_id}/webhooks/{webhook_id}/ping", groupAdmin(handlers.PingWebhook)).Methods("POST", "OPTIONS")
+	protected.Handle("/groups/{group_id}/webhooks/{webhook_id}/deliveries", groupAdmin(handlers.GetWebhookDeliveries)).Methods("GET", "OPTIONS")
+	protected.Handle("/groups/{group_id}/webhooks/{webhook_id}/deliveries/{delivery_id}/redeliver", groupAdmin(handlers.RedeliverWebhookDelivery)).Methods("POST", "OPTIONS")
+
+	// Real-time updates
+	protected.HandleFunc("/stream/token", handlers.CreateStreamToken).Methods("POST", "OPTIONS")
+
+	// Notifications
+	protected.HandleFunc("/notifications", handlers.GetNotifications).Methods("GET", "OPTIONS")
+	protected.HandleFunc("/notifications/read-all", handlers.MarkAllNotificationsRead).Methods("POST", "OPTIONS")
+	protected.HandleFunc("/notifications/{notification_id}/read", handlers.MarkNotificationRead).Methods("POST", "OPTIONS")
+
+	// Currency Management
+	protected.HandleFunc("/exchange-rates", handlers.GetExchangeRates).Methods("GET", "OPTIONS")
+
+	// Admin Routes (Require a site-wide admin)
+	admin := protected.PathPrefix("/admin").Subrouter()
+	admin.Use(middleware.AdminMiddleware)
+	admin.HandleFunc("/exchange-rates", handlers.ImportExchangeRates).Methods("POST", "OPTIONS")
+
+	return r
+}
+
+func main() {
+	configPath := flag.String("config", "", "path to a JSON config file (defaults to $CONFIG_FILE)")
+	dbDriver := flag.String("db-driver", "", "database driver: postgres or sqlite (overrides $DB_DRIVER)")
+	sqlitePath := flag.String("sqlite-path", "", "SQLite database file (overrides $SQLITE_PATH)")
+	flag.Parse()
+
+	// Load settings from the config file and environment; flags take precedence
+	cfg, err := config.Load(*configPath)
+	if err == nil && (*dbDriver != "" || *sqlitePath != "") {
+		if *dbDriver != "" {
+			cfg.DBDriver = *dbDriver
+		}
+		if *sqlitePath != "" {
+			cfg.SQLitePath = *sqlitePath
+		}
+		err = cfg.Validate()
+	}
+	if err != nil {
+		log.Fatalf("❌ Invalid configuration: %v", err)
+	}
+
+	// `migrate up|down|status` manages the schema and exits
+	if flag.Arg(0) == "migrate" {
+		if err := runMigrate(cfg, flag.Args()[1:]); err != nil {
+			log.Fatalf("❌ Migration failed: %v", err)
+		}
+		return
+	}
+
+	handlers.JwtKey = []byte(cfg.JWTSecret)
+	handlers.Mailer = newMailer(cfg.Mail)
+	handlers.Blobs = newBlobStore(cfg.Storage)
+	handlers.MaxAttachmentSize = int64(cfg.Storage.MaxUploadSize) << 20
+	handlers.AppURL = strings.TrimRight(cfg.AppURL, "/")
+	handlers.LoginLockoutThreshold = cfg.RateLimit.LockoutThreshold
+	handlers.LoginLockoutBase = time.Duration(cfg.RateLimit.LockoutBaseSeconds) * time.Second
+	handlers.LoginLockoutMax = time.Duration(cfg.RateLimit.LockoutMaxSeconds) * time.Second
+	handlers.RestoreWindow = time.Duration(cfg.RestoreWindowDays) * 24 * time.Hour
+	handlers.WebhookAllowedNetworks, _ = cfg.WebhookNetworks() // Checked by Validate
+	middleware.TrustProxy = cfg.RateLimit.TrustProxy
+	middleware.ProxyHops = cfg.RateLimit.ProxyHops
+	if cfg.IsDev() && cfg.JWTSecret == config.DefaultJWTSecret {
+		fmt.Println("⚠️ Using the default JWT secret; set JWT_SECRET before deploying")
+	}
+
+	// Connect to the database and apply pending migrations
+	database.ConnectDatabase(cfg.DBDriver, cfg.DSN())
+	if cfg.PGNotify {
+		sqlDB, err := database.DB.DB()
+		if err != nil {
+			log.Fatalf("❌ Error setting up event notifications: %v", err)
+		}
+		notifier := events.Postgres{DSN: cfg.DSN(), DB: sqlDB}
+		handlers.Events.Broadcaster = notifier
+		go notifier.Listen(context.Background(), handlers.Events)
+	}
+	go runEvery(time.Hour, "purging deleted groups and threads", purgeDeleted)
+	go runEvery(time.Minute, "creating recurring expenses", func(now time.Time) (int, error) {
+		return handlers.RunRecurringExpenses(now.UTC())
+	})
+	go runEvery(10*time.Second, "sending webhooks", handlers.RunWebhookDeliveries)
+
+	r := newRouter(cfg)
+
 	// Print all registered routes
 	fmt.Println("Registered Routes:")
 	r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
@@ -81,6 +305,8 @@ func main() {
 	})
 
 	// Start the server
-	fmt.Println("Server is running on port 8080")
-	http.ListenAndServe(":8080", r)
+	fmt.Println("Server is running on port", cfg.Port)
+	if err := http.ListenAndServe(cfg.Addr(), r); err != nil {
+		log.Fatalf("❌ Server stopped: %v", err)
+	}
 }
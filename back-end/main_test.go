@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"go-auth-app/authz"
+	"go-auth-app/config"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestArchivedGroupRoutesAreReadOnly(t *testing.T) {
+	database.SetupMockDB()
+	cfg := config.Default()
+	cfg.RateLimit.IPPerMinute, cfg.RateLimit.UserPerMinute, cfg.RateLimit.AuthPerMinute = 0, 0, 0
+	r := newRouter(cfg)
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	alice := models.User{Username: "alice", Email: "alice@example.com", Password: string(hashedPassword)}
+	bob := models.User{Username: "bob", Email: "bob@example.com", Password: string(hashedPassword)}
+	database.DB.Create(&alice)
+	database.DB.Create(&bob)
+	group := models.Group{Name: "Trip"}
+	database.DB.Create(&group)
+	database.DB.Create(&models.GroupUser{GroupID: group.ID, UserID: alice.ID, Role: authz.RoleOwner})
+	database.DB.Create(&models.GroupUser{GroupID: group.ID, UserID: bob.ID, Role: authz.RoleMember})
+	recurring := models.RecurringExpense{Title: "Rent", Amount: models.NewMoney(900), PaidBy: alice.ID, CreatedBy: alice.ID, GroupID: &group.ID, SplitType: "equal", Split: "{}", Rule: "FREQ=MONTHLY", StartsAt: time.Now()}
+	database.DB.Create(&recurring)
+	webhook := models.Webhook{GroupID: group.ID, CreatedBy: alice.ID, URL: "https://example.com/hook", Secret: "whsec_test", Active: true}
+	database.DB.Create(&webhook)
+	database.DB.Model(&group).Update("archived_at", time.Now())
+
+	login := func(username string) string {
+		body, _ := json.Marshal(map[string]string{"username": username, "password": "password123"})
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, httptest.NewRequest("POST", "/login", bytes.NewBuffer(body)))
+		var tokens map[string]string
+		json.NewDecoder(rr.Body).Decode(&tokens)
+		return tokens["token"]
+	}
+	aliceToken, bobToken := login("alice"), login("bob")
+
+	cases := []struct {
+		method, path, token, body string
+	}{
+		// Membership
+		{"DELETE", fmt.Sprintf("/api/groups/%d/members/%d", group.ID, bob.ID), aliceToken, ""},
+		{"PUT", fmt.Sprintf("/api/groups/%d/members/%d/role", group.ID, bob.ID), aliceToken, `{"role": "owner"}`},
+		{"POST", fmt.Sprintf("/api/groups/%d/leave", group.ID), bobToken, ""},
+		// Recurring expenses
+		{"DELETE", fmt.Sprintf("/api/recurring-expenses/%d", recurring.ID), aliceToken, ""},
+		// Webhooks
+		{"PUT", fmt.Sprintf("/api/groups/%d/webhooks/%d", group.ID, webhook.ID), aliceToken, `{"active": false}`},
+		{"DELETE", fmt.Sprintf("/api/groups/%d/webhooks/%d", group.ID, webhook.ID), aliceToken, ""},
+	}
+	for _, c := range cases {
+		req := httptest.NewRequest(c.method, c.path, bytes.NewBufferString(c.body))
+		req.Header.Set("Authorization", "Bearer "+c.token)
+		rr := httptest.NewRecorder()
+		r.ServeHTTP(rr, req)
+		if rr.Code != http.StatusConflict {
+			t.Errorf("%s %s: expected 409 Conflict in an archived group, got %d: %s", c.method, c.path, rr.Code, rr.Body.String())
+		}
+	}
+
+	var members, recurrings, webhooks int64
+	database.DB.Model(&models.GroupUser{}).Where("group_id = ? AND role = ?", group.ID, authz.RoleMember).Count(&members)
+	database.DB.Model(&models.RecurringExpense{}).Count(&recurrings)
+	database.DB.Model(&models.Webhook{}).Where("active = ?", true).Count(&webhooks)
+	if members != 1 || recurrings != 1 || webhooks != 1 {
+		t.Errorf("Expected the archived group to be unchanged, got %d members, %d recurring expenses, %d active webhooks", members, recurrings, webhooks)
+	}
+}
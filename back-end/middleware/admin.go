@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"fmt"
+	"go-auth-app/database"
+	"go-auth-app/models"
+	"net/http"
+)
+
+// AdminMiddleware only lets site-wide admins through. It must run after AuthMiddleware.
+func AdminMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := r.Context().Value("user_id").(uint)
+		if !ok {
+			http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+			return
+		}
+
+		var user models.User
+		if err := database.DB.First(&user, userID).Error; err != nil || !user.IsAdmin {
+			fmt.Println("🚫 Forbidden: admin access required for user", userID)
+			http.Error(w, "Forbidden: admin access required", http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
@@ -64,25 +64,40 @@ import (
 // }
 
 func AuthMiddleware(next http.Handler) http.Handler {
+	return authenticate(next, false)
+}
+
+// StreamAuthMiddleware is AuthMiddleware for the event stream. Browsers'
+// EventSource cannot send headers, so it also accepts a stream token (see
+// handlers.CreateStreamToken) in the `token` query parameter.
+func StreamAuthMiddleware(next http.Handler) http.Handler {
+	return authenticate(next, true)
+}
+
+func authenticate(next http.Handler, streamToken bool) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Println("🔍 Incoming request for:", r.URL.Path)
 
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			fmt.Println("🚫 Unauthorized: Missing token")
-			http.Error(w, "Unauthorized: Missing token", http.StatusUnauthorized)
-			return
+		// Access tokens come in the header; stream tokens only in the query
+		tokenString, audience := r.URL.Query().Get("token"), handlers.StreamAudience
+		if !streamToken || tokenString == "" {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				fmt.Println("🚫 Unauthorized: Missing token")
+				http.Error(w, "Unauthorized: Missing token", http.StatusUnauthorized)
+				return
+			}
+
+			tokenParts := strings.Split(authHeader, " ")
+			if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
+				fmt.Println("🚫 Unauthorized: Invalid token format")
+				http.Error(w, "Unauthorized: Invalid token format", http.StatusUnauthorized)
+				return
+			}
+
+			tokenString, audience = tokenParts[1], ""
 		}
 
-		tokenParts := strings.Split(authHeader, " ")
-		if len(tokenParts) != 2 || tokenParts[0] != "Bearer" {
-			fmt.Println("🚫 Unauthorized: Invalid token format")
-			http.Error(w, "Unauthorized: Invalid token format", http.StatusUnauthorized)
-			return
-		}
-
-		tokenString := tokenParts[1]
-
 		// Parse JWT token
 		claims := &handlers.Claims{}
 		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
@@ -95,6 +110,31 @@ func AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		// 2FA challenge and stream tokens are not access tokens, nor the other way round
+		if (audience == "" && len(claims.Audience) > 0) || (audience != "" && !claims.VerifyAudience(audience, true)) {
+			fmt.Println("🚫 Unauthorized: Wrong kind of token")
+			http.Error(w, "Unauthorized: Invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+
+		// Tokens without an ID predate revocation support and could never be revoked
+		if claims.ID == "" {
+			fmt.Println("🚫 Unauthorized: Token has no ID")
+			http.Error(w, "Unauthorized: Invalid or expired token", http.StatusUnauthorized)
+			return
+		}
+		revoked, err := handlers.IsTokenRevoked(claims.ID)
+		if err != nil {
+			fmt.Println("❌ Error checking token revocation:", err)
+			http.Error(w, "Error checking token", http.StatusInternalServerError)
+			return
+		}
+		if revoked {
+			fmt.Println("🚫 Unauthorized: Token revoked")
+			http.Error(w, "Unauthorized: Token revoked", http.StatusUnauthorized)
+			return
+		}
+
 		// Debug: Print extracted username
 		fmt.Println("✅ Token Valid - Extracted Username:", claims.Username)
 
@@ -109,6 +149,7 @@ func AuthMiddleware(next http.Handler) http.Handler {
 		// ✅ Store `user_id` in request context
 		fmt.Println("✅ Storing user_id in context:", user.ID)
 		ctx := context.WithValue(r.Context(), "user_id", user.ID)
+		ctx = context.WithValue(ctx, "claims", claims) // Needed to revoke the token on logout
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
@@ -0,0 +1,121 @@
+package middleware_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-auth-app/database"
+	"go-auth-app/handlers"
+	"go-auth-app/middleware"
+	"go-auth-app/models"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestLogoutRevokesTokens(t *testing.T) {
+	database.SetupMockDB()
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	database.DB.Create(&models.User{Username: "alice", Email: "alice@example.com", Password: string(hashedPassword)})
+
+	body, _ := json.Marshal(map[string]string{"username": "alice", "password": "password123"})
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handlers.Login(rr, req)
+	var tokens map[string]string
+	json.NewDecoder(rr.Body).Decode(&tokens)
+
+	call := func(h http.Handler, body []byte) int {
+		req, _ := http.NewRequest("POST", "/api/logout", bytes.NewBuffer(body))
+		req.Header.Set("Authorization", "Bearer "+tokens["token"])
+		rr := httptest.NewRecorder()
+		middleware.AuthMiddleware(h).ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	if code := call(ok, nil); code != http.StatusOK {
+		t.Fatalf("Expected the fresh token to be accepted, got %d", code)
+	}
+
+	logoutBody, _ := json.Marshal(map[string]string{"refresh_token": tokens["refresh_token"]})
+	if code := call(http.HandlerFunc(handlers.Logout), logoutBody); code != http.StatusOK {
+		t.Fatalf("Expected logout to succeed, got %d", code)
+	}
+
+	if code := call(ok, nil); code != http.StatusUnauthorized {
+		t.Errorf("Expected the revoked token to be refused, got %d", code)
+	}
+
+	refreshBody, _ := json.Marshal(map[string]string{"refresh_token": tokens["refresh_token"]})
+	req, _ = http.NewRequest("POST", "/refresh", bytes.NewBuffer(refreshBody))
+	rr = httptest.NewRecorder()
+	handlers.Refresh(rr, req)
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected the refresh token to be revoked by logout, got %d", rr.Code)
+	}
+}
+
+func TestStreamToken(t *testing.T) {
+	database.SetupMockDB()
+
+	hashedPassword, _ := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	database.DB.Create(&models.User{Username: "alice", Email: "alice@example.com", Password: string(hashedPassword)})
+
+	body, _ := json.Marshal(map[string]string{"username": "alice", "password": "password123"})
+	req, _ := http.NewRequest("POST", "/login", bytes.NewBuffer(body))
+	rr := httptest.NewRecorder()
+	handlers.Login(rr, req)
+	var tokens map[string]string
+	json.NewDecoder(rr.Body).Decode(&tokens)
+
+	req, _ = http.NewRequest("POST", "/api/stream/token", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens["token"])
+	rr = httptest.NewRecorder()
+	middleware.AuthMiddleware(http.HandlerFunc(handlers.CreateStreamToken)).ServeHTTP(rr, req)
+	var stream map[string]string
+	json.NewDecoder(rr.Body).Decode(&stream)
+	if rr.Code != http.StatusOK || stream["token"] == "" {
+		t.Fatalf("Expected a stream token, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	call := func(auth func(http.Handler) http.Handler, query, header string) int {
+		req, _ := http.NewRequest("GET", "/api/stream?token="+query, nil)
+		if header != "" {
+			req.Header.Set("Authorization", "Bearer "+header)
+		}
+		rr := httptest.NewRecorder()
+		auth(ok).ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// The stream token opens the stream, and nothing else
+	if code := call(middleware.StreamAuthMiddleware, stream["token"], ""); code != http.StatusOK {
+		t.Errorf("Expected the stream token to open the stream, got %d", code)
+	}
+	if code := call(middleware.StreamAuthMiddleware, "", tokens["token"]); code != http.StatusOK {
+		t.Errorf("Expected the access token header to still work, got %d", code)
+	}
+	if code := call(middleware.AuthMiddleware, "", stream["token"]); code != http.StatusUnauthorized {
+		t.Errorf("Expected the stream token to be refused as an access token, got %d", code)
+	}
+	if code := call(middleware.StreamAuthMiddleware, tokens["token"], ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected an access token in the URL to be refused, got %d", code)
+	}
+
+	// Logging out revokes it with the access token
+	req, _ = http.NewRequest("POST", "/api/logout", nil)
+	req.Header.Set("Authorization", "Bearer "+tokens["token"])
+	middleware.AuthMiddleware(http.HandlerFunc(handlers.Logout)).ServeHTTP(httptest.NewRecorder(), req)
+	if code := call(middleware.StreamAuthMiddleware, stream["token"], ""); code != http.StatusUnauthorized {
+		t.Errorf("Expected the stream token to be revoked, got %d", code)
+	}
+}
@@ -0,0 +1,87 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"go-auth-app/authz"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// RequireGroupMember only lets members of the group that the route's
+// group_id, thread_id or expense_id belongs to through.
+func RequireGroupMember(next http.Handler) http.Handler {
+	return requireAccess(authz.Member, next)
+}
+
+// RequireGroupAdmin is like RequireGroupMember but for destructive actions:
+// the caller must be a group admin or own the resource.
+func RequireGroupAdmin(next http.Handler) http.Handler {
+	return requireAccess(authz.Admin, next)
+}
+
+// RequireGroupOwner only lets the group's owner through, for deleting the
+// group and transferring ownership.
+func RequireGroupOwner(next http.Handler) http.Handler {
+	return requireAccess(authz.Owner, next)
+}
+
+// RequireWritable refuses changes to a resource whose group or thread is
+// archived. It goes after one of the checks above, which handle not found.
+func RequireWritable(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "OPTIONS" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		scope, err := authz.ScopeFromVars(mux.Vars(r))
+		if err == nil {
+			err = authz.Writable(scope)
+		}
+		switch {
+		case err == nil:
+			next.ServeHTTP(w, r)
+		case errors.Is(err, authz.ErrArchived):
+			http.Error(w, "This group or thread is archived and read-only", http.StatusConflict)
+		case errors.Is(err, authz.ErrNotFound):
+			http.Error(w, "Not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Error checking permissions", http.StatusInternalServerError)
+		}
+	})
+}
+
+func requireAccess(level authz.Level, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Let CORS preflight requests through untouched
+		if r.Method == "OPTIONS" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		userID, ok := r.Context().Value("user_id").(uint)
+		if !ok {
+			http.Error(w, "Unauthorized: No user data found", http.StatusUnauthorized)
+			return
+		}
+
+		scope, err := authz.ScopeFromVars(mux.Vars(r))
+		if err == nil {
+			err = authz.Check(userID, scope, level)
+		}
+
+		switch {
+		case err == nil:
+			next.ServeHTTP(w, r)
+		case errors.Is(err, authz.ErrNotFound):
+			http.Error(w, "Not found", http.StatusNotFound)
+		case errors.Is(err, authz.ErrForbidden):
+			fmt.Println("🚫 Forbidden:", r.Method, r.URL.Path, "for user", userID)
+			http.Error(w, "Forbidden: you do not have access to this resource", http.StatusForbidden)
+		default:
+			http.Error(w, "Error checking permissions", http.StatusInternalServerError)
+		}
+	})
+}
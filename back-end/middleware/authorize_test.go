@@ -0,0 +1,90 @@
+package middleware_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go-auth-app/database"
+	"go-auth-app/middleware"
+	"go-auth-app/models"
+
+	"github.com/gorilla/mux"
+)
+
+func TestRequireGroupMemberAndAdmin(t *testing.T) {
+	database.SetupMockDB()
+
+	group := models.Group{Name: "Roommates"}
+	database.DB.Create(&group)
+	database.DB.Create(&models.GroupUser{GroupID: group.ID, UserID: 1, Role: "admin"})
+	database.DB.Create(&models.GroupUser{GroupID: group.ID, UserID: 2, Role: "member"})
+	database.DB.Create(&models.GroupUser{GroupID: group.ID, UserID: 4, Role: "owner"})
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+
+	call := func(h http.Handler, userID uint, vars map[string]string) int {
+		req, _ := http.NewRequest("GET", "/", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "user_id", userID))
+		req = mux.SetURLVars(req, vars)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	groupVars := map[string]string{"group_id": fmt.Sprintf("%d", group.ID)}
+
+	cases := []struct {
+		name    string
+		handler http.Handler
+		userID  uint
+		vars    map[string]string
+		want    int
+	}{
+		{"member can read", middleware.RequireGroupMember(ok), 2, groupVars, http.StatusOK},
+		{"outsider cannot read", middleware.RequireGroupMember(ok), 3, groupVars, http.StatusForbidden},
+		{"admin can delete", middleware.RequireGroupAdmin(ok), 1, groupVars, http.StatusOK},
+		{"member cannot delete", middleware.RequireGroupAdmin(ok), 2, groupVars, http.StatusForbidden},
+		{"owner is an admin too", middleware.RequireGroupAdmin(ok), 4, groupVars, http.StatusOK},
+		{"owner can delete the group", middleware.RequireGroupOwner(ok), 4, groupVars, http.StatusOK},
+		{"admin cannot delete the group", middleware.RequireGroupOwner(ok), 1, groupVars, http.StatusForbidden},
+		{"unknown group", middleware.RequireGroupMember(ok), 1, map[string]string{"group_id": "999"}, http.StatusNotFound},
+	}
+	for _, c := range cases {
+		if got := call(c.handler, c.userID, c.vars); got != c.want {
+			t.Errorf("%s: expected %d, got %d", c.name, c.want, got)
+		}
+	}
+
+	// Expenses resolve to their group; the payer may delete their own expense
+	expense := models.Expense{Title: "Rent", Amount: models.NewMoney(900), PaidBy: 2, GroupID: &group.ID}
+	database.DB.Create(&expense)
+	expenseVars := map[string]string{"expense_id": fmt.Sprintf("%d", expense.ID)}
+
+	if got := call(middleware.RequireGroupAdmin(ok), 2, expenseVars); got != http.StatusOK {
+		t.Errorf("payer deleting own expense: expected 200, got %d", got)
+	}
+	if got := call(middleware.RequireGroupMember(ok), 3, expenseVars); got != http.StatusForbidden {
+		t.Errorf("outsider reading expense: expected 403, got %d", got)
+	}
+
+	// A payer who left the group loses access to their own expense
+	database.DB.Where("group_id = ? AND user_id = ?", group.ID, 2).Delete(&models.GroupUser{})
+	if got := call(middleware.RequireGroupAdmin(ok), 2, expenseVars); got != http.StatusForbidden {
+		t.Errorf("former member editing own expense: expected 403, got %d", got)
+	}
+
+	// Archived groups are read-only
+	if got := call(middleware.RequireWritable(ok), 1, expenseVars); got != http.StatusOK {
+		t.Errorf("writing to an active group: expected 200, got %d", got)
+	}
+	database.DB.Model(&group).Update("archived_at", time.Now())
+	if got := call(middleware.RequireWritable(ok), 1, expenseVars); got != http.StatusConflict {
+		t.Errorf("writing to an archived group: expected 409, got %d", got)
+	}
+}
@@ -0,0 +1,75 @@
+package middleware
+
+import (
+	"fmt"
+	"go-auth-app/handlers"
+	"go-auth-app/ratelimit"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// TrustProxy - When set, the client IP is taken from X-Forwarded-For. Only
+// enable it behind a reverse proxy that sets the header, or clients can spoof it.
+var TrustProxy = false
+
+// ProxyHops - How many trusted proxies append to X-Forwarded-For in front of
+// the server; the client IP is the entry this far from the right
+var ProxyHops = 1
+
+// RateLimitByIP throttles requests per client IP
+func RateLimitByIP(limiter *ratelimit.Limiter) func(http.Handler) http.Handler {
+	return rateLimit(limiter, func(r *http.Request) (string, bool) {
+		return ClientIP(r), true
+	})
+}
+
+// RateLimitByUser throttles requests per authenticated user; it must run after AuthMiddleware
+func RateLimitByUser(limiter *ratelimit.Limiter) func(http.Handler) http.Handler {
+	return rateLimit(limiter, func(r *http.Request) (string, bool) {
+		userID, ok := r.Context().Value("user_id").(uint)
+		return strconv.FormatUint(uint64(userID), 10), ok
+	})
+}
+
+func rateLimit(limiter *ratelimit.Limiter, key func(r *http.Request) (string, bool)) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			k, ok := key(r)
+			if r.Method == "OPTIONS" || !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if allowed, wait := limiter.Allow(k); !allowed {
+				fmt.Println("🚦 Rate limited:", k, r.URL.Path)
+				handlers.TooManyRequests(w, wait)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the IP address the request came from
+func ClientIP(r *http.Request) string {
+	if TrustProxy && ProxyHops > 0 {
+		// Earlier entries come from the client and can be anything, so only
+		// the ones our own proxies appended on the right are used
+		var forwarded []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			forwarded = append(forwarded, strings.Split(header, ",")...)
+		}
+		if len(forwarded) >= ProxyHops {
+			if ip := strings.TrimSpace(forwarded[len(forwarded)-ProxyHops]); ip != "" {
+				return ip
+			}
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
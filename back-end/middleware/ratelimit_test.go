@@ -0,0 +1,104 @@
+package middleware_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-auth-app/middleware"
+	"go-auth-app/ratelimit"
+)
+
+func TestRateLimitByIP(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h := middleware.RateLimitByIP(ratelimit.PerMinute(2))(ok)
+
+	call := func(method, remoteAddr string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest(method, "/login", nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr
+	}
+
+	call("POST", "10.0.0.1:5000")
+	call("POST", "10.0.0.1:5001") // Same client, different port
+
+	rr := call("POST", "10.0.0.1:5002")
+	if rr.Code != http.StatusTooManyRequests {
+		t.Fatalf("Expected 429 Too Many Requests, got %d", rr.Code)
+	}
+	if rr.Header().Get("Retry-After") != "30" {
+		t.Errorf("Expected Retry-After of 30 seconds, got %q", rr.Header().Get("Retry-After"))
+	}
+
+	if rr := call("OPTIONS", "10.0.0.1:5003"); rr.Code != http.StatusOK {
+		t.Errorf("Expected preflight requests not to be limited, got %d", rr.Code)
+	}
+	if rr := call("POST", "10.0.0.2:5000"); rr.Code != http.StatusOK {
+		t.Errorf("Expected another client to be allowed, got %d", rr.Code)
+	}
+}
+
+func TestRateLimitByUser(t *testing.T) {
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h := middleware.RateLimitByUser(ratelimit.PerMinute(1))(ok)
+
+	call := func(userID uint) int {
+		req, _ := http.NewRequest("GET", "/api/profile", nil)
+		req = req.WithContext(context.WithValue(req.Context(), "user_id", userID))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	if code := call(1); code != http.StatusOK {
+		t.Fatalf("Expected the first request to be allowed, got %d", code)
+	}
+	if code := call(1); code != http.StatusTooManyRequests {
+		t.Errorf("Expected the second request to be limited, got %d", code)
+	}
+	if code := call(2); code != http.StatusOK {
+		t.Errorf("Expected another user to be allowed, got %d", code)
+	}
+}
+
+func TestClientIPIgnoresSpoofedForwardedFor(t *testing.T) {
+	trust, hops := middleware.TrustProxy, middleware.ProxyHops
+	t.Cleanup(func() { middleware.TrustProxy, middleware.ProxyHops = trust, hops })
+	middleware.TrustProxy = true
+
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h := middleware.RateLimitByIP(ratelimit.PerMinute(1))(ok)
+	call := func(forwarded string) int {
+		req, _ := http.NewRequest("POST", "/login", nil)
+		req.RemoteAddr = "10.0.0.1:5000"
+		req.Header.Set("X-Forwarded-For", forwarded)
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// The proxy appends the real client after whatever the client sent
+	if code := call("1.1.1.1, 203.0.113.7"); code != http.StatusOK {
+		t.Fatalf("Expected the first request to be allowed, got %d", code)
+	}
+	if code := call("2.2.2.2, 203.0.113.7"); code != http.StatusTooManyRequests {
+		t.Errorf("Expected a spoofed leading entry not to change the key, got %d", code)
+	}
+
+	// Behind two proxies the client is second from the right
+	middleware.ProxyHops = 2
+	req, _ := http.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Forwarded-For", "1.1.1.1, 203.0.113.7, 10.0.0.2")
+	if ip := middleware.ClientIP(req); ip != "203.0.113.7" {
+		t.Errorf("Expected 203.0.113.7, got %s", ip)
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"go-auth-app/config"
+	"go-auth-app/database"
+	"strconv"
+)
+
+const migrateUsage = "usage: migrate up | down [steps] | status"
+
+// runMigrate - Handles `migrate up|down|status` without starting the server
+func runMigrate(cfg config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	db, err := database.Open(cfg.DBDriver, cfg.DSN())
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "up":
+		if err := database.MigrateUp(db); err != nil {
+			return err
+		}
+		fmt.Printf("✅ Schema is at version %d\n", database.LatestVersion())
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 {
+				return fmt.Errorf("steps must be a positive number, got %q", args[1])
+			}
+		}
+		if err := database.MigrateDown(db, steps); err != nil {
+			return err
+		}
+		version, err := database.SchemaVersion(db)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✅ Schema is at version %d\n", version)
+
+	case "status":
+		statuses, err := database.Status(db)
+		if err != nil {
+			return err
+		}
+		for _, s := range statuses {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = "applied " + s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%4d  %-40s %s\n", s.Version, s.Name, applied)
+		}
+
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
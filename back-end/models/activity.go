@@ -0,0 +1,61 @@
+package models
+
+import "time"
+
+// Activity actions, "<target type>.<what happened>"
+const (
+	ActionGroupCreated    = "group.created"
+	ActionGroupRenamed    = "group.renamed"
+	ActionGroupArchived   = "group.archived"
+	ActionGroupUnarchived = "group.unarchived"
+	ActionGroupDeleted    = "group.deleted"
+	ActionGroupRestored   = "group.restored"
+
+	ActionMemberJoined      = "member.joined"
+	ActionMemberRemoved     = "member.removed"
+	ActionMemberLeft        = "member.left"
+	ActionMemberRoleChanged = "member.role_changed"
+
+	ActionInvitationCreated  = "invitation.created"
+	ActionInvitationRevoked  = "invitation.revoked"
+	ActionInvitationDeclined = "invitation.declined"
+
+	ActionThreadCreated    = "thread.created"
+	ActionThreadArchived   = "thread.archived"
+	ActionThreadUnarchived = "thread.unarchived"
+	ActionThreadDeleted    = "thread.deleted"
+	ActionThreadRestored   = "thread.restored"
+
+	ActionExpenseCreated = "expense.created"
+	ActionExpenseUpdated = "expense.updated"
+	ActionExpenseDeleted = "expense.deleted"
+	ActionExpenseSettled = "expense.settled"
+
+	ActionRecurringCreated = "recurring_expense.created"
+	ActionRecurringUpdated = "recurring_expense.updated"
+	ActionRecurringPaused  = "recurring_expense.paused"
+	ActionRecurringResumed = "recurring_expense.resumed"
+	ActionRecurringSkipped = "recurring_expense.skipped"
+	ActionRecurringDeleted = "recurring_expense.deleted"
+
+	ActionCommentCreated    = "comment.created"
+	ActionCommentUpdated    = "comment.updated"
+	ActionCommentDeleted    = "comment.deleted"
+	ActionAttachmentAdded   = "attachment.added"
+	ActionAttachmentDeleted = "attachment.deleted"
+)
+
+// Activity - One entry of a group's activity log: who did what to which
+// entity, with JSON snapshots of it before and after. Entries are never
+// changed or deleted, until the group itself is purged.
+type Activity struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	CreatedAt  time.Time `json:"created_at"`
+	GroupID    uint      `gorm:"not null;index" json:"group_id"`
+	ActorID    *uint     `gorm:"index" json:"actor_id"` // nil for changes made by the server, e.g. recurring expenses
+	Action     string    `gorm:"not null;index" json:"action"`
+	TargetType string    `gorm:"not null" json:"target_type"`
+	TargetID   uint      `gorm:"not null" json:"target_id"`
+	Before     string    `gorm:"column:before_state;type:text" json:"-"`
+	After      string    `gorm:"column:after_state;type:text" json:"-"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "gorm.io/gorm"
+
+// Attachment - A file (usually a receipt) attached to an expense. The content
+// is stored once per SHA-256 in the blob store, however many expenses share it.
+type Attachment struct {
+	gorm.Model
+	ExpenseID    uint   `gorm:"not null;index" json:"expense_id"`
+	UploadedBy   uint   `gorm:"not null" json:"uploaded_by"`
+	FileName     string `gorm:"not null" json:"file_name"`
+	ContentType  string `gorm:"not null" json:"content_type"`
+	Size         int64  `gorm:"not null" json:"size"`
+	SHA256       string `gorm:"column:sha256;size:64;not null;index" json:"sha256"`
+	HasThumbnail bool   `gorm:"not null;default:false" json:"has_thumbnail"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ExpenseComment - A message in the discussion of an expense
+type ExpenseComment struct {
+	gorm.Model
+	ExpenseID uint       `gorm:"not null;index" json:"expense_id"`
+	AuthorID  uint       `gorm:"not null" json:"author_id"`
+	Body      string     `gorm:"type:text;not null" json:"body"`
+	EditedAt  *time.Time `json:"edited_at"` // nil until the author edits it
+}
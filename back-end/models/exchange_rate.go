@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// ExchangeRate - Locally managed FX rate, valid from EffectiveDate until a newer rate for the same pair.
+// A pair has at most one rate per day.
+type ExchangeRate struct {
+	gorm.Model
+	FromCurrency  string    `gorm:"type:varchar(3);not null;index:idx_exchange_rate_pair;uniqueIndex:idx_exchange_rate_date" json:"from_currency"`
+	ToCurrency    string    `gorm:"type:varchar(3);not null;index:idx_exchange_rate_pair;uniqueIndex:idx_exchange_rate_date" json:"to_currency"`
+	Rate          float64   `gorm:"not null" json:"rate"` // 1 FromCurrency = Rate ToCurrency
+	EffectiveDate time.Time `gorm:"not null;index;uniqueIndex:idx_exchange_rate_date" json:"effective_date"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "gorm.io/gorm"
+
+// ExpenseRevision - One edit in the history of an expense.
+// Before/After hold JSON snapshots of the expense and its participants.
+type ExpenseRevision struct {
+	gorm.Model
+	ExpenseID     uint   `gorm:"not null;index;uniqueIndex:idx_expense_revision" json:"expense_id"`
+	Revision      int    `gorm:"not null;uniqueIndex:idx_expense_revision" json:"revision"`
+	ChangedBy     uint   `gorm:"not null" json:"changed_by"`
+	ChangedFields string `json:"changed_fields"` // Comma separated
+	Before        string `gorm:"column:before_state;type:text" json:"before"`
+	After         string `gorm:"column:after_state;type:text" json:"after"`
+}
@@ -1,19 +1,29 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
 
 type Expense struct {
 	gorm.Model
-	Title    string  `gorm:"not null" json:"title"`
-	Amount   float64 `gorm:"not null" json:"amount"`
-	PaidBy   uint    `gorm:"not null" json:"paid_by"`
-	GroupID  *uint   `gorm:"index" json:"group_id"`  // Nullable
-	ThreadID *uint   `gorm:"index" json:"thread_id"` // Nullable
+	Title     string `gorm:"not null" json:"title"`
+	Amount    Money  `gorm:"not null" json:"amount"` // In cents
+	Currency  string `gorm:"type:varchar(3);not null;default:'USD'" json:"currency"`
+	PaidBy    uint   `gorm:"not null" json:"paid_by"`
+	CreatedBy uint   `gorm:"index" json:"created_by"` // Who recorded it; may differ from the payer
+	GroupID   *uint  `gorm:"index" json:"group_id"`   // Nullable
+	ThreadID  *uint  `gorm:"index" json:"thread_id"`  // Nullable
+
+	// Set on expenses created by a recurring expense; unique so an occurrence is never created twice
+	RecurringExpenseID *uint      `gorm:"uniqueIndex:idx_expense_occurrence" json:"recurring_expense_id"`
+	OccurrenceAt       *time.Time `gorm:"uniqueIndex:idx_expense_occurrence" json:"occurrence_at"`
 }
 
 // ExpenseParticipants model (Tracks how an expense is split)
 type ExpenseParticipant struct {
-	ExpenseID  uint    `gorm:"not null;index" json:"expense_id"`
-	UserID     uint    `gorm:"not null;index" json:"user_id"`
-	AmountOwed float64 `gorm:"not null" json:"amount_owed"`
+	ExpenseID  uint  `gorm:"not null;index" json:"expense_id"`
+	UserID     uint  `gorm:"not null;index" json:"user_id"`
+	AmountOwed Money `gorm:"not null" json:"amount_owed"` // In cents
 }
@@ -1,14 +1,21 @@
 package models
 
-import "gorm.io/gorm"
+import (
+	"time"
 
+	"gorm.io/gorm"
+)
+
+// Group - Deleting a group only sets DeletedAt; it can be restored until it is purged
 type Group struct {
 	gorm.Model
-	Name string `gorm:"unique;not null" json:"name"`
+	Name         string     `gorm:"unique;not null" json:"name"`
+	BaseCurrency string     `gorm:"type:varchar(3);not null;default:'USD'" json:"base_currency"`
+	ArchivedAt   *time.Time `json:"archived_at"` // Archived groups are read-only
 }
 
 type GroupUser struct {
-	GroupID uint   `gorm:"not null;index" json:"group_id"`
-	UserID  uint   `gorm:"not null;index" json:"user_id"`
+	GroupID uint   `gorm:"not null;index;uniqueIndex:idx_group_member" json:"group_id"`
+	UserID  uint   `gorm:"not null;index;uniqueIndex:idx_group_member" json:"user_id"`
 	Role    string `gorm:"type:varchar(10);default:'member'" json:"role"`
 }
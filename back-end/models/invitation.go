@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Invitation states; an invitation past its ExpiresAt counts as expired even
+// before its stored status catches up
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+	InvitationExpired  = "expired"
+	InvitationRevoked  = "revoked"
+)
+
+// GroupInvitation - Invitation to join a group. Email invitations are for one
+// address and are answered once; link invitations (no Email) can be used by
+// anyone holding the token, up to MaxUses times (0 means unlimited).
+// Only the SHA-256 hash of the token is stored.
+type GroupInvitation struct {
+	gorm.Model
+	GroupID     uint       `gorm:"not null;index" json:"group_id"`
+	InvitedBy   uint       `gorm:"not null" json:"invited_by"`
+	Email       *string    `gorm:"index" json:"email"`
+	TokenHash   string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	Status      string     `gorm:"type:varchar(10);not null;default:'pending'" json:"status"`
+	ExpiresAt   time.Time  `gorm:"not null" json:"expires_at"`
+	MaxUses     int        `gorm:"not null;default:0" json:"max_uses"`
+	Uses        int        `gorm:"not null;default:0" json:"uses"`
+	AcceptedBy  *uint      `json:"accepted_by"`
+	RespondedAt *time.Time `json:"responded_at"`
+}
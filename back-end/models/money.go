@@ -0,0 +1,54 @@
+package models
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Money is an amount stored in integer minor units (cents), so splits and
+// balances never drift the way float64 sums do. It is still sent over JSON as
+// a decimal number (e.g. 120.50) to keep the API unchanged for clients.
+type Money int64
+
+// NewMoney converts a decimal amount to Money, rounding to the nearest cent
+func NewMoney(amount float64) Money {
+	return Money(math.Round(amount * 100))
+}
+
+// Float returns the amount as a decimal value, for display only
+func (m Money) Float() float64 {
+	return float64(m) / 100
+}
+
+// String formats the amount with exactly two decimals
+func (m Money) String() string {
+	sign := ""
+	v := int64(m)
+	if v < 0 {
+		sign = "-"
+		v = -v
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, v/100, v%100)
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return []byte(m.String()), nil
+}
+
+func (m *Money) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	if s == "null" {
+		return nil
+	}
+	// Accept quoted amounts as well as plain numbers
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = s[1 : len(s)-1]
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return fmt.Errorf("invalid money amount %q", string(data))
+	}
+	*m = NewMoney(f)
+	return nil
+}
@@ -0,0 +1,25 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Notification types
+const (
+	NotificationMention = "mention" // Someone mentioned the user in a comment
+)
+
+// Notification - Something that happened which a user should know about
+type Notification struct {
+	gorm.Model
+	UserID    uint       `gorm:"not null;index" json:"user_id"` // Who is notified
+	ActorID   uint       `gorm:"not null" json:"actor_id"`      // Who caused it
+	Type      string     `gorm:"not null" json:"type"`
+	GroupID   *uint      `json:"group_id"`
+	ExpenseID *uint      `json:"expense_id"`
+	CommentID *uint      `json:"comment_id"`
+	Message   string     `gorm:"not null" json:"message"`
+	ReadAt    *time.Time `json:"read_at"`
+}
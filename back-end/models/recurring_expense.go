@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecurringExpense - Template the scheduler turns into an Expense at every
+// occurrence of its schedule. Occurrences are computed in UTC.
+type RecurringExpense struct {
+	gorm.Model
+	Title     string `gorm:"not null" json:"title"`
+	Amount    Money  `gorm:"not null" json:"amount"` // In cents
+	Currency  string `gorm:"type:varchar(3);not null;default:'USD'" json:"currency"`
+	PaidBy    uint   `gorm:"not null" json:"paid_by"`
+	CreatedBy uint   `gorm:"not null" json:"created_by"`
+	GroupID   *uint  `gorm:"index" json:"group_id"`
+	ThreadID  *uint  `gorm:"index" json:"thread_id"`
+	SplitType string `gorm:"type:varchar(10);not null" json:"split_type"`
+	Split     string `gorm:"type:text;not null" json:"-"` // JSON of the split_with/splits of the request
+
+	Rule     string     `gorm:"not null" json:"rule"` // RRULE, e.g. FREQ=MONTHLY;BYMONTHDAY=1
+	StartsAt time.Time  `gorm:"not null" json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+
+	NextRunAt *time.Time `gorm:"index" json:"next_run_at"` // nil once the schedule has ended
+	LastRunAt *time.Time `json:"last_run_at"`              // Latest occurrence, created or skipped
+	Runs      int        `gorm:"not null;default:0" json:"runs"`
+	PausedAt  *time.Time `json:"paused_at"`
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RefreshToken - Long-lived token exchanged for new access tokens.
+// Only the SHA-256 hash is stored; every use rotates it to a new token in the
+// same family, so presenting an already rotated token revokes the whole family.
+type RefreshToken struct {
+	gorm.Model
+	UserID     uint       `gorm:"not null;index" json:"user_id"`
+	TokenHash  string     `gorm:"type:varchar(64);uniqueIndex;not null" json:"-"`
+	FamilyID   string     `gorm:"type:varchar(32);index;not null" json:"-"` // Shared by every rotation of one login
+	ExpiresAt  time.Time  `gorm:"not null" json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	ReplacedBy *uint      `json:"-"` // The token this one was rotated into
+}
+
+// RevokedToken - Access token (by its jti) that must be refused before it expires
+type RevokedToken struct {
+	JTI       string    `gorm:"primaryKey;type:varchar(32)" json:"jti"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"` // The row is useless afterwards
+}
@@ -1,6 +1,8 @@
 package models
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
@@ -9,4 +11,25 @@ type User struct {
 	Username string `gorm:"unique;not null" json:"username"`
 	Email    string `gorm:"unique;not null" json:"email"`
 	Password string `gorm:"not null" json:"-"`
+	IsAdmin  bool   `gorm:"not null;default:false" json:"-"` // Site-wide admin (manages exchange rates)
+
+	EmailVerifiedAt *time.Time `json:"email_verified_at"` // nil until the user follows the verification link
+
+	// Two-factor authentication: the secret is stored at enrollment and only
+	// required at login once the user confirms it with a first code
+	TOTPSecret    string     `gorm:"column:totp_secret" json:"-"`
+	TOTPEnabledAt *time.Time `gorm:"column:totp_enabled_at" json:"-"`
+	TOTPLastStep  int64      `gorm:"column:totp_last_step;not null;default:0" json:"-"` // Last accepted step; a code is never accepted twice
+
+	// Brute-force protection: consecutive failed logins and the resulting lock
+	FailedLogins int        `gorm:"not null;default:0" json:"-"`
+	LockedUntil  *time.Time `json:"-"`
+}
+
+// RecoveryCode - Single-use 2FA backup code, stored as a SHA-256 hash
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint       `gorm:"not null;index" json:"user_id"`
+	CodeHash string     `gorm:"type:varchar(64);not null" json:"-"`
+	UsedAt   *time.Time `json:"used_at"`
 }
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Webhook - An endpoint outside GatorSplit that is sent a group's events
+type Webhook struct {
+	gorm.Model
+	GroupID   uint   `gorm:"not null;index" json:"group_id"`
+	CreatedBy uint   `gorm:"not null" json:"created_by"`
+	URL       string `gorm:"not null" json:"url"`
+	Secret    string `gorm:"not null" json:"-"`      // Signs the payloads; only shown when the webhook is created
+	Events    string `gorm:"type:text" json:"-"`     // Comma separated event types or prefixes; empty for every event
+	Active    bool   `gorm:"not null" json:"active"` // Inactive webhooks are not sent new events
+}
+
+// Webhook delivery states
+const (
+	DeliveryPending   = "pending"   // Waiting for its next attempt
+	DeliveryDelivered = "delivered" // The endpoint answered with a 2xx status
+	DeliveryDead      = "dead"      // Gave up after the last attempt failed
+)
+
+// WebhookDelivery - One event sent, or to be sent, to a webhook. Only the
+// latest attempt's outcome is kept.
+type WebhookDelivery struct {
+	ID            uint       `gorm:"primaryKey" json:"id"`
+	CreatedAt     time.Time  `json:"created_at"`
+	WebhookID     uint       `gorm:"not null;index" json:"webhook_id"`
+	EventID       uint       `json:"event_id"` // The activity log entry; 0 for pings
+	EventType     string     `gorm:"not null" json:"event_type"`
+	Payload       string     `gorm:"type:text;not null" json:"payload"`
+	Status        string     `gorm:"not null;index" json:"status"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt *time.Time `gorm:"index" json:"next_attempt_at"` // nil once delivered or dead
+	LastAttemptAt *time.Time `json:"last_attempt_at"`
+	ResponseCode  int        `json:"response_code"` // 0 when no response was received
+	Error         string     `gorm:"type:text" json:"error"`
+	DeliveredAt   *time.Time `json:"delivered_at"`
+}
@@ -0,0 +1,50 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLimiterRefills(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := New(1, 2) // 1 request per second, bursts of 2
+	l.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		if ok, _ := l.Allow("1.2.3.4"); !ok {
+			t.Fatalf("Expected request %d of the burst to be allowed", i+1)
+		}
+	}
+
+	ok, wait := l.Allow("1.2.3.4")
+	if ok {
+		t.Fatal("Expected the request after the burst to be throttled")
+	}
+	if wait != time.Second {
+		t.Errorf("Expected to wait 1s, got %v", wait)
+	}
+
+	// Keys are independent
+	if ok, _ := l.Allow("5.6.7.8"); !ok {
+		t.Error("Expected another key to be allowed")
+	}
+
+	now = now.Add(time.Second)
+	if ok, _ := l.Allow("1.2.3.4"); !ok {
+		t.Error("Expected a token to be available after a second")
+	}
+}
+
+func TestLimiterSweepsFullBuckets(t *testing.T) {
+	now := time.Unix(1000, 0)
+	l := PerMinute(60)
+	l.now = func() time.Time { return now }
+
+	l.Allow("a")
+	now = now.Add(2 * sweepInterval)
+	l.Allow("b")
+
+	if _, ok := l.buckets["a"]; ok {
+		t.Error("Expected the idle bucket to be dropped")
+	}
+}
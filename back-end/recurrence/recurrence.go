@@ -0,0 +1,259 @@
+// Package recurrence implements the subset of iCalendar recurrence rules
+// (RFC 5545 RRULE) needed for recurring expenses: FREQ, INTERVAL, BYDAY (weekly),
+// BYMONTHDAY (monthly), COUNT and UNTIL.
+package recurrence
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Frequencies accepted in FREQ
+const (
+	Daily   = "DAILY"
+	Weekly  = "WEEKLY"
+	Monthly = "MONTHLY"
+	Yearly  = "YEARLY"
+)
+
+// maxPeriods bounds the search for the next occurrence, so a rule that can
+// never match again (e.g. BYMONTHDAY=31 every 12 months from February) ends
+const maxPeriods = 10000
+
+var weekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// Rule - A parsed recurrence rule. The series starts at a separate start time,
+// which also gives every occurrence its time of day.
+type Rule struct {
+	Freq       string
+	Interval   int            // Every Interval days/weeks/months/years, at least 1
+	ByDay      []time.Weekday // Weekly only: the days of the week, default the start's
+	ByMonthDay []int          // Monthly only: days of the month, negative counts from the end
+	Count      int            // Number of occurrences, 0 for no limit
+	Until      *time.Time     // Last possible occurrence
+}
+
+// Parse reads a rule such as "FREQ=MONTHLY;BYMONTHDAY=1" or "RRULE:FREQ=WEEKLY;BYDAY=MO,TH"
+func Parse(s string) (Rule, error) {
+	r := Rule{Interval: 1}
+	s = strings.TrimPrefix(strings.TrimSpace(s), "RRULE:")
+
+	for _, part := range strings.Split(s, ";") {
+		if part == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(part, "=")
+		if !ok || value == "" {
+			return Rule{}, fmt.Errorf("invalid rule part %q", part)
+		}
+
+		var err error
+		switch strings.ToUpper(key) {
+		case "FREQ":
+			r.Freq = strings.ToUpper(value)
+			if r.Freq != Daily && r.Freq != Weekly && r.Freq != Monthly && r.Freq != Yearly {
+				return Rule{}, fmt.Errorf("unsupported FREQ %q", value)
+			}
+		case "INTERVAL":
+			if r.Interval, err = strconv.Atoi(value); err != nil || r.Interval < 1 {
+				return Rule{}, fmt.Errorf("INTERVAL must be a positive number, got %q", value)
+			}
+		case "COUNT":
+			if r.Count, err = strconv.Atoi(value); err != nil || r.Count < 1 {
+				return Rule{}, fmt.Errorf("COUNT must be a positive number, got %q", value)
+			}
+		case "UNTIL":
+			until, err := parseUntil(value)
+			if err != nil {
+				return Rule{}, err
+			}
+			r.Until = &until
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				wd, ok := weekdays[strings.ToUpper(day)]
+				if !ok {
+					return Rule{}, fmt.Errorf("invalid BYDAY value %q", day)
+				}
+				r.ByDay = append(r.ByDay, wd)
+			}
+		case "BYMONTHDAY":
+			for _, day := range strings.Split(value, ",") {
+				d, err := strconv.Atoi(day)
+				if err != nil || d == 0 || d < -31 || d > 31 {
+					return Rule{}, fmt.Errorf("invalid BYMONTHDAY value %q", day)
+				}
+				r.ByMonthDay = append(r.ByMonthDay, d)
+			}
+		default:
+			return Rule{}, fmt.Errorf("unsupported rule part %q", key)
+		}
+	}
+
+	if r.Freq == "" {
+		return Rule{}, fmt.Errorf("FREQ is required")
+	}
+	if len(r.ByDay) > 0 && r.Freq != Weekly {
+		return Rule{}, fmt.Errorf("BYDAY is only supported with FREQ=WEEKLY")
+	}
+	if len(r.ByMonthDay) > 0 && r.Freq != Monthly {
+		return Rule{}, fmt.Errorf("BYMONTHDAY is only supported with FREQ=MONTHLY")
+	}
+	if r.Count > 0 && r.Until != nil {
+		return Rule{}, fmt.Errorf("COUNT and UNTIL cannot be combined")
+	}
+	return r, nil
+}
+
+func parseUntil(value string) (time.Time, error) {
+	for _, layout := range []string{"20060102T150405Z", "20060102"} {
+		if t, err := time.ParseInLocation(layout, value, time.UTC); err == nil {
+			if layout == "20060102" {
+				t = t.Add(24*time.Hour - time.Nanosecond) // The whole day
+			}
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("UNTIL must look like 20060102 or 20060102T150405Z, got %q", value)
+}
+
+// String formats the rule in its canonical form
+func (r Rule) String() string {
+	parts := []string{"FREQ=" + r.Freq}
+	if r.Interval > 1 {
+		parts = append(parts, "INTERVAL="+strconv.Itoa(r.Interval))
+	}
+	if len(r.ByDay) > 0 {
+		var days []string
+		for _, wd := range r.ByDay {
+			days = append(days, strings.ToUpper(wd.String()[:2]))
+		}
+		parts = append(parts, "BYDAY="+strings.Join(days, ","))
+	}
+	if len(r.ByMonthDay) > 0 {
+		var days []string
+		for _, d := range r.ByMonthDay {
+			days = append(days, strconv.Itoa(d))
+		}
+		parts = append(parts, "BYMONTHDAY="+strings.Join(days, ","))
+	}
+	if r.Count > 0 {
+		parts = append(parts, "COUNT="+strconv.Itoa(r.Count))
+	}
+	if r.Until != nil {
+		parts = append(parts, "UNTIL="+r.Until.UTC().Format("20060102T150405Z"))
+	}
+	return strings.Join(parts, ";")
+}
+
+// After returns the first occurrence strictly after t of the series starting
+// at start, or false once the series has ended. Occurrences before start
+// (e.g. earlier weekdays of its first week) do not count.
+func (r Rule) After(start, t time.Time) (time.Time, bool) {
+	n := 0
+	for period := 0; period < maxPeriods; period++ {
+		for _, occ := range r.candidates(start, period) {
+			if occ.Before(start) {
+				continue
+			}
+			if r.Until != nil && occ.After(*r.Until) {
+				return time.Time{}, false
+			}
+			n++
+			if r.Count > 0 && n > r.Count {
+				return time.Time{}, false
+			}
+			if occ.After(t) {
+				return occ, true
+			}
+		}
+	}
+	return time.Time{}, false
+}
+
+// First returns the first occurrence of the series, which is start itself if it matches
+func (r Rule) First(start time.Time) (time.Time, bool) {
+	return r.After(start, start.Add(-time.Nanosecond))
+}
+
+// candidates - The possible occurrences of the period-th interval after start, in order
+func (r Rule) candidates(start time.Time, period int) []time.Time {
+	step := period * r.Interval
+	at := func(year int, month time.Month, day int) time.Time {
+		return time.Date(year, month, day, start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), start.Location())
+	}
+
+	switch r.Freq {
+	case Daily:
+		return []time.Time{start.AddDate(0, 0, step)}
+
+	case Weekly:
+		base := start.AddDate(0, 0, 7*step)
+		if len(r.ByDay) == 0 {
+			return []time.Time{base}
+		}
+		// Weeks start on Monday
+		monday := base.AddDate(0, 0, -mondayIndex(base.Weekday()))
+		var days []int
+		for _, wd := range r.ByDay {
+			days = append(days, mondayIndex(wd))
+		}
+		sort.Ints(days)
+		var occs []time.Time
+		for i, d := range days {
+			if i > 0 && d == days[i-1] {
+				continue
+			}
+			occs = append(occs, monday.AddDate(0, 0, d))
+		}
+		return occs
+
+	case Monthly:
+		first := at(start.Year(), start.Month()+time.Month(step), 1)
+		length := daysIn(first.Year(), first.Month())
+		monthDays := r.ByMonthDay
+		if len(monthDays) == 0 {
+			monthDays = []int{start.Day()}
+		}
+		var days []int
+		for _, d := range monthDays {
+			if d < 0 {
+				d = length + d + 1
+			}
+			// Months without the day are skipped, as in RFC 5545
+			if d >= 1 && d <= length {
+				days = append(days, d)
+			}
+		}
+		sort.Ints(days)
+		var occs []time.Time
+		for i, d := range days {
+			if i > 0 && d == days[i-1] {
+				continue
+			}
+			occs = append(occs, at(first.Year(), first.Month(), d))
+		}
+		return occs
+
+	case Yearly:
+		occ := at(start.Year()+step, start.Month(), start.Day())
+		if occ.Month() != start.Month() {
+			return nil // February 29th outside leap years
+		}
+		return []time.Time{occ}
+	}
+	return nil
+}
+
+func mondayIndex(wd time.Weekday) int {
+	return (int(wd) + 6) % 7
+}
+
+func daysIn(year int, month time.Month) int {
+	return time.Date(year, month+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
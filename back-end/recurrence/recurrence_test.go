@@ -0,0 +1,87 @@
+package recurrence
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func date(s string) time.Time {
+	t, err := time.Parse("2006-01-02 15:04", s)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// series - The first n occurrences of the rule
+func series(t *testing.T, rule string, start time.Time, n int) []string {
+	r, err := Parse(rule)
+	if err != nil {
+		t.Fatalf("Parse(%q) failed: %v", rule, err)
+	}
+	var out []string
+	occ, ok := r.First(start)
+	for ; ok && len(out) < n; occ, ok = r.After(start, occ) {
+		out = append(out, occ.Format("2006-01-02 15:04"))
+	}
+	return out
+}
+
+func TestSeries(t *testing.T) {
+	cases := []struct {
+		rule  string
+		start string
+		want  []string
+		ends  bool // The series has no more occurrences than want
+	}{
+		{"FREQ=DAILY;INTERVAL=2", "2026-01-30 08:00", []string{"2026-01-30 08:00", "2026-02-01 08:00", "2026-02-03 08:00"}, false},
+		// Starts on a Wednesday: Monday of the first week is skipped
+		{"FREQ=WEEKLY;BYDAY=MO,FR", "2026-01-07 09:30", []string{"2026-01-09 09:30", "2026-01-12 09:30", "2026-01-16 09:30"}, false},
+		{"FREQ=WEEKLY;INTERVAL=2", "2026-01-07 09:30", []string{"2026-01-07 09:30", "2026-01-21 09:30", "2026-02-04 09:30"}, false},
+		// Months without a 31st are skipped; -1 is always the last day
+		{"FREQ=MONTHLY", "2026-01-31 00:00", []string{"2026-01-31 00:00", "2026-03-31 00:00", "2026-05-31 00:00"}, false},
+		{"FREQ=MONTHLY;BYMONTHDAY=-1", "2026-01-15 00:00", []string{"2026-01-31 00:00", "2026-02-28 00:00", "2026-03-31 00:00"}, false},
+		{"FREQ=MONTHLY;BYMONTHDAY=1,15", "2026-01-10 00:00", []string{"2026-01-15 00:00", "2026-02-01 00:00", "2026-02-15 00:00"}, false},
+		{"FREQ=YEARLY", "2024-02-29 12:00", []string{"2024-02-29 12:00", "2028-02-29 12:00"}, false},
+		{"FREQ=MONTHLY;COUNT=2", "2026-01-01 00:00", []string{"2026-01-01 00:00", "2026-02-01 00:00"}, true},
+		{"RRULE:FREQ=DAILY;UNTIL=20260102", "2026-01-01 10:00", []string{"2026-01-01 10:00", "2026-01-02 10:00"}, true},
+	}
+	for _, c := range cases {
+		got := series(t, c.rule, date(c.start), len(c.want)+1)
+		if !c.ends && len(got) > len(c.want) {
+			got = got[:len(c.want)]
+		}
+		if strings.Join(got, ", ") != strings.Join(c.want, ", ") {
+			t.Errorf("%s from %s: expected %v, got %v", c.rule, c.start, c.want, got)
+		}
+	}
+}
+
+func TestParseRejectsInvalidRules(t *testing.T) {
+	for _, rule := range []string{
+		"",
+		"INTERVAL=2",
+		"FREQ=HOURLY",
+		"FREQ=DAILY;INTERVAL=0",
+		"FREQ=DAILY;BYDAY=MO",
+		"FREQ=MONTHLY;BYMONTHDAY=32",
+		"FREQ=WEEKLY;BYDAY=XX",
+		"FREQ=DAILY;COUNT=3;UNTIL=20260101",
+		"FREQ=DAILY;BYSETPOS=1",
+	} {
+		if _, err := Parse(rule); err == nil {
+			t.Errorf("Expected %q to be rejected", rule)
+		}
+	}
+}
+
+func TestString(t *testing.T) {
+	r, err := Parse("freq=weekly;interval=2;byday=fr,mo;count=4")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if got := r.String(); got != "FREQ=WEEKLY;INTERVAL=2;BYDAY=FR,MO;COUNT=4" {
+		t.Errorf("Unexpected canonical form %q", got)
+	}
+}
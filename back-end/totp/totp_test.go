@@ -0,0 +1,57 @@
+package totp_test
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"go-auth-app/totp"
+)
+
+// RFC 6238 appendix B test vectors (SHA1), truncated to 6 digits
+func TestCodeAtRFCVectors(t *testing.T) {
+	secret := base32.StdEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	cases := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, c := range cases {
+		got, err := totp.CodeAt(secret, totp.Step(time.Unix(c.unix, 0)))
+		if err != nil {
+			t.Fatalf("CodeAt failed: %v", err)
+		}
+		if got != c.want {
+			t.Errorf("At %d: expected %s, got %s", c.unix, c.want, got)
+		}
+	}
+}
+
+func TestValidateAllowsSkew(t *testing.T) {
+	secret, _ := totp.GenerateSecret()
+	now := time.Now()
+
+	previous, _ := totp.CodeAt(secret, totp.Step(now)-1)
+	if _, ok := totp.Validate(secret, previous, now); !ok {
+		t.Error("Expected the code of the previous step to be accepted")
+	}
+
+	old, _ := totp.CodeAt(secret, totp.Step(now)-5)
+	if _, ok := totp.Validate(secret, old, now); ok {
+		t.Error("Expected an old code to be refused")
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri := totp.URI("GatorSplit", "alice@example.com", "JBSWY3DPEHPK3PXP")
+	if !strings.HasPrefix(uri, "otpauth://totp/GatorSplit:alice@example.com?") || !strings.Contains(uri, "secret=JBSWY3DPEHPK3PXP") {
+		t.Errorf("Unexpected URI: %s", uri)
+	}
+}